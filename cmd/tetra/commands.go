@@ -6,18 +6,26 @@ package main
 import (
 	"github.com/spf13/cobra"
 
+	"github.com/cilium/tetragon/cmd/tetra/convert"
+	"github.com/cilium/tetragon/cmd/tetra/deadletter"
 	"github.com/cilium/tetragon/cmd/tetra/getevents"
+	"github.com/cilium/tetragon/cmd/tetra/replay"
 	"github.com/cilium/tetragon/cmd/tetra/rthooks"
 	"github.com/cilium/tetragon/cmd/tetra/sensors"
 	"github.com/cilium/tetragon/cmd/tetra/stacktracetree"
 	"github.com/cilium/tetragon/cmd/tetra/status"
+	"github.com/cilium/tetragon/cmd/tetra/verify"
 	"github.com/cilium/tetragon/cmd/tetra/version"
 )
 
 // addBaseCommands adds commands that build and make sense on all platform:
-// getevents, version, sensors, stacktracetree, status, rthooks
+// getevents, replay, verify, convert, deadletter, version, sensors, stacktracetree, status, rthooks
 func addBaseCommands(rootCmd *cobra.Command) {
 	rootCmd.AddCommand(getevents.New())
+	rootCmd.AddCommand(replay.New())
+	rootCmd.AddCommand(verify.New())
+	rootCmd.AddCommand(convert.New())
+	rootCmd.AddCommand(deadletter.New())
 	rootCmd.AddCommand(version.New())
 	rootCmd.AddCommand(sensors.New())
 	rootCmd.AddCommand(stacktracetree.New())
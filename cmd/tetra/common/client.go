@@ -5,15 +5,22 @@ package common
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/credentials/local"
 
 	"github.com/cilium/tetragon/api/v1/tetragon"
+	"github.com/cilium/tetragon/pkg/grpcauth"
 )
 
 // gRGC A6 - gRPC Retry Design (a.k.a. built in backoff retry)
@@ -106,12 +113,15 @@ func NewClient(ctx context.Context, address string, timeout time.Duration) (*Cli
 	c.SignalCtx, c.signalCancel = signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
 	c.Ctx, c.timeoutCancel = context.WithTimeout(c.SignalCtx, timeout)
 
-	var err error
-	c.conn, err = grpc.NewClient(address,
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	opts, err := credentialsOptions(address)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts,
 		grpc.WithDefaultServiceConfig(RetryPolicy(Retries)),
 		grpc.WithMaxCallAttempts(Retries+1), // maxAttempt includes the first call
 	)
+	c.conn, err = grpc.NewClient(address, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create gRPC client with address %s: %w", address, err)
 	}
@@ -119,3 +129,53 @@ func NewClient(ctx context.Context, address string, timeout time.Duration) (*Cli
 
 	return c, nil
 }
+
+// credentialsOptions returns the dial options for the TLS and token flags.
+// Without TLS, the token is only sent to servers on unix sockets.
+func credentialsOptions(address string) ([]grpc.DialOption, error) {
+	var opts []grpc.DialOption
+	if TLSCAFile == "" && TLSCertFile == "" && TLSKeyFile == "" {
+		switch {
+		case TokenFile == "":
+			opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		case strings.HasPrefix(address, "unix://"):
+			opts = append(opts, grpc.WithTransportCredentials(local.NewCredentials()))
+		default:
+			return nil, fmt.Errorf("--%s requires TLS, see --%s, unless the server address is a unix socket", KeyTokenFile, KeyTLSCAFile)
+		}
+	} else {
+		if (TLSCertFile == "") != (TLSKeyFile == "") {
+			return nil, fmt.Errorf("--%s and --%s must be set together", KeyTLSCertFile, KeyTLSKeyFile)
+		}
+		conf := &tls.Config{
+			MinVersion: tls.VersionTLS12,
+			ServerName: TLSServerName,
+		}
+		if TLSCAFile != "" {
+			pem, err := os.ReadFile(TLSCAFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read CA file: %w", err)
+			}
+			conf.RootCAs = x509.NewCertPool()
+			if !conf.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificate found in CA file %q", TLSCAFile)
+			}
+		}
+		if TLSCertFile != "" {
+			cert, err := tls.LoadX509KeyPair(TLSCertFile, TLSKeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load client certificate: %w", err)
+			}
+			conf.Certificates = []tls.Certificate{cert}
+		}
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(conf)))
+	}
+	if TokenFile != "" {
+		token, err := os.ReadFile(TokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read token file: %w", err)
+		}
+		opts = append(opts, grpc.WithPerRPCCredentials(grpcauth.TokenCredentials(strings.TrimSpace(string(token)))))
+	}
+	return opts, nil
+}
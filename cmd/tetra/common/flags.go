@@ -15,15 +15,20 @@ import (
 )
 
 const (
-	KeyColor         = "color"          // string
-	KeyDebug         = "debug"          // bool
-	KeyOutput        = "output"         // string
-	KeyTty           = "tty-encode"     // string
-	KeyServerAddress = "server-address" // string
-	KeyTimeout       = "timeout"        // duration
-	KeyRetries       = "retries"        // int
-	KeyNamespace     = "namespace"      // string
-	KeyLogLevel      = "loglevel"       // string
+	KeyColor         = "color"           // string
+	KeyDebug         = "debug"           // bool
+	KeyOutput        = "output"          // string
+	KeyTty           = "tty-encode"      // string
+	KeyServerAddress = "server-address"  // string
+	KeyTimeout       = "timeout"         // duration
+	KeyRetries       = "retries"         // int
+	KeyTLSCAFile     = "tls-ca-file"     // string
+	KeyTLSCertFile   = "tls-cert-file"   // string
+	KeyTLSKeyFile    = "tls-key-file"    // string
+	KeyTLSServerName = "tls-server-name" // string
+	KeyTokenFile     = "token-file"      // string
+	KeyNamespace     = "namespace"       // string
+	KeyLogLevel      = "loglevel"        // string
 )
 
 const (
@@ -35,6 +40,14 @@ var (
 	ServerAddress string
 	Timeout       time.Duration
 	Retries       int
+
+	// TLS and token options of the connection to the server, see
+	// --server-tls-* and --server-auth-token-file of the agent.
+	TLSCAFile     string
+	TLSCertFile   string
+	TLSKeyFile    string
+	TLSServerName string
+	TokenFile     string
 )
 
 func readActiveServerAddressFromFile(fname string) (string, error) {
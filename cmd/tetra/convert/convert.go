@@ -0,0 +1,192 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package convert
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/encoding/protodelim"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"github.com/cilium/tetragon/api/v1/tetragon"
+	"github.com/cilium/tetragon/pkg/encoder"
+)
+
+const (
+	FormatJSON     = encoder.FormatJSON
+	FormatCBOR     = encoder.FormatCBOR
+	FormatProtobuf = encoder.FormatProtobuf
+	FormatCompact  = encoder.FormatCompact
+)
+
+type Opts struct {
+	In   string
+	Out  string
+	From string
+	To   string
+}
+
+var Options Opts
+
+// unmarshalOptions ignores the fields added to exported events, such as
+// labels and signature.
+var unmarshalOptions = protojson.UnmarshalOptions{DiscardUnknown: true}
+
+// reader returns the events read from r, one at a time. It returns io.EOF
+// once all events are read.
+type reader func() (*tetragon.GetEventsResponse, error)
+
+func newReader(r io.Reader, format string) (reader, error) {
+	switch format {
+	case FormatJSON:
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		line := 0
+		return func() (*tetragon.GetEventsResponse, error) {
+			for scanner.Scan() {
+				line++
+				data := bytes.TrimSpace(scanner.Bytes())
+				if len(data) == 0 {
+					continue
+				}
+				event := &tetragon.GetEventsResponse{}
+				if err := unmarshalOptions.Unmarshal(data, event); err != nil {
+					return nil, fmt.Errorf("line %d: %w", line, err)
+				}
+				return event, nil
+			}
+			if err := scanner.Err(); err != nil {
+				return nil, err
+			}
+			return nil, io.EOF
+		}, nil
+	case FormatCBOR:
+		mode, err := cbor.DecOptions{DefaultMapType: reflect.TypeOf(map[string]any(nil))}.DecMode()
+		if err != nil {
+			return nil, err
+		}
+		dec := mode.NewDecoder(r)
+		return func() (*tetragon.GetEventsResponse, error) {
+			var data map[string]any
+			if err := dec.Decode(&data); err != nil {
+				return nil, err
+			}
+			// CBOR events have the same fields as JSON ones.
+			b, err := json.Marshal(data)
+			if err != nil {
+				return nil, err
+			}
+			event := &tetragon.GetEventsResponse{}
+			if err := unmarshalOptions.Unmarshal(b, event); err != nil {
+				return nil, err
+			}
+			return event, nil
+		}, nil
+	case FormatProtobuf:
+		br := bufio.NewReader(r)
+		return func() (*tetragon.GetEventsResponse, error) {
+			event := &tetragon.GetEventsResponse{}
+			if err := protodelim.UnmarshalFrom(br, event); err != nil {
+				return nil, err
+			}
+			return event, nil
+		}, nil
+	}
+	return nil, fmt.Errorf("invalid input format %q: must be json, cbor or protobuf", format)
+}
+
+func newEncoder(w io.Writer, format string) (encoder.EventEncoder, error) {
+	if !encoder.IsFormat(format) {
+		return nil, fmt.Errorf("invalid output format %q: must be one of %s", format, strings.Join(encoder.Formats(), ", "))
+	}
+	return encoder.NewEncoder(format, w, encoder.Options{})
+}
+
+// convert reads the events of r in the from format and writes them to w in
+// the to format. It returns the number of events converted.
+func convert(r io.Reader, w io.Writer, from, to string) (int, error) {
+	next, err := newReader(r, from)
+	if err != nil {
+		return 0, err
+	}
+	enc, err := newEncoder(w, to)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for {
+		event, err := next()
+		if errors.Is(err, io.EOF) {
+			return n, nil
+		}
+		if err != nil {
+			return n, fmt.Errorf("failed to read event %d: %w", n+1, err)
+		}
+		if err := enc.Encode(event); err != nil {
+			return n, fmt.Errorf("failed to write event %d: %w", n+1, err)
+		}
+		n++
+	}
+}
+
+func New() *cobra.Command {
+	cmd := cobra.Command{
+		Use:   "convert",
+		Short: "Convert exported events between formats",
+		Long: `This command converts events exported to a file from one format to another,
+without a running agent. Examples:
+
+  # Convert a CBOR export to JSON
+  tetra convert --in events.cbor --from cbor --to json
+
+  # Print JSON events in the compact format of getevents
+  tetra convert --in events.json --to compact
+
+  # Convert JSON events to size-delimited protobuf messages
+  tetra convert --in events.json --to protobuf --out events.pb`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			var err error
+			in := os.Stdin
+			if Options.In != "-" {
+				if in, err = os.Open(Options.In); err != nil {
+					return err
+				}
+				defer in.Close()
+			}
+			out := cmd.OutOrStdout()
+			if Options.Out != "-" {
+				f, err := os.Create(Options.Out)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				out = f
+			}
+			w := bufio.NewWriter(out)
+			_, err = convert(in, w, Options.From, Options.To)
+			if flushErr := w.Flush(); err == nil {
+				err = flushErr
+			}
+			return err
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&Options.In, "in", "-", "File with the events to convert, - for stdin")
+	flags.StringVar(&Options.Out, "out", "-", "File to write the converted events to, - for stdout")
+	flags.StringVar(&Options.From, "from", FormatJSON, "Format of the input: json, cbor or protobuf")
+	flags.StringVar(&Options.To, "to", FormatJSON, "Format of the output: json, cbor, protobuf, compact or any other registered format")
+	return &cmd
+}
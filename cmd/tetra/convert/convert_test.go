@@ -0,0 +1,60 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package convert
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_convert(t *testing.T) {
+	input, err := os.ReadFile("testdata/events.json")
+	require.NoError(t, err)
+
+	for _, format := range []string{FormatJSON, FormatCBOR, FormatProtobuf} {
+		t.Run(format, func(t *testing.T) {
+			var encoded bytes.Buffer
+			n, err := convert(bytes.NewReader(input), &encoded, FormatJSON, format)
+			require.NoError(t, err)
+			assert.Equal(t, 2, n)
+
+			var out bytes.Buffer
+			n, err = convert(&encoded, &out, format, FormatJSON)
+			require.NoError(t, err)
+			assert.Equal(t, 2, n)
+			// Labels are not part of events and are dropped.
+			lines := strings.Split(strings.TrimSpace(string(input)), "\n")
+			outLines := strings.Split(strings.TrimSpace(out.String()), "\n")
+			require.Len(t, outLines, 2)
+			assert.JSONEq(t, lines[0], outLines[0])
+			assert.JSONEq(t, strings.Replace(lines[1], `,"labels":{"cluster":"c1"}`, "", 1), outLines[1])
+		})
+	}
+}
+
+func Test_convertCompact(t *testing.T) {
+	input, err := os.ReadFile("testdata/events.json")
+	require.NoError(t, err)
+	expected, err := os.ReadFile("testdata/events.compact")
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	_, err = convert(bytes.NewReader(input), &out, FormatJSON, FormatCompact)
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), out.String())
+}
+
+func Test_convertErrors(t *testing.T) {
+	_, err := convert(strings.NewReader(""), &bytes.Buffer{}, "cef", FormatJSON)
+	require.ErrorContains(t, err, "invalid input format")
+	_, err = convert(strings.NewReader(""), &bytes.Buffer{}, FormatJSON, "cef")
+	require.ErrorContains(t, err, "invalid output format")
+	_, err = convert(strings.NewReader("{}\nnot json\n"), &bytes.Buffer{}, FormatJSON, FormatJSON)
+	require.ErrorContains(t, err, "failed to read event 2: line 2")
+}
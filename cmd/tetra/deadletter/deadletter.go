@@ -0,0 +1,192 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package deadletter
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+type ResendOpts struct {
+	File      string
+	URL       string
+	Headers   map[string]string
+	BatchSize int
+	Timeout   time.Duration
+}
+
+var resendOptions ResendOpts
+
+// record is a line of the dead-letter file. Only the event is sent again,
+// the whole line is kept if it cannot be.
+type record struct {
+	line  []byte
+	event json.RawMessage
+}
+
+// readRecords reads the records of a dead-letter file.
+func readRecords(r io.Reader) ([]record, error) {
+	var records []record
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var rec struct {
+			Event json.RawMessage `json:"event"`
+		}
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return nil, fmt.Errorf("failed to parse record %d: %w", len(records)+1, err)
+		}
+		records = append(records, record{line: bytes.Clone(line), event: rec.Event})
+	}
+	return records, scanner.Err()
+}
+
+// post sends events to url as newline-delimited JSON, like the webhook
+// exporter.
+func post(ctx context.Context, client *http.Client, url string, headers map[string]string, events []record) error {
+	var body bytes.Buffer
+	for _, rec := range events {
+		body.Write(rec.event)
+		body.WriteByte('\n')
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return nil
+}
+
+// resend sends the events of records in batches, and returns the records of
+// the batches that failed with the last error.
+func resend(ctx context.Context, records []record, opts ResendOpts) ([]record, error) {
+	client := &http.Client{Timeout: opts.Timeout}
+	var failed []record
+	var lastErr error
+	for start := 0; start < len(records); start += opts.BatchSize {
+		batch := records[start:min(start+opts.BatchSize, len(records))]
+		if err := post(ctx, client, opts.URL, opts.Headers, batch); err != nil {
+			failed = append(failed, batch...)
+			lastErr = err
+		}
+	}
+	return failed, lastErr
+}
+
+// resendFile sends the events of the dead-letter file again. The file is
+// first moved aside, so that the agent writes new records to a new file,
+// and the records that still cannot be sent are appended back to it. A file
+// moved aside by an interrupted run is sent first.
+func resendFile(ctx context.Context, opts ResendOpts) (sent, failed int, err error) {
+	pending := opts.File + ".resending"
+	if _, err := os.Stat(pending); errors.Is(err, os.ErrNotExist) {
+		if err := os.Rename(opts.File, pending); err != nil {
+			return 0, 0, err
+		}
+	}
+	data, err := os.ReadFile(pending)
+	if err != nil {
+		return 0, 0, err
+	}
+	records, err := readRecords(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, err
+	}
+	failedRecords, sendErr := resend(ctx, records, opts)
+	if len(failedRecords) > 0 {
+		f, err := os.OpenFile(opts.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+		if err != nil {
+			return 0, 0, err
+		}
+		var buf bytes.Buffer
+		for _, rec := range failedRecords {
+			buf.Write(rec.line)
+			buf.WriteByte('\n')
+		}
+		_, err = f.Write(buf.Bytes())
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	if err := os.Remove(pending); err != nil {
+		return 0, 0, err
+	}
+	return len(records) - len(failedRecords), len(failedRecords), sendErr
+}
+
+func newResendCmd() *cobra.Command {
+	cmd := cobra.Command{
+		Use:   "resend",
+		Short: "Send the events of a dead-letter file again",
+		Long: `This command sends the events of a dead-letter file, as written by the agent with
+--export-dead-letter-file, to a webhook endpoint as newline-delimited JSON.
+Events that are sent are removed from the file, the others are kept.
+
+  tetra deadletter resend --file /var/log/tetragon/dead-letter.json --url https://collector/events`,
+		Args: cobra.NoArgs,
+		PreRunE: func(_ *cobra.Command, _ []string) error {
+			if resendOptions.File == "" || resendOptions.URL == "" {
+				return errors.New("--file and --url must be set")
+			}
+			if resendOptions.BatchSize <= 0 {
+				return errors.New("--batch-size must be positive")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			sent, failed, err := resendFile(cmd.Context(), resendOptions)
+			fmt.Fprintf(cmd.OutOrStdout(), "Sent %d events, %d kept in %s\n", sent, failed, resendOptions.File)
+			if err != nil {
+				return fmt.Errorf("failed to send %d events: %w", failed, err)
+			}
+			return nil
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&resendOptions.File, "file", "", "Dead-letter file")
+	flags.StringVar(&resendOptions.URL, "url", "", "Endpoint events are POSTed to")
+	flags.StringToStringVar(&resendOptions.Headers, "header", nil, "Headers added to every request, such as Authorization=Bearer ...")
+	flags.IntVar(&resendOptions.BatchSize, "batch-size", 100, "Maximum number of events in a single request")
+	flags.DurationVar(&resendOptions.Timeout, "timeout", 10*time.Second, "Timeout of a single request")
+	return &cmd
+}
+
+func New() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "deadletter",
+		Short: "Manage the events exporters failed to send",
+	}
+	cmd.AddCommand(newResendCmd())
+	return cmd
+}
@@ -0,0 +1,53 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package deadletter
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResendFile(t *testing.T) {
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		// Reject the batches with the third event.
+		if strings.Contains(string(data), `"n":3`) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		bodies = append(bodies, string(data))
+	}))
+	defer srv.Close()
+
+	file := filepath.Join(t.TempDir(), "dead-letter.json")
+	records := `{"time":"2024-01-01T00:00:00Z","exporter":"webhook","error":"timeout","event":{"n":1}}
+{"time":"2024-01-01T00:00:00Z","exporter":"webhook","error":"timeout","event":{"n":2}}
+{"time":"2024-01-01T00:00:00Z","exporter":"webhook","error":"timeout","event":{"n":3}}
+`
+	require.NoError(t, os.WriteFile(file, []byte(records), 0o600))
+
+	opts := ResendOpts{File: file, URL: srv.URL, BatchSize: 2, Timeout: time.Second}
+	sent, failed, err := resendFile(context.Background(), opts)
+	require.ErrorContains(t, err, "503")
+	assert.Equal(t, 2, sent)
+	assert.Equal(t, 1, failed)
+	assert.Equal(t, []string{"{\"n\":1}\n{\"n\":2}\n"}, bodies)
+
+	// The record that could not be sent is kept.
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Equal(t, strings.SplitAfter(records, "\n")[2], string(data))
+	assert.NoFileExists(t, file+".resending")
+}
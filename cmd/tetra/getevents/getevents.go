@@ -59,6 +59,16 @@ var GetEncoder = func(w io.Writer, colorMode encoder.ColorMode, timestamps bool,
 	return encoder.NewProtojsonEncoder(w)
 }
 
+// newEncoder returns the encoder of the output format. The json and compact
+// formats use GetEncoder, and the other formats registered with
+// encoder.RegisterEncoderAtInit are created by their factory.
+func newEncoder(w io.Writer) (encoder.EventEncoder, error) {
+	if Options.TTYEncode != "" || Options.Output == encoder.FormatJSON || Options.Output == encoder.FormatCompact {
+		return GetEncoder(w, encoder.ColorMode(Options.Color), Options.Timestamps, Options.Output == encoder.FormatCompact, Options.TTYEncode, Options.StackTraces, Options.ImaHash), nil
+	}
+	return encoder.NewEncoder(Options.Output, w, encoder.Options{})
+}
+
 // GetFilter returns a filter for an event stream based on configuration options.
 var GetFilter = func() *tetragon.Filter {
 	if Options.Host {
@@ -135,7 +145,10 @@ func getEvents(ctx context.Context, client tetragon.FineGuidanceSensorsClient) e
 	if err != nil {
 		return fmt.Errorf("failed to call GetEvents: %w", err)
 	}
-	eventEncoder := GetEncoder(os.Stdout, encoder.ColorMode(Options.Color), Options.Timestamps, Options.Output == "compact", Options.TTYEncode, Options.StackTraces, Options.ImaHash)
+	eventEncoder, err := newEncoder(os.Stdout)
+	if err != nil {
+		return err
+	}
 	for {
 		res, err := stream.Recv()
 		if err != nil {
@@ -169,7 +182,7 @@ redirection of events to the stdin. Examples:
   # Include only process and parent.pod fields
   tetra getevents -f process,parent.pod`,
 		PreRunE: func(_ *cobra.Command, _ []string) error {
-			if Options.Output != "json" && Options.Output != "compact" {
+			if !encoder.IsFormat(Options.Output) {
 				return fmt.Errorf("invalid value for %q flag: %s", common.KeyOutput, Options.Output)
 			}
 			if Options.Color != "auto" && Options.Color != "always" && Options.Color != "never" {
@@ -230,7 +243,7 @@ redirection of events to the stdin. Examples:
 	}
 
 	flags := cmd.Flags()
-	flags.StringVarP(&Options.Output, common.KeyOutput, "o", "json", "Output format. json or compact")
+	flags.StringVarP(&Options.Output, common.KeyOutput, "o", "json", "Output format. json, compact or any other registered format")
 	flags.StringVar(&Options.Color, "color", "auto", "Colorize compact output. auto, always, or never")
 	flags.StringSliceVarP(&Options.IncludeFields, "include-fields", "f", nil, "Include only fields in events")
 	flags.StringSliceVarP(&Options.EventTypes, "event-types", "e", nil, "Include only events of given types")
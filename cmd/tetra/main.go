@@ -47,5 +47,10 @@ func New() *cobra.Command {
 	flags.StringVar(&common.ServerAddress, common.KeyServerAddress, "", "gRPC server address")
 	flags.DurationVar(&common.Timeout, common.KeyTimeout, 30*time.Second, "Connection timeout")
 	flags.IntVar(&common.Retries, common.KeyRetries, 1, "Connection retries with exponential backoff")
+	flags.StringVar(&common.TLSCAFile, common.KeyTLSCAFile, "", "Connect with TLS, verifying the server certificate with the CA certificates of this file")
+	flags.StringVar(&common.TLSCertFile, common.KeyTLSCertFile, "", "Client certificate file for mutual TLS")
+	flags.StringVar(&common.TLSKeyFile, common.KeyTLSKeyFile, "", "Client key file for mutual TLS")
+	flags.StringVar(&common.TLSServerName, common.KeyTLSServerName, "", "Server name to verify the server certificate against, instead of the host of the server address")
+	flags.StringVar(&common.TokenFile, common.KeyTokenFile, "", "File holding the token to authenticate to the server")
 	return rootCmd
 }
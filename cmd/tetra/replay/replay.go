@@ -0,0 +1,182 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/time/rate"
+)
+
+type Opts struct {
+	File              string
+	UDP               string
+	TCP               string
+	Rate              string
+	RewriteTimestamps bool
+	Loop              bool
+}
+
+var Options Opts
+
+// parseRate parses a rate such as "1000/s", "500/m" or "10000/h". An empty
+// rate or a count of 0 means no limit.
+func parseRate(s string) (rate.Limit, error) {
+	if s == "" {
+		return rate.Inf, nil
+	}
+	count, unit, found := strings.Cut(s, "/")
+	n, err := strconv.ParseUint(count, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid rate %q: %w", s, err)
+	}
+	if n == 0 {
+		return rate.Inf, nil
+	}
+	per := time.Second
+	if found {
+		switch unit {
+		case "s":
+		case "m":
+			per = time.Minute
+		case "h":
+			per = time.Hour
+		default:
+			return 0, fmt.Errorf("invalid rate %q: unit must be s, m or h", s)
+		}
+	}
+	return rate.Limit(float64(n) / per.Seconds()), nil
+}
+
+// rewriteTimestamp sets the time of the JSON event in line to now. Other
+// fields are kept as they are, including unknown ones.
+func rewriteTimestamp(line []byte, now time.Time) ([]byte, error) {
+	var ev map[string]json.RawMessage
+	if err := json.Unmarshal(line, &ev); err != nil {
+		return nil, err
+	}
+	ts, err := json.Marshal(now.UTC().Format(time.RFC3339Nano))
+	if err != nil {
+		return nil, err
+	}
+	ev["time"] = ts
+	return json.Marshal(ev)
+}
+
+// replay sends the events of r to w, one write per event, at most limit
+// events per second. It returns the number of events sent.
+func replay(ctx context.Context, r io.Reader, w io.Writer, limit rate.Limit, rewrite bool) (int, error) {
+	limiter := rate.NewLimiter(limit, 1)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	sent := 0
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if rewrite {
+			var err error
+			if line, err = rewriteTimestamp(line, time.Now()); err != nil {
+				return sent, fmt.Errorf("failed to parse event %d: %w", sent+1, err)
+			}
+		}
+		if err := limiter.Wait(ctx); err != nil {
+			if errors.Is(err, context.Canceled) {
+				return sent, nil
+			}
+			return sent, err
+		}
+		if _, err := w.Write(append(line, '\n')); err != nil {
+			return sent, fmt.Errorf("failed to send event %d: %w", sent+1, err)
+		}
+		sent++
+	}
+	return sent, scanner.Err()
+}
+
+func New() *cobra.Command {
+	cmd := cobra.Command{
+		Use:   "replay",
+		Short: "Send captured events to a collector",
+		Long: `This command sends the JSON events of a file, as written by the JSON exporter, to
+a collector over UDP or TCP. Each event is sent in its own UDP datagram or as a
+line of the TCP stream. Examples:
+
+  # Send events over UDP at 1000 events per second
+  tetra replay --file events.json --udp 10.0.0.5:514 --rate 1000/s
+
+  # Send events over TCP as fast as possible, with the current time
+  tetra replay --file events.json --tcp 10.0.0.5:514 --rewrite-timestamps`,
+		PreRunE: func(_ *cobra.Command, _ []string) error {
+			if (Options.UDP == "") == (Options.TCP == "") {
+				return errors.New("exactly one of --udp and --tcp must be set")
+			}
+			if Options.Loop && Options.File == "-" {
+				return errors.New("--loop cannot be used with stdin")
+			}
+			_, err := parseRate(Options.Rate)
+			return err
+		},
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			limit, _ := parseRate(Options.Rate)
+			network, address := "udp", Options.UDP
+			if Options.TCP != "" {
+				network, address = "tcp", Options.TCP
+			}
+			conn, err := net.Dial(network, address)
+			if err != nil {
+				return err
+			}
+			defer conn.Close()
+
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer cancel()
+			total := 0
+			for {
+				n, err := replayFile(ctx, conn, limit)
+				total += n
+				if err != nil || !Options.Loop || ctx.Err() != nil {
+					fmt.Fprintf(cmd.ErrOrStderr(), "Sent %d events to %s\n", total, address)
+					return err
+				}
+			}
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&Options.File, "file", "-", "File with one JSON event per line, - for stdin")
+	flags.StringVar(&Options.UDP, "udp", "", "Address to send events to over UDP")
+	flags.StringVar(&Options.TCP, "tcp", "", "Address to send events to over TCP")
+	flags.StringVar(&Options.Rate, "rate", "", "Maximum rate of events, such as 1000/s, 500/m or 10000/h. No limit by default")
+	flags.BoolVar(&Options.RewriteTimestamps, "rewrite-timestamps", false, "Set the time of events to the time they are sent")
+	flags.BoolVar(&Options.Loop, "loop", false, "Send the file again once all its events are sent, until interrupted")
+	return &cmd
+}
+
+func replayFile(ctx context.Context, w io.Writer, limit rate.Limit) (int, error) {
+	if Options.File == "-" {
+		return replay(ctx, os.Stdin, w, limit, Options.RewriteTimestamps)
+	}
+	f, err := os.Open(Options.File)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return replay(ctx, f, w, limit, Options.RewriteTimestamps)
+}
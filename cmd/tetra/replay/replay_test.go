@@ -0,0 +1,77 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package replay
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+func Test_parseRate(t *testing.T) {
+	tests := []struct {
+		in   string
+		want rate.Limit
+	}{
+		{"", rate.Inf},
+		{"0/s", rate.Inf},
+		{"1000/s", 1000},
+		{"1000", 1000},
+		{"120/m", 2},
+		{"3600/h", 1},
+	}
+	for _, tt := range tests {
+		got, err := parseRate(tt.in)
+		require.NoError(t, err, tt.in)
+		if tt.want == rate.Inf {
+			assert.Equal(t, rate.Inf, got, tt.in)
+		} else {
+			assert.InEpsilon(t, float64(tt.want), float64(got), 1e-9, tt.in)
+		}
+	}
+	for _, in := range []string{"fast", "10/d", "-1/s"} {
+		_, err := parseRate(in)
+		require.Error(t, err, in)
+	}
+}
+
+func Test_replay(t *testing.T) {
+	input := `{"process_exec":{"process":{"binary":"/bin/a"}},"time":"2024-01-01T00:00:00Z"}
+
+{"process_exit":{"process":{"binary":"/bin/a"}},"time":"2024-01-01T00:00:01Z","labels":{"env":"prod"}}
+`
+	var out bytes.Buffer
+	n, err := replay(context.Background(), strings.NewReader(input), &out, rate.Inf, false)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, strings.Replace(input, "\n\n", "\n", 1), out.String())
+
+	out.Reset()
+	n, err = replay(context.Background(), strings.NewReader(input), &out, rate.Inf, true)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 2)
+	assert.NotContains(t, lines[0], "2024-01-01")
+	assert.Contains(t, lines[1], `"labels":{"env":"prod"}`, "unknown fields are kept")
+
+	_, err = replay(context.Background(), strings.NewReader("not json\n"), &out, rate.Inf, true)
+	require.Error(t, err)
+}
+
+func Test_replayRate(t *testing.T) {
+	input := strings.Repeat("{}\n", 5)
+	var out bytes.Buffer
+	start := time.Now()
+	n, err := replay(context.Background(), strings.NewReader(input), &out, 100, false)
+	require.NoError(t, err)
+	assert.Equal(t, 5, n)
+	assert.GreaterOrEqual(t, time.Since(start), 35*time.Millisecond)
+}
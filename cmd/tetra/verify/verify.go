@@ -0,0 +1,100 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package verify
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/cilium/tetragon/pkg/signing"
+)
+
+type Opts struct {
+	File      string
+	Key       string
+	Algorithm string
+}
+
+var Options Opts
+
+// verify checks the signature of every event read from r. It reports the
+// events with an invalid signature to w and returns the number of valid and
+// invalid events.
+func verify(r io.Reader, w io.Writer, v *signing.Verifier) (int, int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	valid, invalid := 0, 0
+	for line := 1; scanner.Scan(); line++ {
+		event := bytes.TrimSpace(scanner.Bytes())
+		if len(event) == 0 {
+			continue
+		}
+		if keyID, err := v.Verify(event); err != nil {
+			invalid++
+			if keyID != "" {
+				fmt.Fprintf(w, "line %d: key %q: %s\n", line, keyID, err)
+			} else {
+				fmt.Fprintf(w, "line %d: %s\n", line, err)
+			}
+			continue
+		}
+		valid++
+	}
+	return valid, invalid, scanner.Err()
+}
+
+func New() *cobra.Command {
+	cmd := cobra.Command{
+		Use:   "verify",
+		Short: "Verify the signature of exported events",
+		Long: `This command checks the signature of JSON events exported with
+--export-signing-key. It fails if any event is not signed or has an invalid
+signature. Examples:
+
+  # Verify events signed with an ed25519 key
+  openssl pkey -in signing.key -pubout -out signing.pub
+  tetra verify --key signing.pub --file events.json
+
+  # Verify events signed with an HMAC secret
+  tetra verify --algorithm hmac-sha256 --key secret --file events.json`,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			key, err := os.ReadFile(Options.Key)
+			if err != nil {
+				return fmt.Errorf("failed to read key: %w", err)
+			}
+			v, err := signing.NewVerifier(Options.Algorithm, bytes.TrimRight(key, "\n"))
+			if err != nil {
+				return err
+			}
+			in := os.Stdin
+			if Options.File != "-" {
+				if in, err = os.Open(Options.File); err != nil {
+					return err
+				}
+				defer in.Close()
+			}
+			valid, invalid, err := verify(in, cmd.OutOrStdout(), v)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "%d valid, %d invalid\n", valid, invalid)
+			if invalid > 0 {
+				return fmt.Errorf("%d events failed verification", invalid)
+			}
+			return nil
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&Options.File, "file", "-", "File with one JSON event per line, - for stdin")
+	flags.StringVar(&Options.Key, "key", "", "Path of the public key (ed25519) or secret (hmac-sha256)")
+	flags.StringVar(&Options.Algorithm, "algorithm", signing.AlgEd25519, "Signing algorithm: ed25519 or hmac-sha256")
+	cmd.MarkFlagRequired("key")
+	return &cmd
+}
@@ -0,0 +1,32 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package verify
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cilium/tetragon/pkg/signing"
+)
+
+func Test_verify(t *testing.T) {
+	signer, err := signing.NewSigner(signing.AlgHMACSHA256, "k1", []byte("secret"))
+	require.NoError(t, err)
+	signed, err := signer.AppendSigned(nil, []byte(`{"node_name":"n1"}`))
+	require.NoError(t, err)
+	input := string(signed) + "\n\n" + `{"node_name":"n2"}` + "\n" + strings.Replace(string(signed), "n1", "n3", 1) + "\n"
+
+	verifier, err := signing.NewVerifier(signing.AlgHMACSHA256, []byte("secret"))
+	require.NoError(t, err)
+	var out bytes.Buffer
+	valid, invalid, err := verify(strings.NewReader(input), &out, verifier)
+	require.NoError(t, err)
+	assert.Equal(t, 1, valid)
+	assert.Equal(t, 2, invalid)
+	assert.Equal(t, "line 3: event is not signed\nline 4: key \"k1\": invalid signature\n", out.String())
+}
@@ -0,0 +1,100 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/spf13/viper"
+
+	"github.com/cilium/tetragon/api/v1/tetragon"
+	"github.com/cilium/tetragon/pkg/exporter"
+	"github.com/cilium/tetragon/pkg/fieldfilters"
+	"github.com/cilium/tetragon/pkg/filters"
+	"github.com/cilium/tetragon/pkg/grpcauth"
+	"github.com/cilium/tetragon/pkg/option"
+	"github.com/cilium/tetragon/pkg/tracingpolicy"
+)
+
+// errCheckConfigFailed is returned by checkConfig when at least one check
+// failed.
+var errCheckConfigFailed = errors.New("configuration check failed")
+
+// checkConfig parses the configuration, loads the TLS material of the gRPC
+// server, and checks export destinations, filters and the tracing policy
+// passed with --tracing-policy, without loading any BPF program. Unlike
+// reloads, it resolves the hosts of the export destinations and loads their
+// TLS material, see exporter.Check. It writes one line per check to w.
+func checkConfig(w io.Writer) error {
+	failed := false
+	report := func(name string, err error) bool {
+		if err != nil {
+			fmt.Fprintf(w, "FAIL  %s: %v\n", name, err)
+			failed = true
+			return false
+		}
+		fmt.Fprintf(w, "OK    %s\n", name)
+		return true
+	}
+
+	if !report("flags", option.ReadAndSetFlags()) {
+		return errCheckConfigFailed
+	}
+	report("options", option.Validate())
+	// The certificates and token are loaded, as the gRPC server does when
+	// it starts.
+	_, err := grpcauth.New(serverAuthOptions())
+	report("gRPC server authentication", err)
+
+	redactionFilters, err := fieldfilters.ParseRedactionFilterList(viper.GetString(option.KeyRedactionFilters))
+	if err == nil {
+		err = redactionFilters.SetMode(viper.GetString(option.KeyRedactionMode), viper.GetString(option.KeyRedactionHashKey))
+	}
+	report("redaction filters", err)
+
+	reqs, err := exporterRequests(viper.GetViper())
+	if report("export filters", err) {
+		for i, req := range reqs {
+			conf := &option.Config.Exporters[i]
+			name := fmt.Sprintf("exporter %q (%s)", conf.Name, conf.Type)
+			err := exporter.Check(conf)
+			if err == nil {
+				err = buildExportFilters(req)
+			}
+			report(name, err)
+		}
+	}
+	if len(option.Config.Exporters) == 0 {
+		fmt.Fprintln(w, "NOTE  no exporter is configured, events are only available through the gRPC API")
+	}
+
+	if option.Config.TracingPolicy != "" {
+		_, err := tracingpolicy.FromFile(option.Config.TracingPolicy)
+		report("tracing policy "+option.Config.TracingPolicy, err)
+	}
+
+	if failed {
+		return errCheckConfigFailed
+	}
+	return nil
+}
+
+// buildExportFilters compiles the filters of req, as the exporter would when
+// it starts.
+func buildExportFilters(req *tetragon.GetEventsRequest) error {
+	ctx := context.Background()
+	if _, err := filters.BuildFilterList(ctx, req.AllowList, filters.Filters); err != nil {
+		return fmt.Errorf("invalid allow list: %w", err)
+	}
+	if _, err := filters.BuildFilterList(ctx, req.DenyList, filters.Filters); err != nil {
+		return fmt.Errorf("invalid deny list: %w", err)
+	}
+	if _, err := fieldfilters.FieldFiltersFromGetEventsRequest(req); err != nil {
+		return fmt.Errorf("invalid field filters: %w", err)
+	}
+	return nil
+}
@@ -4,12 +4,14 @@
 package main
 
 import (
+	"fmt"
 	"strings"
 
 	"github.com/cilium/tetragon/pkg/logger"
 	"github.com/cilium/tetragon/pkg/logger/logfields"
 	"github.com/cilium/tetragon/pkg/option"
 
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
@@ -22,41 +24,71 @@ var (
 	}
 )
 
+// configFlags are the command line flags of the agent. They are bound to the
+// viper the configuration is read into when the exporters are reloaded.
+var configFlags *pflag.FlagSet
+
+// readConfigSettings reads the configuration files into the global viper,
+// and exits if --config-dir cannot be read.
 func readConfigSettings(defaultConfDir string, defaultConfDropIn string, dropInsDir []string) {
-	viper.SetEnvPrefix("tetragon")
+	if err := readConfigSettingsTo(viper.GetViper(), defaultConfDir, defaultConfDropIn, dropInsDir); err != nil {
+		logger.Fatal(log, "Failed to read config from directory", option.KeyConfigDir, viper.GetString(option.KeyConfigDir), logfields.Error, err)
+	}
+}
+
+// readConfigSettingsTo reads the environment and the configuration files
+// into v. It returns an error if --config-dir cannot be read.
+func readConfigSettingsTo(v *viper.Viper, defaultConfDir string, defaultConfDropIn string, dropInsDir []string) error {
+	v.SetEnvPrefix("tetragon")
 	replacer := strings.NewReplacer("-", "_")
-	viper.SetEnvKeyReplacer(replacer)
-	viper.AutomaticEnv()
+	v.SetEnvKeyReplacer(replacer)
+	v.AutomaticEnv()
 
 	// First set default conf file and format
-	viper.SetConfigName("tetragon")
-	viper.SetConfigType("yaml")
+	v.SetConfigName("tetragon")
+	v.SetConfigType("yaml")
 
 	// Read default drop-ins directories
 	for _, dir := range dropInsDir {
-		option.ReadConfigDir(dir)
+		option.ReadConfigDirTo(v, dir)
 	}
 
 	// Look into cwd first, this is needed for quick development only
-	option.ReadConfigFile(".", "tetragon.yaml")
+	option.ReadConfigFileTo(v, ".", "tetragon.yaml")
 
 	// Look for /etc/tetragon/tetragon.yaml
-	option.ReadConfigFile(defaultConfDir, "tetragon.yaml")
+	option.ReadConfigFileTo(v, defaultConfDir, "tetragon.yaml")
 
 	// Look into default /etc/tetragon/tetragon.conf.d/ now
-	option.ReadConfigDir(defaultConfDropIn)
+	option.ReadConfigDirTo(v, defaultConfDropIn)
 
 	// Read now the passed key --config-dir
-	if viper.IsSet(option.KeyConfigDir) {
-		configDir := viper.GetString(option.KeyConfigDir)
+	if v.IsSet(option.KeyConfigDir) {
+		configDir := v.GetString(option.KeyConfigDir)
 		// viper.IsSet could return true on an empty string reset
 		if configDir != "" {
-			err := option.ReadConfigDir(configDir)
-			if err != nil {
-				logger.Fatal(log, "Failed to read config from directory", option.KeyConfigDir, configDir, logfields.Error, err)
-			} else {
-				log.Info("Loaded config from directory", option.KeyConfigDir, configDir)
+			if err := option.ReadConfigDirTo(v, configDir); err != nil {
+				return err
 			}
+			log.Info("Loaded config from directory", option.KeyConfigDir, configDir)
 		}
 	}
+	return nil
+}
+
+// newConfigViper returns a new viper holding the command line flags, the
+// environment and the configuration files. Unlike the global viper, which
+// merges the files read at startup, it does not hold the options removed
+// from the files since.
+func newConfigViper(flags *pflag.FlagSet, defaultConfDir string, defaultConfDropIn string, dropInsDir []string) (*viper.Viper, error) {
+	v := viper.New()
+	if flags != nil {
+		if err := v.BindPFlags(flags); err != nil {
+			return nil, err
+		}
+	}
+	if err := readConfigSettingsTo(v, defaultConfDir, defaultConfDropIn, dropInsDir); err != nil {
+		return nil, fmt.Errorf("failed to read config from directory: %w", err)
+	}
+	return v, nil
 }
@@ -0,0 +1,380 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/cilium/tetragon/api/v1/tetragon"
+	"github.com/cilium/tetragon/pkg/control"
+	"github.com/cilium/tetragon/pkg/exporter"
+	"github.com/cilium/tetragon/pkg/fieldfilters"
+	"github.com/cilium/tetragon/pkg/filters"
+	"github.com/cilium/tetragon/pkg/logger/logfields"
+	"github.com/cilium/tetragon/pkg/option"
+	"github.com/cilium/tetragon/pkg/ratelimit"
+	"github.com/cilium/tetragon/pkg/server"
+)
+
+// exporterSet runs the exporters listed in option.Config.Exporters, and
+// replaces them when the export configuration is reloaded.
+type exporterSet struct {
+	server *server.Server
+	// newViper returns a new viper holding the current configuration, to
+	// reload it.
+	newViper func() (*viper.Viper, error)
+	// viper holds the configuration the running exporters were created
+	// from, nil meaning the global viper.
+	viper *viper.Viper
+	// mu serializes reloads and replays, which come from signals and from
+	// the control socket.
+	mu        sync.Mutex
+	cancel    context.CancelFunc
+	exporters []*exporter.Exporter
+}
+
+// exporterRequests returns the GetEventsRequest of every configured
+// exporter, in the order of option.Config.Exporters, with the global export
+// filters of v.
+func exporterRequests(v *viper.Viper) ([]*tetragon.GetEventsRequest, error) {
+	if len(option.Config.Exporters) == 0 {
+		return nil, nil
+	}
+	allowList, denyList, err := getExportFilters(v)
+	if err != nil {
+		return nil, err
+	}
+	fieldFilters, err := getFieldFilters(v)
+	if err != nil {
+		return nil, err
+	}
+	var aggregationOptions *tetragon.AggregationOptions
+	if option.Config.EnableExportAggregation {
+		aggregationOptions = &tetragon.AggregationOptions{
+			WindowSize:        durationpb.New(option.Config.ExportAggregationWindowSize),
+			ChannelBufferSize: option.Config.ExportAggregationBufferSize,
+		}
+	}
+
+	reqs := make([]*tetragon.GetEventsRequest, 0, len(option.Config.Exporters))
+	for i := range option.Config.Exporters {
+		conf := &option.Config.Exporters[i]
+		req := &tetragon.GetEventsRequest{AllowList: allowList, DenyList: denyList, AggregationOptions: aggregationOptions, FieldFilters: fieldFilters}
+		if err := setExporterFilters(v, req, conf); err != nil {
+			return nil, fmt.Errorf("exporter %q: %w", conf.Name, err)
+		}
+		reqs = append(reqs, req)
+	}
+	return reqs, nil
+}
+
+// setExporterFilters overrides the global export filters of req with the
+// ones set in the exporter configuration, and applies the allowed and
+// denied event types.
+func setExporterFilters(v *viper.Viper, req *tetragon.GetEventsRequest, conf *option.ExporterConfig) error {
+	var err error
+	enablePidSetFilter := v.GetBool(option.KeyEnablePidSetFilter)
+	if conf.AllowList != "" {
+		if req.AllowList, err = filters.ParseFilterList(conf.AllowList, enablePidSetFilter); err != nil {
+			return fmt.Errorf("failed to parse allowList: %w", err)
+		}
+	}
+	if conf.DenyList != "" {
+		if req.DenyList, err = filters.ParseFilterList(conf.DenyList, enablePidSetFilter); err != nil {
+			return fmt.Errorf("failed to parse denyList: %w", err)
+		}
+	}
+	if conf.FieldFilters != "" {
+		if req.FieldFilters, err = fieldfilters.ParseFieldFilterList(conf.FieldFilters); err != nil {
+			return fmt.Errorf("failed to parse fieldFilters: %w", err)
+		}
+	}
+	fields := option.Config.ExportFields
+	if len(conf.Fields) > 0 {
+		fields = conf.Fields
+	}
+	if filter := fieldfilters.IncludeFieldsFilter(fields); filter != nil {
+		req.FieldFilters = append(slices.Clip(req.FieldFilters), filter)
+	}
+
+	allowTypes, denyTypes := option.Config.ExportAllowEventTypes, option.Config.ExportDenyEventTypes
+	if len(conf.AllowEventTypes) > 0 {
+		allowTypes = conf.AllowEventTypes
+	}
+	if len(conf.DenyEventTypes) > 0 {
+		denyTypes = conf.DenyEventTypes
+	}
+	types, err := filters.ParseEventTypes(allowTypes)
+	if err != nil {
+		return fmt.Errorf("failed to parse allowed event types: %w", err)
+	}
+	req.AllowList = filters.AllowEventTypes(req.AllowList, types)
+	if types, err = filters.ParseEventTypes(denyTypes); err != nil {
+		return fmt.Errorf("failed to parse denied event types: %w", err)
+	}
+	req.DenyList = filters.DenyEventTypes(req.DenyList, types)
+	return nil
+}
+
+// configViper returns the viper holding the configuration of the running
+// exporters.
+func (s *exporterSet) configViper() *viper.Viper {
+	if s.viper == nil {
+		return viper.GetViper()
+	}
+	return s.viper
+}
+
+func (s *exporterSet) start(ctx context.Context) error {
+	option.RLockExportFlags()
+	defer option.RUnlockExportFlags()
+	reqs, err := exporterRequests(s.configViper())
+	if err != nil {
+		return err
+	}
+	return s.startWithRequests(ctx, reqs)
+}
+
+func (s *exporterSet) startWithRequests(ctx context.Context, reqs []*tetragon.GetEventsRequest) error {
+	ctx, s.cancel = context.WithCancel(ctx)
+	var errs error
+	primary := false
+	for i := range option.Config.Exporters {
+		conf := &option.Config.Exporters[i]
+		exp, err := exporter.NewFromConfig(ctx, conf, reqs[i], s.server)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		// tetragon_events_exported_total counts the events of the first
+		// exporter, as it did when there was a single one.
+		if !primary && !exp.Mirror() {
+			exp.SetPrimary(true)
+			primary = true
+		}
+		log.Info("Starting exporter", "name", conf.Name, "type", conf.Type, "request", reqs[i])
+		if err := exp.Start(); err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		s.exporters = append(s.exporters, exp)
+	}
+	return errs
+}
+
+// stop stops all exporters and waits until their outputs are closed.
+func (s *exporterSet) stop() {
+	if s.cancel == nil {
+		return
+	}
+	s.cancel()
+	for _, exp := range s.exporters {
+		<-exp.Done()
+	}
+	s.exporters = nil
+}
+
+// validateExporters checks the configuration of every exporter, and the
+// filters of its request in reqs, as checkConfig does.
+func validateExporters(reqs []*tetragon.GetEventsRequest) error {
+	var errs error
+	for i, req := range reqs {
+		conf := &option.Config.Exporters[i]
+		err := exporter.Validate(conf)
+		if err == nil {
+			err = buildExportFilters(req)
+		}
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("exporter %q: %w", conf.Name, err))
+		}
+	}
+	return errs
+}
+
+// reload reads the configuration again and replaces the running exporters.
+// The configuration is read into a new viper, so that the options removed
+// from the configuration files are reset. If the new export configuration
+// is invalid, the running exporters and the export options are kept: see
+// option.ReloadExportFlags.
+func (s *exporterSet) reload(ctx context.Context) error {
+	if s.newViper == nil {
+		return errors.New("reloading the configuration is not supported")
+	}
+	v, err := s.newViper()
+	if err != nil {
+		return err
+	}
+	var reqs []*tetragon.GetEventsRequest
+	err = option.ReloadExportFlags(v, s.configViper(), func() error {
+		var err error
+		if reqs, err = exporterRequests(v); err != nil {
+			return err
+		}
+		return validateExporters(reqs)
+	})
+	if err != nil {
+		return fmt.Errorf("invalid export configuration: %w", err)
+	}
+	s.stop()
+	s.viper = v
+	option.RLockExportFlags()
+	defer option.RUnlockExportFlags()
+	return s.startWithRequests(ctx, reqs)
+}
+
+// replay exports the retained events of every exporter again.
+func (s *exporterSet) replay() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, exp := range s.exporters {
+		n := exp.Replay()
+		log.Info("Exported retained events again", "exporter", exp.Name(), "events", n)
+	}
+}
+
+// reloadExporters reloads the exporters, see reload.
+func (s *exporterSet) reloadExporters(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(ctx); err != nil {
+		return err
+	}
+	log.Info("Exporters reloaded", "exporters", len(s.exporters))
+	return nil
+}
+
+// names returns the names of the running exporters.
+func (s *exporterSet) names() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.exporters))
+	for _, exp := range s.exporters {
+		names = append(names, exp.Name())
+	}
+	return names
+}
+
+// health returns the health state of every running exporter, by name.
+func (s *exporterSet) health() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	states := make(map[string]string, len(s.exporters))
+	for _, exp := range s.exporters {
+		states[exp.Name()] = exp.Health()
+	}
+	return states
+}
+
+// rateLimits returns the state of the rate limiter of every rate limited
+// exporter, by name.
+func (s *exporterSet) rateLimits() map[string]ratelimit.Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := make(map[string]ratelimit.Stats, len(s.exporters))
+	for _, exp := range s.exporters {
+		if st, ok := exp.RateLimitStats(); ok {
+			stats[exp.Name()] = st
+		}
+	}
+	return stats
+}
+
+// healthServices returns the status of the exporters reported by the gRPC
+// health server, as "exporter/<name>" services. Degraded exporters are still
+// serving.
+func (s *exporterSet) healthServices() map[string]grpc_health_v1.HealthCheckResponse_ServingStatus {
+	services := make(map[string]grpc_health_v1.HealthCheckResponse_ServingStatus)
+	for name, state := range s.health() {
+		status := grpc_health_v1.HealthCheckResponse_SERVING
+		if state == exporter.HealthFailing {
+			status = grpc_health_v1.HealthCheckResponse_NOT_SERVING
+		}
+		services["exporter/"+name] = status
+	}
+	return services
+}
+
+// check returns an error if an exporter has stopped, or has been writing an
+// event for more than timeout.
+func (s *exporterSet) check(timeout time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, exp := range s.exporters {
+		select {
+		case <-exp.Done():
+			return fmt.Errorf("exporter %q stopped", exp.Name())
+		default:
+		}
+		if exp.Stalled(timeout) {
+			return fmt.Errorf("exporter %q has been writing an event for more than %s", exp.Name(), timeout)
+		}
+	}
+	return nil
+}
+
+// controlHandlers returns the control socket commands of the exporters,
+// which do the same as the signals.
+func (s *exporterSet) controlHandlers(ctx context.Context) map[string]control.Handler {
+	return map[string]control.Handler{
+		"exporters": func([]string) (string, error) {
+			return strings.Join(s.names(), "\n"), nil
+		},
+		"reload-exporters": func([]string) (string, error) {
+			if err := s.reloadExporters(ctx); err != nil {
+				log.Warn("Failed to reload exporters from the control socket", logfields.Error, err)
+				return "", err
+			}
+			return strings.Join(s.names(), "\n"), nil
+		},
+		"rate-limits": func([]string) (string, error) {
+			b, err := json.MarshalIndent(s.rateLimits(), "", "  ")
+			return string(b), err
+		},
+		"replay-exporters": func([]string) (string, error) {
+			s.replay()
+			return "", nil
+		},
+	}
+}
+
+// handleSignals reloads the exporters whenever the agent receives SIGHUP,
+// without restarting sensors, and exports the retained events again on
+// replaySignal (SIGUSR2 on Linux).
+func (s *exporterSet) handleSignals(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	replay := make(chan os.Signal, 1)
+	if replaySignal != nil {
+		signal.Notify(replay, replaySignal)
+		defer signal.Stop(replay)
+	}
+	for {
+		select {
+		case <-replay:
+			s.replay()
+		case <-hup:
+			log.Info("Received SIGHUP, reloading exporters")
+			if err := s.reloadExporters(ctx); err != nil {
+				log.Warn("Failed to reload exporters", logfields.Error, err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,85 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cilium/tetragon/pkg/option"
+)
+
+// newTestExporterSet returns an exporterSet that reloads the configuration
+// from the drop-in directory it returns, with args as command line flags.
+func newTestExporterSet(t *testing.T, args ...string) (*exporterSet, string) {
+	saved := option.Config
+	t.Cleanup(func() { option.Config = saved })
+
+	flags := pflag.NewFlagSet("tetragon", pflag.ContinueOnError)
+	option.AddFlags(flags)
+	require.NoError(t, flags.Parse(args))
+
+	root := t.TempDir()
+	dropIn := filepath.Join(root, "tetragon.conf.d")
+	require.NoError(t, os.MkdirAll(dropIn, 0755))
+	s := &exporterSet{
+		newViper: func() (*viper.Viper, error) {
+			return newConfigViper(flags, root, dropIn, nil)
+		},
+	}
+	return s, dropIn
+}
+
+func TestExporterSetReloadRemovedOption(t *testing.T) {
+	s, dropIn := newTestExporterSet(t)
+	file := filepath.Join(dropIn, option.KeyExportRateLimit)
+	require.NoError(t, os.WriteFile(file, []byte("100"), 0644))
+
+	require.NoError(t, s.reloadExporters(context.Background()))
+	require.Equal(t, 100, option.Config.ExportRateLimit)
+
+	require.NoError(t, os.Remove(file))
+	require.NoError(t, s.reloadExporters(context.Background()))
+	require.Equal(t, -1, option.Config.ExportRateLimit)
+}
+
+func TestExporterSetReloadInvalid(t *testing.T) {
+	s, dropIn := newTestExporterSet(t)
+	file := filepath.Join(dropIn, option.KeyExportRateLimit)
+	require.NoError(t, os.WriteFile(file, []byte("100"), 0644))
+	require.NoError(t, s.reloadExporters(context.Background()))
+	v := s.viper
+
+	require.NoError(t, os.WriteFile(file, []byte("200"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dropIn, option.KeyExportFilename), []byte(filepath.Join(t.TempDir(), "events.log")), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dropIn, option.KeyExportAllowlist), []byte("{invalid"), 0644))
+	require.Error(t, s.reloadExporters(context.Background()))
+	require.Equal(t, 100, option.Config.ExportRateLimit)
+	require.Empty(t, option.Config.ExportFilename)
+	require.Same(t, v, s.viper)
+}
+
+func TestExporterSetReloadInvalidFlags(t *testing.T) {
+	s, dropIn := newTestExporterSet(t)
+	require.NoError(t, os.WriteFile(filepath.Join(dropIn, option.KeyExportRateLimit), []byte("100"), 0644))
+	require.NoError(t, s.reloadExporters(context.Background()))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dropIn, option.KeyExporters), []byte("- type: ["), 0644))
+	require.Error(t, s.reloadExporters(context.Background()))
+	require.Equal(t, 100, option.Config.ExportRateLimit)
+}
+
+func TestExporterSetReloadMissingConfigDir(t *testing.T) {
+	s, _ := newTestExporterSet(t, "--"+option.KeyConfigDir, filepath.Join(t.TempDir(), "missing"))
+	option.Config.ExportRateLimit = 100
+
+	require.Error(t, s.reloadExporters(context.Background()))
+	require.Equal(t, 100, option.Config.ExportRateLimit)
+}
@@ -5,10 +5,10 @@ package main
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"io/fs"
 	"log/slog"
+	"maps"
 	"net"
 	"net/http"
 	pprofhttp "net/http/pprof"
@@ -30,13 +30,13 @@ import (
 
 	"github.com/cilium/tetragon/pkg/bugtool"
 	"github.com/cilium/tetragon/pkg/cgrouprate"
+	"github.com/cilium/tetragon/pkg/control"
 	"github.com/cilium/tetragon/pkg/defaults"
-	"github.com/cilium/tetragon/pkg/encoder"
 	"github.com/cilium/tetragon/pkg/exporter"
 	"github.com/cilium/tetragon/pkg/fieldfilters"
-	"github.com/cilium/tetragon/pkg/fileutils"
 	"github.com/cilium/tetragon/pkg/filters"
 	tetragonGrpc "github.com/cilium/tetragon/pkg/grpc"
+	"github.com/cilium/tetragon/pkg/grpcauth"
 	"github.com/cilium/tetragon/pkg/health"
 	"github.com/cilium/tetragon/pkg/logger"
 	"github.com/cilium/tetragon/pkg/manager"
@@ -45,10 +45,11 @@ import (
 	"github.com/cilium/tetragon/pkg/observer"
 	"github.com/cilium/tetragon/pkg/option"
 	"github.com/cilium/tetragon/pkg/pidfile"
+	"github.com/cilium/tetragon/pkg/policydir"
 	"github.com/cilium/tetragon/pkg/process"
-	"github.com/cilium/tetragon/pkg/ratelimit"
 	"github.com/cilium/tetragon/pkg/reader/node"
 	"github.com/cilium/tetragon/pkg/rthooks"
+	"github.com/cilium/tetragon/pkg/sdnotify"
 	"github.com/cilium/tetragon/pkg/sensors/base"
 	"github.com/cilium/tetragon/pkg/sensors/exec/procevents"
 	"github.com/cilium/tetragon/pkg/sensors/program"
@@ -61,14 +62,18 @@ import (
 
 	// Imported to allow sensors to be initialized inside init().
 	_ "github.com/cilium/tetragon/pkg/sensors"
+	// Imported to register exporter types inside init().
+	_ "github.com/cilium/tetragon/pkg/exporter/gelf"
+	_ "github.com/cilium/tetragon/pkg/exporter/loki"
+	_ "github.com/cilium/tetragon/pkg/exporter/redis"
+	_ "github.com/cilium/tetragon/pkg/exporter/syslog"
+	_ "github.com/cilium/tetragon/pkg/exporter/webhook"
 
-	"github.com/cilium/lumberjack/v2"
 	gops "github.com/google/gops/agent"
 	"github.com/spf13/cobra"
 	"github.com/spf13/cobra/doc"
 	"github.com/spf13/viper"
 	"google.golang.org/grpc"
-	"google.golang.org/protobuf/types/known/durationpb"
 
 	"github.com/cilium/tetragon/pkg/k8s/apis/cilium.io/v1alpha1"
 )
@@ -77,20 +82,20 @@ var (
 	log = logger.GetLogger()
 )
 
-func getExportFilters() ([]*tetragon.Filter, []*tetragon.Filter, error) {
-	allowList, err := filters.ParseFilterList(viper.GetString(option.KeyExportAllowlist), viper.GetBool(option.KeyEnablePidSetFilter))
+func getExportFilters(v *viper.Viper) ([]*tetragon.Filter, []*tetragon.Filter, error) {
+	allowList, err := filters.ParseFilterList(v.GetString(option.KeyExportAllowlist), v.GetBool(option.KeyEnablePidSetFilter))
 	if err != nil {
 		return nil, nil, err
 	}
-	denyList, err := filters.ParseFilterList(viper.GetString(option.KeyExportDenylist), viper.GetBool(option.KeyEnablePidSetFilter))
+	denyList, err := filters.ParseFilterList(v.GetString(option.KeyExportDenylist), v.GetBool(option.KeyEnablePidSetFilter))
 	if err != nil {
 		return nil, nil, err
 	}
 	return allowList, denyList, nil
 }
 
-func getFieldFilters() ([]*tetragon.FieldFilter, error) {
-	fieldFilters := viper.GetString(option.KeyFieldFilters)
+func getFieldFilters(v *viper.Viper) ([]*tetragon.FieldFilter, error) {
+	fieldFilters := v.GetString(option.KeyFieldFilters)
 
 	filters, err := fieldfilters.ParseFieldFilterList(fieldFilters)
 	if err != nil {
@@ -104,6 +109,9 @@ func setRedactionFilters() error {
 	var err error
 	redactionFilters := viper.GetString(option.KeyRedactionFilters)
 	fieldfilters.RedactionFilters, err = fieldfilters.ParseRedactionFilterList(redactionFilters)
+	if err == nil {
+		err = fieldfilters.RedactionFilters.SetMode(viper.GetString(option.KeyRedactionMode), viper.GetString(option.KeyRedactionHashKey))
+	}
 	if err == nil {
 		log.Info("Configured redaction filters", "redactionFilters", redactionFilters)
 	} else {
@@ -217,17 +225,15 @@ func tetragonExecuteCtx(ctx context.Context, cancel context.CancelFunc, ready fu
 		logger.Fatal(log, "Failed to setup logging", logfields.Error, err)
 	}
 
-	if !filepath.IsAbs(option.Config.TracingPolicyDir) {
-		logger.Fatal(log, fmt.Sprintf("Failed path specified by --tracing-policy-dir '%q' is not absolute", option.Config.TracingPolicyDir))
+	if err := option.Validate(); err != nil {
+		logger.Fatal(log, "Invalid configuration", logfields.Error, err)
 	}
 	option.Config.TracingPolicyDir = filepath.Clean(option.Config.TracingPolicyDir)
-
-	if option.Config.RBSize != 0 && option.Config.RBSizeTotal != 0 {
-		logger.Fatal(log, "Can't specify --rb-size and --rb-size-total together")
+	if option.Config.NodeName != "" {
+		node.OverrideNodeName(option.Config.NodeName)
 	}
-
-	if option.Config.ExecveMapEntries != 0 && len(option.Config.ExecveMapSize) != 0 {
-		logger.Fatal(log, "Can't specify --execve-map-entries and --execve-map-size together")
+	if len(option.Config.NodeLabels) > 0 {
+		node.SetNodeLabels(option.Config.NodeLabels)
 	}
 
 	// enable extra programs/maps loading debug output
@@ -237,6 +243,9 @@ func tetragonExecuteCtx(ctx context.Context, cancel context.CancelFunc, ready fu
 
 	log.Info("Starting tetragon", "version", version.Version)
 	log.Info("config settings", "config", viper.AllSettings())
+	if option.Config.MinimalMode {
+		log.Info("Minimal mode enabled", "disabled", option.Config.MinimalModeDisabled)
+	}
 
 	// Create run dir early
 	os.MkdirAll(defaults.DefaultRunDir, 0755)
@@ -259,10 +268,6 @@ func tetragonExecuteCtx(ctx context.Context, cancel context.CancelFunc, ready fu
 
 	log.Info("Tetragon pid file creation succeeded", "pid", pid, "pidfile", defaults.DefaultPidFile)
 
-	if option.Config.ForceLargeProgs && option.Config.ForceSmallProgs {
-		logger.Fatal(log, "Can't specify --force-small-progs and --force-large-progs together")
-	}
-
 	if option.Config.ForceLargeProgs {
 		log.Info("Force loading large programs")
 	}
@@ -394,6 +399,14 @@ func tetragonExecuteCtx(ctx context.Context, cancel context.CancelFunc, ready fu
 		// Handler must be registered before the watcher is started
 		metrics.RegisterPodDeleteHandler()
 	}
+	if option.Config.ExporterMetricsServer != "" {
+		go metricsconfig.EnableExporterMetrics(option.Config.ExporterMetricsServer)
+	}
+	if option.Config.MetricsStatsd != "" {
+		if err := metricsconfig.EnableStatsd(ctx, option.Config.MetricsStatsd, option.Config.MetricsStatsdInterval); err != nil {
+			return err
+		}
+	}
 
 	// Probe runtime configuration and do not fail on errors
 	obs.UpdateRuntimeConf(option.Config.BpfDir)
@@ -428,7 +441,10 @@ func tetragonExecuteCtx(ctx context.Context, cancel context.CancelFunc, ready fu
 			if err != nil {
 				log.Warn("Failed to get local Kubernetes node info. node_labels field will be empty", logfields.Error, err)
 			} else {
-				node.SetNodeLabels(k8sNode.Labels)
+				labels := make(map[string]string, len(k8sNode.Labels)+len(option.Config.NodeLabels))
+				maps.Copy(labels, k8sNode.Labels)
+				maps.Copy(labels, option.Config.NodeLabels)
+				node.SetNodeLabels(labels)
 			}
 		} else {
 			podAccessor = watcher.NewFakeK8sWatcher(nil)
@@ -491,17 +507,37 @@ func tetragonExecuteCtx(ctx context.Context, cancel context.CancelFunc, ready fu
 	if err = Serve(ctx, option.Config.ServerAddress, pm.Server); err != nil {
 		return err
 	}
-	if option.Config.ExportFilename != "" {
-		if err = startExporter(ctx, pm.Server); err != nil {
+	exporters := &exporterSet{
+		server: pm.Server,
+		newViper: func() (*viper.Viper, error) {
+			return newConfigViper(configFlags, adminTgConfDir, adminTgConfDropIn, packageTgConfDropIns)
+		},
+	}
+	if err = exporters.start(ctx); err != nil {
+		return err
+	}
+	go exporters.handleSignals(ctx)
+
+	if option.Config.ControlSocket != "" {
+		ctl := control.NewServer()
+		for command, h := range exporters.controlHandlers(ctx) {
+			ctl.Handle(command, h)
+		}
+		if err := ctl.Listen(ctx, option.Config.ControlSocket); err != nil {
 			return err
 		}
 	}
 
 	if option.Config.HealthServerAddress != "" {
-		health.StartHealthServer(ctx, option.Config.HealthServerAddress, option.Config.HealthServerInterval)
+		health.StartHealthServer(ctx, option.Config.HealthServerAddress, option.Config.HealthServerInterval, exporters.healthServices)
+	}
+	if option.Config.HealthProbeAddress != "" {
+		if err := health.StartProbeServer(ctx, option.Config.HealthProbeAddress, probeStatus(time.Now(), exporters)); err != nil {
+			return err
+		}
 	}
 
-	log.Info("Exporter configuration", "enabled", option.Config.ExportFilename != "", "fileName", option.Config.ExportFilename)
+	log.Info("Exporter configuration", "enabled", len(option.Config.Exporters) > 0, "exporters", option.Config.Exporters)
 	obs.AddListener(pm)
 	saveInitInfo()
 
@@ -528,7 +564,11 @@ func tetragonExecuteCtx(ctx context.Context, cancel context.CancelFunc, ready fu
 	}
 	cgrouprate.Config()
 
-	err = loadTpFromDir(ctx, option.Config.TracingPolicyDir)
+	if option.Config.TracingPolicyDirWatch {
+		err = watchTpDir(ctx, option.Config.TracingPolicyDir)
+	} else {
+		err = loadTpFromDir(ctx, option.Config.TracingPolicyDir)
+	}
 	if err != nil {
 		return err
 	}
@@ -548,7 +588,10 @@ func tetragonExecuteCtx(ctx context.Context, cancel context.CancelFunc, ready fu
 		go logStatus(ctx, obs)
 	}
 
-	return obs.StartReady(ctx, ready)
+	return obs.StartReady(ctx, func() {
+		ready()
+		notifySystemd(ctx, exporters)
+	})
 }
 
 func loadTpFromDir(ctx context.Context, dir string) error {
@@ -593,6 +636,25 @@ func loadTpFromDir(ctx context.Context, dir string) error {
 	return err
 }
 
+// watchTpDir loads the tracing policies of dir, like loadTpFromDir, and then
+// keeps them in sync with the files of dir.
+func watchTpDir(ctx context.Context, dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create tracing policies dir %s: %w", dir, err)
+	}
+	w := policydir.New(dir, observer.GetSensorManager())
+	if err := w.Sync(ctx); err != nil {
+		return err
+	}
+	log.Info("Watching Tracing Policies directory", "tracing-policy-dir", dir)
+	go func() {
+		if err := w.Run(ctx); err != nil {
+			log.Warn("Failed to watch Tracing Policies directory", "tracing-policy-dir", dir, logfields.Error, err)
+		}
+	}()
+	return nil
+}
+
 func addTracingPolicy(ctx context.Context, file string) error {
 	f, err := filepath.Abs(filepath.Clean(file))
 	if err != nil {
@@ -661,85 +723,15 @@ func getObserverDir() string {
 	return bpf.MapPrefixPath()
 }
 
-func startExporter(ctx context.Context, server *server.Server) error {
-	allowList, denyList, err := getExportFilters()
-	if err != nil {
-		return err
-	}
-	fieldFilters, err := getFieldFilters()
-	if err != nil {
-		return err
-	}
-	writer := &lumberjack.Logger{
-		Filename:   option.Config.ExportFilename,
-		MaxSize:    option.Config.ExportFileMaxSizeMB,
-		MaxBackups: option.Config.ExportFileMaxBackups,
-		Compress:   option.Config.ExportFileCompress,
-	}
-
-	perms, err := fileutils.RegularFilePerms(option.Config.ExportFilePerm)
-	if err != nil {
-		log.Warn(fmt.Sprintf("Failed to parse export file permission '%s', failing back to %v",
-			option.KeyExportFilePerm, perms), logfields.Error, err)
-	}
-	writer.FileMode = perms
-
-	finfo, err := os.Stat(filepath.Clean(option.Config.ExportFilename))
-	if err == nil && finfo.IsDir() {
-		// Error if exportFilename points to a directory
-		return errors.New("passed export JSON logs file point to a directory")
+// serverAuthOptions returns the authentication options of the gRPC server.
+func serverAuthOptions() grpcauth.Options {
+	return grpcauth.Options{
+		CertFile:     option.Config.ServerTLSCertFile,
+		KeyFile:      option.Config.ServerTLSKeyFile,
+		ClientCAFile: option.Config.ServerTLSClientCAFile,
+		TokenFile:    option.Config.ServerAuthTokenFile,
+		ListenAddr:   option.Config.ServerAddress,
 	}
-	logFile := filepath.Base(option.Config.ExportFilename)
-	logsDir, err := filepath.Abs(filepath.Dir(filepath.Clean(option.Config.ExportFilename)))
-	if err != nil {
-		log.Warn(fmt.Sprintf("Failed to get absolute path of exported JSON logs '%s'", option.Config.ExportFilename), logfields.Error, err)
-		// Do not fail; we let lumberjack handle this. We want to
-		// log the rotate logs operation.
-		logsDir = filepath.Dir(option.Config.ExportFilename)
-	}
-
-	if option.Config.ExportFileRotationInterval < 0 {
-		// Passed an invalid interval let's error out
-		return fmt.Errorf("frequency '%s' at which to rotate JSON export files is negative", option.Config.ExportFileRotationInterval.String())
-	} else if option.Config.ExportFileRotationInterval > 0 {
-		log.Info("Periodically rotating JSON export files",
-			"directory", logsDir,
-			"frequency", option.Config.ExportFileRotationInterval.String())
-		go func() {
-			ticker := time.NewTicker(option.Config.ExportFileRotationInterval)
-			for {
-				select {
-				case <-ctx.Done():
-					return
-				case <-ticker.C:
-					log.Info("Rotating JSON logs export", "file", logFile, "directory", logsDir)
-					if rotationErr := writer.Rotate(); rotationErr != nil {
-						log.Warn("Failed to rotate JSON export file", "file", option.Config.ExportFilename, logfields.Error, rotationErr)
-					}
-				}
-			}
-		}()
-	}
-
-	// Track how many bytes are written to the event export location
-	encoderWriter := exporter.NewExportedBytesTotalWriter(writer)
-	encoder := encoder.NewProtojsonEncoder(encoderWriter)
-	var rateLimiter *ratelimit.RateLimiter
-	if option.Config.ExportRateLimit >= 0 {
-		rateLimiter = ratelimit.NewRateLimiter(ctx, 1*time.Minute, option.Config.ExportRateLimit, encoder)
-	}
-	var aggregationOptions *tetragon.AggregationOptions
-	if option.Config.EnableExportAggregation {
-		aggregationOptions = &tetragon.AggregationOptions{
-			WindowSize:        durationpb.New(option.Config.ExportAggregationWindowSize),
-			ChannelBufferSize: option.Config.ExportAggregationBufferSize,
-		}
-	}
-	req := tetragon.GetEventsRequest{AllowList: allowList, DenyList: denyList, AggregationOptions: aggregationOptions, FieldFilters: fieldFilters}
-	log.Info("Configured field filters", "fieldFilters", fieldFilters)
-	log.Info("Starting JSON exporter", "logger", writer, "request", &req)
-	exporter := exporter.NewExporter(ctx, &req, server, encoder, writer, rateLimiter)
-	return exporter.Start()
 }
 
 func Serve(ctx context.Context, listenAddr string, srv *server.Server) error {
@@ -747,7 +739,18 @@ func Serve(ctx context.Context, listenAddr string, srv *server.Server) error {
 	if len(listenAddr) == 0 {
 		return nil
 	}
-	grpcServer := grpc.NewServer()
+	var opts []grpc.ServerOption
+	if authOpts := serverAuthOptions(); authOpts.Enabled() {
+		auth, err := grpcauth.New(authOpts)
+		if err != nil {
+			return err
+		}
+		if err := auth.Watch(ctx); err != nil {
+			return err
+		}
+		opts = auth.ServerOptions()
+	}
+	grpcServer := grpc.NewServer(opts...)
 	tetragon.RegisterFineGuidanceSensorsServer(grpcServer, srv)
 	proto, addr, err := server.SplitListenAddr(listenAddr)
 	if err != nil {
@@ -781,6 +784,39 @@ func Serve(ctx context.Context, listenAddr string, srv *server.Server) error {
 	return nil
 }
 
+// probeStatus returns the status answered to UDP health probes.
+func probeStatus(started time.Time, exporters *exporterSet) func() any {
+	return func() any {
+		status := "unknown"
+		if resp, err := health.GetHealth(); err == nil && len(resp.GetHealthStatus()) > 0 {
+			status = resp.GetHealthStatus()[0].GetDetails()
+		}
+		exported, dropped := exporter.Totals()
+		return map[string]any{
+			"status":          status,
+			"version":         version.Version,
+			"uptime_seconds":  int64(time.Since(started).Seconds()),
+			"events_exported": exported,
+			"events_dropped":  dropped,
+			"exporters":       exporters.health(),
+			"rate_limits":     exporters.rateLimits(),
+		}
+	}
+}
+
+// notifySystemd tells systemd that the agent is ready, and pets the service
+// watchdog, if enabled, as long as no exporter is stalled.
+func notifySystemd(ctx context.Context, exporters *exporterSet) {
+	if sent, err := sdnotify.Notify(sdnotify.Ready); err != nil {
+		log.Warn("Failed to notify systemd", logfields.Error, err)
+	} else if sent {
+		log.Info("Notified systemd that the agent is ready")
+	}
+	go sdnotify.RunWatchdog(ctx, func() error {
+		return exporters.check(sdnotify.WatchdogInterval())
+	})
+}
+
 func startGopsServer() error {
 	// Empty means no gops
 	if option.Config.GopsAddr == "" {
@@ -811,9 +847,20 @@ func execute() error {
 				return
 			}
 
+			if viper.GetBool(option.KeyCheckConfig) {
+				if err := checkConfig(os.Stdout); err != nil {
+					os.Exit(1)
+				}
+				return
+			}
+
 			if err := option.ReadAndSetFlags(); err != nil {
 				logger.Fatal(log, "Failed to parse command line flags", logfields.Error, err)
 			}
+			authOpts := serverAuthOptions()
+			if err := authOpts.Validate(); err != nil {
+				logger.Fatal(log, "Failed to parse command line flags", logfields.Error, err)
+			}
 			// Override perf ring buffer choice if only the perf ring is available.
 			// NB: can't do this in option.ReadAndSetFlags() as it causes an import cycle.
 			// It isn't the prettiest, but it is an important and unique part of Tetragon,
@@ -838,6 +885,7 @@ func execute() error {
 	flags := rootCmd.PersistentFlags()
 	option.AddFlags(flags)
 	viper.BindPFlags(flags)
+	configFlags = flags
 	return rootCmd.Execute()
 }
 
@@ -4,6 +4,9 @@
 package main
 
 import (
+	"os"
+	"syscall"
+
 	"github.com/cilium/tetragon/pkg/alignchecker"
 	"github.com/cilium/tetragon/pkg/btf"
 	"github.com/cilium/tetragon/pkg/checkprocfs"
@@ -16,6 +19,9 @@ import (
 	"github.com/spf13/viper"
 )
 
+// replaySignal makes the exporters export their retained events again.
+var replaySignal os.Signal = syscall.SIGUSR2
+
 func logCurrentSecurityContext() {
 	proc.LogCurrentSecurityContext()
 }
@@ -56,6 +56,7 @@ func TestGeneratedExecEvents(t *testing.T) {
 		t.Fatalf("testutils.GetExportFilename failed: %v\n", err)
 	}
 	option.Config.ExportFilename = fname
+	option.Config.Exporters = []option.ExporterConfig{{Name: "file", Type: "file"}}
 
 	var wg sync.WaitGroup
 	wg.Add(1)
@@ -3,6 +3,11 @@
 
 package main
 
+import "os"
+
+// replaySignal is not available on Windows.
+var replaySignal os.Signal
+
 func logCurrentSecurityContext() {
 }
 
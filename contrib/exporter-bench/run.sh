@@ -0,0 +1,91 @@
+#!/bin/bash
+# SPDX-License-Identifier: Apache-2.0
+# Copyright Authors of Tetragon
+
+# Runs the benchmarks of the export path and compares their memory usage
+# against a recorded baseline. Times depend too much on the machine to be
+# compared automatically, so they are only printed.
+#
+#   contrib/exporter-bench/run.sh --record   # record the baseline
+#   contrib/exporter-bench/run.sh            # compare against it
+#
+# The comparison fails if a benchmark allocates more per operation than in
+# the baseline, or more than 5% more bytes, since the bytes of pooled buffers
+# vary slightly between runs.
+
+set -e
+
+baseline=${BASELINE:-contrib/exporter-bench/baseline.txt}
+count=${COUNT:-5}
+packages="./pkg/exporter ./pkg/encoder ./pkg/ratelimit"
+record=
+
+while test $# -gt 0; do
+	case "$1" in
+	--record)
+		record=1
+		;;
+	--baseline)
+		shift
+		baseline="$1"
+		;;
+	--count)
+		shift
+		count="$1"
+		;;
+	*)
+		echo "unknown ${1}"
+		exit 1
+	esac
+	shift
+done
+
+out=$(mktemp)
+trap 'rm -f ${out}' EXIT
+
+go test -run '^$' -bench . -benchmem -count "${count}" ${packages} | tee "${out}"
+
+if test -n "${record}"; then
+	grep '^Benchmark' "${out}" > "${baseline}"
+	echo "baseline recorded in ${baseline}"
+	exit 0
+fi
+
+if ! test -f "${baseline}"; then
+	echo "no baseline in ${baseline}, record one with --record"
+	exit 1
+fi
+
+# Keep the lowest value of each benchmark over the runs, and compare the
+# B/op and allocs/op columns. The GOMAXPROCS suffix of the names is removed
+# so that baselines can be compared across machines.
+awk '
+function min(a, b) { return (a == "" || b < a) ? b : a }
+/^Benchmark/ {
+	name = $1
+	sub(/-[0-9]+$/, "", name)
+	for (i = 3; i < NF; i++) {
+		if ($(i+1) == "ns/op") ns[FILENAME, name] = min(ns[FILENAME, name], $i)
+		if ($(i+1) == "B/op") bytes[FILENAME, name] = min(bytes[FILENAME, name], $i)
+		if ($(i+1) == "allocs/op") allocs[FILENAME, name] = min(allocs[FILENAME, name], $i)
+	}
+	if (FILENAME == ARGV[2]) names[name] = 1
+}
+END {
+	status = 0
+	printf "%-50s %14s %14s %18s %18s\n", "benchmark", "ns/op old", "ns/op new", "B/op old->new", "allocs/op old->new"
+	for (name in names) {
+		if (!((ARGV[1], name) in allocs)) {
+			printf "%-50s not in the baseline\n", name
+			continue
+		}
+		mark = ""
+		if (bytes[ARGV[2], name] > bytes[ARGV[1], name] * 1.05 || allocs[ARGV[2], name] > allocs[ARGV[1], name]) {
+			mark = " REGRESSION"
+			status = 1
+		}
+		printf "%-50s %14s %14s %18s %18s%s\n", name, ns[ARGV[1], name], ns[ARGV[2], name],
+			bytes[ARGV[1], name] "->" bytes[ARGV[2], name], allocs[ARGV[1], name] "->" allocs[ARGV[2], name], mark
+	}
+	exit status
+}' "${baseline}" "${out}"
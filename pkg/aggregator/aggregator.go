@@ -4,10 +4,13 @@
 package aggregator
 
 import (
+	"context"
 	"sort"
 	"strings"
 	"time"
 
+	"google.golang.org/protobuf/proto"
+
 	"github.com/cilium/tetragon/api/v1/tetragon"
 	"github.com/cilium/tetragon/pkg/logger"
 	"github.com/cilium/tetragon/pkg/logger/logfields"
@@ -39,20 +42,40 @@ func NewAggregator(
 	}, nil
 }
 
-func (a *Aggregator) Start() {
-	// nolint Since Aggregator.Start is an endless function,
-	// this qualifies as an acceptable use of time.Tick
-	tick := time.Tick(a.window)
+// Start aggregates events until ctx is done. Events still cached by then are
+// not sent, since the stream they would be sent to is stopping.
+func (a *Aggregator) Start(ctx context.Context) {
+	ticker := time.NewTicker(a.window)
+	defer ticker.Stop()
 	for {
 		select {
 		case event := <-a.events:
 			a.handleEvent(event)
-		case <-tick:
+		case <-ticker.C:
 			a.flush()
+		case <-ctx.Done():
+			return
 		}
 	}
 }
 
+// Add aggregates event like the events sent to the channel of Start, on the
+// goroutine of the caller. Aggregated events are sent by Flush, which must be
+// called every Window, on the same goroutine.
+func (a *Aggregator) Add(event *tetragon.GetEventsResponse) {
+	a.handleEvent(event)
+}
+
+// Flush sends the events aggregated by Add.
+func (a *Aggregator) Flush() {
+	a.flush()
+}
+
+// Window returns the time events are aggregated for.
+func (a *Aggregator) Window() time.Duration {
+	return a.window
+}
+
 func (a *Aggregator) flush() {
 	for _, event := range a.cache {
 		if err := a.server.Send(event); err != nil {
@@ -64,12 +87,44 @@ func (a *Aggregator) flush() {
 }
 
 func (a *Aggregator) handleEvent(event *tetragon.GetEventsResponse) {
-	switch event.Event.(type) {
-	default:
+	key, ok := aggregationKey(event)
+	if !ok {
 		if err := a.server.Send(event); err != nil {
 			logger.GetLogger().Warn("Failed to send unaggregated response", logfields.Error, err)
 		}
+		return
+	}
+	if cached, ok := a.cache[key]; ok {
+		cached.AggregationInfo.Count++
+		return
+	}
+	// The event is shared with the other listeners, so the aggregation
+	// info is set on a copy.
+	cached := proto.CloneOf(event)
+	cached.AggregationInfo = &tetragon.AggregationInfo{Count: 1}
+	a.cache[key] = cached
+}
+
+// aggregationKey returns the key identifying identical events within a
+// window, and whether the event can be aggregated. Process execs and exits
+// with the same binary, arguments and pod are aggregated, so that repeated
+// commands such as health checks are sent once per window with a count.
+func aggregationKey(event *tetragon.GetEventsResponse) (string, bool) {
+	var process *tetragon.Process
+	var kind string
+	switch ev := event.Event.(type) {
+	case *tetragon.GetEventsResponse_ProcessExec:
+		process, kind = ev.ProcessExec.GetProcess(), "exec"
+	case *tetragon.GetEventsResponse_ProcessExit:
+		process, kind = ev.ProcessExit.GetProcess(), "exit"
+	default:
+		return "", false
+	}
+	if process == nil {
+		return "", false
 	}
+	pod := process.GetPod()
+	return strings.Join([]string{kind, process.Binary, process.Arguments, pod.GetNamespace(), pod.GetName()}, "\x00"), true
 }
 
 func getNameOrIp(ip string, names []string) string {
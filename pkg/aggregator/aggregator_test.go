@@ -4,12 +4,92 @@
 package aggregator
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/cilium/tetragon/api/v1/tetragon"
 )
 
 func Test_getNameOrIp(t *testing.T) {
 	assert.Equal(t, "1.1.1.1", getNameOrIp("1.1.1.1", []string{}))
 	assert.Equal(t, "a.com,b.com,c.com", getNameOrIp("1.1.1.1", []string{"b.com", "c.com", "a.com"}))
 }
+
+type fakeServer struct {
+	tetragon.FineGuidanceSensors_GetEventsServer
+	events []*tetragon.GetEventsResponse
+}
+
+func (s *fakeServer) Send(event *tetragon.GetEventsResponse) error {
+	s.events = append(s.events, event)
+	return nil
+}
+
+func execEvent(binary, args, pod string) *tetragon.GetEventsResponse {
+	return &tetragon.GetEventsResponse{
+		Event: &tetragon.GetEventsResponse_ProcessExec{
+			ProcessExec: &tetragon.ProcessExec{
+				Process: &tetragon.Process{
+					Binary:    binary,
+					Arguments: args,
+					Pod:       &tetragon.Pod{Namespace: "default", Name: pod},
+				},
+			},
+		},
+	}
+}
+
+func TestAggregator_ProcessExec(t *testing.T) {
+	server := &fakeServer{}
+	a, err := NewAggregator(server, &tetragon.AggregationOptions{})
+	require.NoError(t, err)
+
+	for range 3 {
+		a.handleEvent(execEvent("/bin/curl", "localhost:8080/healthz", "web"))
+	}
+	a.handleEvent(execEvent("/bin/curl", "localhost:8080/healthz", "db"))
+	a.handleEvent(execEvent("/bin/sh", "-c id", "web"))
+	a.handleEvent(&tetragon.GetEventsResponse{
+		Event: &tetragon.GetEventsResponse_ProcessKprobe{ProcessKprobe: &tetragon.ProcessKprobe{}},
+	})
+	require.Len(t, server.events, 1, "kprobe events are not aggregated")
+	assert.Nil(t, server.events[0].AggregationInfo)
+
+	a.flush()
+	require.Len(t, server.events, 4)
+	counts := make(map[string]uint64)
+	for _, ev := range server.events[1:] {
+		p := ev.GetProcessExec().Process
+		counts[p.Binary+" "+p.Pod.Name] = ev.AggregationInfo.Count
+	}
+	assert.Equal(t, map[string]uint64{"/bin/curl web": 3, "/bin/curl db": 1, "/bin/sh web": 1}, counts)
+
+	event := execEvent("/bin/curl", "localhost:8080/healthz", "web")
+	a.handleEvent(event)
+	assert.Nil(t, event.AggregationInfo, "events shared with other listeners are not modified")
+	a.flush()
+	require.Len(t, server.events, 5)
+	assert.Equal(t, uint64(1), server.events[4].AggregationInfo.Count, "cache is cleared on flush")
+}
+
+func TestAggregator_Start(t *testing.T) {
+	a, err := NewAggregator(&fakeServer{}, &tetragon.AggregationOptions{WindowSize: durationpb.New(time.Millisecond)})
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		a.Start(ctx)
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("aggregator did not stop")
+	}
+}
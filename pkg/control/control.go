@@ -0,0 +1,168 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+// Package control implements a local control socket to change the log level
+// and inspect the agent at runtime. Unlike the gRPC API, it is available in
+// minimal mode.
+//
+// The protocol is line based: each line is a command followed by its
+// arguments, and each response ends with an empty line. Errors start with
+// "error: ". For example, with socat:
+//
+//	echo "log-level debug" | socat - UNIX-CONNECT:/var/run/tetragon/control.sock
+package control
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cilium/tetragon/pkg/logger"
+	"github.com/cilium/tetragon/pkg/logger/logfields"
+	"github.com/cilium/tetragon/pkg/unixlisten"
+	"github.com/cilium/tetragon/pkg/version"
+)
+
+// Handler runs a command and returns its output.
+type Handler func(args []string) (string, error)
+
+// Server serves control commands.
+type Server struct {
+	mu       sync.RWMutex
+	handlers map[string]Handler
+	started  time.Time
+}
+
+// NewServer returns a server with the built-in commands: help, log-level
+// and status.
+func NewServer() *Server {
+	s := &Server{
+		handlers: make(map[string]Handler),
+		started:  time.Now(),
+	}
+	s.Handle("help", s.help)
+	s.Handle("log-level", logLevel)
+	s.Handle("status", s.status)
+	return s
+}
+
+// Handle registers the handler of a command, replacing any previous one.
+func (s *Server) Handle(command string, h Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[command] = h
+}
+
+// Listen serves commands on a unix socket at path, only accessible by its
+// owner, until ctx is done.
+func (s *Server) Listen(ctx context.Context, path string) error {
+	l, err := unixlisten.ListenWithRename(path, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to listen on control socket %q: %w", path, err)
+	}
+	logger.GetLogger().Info("Control socket listening", "address", path)
+	go s.Serve(ctx, l)
+	return nil
+}
+
+// Serve serves commands on the connections of l until ctx is done, and then
+// closes l.
+func (s *Server) Serve(ctx context.Context, l net.Listener) {
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				logger.GetLogger().Warn("Control socket stopped", logfields.Error, err)
+			}
+			return
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+	w := bufio.NewWriter(conn)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		out, err := s.Run(fields[0], fields[1:])
+		if err != nil {
+			out = "error: " + err.Error()
+		}
+		out = strings.TrimRight(out, "\n")
+		if out != "" {
+			out += "\n"
+		}
+		w.WriteString(out + "\n")
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// Run runs a command.
+func (s *Server) Run(command string, args []string) (string, error) {
+	s.mu.RLock()
+	h, ok := s.handlers[command]
+	s.mu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("unknown command %q, see help", command)
+	}
+	logger.GetLogger().Info("Running control command", "command", command, "args", args)
+	return h(args)
+}
+
+func (s *Server) help([]string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return "commands: " + strings.Join(slices.Sorted(maps.Keys(s.handlers)), ", "), nil
+}
+
+// logLevel prints the log level, or sets it if an argument is given.
+func logLevel(args []string) (string, error) {
+	current := logger.GetLogLevel(logger.GetLogger())
+	switch len(args) {
+	case 0:
+		return strings.ToLower(current.String()), nil
+	case 1:
+		level, err := logger.ParseLevel(args[0])
+		if err != nil {
+			return "", err
+		}
+		logger.SetLogLevel(level)
+		logger.GetLogger().Warn(fmt.Sprintf("Log level changed from %s to %s", current, level))
+		return strings.ToLower(level.String()), nil
+	default:
+		return "", errors.New("usage: log-level [trace|debug|info|warn|error]")
+	}
+}
+
+// status prints the state of the agent as JSON.
+func (s *Server) status([]string) (string, error) {
+	b, err := json.MarshalIndent(map[string]any{
+		"version":    version.Version,
+		"pid":        os.Getpid(),
+		"uptime":     time.Since(s.started).Round(time.Second).String(),
+		"log_level":  strings.ToLower(logger.GetLogLevel(logger.GetLogger()).String()),
+		"goroutines": runtime.NumGoroutine(),
+	}, "", "  ")
+	return string(b), err
+}
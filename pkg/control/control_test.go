@@ -0,0 +1,66 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package control
+
+import (
+	"bufio"
+	"context"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cilium/tetragon/pkg/logger"
+)
+
+// command sends a command on conn and returns the lines of the response.
+func command(t *testing.T, conn net.Conn, r *bufio.Reader, cmd string) []string {
+	_, err := conn.Write([]byte(cmd + "\n"))
+	require.NoError(t, err)
+	var lines []string
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return lines
+		}
+		lines = append(lines, line)
+	}
+}
+
+func TestServer(t *testing.T) {
+	defer logger.SetLogLevel(logger.GetLogLevel(logger.GetLogger()))
+	logger.SetLogLevel(slog.LevelInfo)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	path := filepath.Join(t.TempDir(), "control.sock")
+	s := NewServer()
+	s.Handle("echo", func(args []string) (string, error) {
+		return strings.Join(args, "\n"), nil
+	})
+	require.NoError(t, s.Listen(ctx, path))
+
+	conn, err := net.Dial("unix", path)
+	require.NoError(t, err)
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	assert.Equal(t, []string{"commands: echo, help, log-level, status"}, command(t, conn, r, "help"))
+	assert.Equal(t, []string{"a", "b"}, command(t, conn, r, "echo a b"))
+	assert.Equal(t, []string{"info"}, command(t, conn, r, "log-level"))
+	assert.Equal(t, []string{"debug"}, command(t, conn, r, "log-level DEBUG"))
+	assert.True(t, logger.GetLogger().Enabled(ctx, slog.LevelDebug))
+	assert.Equal(t, []string{"debug"}, command(t, conn, r, "log-level"))
+	assert.Equal(t, []string{"error: unknown level verbose"}, command(t, conn, r, "log-level verbose"))
+	assert.Equal(t, []string{`error: unknown command "foo", see help`}, command(t, conn, r, "foo"))
+
+	status := strings.Join(command(t, conn, r, "status"), "\n")
+	assert.Contains(t, status, `"log_level": "debug"`)
+}
@@ -0,0 +1,91 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package encoder
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strconv"
+
+	"github.com/fxamacker/cbor/v2"
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"github.com/cilium/tetragon/api/v1/tetragon"
+)
+
+// CBOREncoder writes events as a sequence of CBOR maps (RFC 8742), with the
+// same field names and values as the JSON export. Numbers are encoded as
+// CBOR integers or floats.
+type CBOREncoder struct {
+	w      io.Writer
+	labels map[string]string
+	enc    cbor.EncMode
+}
+
+// NewCBOREncoder returns a CBOREncoder writing to w. If labels is not empty,
+// it is added to every event as a "labels" map, like the JSON exporter does.
+func NewCBOREncoder(w io.Writer, labels map[string]string) *CBOREncoder {
+	// Sorted keys make the encoding of an event deterministic.
+	enc, _ := cbor.CanonicalEncOptions().EncMode()
+	return &CBOREncoder{
+		w:      w,
+		labels: labels,
+		enc:    enc,
+	}
+}
+
+// Encode implements EventEncoder.Encode.
+func (c *CBOREncoder) Encode(v interface{}) error {
+	event, ok := v.(*tetragon.GetEventsResponse)
+	if !ok {
+		return ErrInvalidEvent
+	}
+	b, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(event)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var data map[string]any
+	if err := dec.Decode(&data); err != nil {
+		return err
+	}
+	if len(c.labels) > 0 {
+		data["labels"] = c.labels
+	}
+	out, err := c.enc.Marshal(convertNumbers(data))
+	if err != nil {
+		return err
+	}
+	_, err = c.w.Write(out)
+	return err
+}
+
+// convertNumbers replaces the JSON numbers of v by integers, or floats for
+// numbers that are not integers.
+func convertNumbers(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, inner := range v {
+			v[k] = convertNumbers(inner)
+		}
+	case []any:
+		for i, inner := range v {
+			v[i] = convertNumbers(inner)
+		}
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		if u, err := strconv.ParseUint(v.String(), 10, 64); err == nil {
+			return u
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		return v.String()
+	}
+	return v
+}
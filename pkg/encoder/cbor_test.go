@@ -0,0 +1,48 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package encoder
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/cilium/tetragon/api/v1/tetragon"
+)
+
+func TestCBOREncoder(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewCBOREncoder(&buf, map[string]string{"cluster": "prod"})
+	for _, binary := range []string{"/usr/bin/curl", "/bin/sh"} {
+		require.NoError(t, enc.Encode(&tetragon.GetEventsResponse{
+			Event: &tetragon.GetEventsResponse_ProcessExec{ProcessExec: &tetragon.ProcessExec{
+				Process: &tetragon.Process{Binary: binary, Pid: wrapperspb.UInt32(1234)},
+			}},
+			NodeName: "node1",
+		}))
+	}
+	require.Error(t, enc.Encode("not an event"))
+
+	// The output is a sequence of self-delimited CBOR events.
+	dec := cbor.NewDecoder(&buf)
+	for _, binary := range []string{"/usr/bin/curl", "/bin/sh"} {
+		var event map[string]any
+		require.NoError(t, dec.Decode(&event))
+		assert.Equal(t, map[string]any{
+			"process_exec": map[any]any{
+				"process": map[any]any{
+					"binary": binary,
+					"pid":    uint64(1234),
+				},
+			},
+			"node_name": "node1",
+			"labels":    map[any]any{"cluster": "prod"},
+		}, event)
+	}
+	assert.Equal(t, 0, buf.Len())
+}
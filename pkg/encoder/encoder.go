@@ -10,6 +10,7 @@ import (
 	"io"
 	"os"
 	"strings"
+	"sync"
 
 	"github.com/cilium/tetragon/api/v1/tetragon"
 	"github.com/cilium/tetragon/pkg/arch"
@@ -117,33 +118,62 @@ func (p *CompactEncoder) Encode(v interface{}) error {
 		ts := event.Time.AsTime().UTC().Format(rfc3339Nano)
 		str = fmt.Sprintf("%s %s", ts, str)
 	}
-	fmt.Fprintln(p.Writer, str)
+	if _, err := fmt.Fprintln(p.Writer, str); err != nil {
+		return err
+	}
 
 	// print stack trace if available
 	if p.StackTraces {
 		st := HumanStackTrace(event, p.Colorer)
-		fmt.Fprint(p.Writer, st)
+		if _, err := fmt.Fprint(p.Writer, st); err != nil {
+			return err
+		}
 	}
 
 	// print ima hash if available
 	if p.ImaHash {
 		st := HumanIMAHash(event, p.Colorer)
-		fmt.Fprint(p.Writer, st)
+		if _, err := fmt.Fprint(p.Writer, st); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
 type ProtojsonEncoder struct {
-	w io.Writer
+	w    io.Writer
+	opts JSONOptions
 }
 
 func NewProtojsonEncoder(w io.Writer) *ProtojsonEncoder {
 	return &ProtojsonEncoder{
-		w,
+		w: w,
+	}
+}
+
+// NewProtojsonEncoderWithOptions returns a ProtojsonEncoder encoding events
+// as set by opts.
+func NewProtojsonEncoderWithOptions(w io.Writer, opts JSONOptions) *ProtojsonEncoder {
+	return &ProtojsonEncoder{
+		w:    w,
+		opts: opts,
 	}
 }
 
+// protojsonBufPool holds the buffers events are marshalled into, so that
+// encoding an event does not allocate a new buffer every time.
+var protojsonBufPool = sync.Pool{
+	New: func() any {
+		b := make([]byte, 0, 4096)
+		return &b
+	},
+}
+
+// maxPooledBufSize is the capacity above which buffers are not returned to
+// the pool, so that a few very large events do not pin memory.
+const maxPooledBufSize = 64 * 1024
+
 func (p *ProtojsonEncoder) Encode(v interface{}) error {
 	// TODO(WF): We may want to implement a streaming API here, similar to what they do in
 	// encoding/json. For now, I think this is probably fine though.
@@ -151,17 +181,29 @@ func (p *ProtojsonEncoder) Encode(v interface{}) error {
 	if !ok {
 		return ErrInvalidEvent
 	}
+	bufp := protojsonBufPool.Get().(*[]byte)
 	out, err := protojson.MarshalOptions{
 		// Our old exporter's behaviour was to use the snake_case names rather than
 		// camelCase. We want to maintain backward compatibility here so let's do the
 		// same thing in the protojson encoder.
-		UseProtoNames: true,
-	}.Marshal(event)
+		UseProtoNames:   !p.opts.CamelCase,
+		EmitUnpopulated: p.opts.EmitUnpopulated,
+	}.MarshalAppend((*bufp)[:0], event)
+	if err == nil && (p.opts.EpochMillis || p.opts.Flatten) {
+		out, err = rewriteJSON(event, out, p.opts)
+	} else if err == nil {
+		out = append(out, '\n')
+	}
 	if err != nil {
+		protojsonBufPool.Put(bufp)
 		return err
 	}
-	fmt.Fprintln(p.w, string(out))
-	return nil
+	_, err = p.w.Write(out)
+	if cap(out) <= maxPooledBufSize {
+		*bufp = out
+		protojsonBufPool.Put(bufp)
+	}
+	return err
 }
 
 const (
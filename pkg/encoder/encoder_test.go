@@ -6,6 +6,8 @@ package encoder
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"io"
 	"os"
 	"testing"
 
@@ -585,3 +587,74 @@ func FuzzCompactEncoder(f *testing.F) {
 		require.NoError(t, err)
 	})
 }
+
+func testProtojsonEvent() *tetragon.GetEventsResponse {
+	return &tetragon.GetEventsResponse{
+		Event: &tetragon.GetEventsResponse_ProcessExec{
+			ProcessExec: &tetragon.ProcessExec{
+				Process: &tetragon.Process{
+					Binary:    "/usr/bin/curl",
+					Arguments: "cilium.io",
+					Pod:       &tetragon.Pod{Namespace: "kube-system", Name: "tetragon"},
+				},
+			},
+		},
+		NodeName: "my-node",
+		Time:     &timestamppb.Timestamp{Seconds: 1700000000},
+	}
+}
+
+func TestProtojsonEncoder_Encode(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewProtojsonEncoder(&buf)
+	ev := testProtojsonEvent()
+	require.NoError(t, enc.Encode(ev))
+	require.NoError(t, enc.Encode(ev))
+
+	lines := bytes.Split(bytes.TrimSuffix(buf.Bytes(), []byte{'\n'}), []byte{'\n'})
+	require.Len(t, lines, 2)
+	for _, line := range lines {
+		var got tetragon.GetEventsResponse
+		require.NoError(t, protojson.Unmarshal(line, &got))
+		assert.True(t, proto.Equal(ev, &got))
+	}
+	assert.ErrorIs(t, enc.Encode("not an event"), ErrInvalidEvent)
+}
+
+// errWriter fails every write, like a full disk.
+type errWriter struct{}
+
+var errWrite = errors.New("no space left on device")
+
+func (errWriter) Write([]byte) (int, error) {
+	return 0, errWrite
+}
+
+func TestEncoder_WriteError(t *testing.T) {
+	ev := testProtojsonEvent()
+	require.ErrorIs(t, NewProtojsonEncoder(errWriter{}).Encode(ev), errWrite)
+	require.ErrorIs(t, NewCompactEncoder(errWriter{}, Never, false, false, false).Encode(ev), errWrite)
+}
+
+// Encoding into pooled buffers must not allocate more than marshalling the
+// event on its own.
+func TestProtojsonEncoder_Allocs(t *testing.T) {
+	ev := testProtojsonEvent()
+	enc := NewProtojsonEncoder(io.Discard)
+	encodeAllocs := testing.AllocsPerRun(100, func() {
+		enc.Encode(ev)
+	})
+	marshalAllocs := testing.AllocsPerRun(100, func() {
+		protojson.MarshalOptions{UseProtoNames: true}.Marshal(ev)
+	})
+	assert.LessOrEqual(t, encodeAllocs, marshalAllocs)
+}
+
+func BenchmarkProtojsonEncoder_Encode(b *testing.B) {
+	ev := testProtojsonEvent()
+	enc := NewProtojsonEncoder(io.Discard)
+	b.ReportAllocs()
+	for b.Loop() {
+		enc.Encode(ev)
+	}
+}
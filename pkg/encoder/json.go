@@ -0,0 +1,172 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package encoder
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/cilium/tetragon/api/v1/tetragon"
+)
+
+// JSONOptions change how ProtojsonEncoder encodes events. The zero value
+// encodes events as the JSON exporter always did.
+type JSONOptions struct {
+	// CamelCase uses the lowerCamelCase JSON names of fields, such as
+	// startTime, instead of their snake_case names.
+	CamelCase bool
+	// EmitUnpopulated includes the fields that are not set, with their
+	// zero value.
+	EmitUnpopulated bool
+	// EpochMillis encodes timestamps as a number of milliseconds since the
+	// epoch instead of an RFC 3339 string.
+	EpochMillis bool
+	// Flatten encodes events as a single-level object, with the fields of
+	// nested objects named by their path, such as process.pod.namespace.
+	// Maps are flattened the same way, such as node_labels.zone, and empty
+	// ones are dropped. Lists are kept. The fields of the event are at the
+	// top level, without the event type, which is in the event_type field.
+	Flatten bool
+}
+
+const timestampName protoreflect.FullName = "google.protobuf.Timestamp"
+
+// rewriteJSON returns data, the JSON encoding of event, with its timestamps
+// converted and flattened as set by opts, with a trailing newline.
+func rewriteJSON(event *tetragon.GetEventsResponse, data []byte, opts JSONOptions) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var obj map[string]any
+	if err := dec.Decode(&obj); err != nil {
+		return nil, err
+	}
+	if opts.EpochMillis {
+		convertTimestamps(event.ProtoReflect(), obj, !opts.CamelCase)
+	}
+	if opts.Flatten {
+		obj = flattenEvent(event, obj, !opts.CamelCase)
+	}
+	var out bytes.Buffer
+	enc := json.NewEncoder(&out)
+	// Like protojson.
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(obj); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func convertTimestamps(m protoreflect.Message, obj map[string]any, protoNames bool) {
+	fields := m.Descriptor().Fields()
+	for i := range fields.Len() {
+		fd := fields.Get(i)
+		if fd.Message() == nil || (fd.Cardinality() != protoreflect.Repeated && !m.Has(fd)) {
+			continue
+		}
+		key := fd.JSONName()
+		if protoNames {
+			key = string(fd.Name())
+		}
+		v, ok := obj[key]
+		if !ok {
+			continue
+		}
+		switch {
+		case fd.IsList():
+			list, items := m.Get(fd).List(), asSlice(v)
+			for j := range min(list.Len(), len(items)) {
+				items[j] = convertValue(list.Get(j).Message(), items[j], protoNames)
+			}
+		case fd.IsMap():
+			if fd.MapValue().Message() == nil {
+				continue
+			}
+			values, ok := v.(map[string]any)
+			if !ok {
+				continue
+			}
+			m.Get(fd).Map().Range(func(k protoreflect.MapKey, mv protoreflect.Value) bool {
+				if item, ok := values[k.String()]; ok {
+					values[k.String()] = convertValue(mv.Message(), item, protoNames)
+				}
+				return true
+			})
+		default:
+			obj[key] = convertValue(m.Get(fd).Message(), v, protoNames)
+		}
+	}
+}
+
+// convertValue returns the JSON value v, the encoding of m, with its
+// timestamps converted.
+func convertValue(m protoreflect.Message, v any, protoNames bool) any {
+	desc := m.Descriptor()
+	if desc.FullName() == timestampName {
+		fields := desc.Fields()
+		seconds := m.Get(fields.ByName("seconds")).Int()
+		nanos := m.Get(fields.ByName("nanos")).Int()
+		return seconds*1000 + nanos/1000000
+	}
+	// Other well-known types, such as wrappers, have no timestamps.
+	if desc.ParentFile().Package() == "google.protobuf" {
+		return v
+	}
+	if obj, ok := v.(map[string]any); ok {
+		convertTimestamps(m, obj, protoNames)
+	}
+	return v
+}
+
+// flattenEvent returns obj, the JSON object of event, flattened. The fields
+// of the event object, such as process_exec, are moved to the top level and
+// the event type is set in event_type. Lists are kept as they are.
+func flattenEvent(event *tetragon.GetEventsResponse, obj map[string]any, protoNames bool) map[string]any {
+	flat := make(map[string]any, len(obj))
+	typeKey := "eventType"
+	if protoNames {
+		typeKey = "event_type"
+	}
+	var eventKey string
+	m := event.ProtoReflect()
+	if fd := m.WhichOneof(m.Descriptor().Oneofs().ByName("event")); fd != nil {
+		eventKey = fd.JSONName()
+		if protoNames {
+			eventKey = string(fd.Name())
+		}
+		flat[typeKey] = event.EventType().String()
+	}
+	for k, v := range obj {
+		if k == eventKey {
+			if inner, ok := v.(map[string]any); ok {
+				flatten(flat, "", inner)
+				continue
+			}
+		}
+		flatten(flat, k, v)
+	}
+	return flat
+}
+
+// flatten adds value to flat, under key prefix. The fields of objects are
+// added with their path, separated by dots.
+func flatten(flat map[string]any, prefix string, value any) {
+	obj, ok := value.(map[string]any)
+	if !ok {
+		flat[prefix] = value
+		return
+	}
+	for k, v := range obj {
+		if prefix != "" {
+			k = prefix + "." + k
+		}
+		flatten(flat, k, v)
+	}
+}
+
+func asSlice(v any) []any {
+	items, _ := v.([]any)
+	return items
+}
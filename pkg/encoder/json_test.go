@@ -0,0 +1,111 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package encoder
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestProtojsonEncoder_Options(t *testing.T) {
+	ev := testProtojsonEvent()
+	ev.GetProcessExec().Process.StartTime = &timestamppb.Timestamp{Seconds: 1699999999, Nanos: 123456789}
+
+	tests := []struct {
+		name string
+		opts JSONOptions
+		want string
+	}{
+		{
+			name: "default",
+			want: `{"process_exec":{"process":{"binary":"/usr/bin/curl","arguments":"cilium.io","start_time":"2023-11-14T22:13:19.123456789Z","pod":{"namespace":"kube-system","name":"tetragon"}}},"node_name":"my-node","time":"2023-11-14T22:13:20Z"}`,
+		},
+		{
+			name: "camelCase",
+			opts: JSONOptions{CamelCase: true},
+			want: `{"processExec":{"process":{"binary":"/usr/bin/curl","arguments":"cilium.io","startTime":"2023-11-14T22:13:19.123456789Z","pod":{"namespace":"kube-system","name":"tetragon"}}},"nodeName":"my-node","time":"2023-11-14T22:13:20Z"}`,
+		},
+		{
+			name: "epoch millis",
+			opts: JSONOptions{EpochMillis: true},
+			want: `{"process_exec":{"process":{"binary":"/usr/bin/curl","arguments":"cilium.io","start_time":1699999999123,"pod":{"namespace":"kube-system","name":"tetragon"}}},"node_name":"my-node","time":1700000000000}`,
+		},
+		{
+			name: "camelCase epoch millis",
+			opts: JSONOptions{CamelCase: true, EpochMillis: true},
+			want: `{"processExec":{"process":{"binary":"/usr/bin/curl","arguments":"cilium.io","startTime":1699999999123,"pod":{"namespace":"kube-system","name":"tetragon"}}},"nodeName":"my-node","time":1700000000000}`,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, NewProtojsonEncoderWithOptions(&buf, tc.opts).Encode(ev))
+			assert.JSONEq(t, tc.want, buf.String())
+			assert.Equal(t, byte('\n'), buf.Bytes()[buf.Len()-1])
+		})
+	}
+}
+
+func TestProtojsonEncoder_EmitUnpopulated(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewProtojsonEncoderWithOptions(&buf, JSONOptions{EmitUnpopulated: true, EpochMillis: true})
+	require.NoError(t, enc.Encode(testProtojsonEvent()))
+	out := buf.String()
+	assert.Contains(t, out, `"cwd":""`)
+	assert.Contains(t, out, `"start_time":null`)
+	assert.Contains(t, out, `"time":1700000000000`)
+}
+
+func TestProtojsonEncoder_Flatten(t *testing.T) {
+	ev := testProtojsonEvent()
+	ev.GetProcessExec().Process.StartTime = &timestamppb.Timestamp{Seconds: 1699999999, Nanos: 123456789}
+
+	var buf bytes.Buffer
+	require.NoError(t, NewProtojsonEncoderWithOptions(&buf, JSONOptions{Flatten: true, EpochMillis: true}).Encode(ev))
+	assert.JSONEq(t, `{
+		"event_type": "PROCESS_EXEC",
+		"process.binary": "/usr/bin/curl",
+		"process.arguments": "cilium.io",
+		"process.start_time": 1699999999123,
+		"process.pod.namespace": "kube-system",
+		"process.pod.name": "tetragon",
+		"node_name": "my-node",
+		"time": 1700000000000
+	}`, buf.String())
+
+	buf.Reset()
+	require.NoError(t, NewProtojsonEncoderWithOptions(&buf, JSONOptions{Flatten: true, CamelCase: true}).Encode(ev))
+	assert.JSONEq(t, `{
+		"eventType": "PROCESS_EXEC",
+		"process.binary": "/usr/bin/curl",
+		"process.arguments": "cilium.io",
+		"process.startTime": "2023-11-14T22:13:19.123456789Z",
+		"process.pod.namespace": "kube-system",
+		"process.pod.name": "tetragon",
+		"nodeName": "my-node",
+		"time": "2023-11-14T22:13:20Z"
+	}`, buf.String())
+}
+
+func TestProtojsonEncoder_FlattenMaps(t *testing.T) {
+	ev := testProtojsonEvent()
+	ev.GetProcessExec().Process.Pod.PodLabels = map[string]string{"app": "tetragon"}
+	ev.NodeLabels = map[string]string{"zone": "eu-west-1a"}
+
+	var buf bytes.Buffer
+	require.NoError(t, NewProtojsonEncoderWithOptions(&buf, JSONOptions{Flatten: true}).Encode(ev))
+	var obj map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &obj))
+	for k, v := range obj {
+		_, nested := v.(map[string]any)
+		assert.False(t, nested, k)
+	}
+	assert.Equal(t, "tetragon", obj["process.pod.pod_labels.app"])
+	assert.Equal(t, "eu-west-1a", obj["node_labels.zone"])
+}
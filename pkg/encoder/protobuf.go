@@ -0,0 +1,32 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package encoder
+
+import (
+	"io"
+
+	"google.golang.org/protobuf/encoding/protodelim"
+
+	"github.com/cilium/tetragon/api/v1/tetragon"
+)
+
+// ProtobufEncoder writes events as size-delimited protobuf messages, the
+// format read by protodelim and by parseDelimitedFrom in Java.
+type ProtobufEncoder struct {
+	w io.Writer
+}
+
+func NewProtobufEncoder(w io.Writer) *ProtobufEncoder {
+	return &ProtobufEncoder{w: w}
+}
+
+// Encode implements EventEncoder.Encode.
+func (p *ProtobufEncoder) Encode(v interface{}) error {
+	event, ok := v.(*tetragon.GetEventsResponse)
+	if !ok {
+		return ErrInvalidEvent
+	}
+	_, err := protodelim.MarshalTo(p.w, event)
+	return err
+}
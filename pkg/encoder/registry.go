@@ -0,0 +1,84 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package encoder
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Names of the built-in formats.
+const (
+	FormatJSON     = "json"
+	FormatCBOR     = "cbor"
+	FormatProtobuf = "protobuf"
+	FormatCompact  = "compact"
+)
+
+// Options are the options of the encoders created by an EventEncoderFactory.
+// Formats ignore the options that do not apply to them.
+type Options struct {
+	// Labels are added to every event, such as under "labels" in CBOR.
+	Labels map[string]string
+	// JSON sets how events are encoded in JSON.
+	JSON JSONOptions
+}
+
+// EventEncoderFactory returns an encoder writing events to w.
+type EventEncoderFactory func(w io.Writer, opts Options) (EventEncoder, error)
+
+var registeredFormats = map[string]EventEncoderFactory{}
+
+// RegisterEncoderAtInit registers a factory for a format, so that the format
+// can be selected by name, such as in the "format" option of exporters or in
+// tetra convert --to.
+//
+// This function is meant to be called in an init() by format
+// implementations. Builds adding formats blank-import the packages
+// registering them.
+func RegisterEncoderAtInit(name string, f EventEncoderFactory) {
+	if _, exists := registeredFormats[name]; exists {
+		panic(fmt.Sprintf("RegisterEncoderAtInit called, but %s is already registered", name))
+	}
+	registeredFormats[name] = f
+}
+
+// Formats returns the sorted list of registered formats.
+func Formats() []string {
+	return slices.Sorted(maps.Keys(registeredFormats))
+}
+
+// IsFormat returns whether a format is registered under name.
+func IsFormat(name string) bool {
+	_, ok := registeredFormats[name]
+	return ok
+}
+
+// NewEncoder returns the encoder of the format registered under name,
+// writing events to w.
+func NewEncoder(name string, w io.Writer, opts Options) (EventEncoder, error) {
+	f, ok := registeredFormats[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown format %q: must be one of %s", name, strings.Join(Formats(), ", "))
+	}
+	return f(w, opts)
+}
+
+func init() {
+	RegisterEncoderAtInit(FormatJSON, func(w io.Writer, opts Options) (EventEncoder, error) {
+		return NewProtojsonEncoderWithOptions(w, opts.JSON), nil
+	})
+	RegisterEncoderAtInit(FormatCBOR, func(w io.Writer, opts Options) (EventEncoder, error) {
+		return NewCBOREncoder(w, opts.Labels), nil
+	})
+	RegisterEncoderAtInit(FormatProtobuf, func(w io.Writer, _ Options) (EventEncoder, error) {
+		return NewProtobufEncoder(w), nil
+	})
+	RegisterEncoderAtInit(FormatCompact, func(w io.Writer, _ Options) (EventEncoder, error) {
+		return NewCompactEncoder(w, Never, true, false, false), nil
+	})
+}
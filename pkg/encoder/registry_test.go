@@ -0,0 +1,57 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package encoder
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cilium/tetragon/api/v1/tetragon"
+)
+
+// binaryEncoder writes the binary of each event on its own line.
+type binaryEncoder struct {
+	w io.Writer
+}
+
+func (e *binaryEncoder) Encode(v interface{}) error {
+	event, ok := v.(*tetragon.GetEventsResponse)
+	if !ok {
+		return ErrInvalidEvent
+	}
+	_, err := fmt.Fprintln(e.w, event.GetProcessExec().GetProcess().GetBinary())
+	return err
+}
+
+func TestRegisterEncoderAtInit(t *testing.T) {
+	assert.Equal(t, []string{FormatCBOR, FormatCompact, FormatJSON, FormatProtobuf}, Formats())
+
+	RegisterEncoderAtInit("binary", func(w io.Writer, _ Options) (EventEncoder, error) {
+		return &binaryEncoder{w: w}, nil
+	})
+	t.Cleanup(func() { delete(registeredFormats, "binary") })
+	assert.True(t, IsFormat("binary"))
+	assert.Contains(t, Formats(), "binary")
+	assert.Panics(t, func() {
+		RegisterEncoderAtInit("binary", func(w io.Writer, _ Options) (EventEncoder, error) { return nil, nil })
+	})
+
+	var buf bytes.Buffer
+	enc, err := NewEncoder("binary", &buf, Options{})
+	require.NoError(t, err)
+	require.NoError(t, enc.Encode(&tetragon.GetEventsResponse{
+		Event: &tetragon.GetEventsResponse_ProcessExec{ProcessExec: &tetragon.ProcessExec{
+			Process: &tetragon.Process{Binary: "/bin/true"},
+		}},
+	}))
+	assert.Equal(t, "/bin/true\n", buf.String())
+
+	_, err = NewEncoder("ecs", &buf, Options{})
+	require.ErrorContains(t, err, `unknown format "ecs"`)
+}
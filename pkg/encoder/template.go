@@ -0,0 +1,173 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package encoder
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"github.com/cilium/tetragon/api/v1/tetragon"
+)
+
+// DefaultTemplate is the key of the template used for event types that have
+// no template of their own.
+const DefaultTemplate = "default"
+
+// TemplateEncoder writes one line per event, formatted with a Go
+// text/template chosen by event type. Templates are executed on the event as
+// it is exported in JSON, so that fields are referenced by their JSON name,
+// for example:
+//
+//	time={{.time}} binary={{.process_exec.process.binary}}
+//
+// Fields that may be missing, such as the pod of a process, are read with
+// get, which does not fail on missing fields:
+//
+//	pod={{get . "process_exec.process.pod.name" | default "-"}}
+//
+// Events whose type has no template, and no default template is set, are
+// skipped.
+type TemplateEncoder struct {
+	w         io.Writer
+	templates map[tetragon.EventType]*template.Template
+	def       *template.Template
+}
+
+var templateFuncs = template.FuncMap{
+	// get returns the field at a dot-separated path of v, or nil if it is
+	// missing.
+	"get": func(v any, path string) any {
+		for _, name := range strings.Split(path, ".") {
+			m, ok := v.(map[string]any)
+			if !ok {
+				return nil
+			}
+			v = m[name]
+		}
+		return v
+	},
+	// json returns the JSON encoding of a value, for example to export a
+	// nested object as a single field.
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	// quote returns a double-quoted Go string literal.
+	"quote": func(v any) string {
+		return strconv.Quote(toString(v))
+	},
+	// csv returns its arguments as a CSV record, quoting them as needed.
+	"csv": func(v ...any) (string, error) {
+		record := make([]string, len(v))
+		for i := range v {
+			record[i] = toString(v[i])
+		}
+		var b strings.Builder
+		w := csv.NewWriter(&b)
+		if err := w.Write(record); err != nil {
+			return "", err
+		}
+		w.Flush()
+		return strings.TrimSuffix(b.String(), "\n"), w.Error()
+	},
+	// join joins the elements of a list with sep.
+	"join": func(sep string, v any) string {
+		list, _ := v.([]any)
+		elems := make([]string, len(list))
+		for i := range list {
+			elems[i] = toString(list[i])
+		}
+		return strings.Join(elems, sep)
+	},
+	// default returns def if v is missing or empty.
+	"default": func(def string, v any) string {
+		if s := toString(v); s != "" {
+			return s
+		}
+		return def
+	},
+}
+
+// toString formats a JSON value as it would be printed by a template, but
+// with an empty string for missing values.
+func toString(v any) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// NewTemplateEncoder returns a TemplateEncoder writing to w. The keys of
+// templates are event types, such as "PROCESS_EXEC", or DefaultTemplate.
+// Keys are case insensitive.
+func NewTemplateEncoder(w io.Writer, templates map[string]string) (*TemplateEncoder, error) {
+	if len(templates) == 0 {
+		return nil, errors.New("no templates")
+	}
+	e := &TemplateEncoder{
+		w:         w,
+		templates: make(map[tetragon.EventType]*template.Template),
+	}
+	for key, text := range templates {
+		name := strings.ToUpper(key)
+		t, err := template.New(name).Funcs(templateFuncs).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template %q: %w", key, err)
+		}
+		if strings.EqualFold(key, DefaultTemplate) {
+			e.def = t
+			continue
+		}
+		typ, ok := tetragon.EventType_value[name]
+		if !ok || tetragon.EventType(typ) == tetragon.EventType_UNDEF {
+			return nil, fmt.Errorf("invalid template %q: unknown event type", key)
+		}
+		e.templates[tetragon.EventType(typ)] = t
+	}
+	return e, nil
+}
+
+// Encode implements EventEncoder.Encode.
+func (e *TemplateEncoder) Encode(v interface{}) error {
+	event, ok := v.(*tetragon.GetEventsResponse)
+	if !ok {
+		return ErrInvalidEvent
+	}
+	t, ok := e.templates[event.EventType()]
+	if !ok {
+		if t = e.def; t == nil {
+			return nil
+		}
+	}
+	b, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(event)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	// Keep numbers as they are exported, large integers would lose
+	// precision as floats.
+	dec.UseNumber()
+	var data map[string]any
+	if err := dec.Decode(&data); err != nil {
+		return err
+	}
+	var out bytes.Buffer
+	if err := t.Execute(&out, data); err != nil {
+		return fmt.Errorf("failed to execute template %q: %w", t.Name(), err)
+	}
+	if out.Len() == 0 || out.Bytes()[out.Len()-1] != '\n' {
+		out.WriteByte('\n')
+	}
+	_, err = e.w.Write(out.Bytes())
+	return err
+}
@@ -0,0 +1,70 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package encoder
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/cilium/tetragon/api/v1/tetragon"
+)
+
+func TestTemplateEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	enc, err := NewTemplateEncoder(&buf, map[string]string{
+		"process_exec": `exec binary={{.process_exec.process.binary}} pid={{.process_exec.process.pid}} pod={{get . "process_exec.process.pod.name" | default "-"}}`,
+		"PROCESS_EXIT": `{{csv .node_name .process_exit.process.binary .process_exit.process.arguments}}`,
+	})
+	require.NoError(t, err)
+
+	events := []*tetragon.GetEventsResponse{{
+		Event: &tetragon.GetEventsResponse_ProcessExec{ProcessExec: &tetragon.ProcessExec{
+			Process: &tetragon.Process{Binary: "/usr/bin/curl", Pid: wrapperspb.UInt32(1234)},
+		}},
+	}, {
+		Event: &tetragon.GetEventsResponse_ProcessExit{ProcessExit: &tetragon.ProcessExit{
+			Process: &tetragon.Process{Binary: "/bin/sh", Arguments: `-c "echo a,b"`},
+		}},
+		NodeName: "node1",
+	}, {
+		// no template for kprobes, and no default template
+		Event: &tetragon.GetEventsResponse_ProcessKprobe{ProcessKprobe: &tetragon.ProcessKprobe{}},
+	}}
+	for _, ev := range events {
+		require.NoError(t, enc.Encode(ev))
+	}
+	assert.Equal(t, `exec binary=/usr/bin/curl pid=1234 pod=-
+node1,/bin/sh,"-c ""echo a,b"""
+`, buf.String())
+
+	buf.Reset()
+	enc, err = NewTemplateEncoder(&buf, map[string]string{
+		DefaultTemplate: "{{.node_name}} {{json .process_kprobe.process}}\n",
+	})
+	require.NoError(t, err)
+	require.NoError(t, enc.Encode(&tetragon.GetEventsResponse{
+		Event: &tetragon.GetEventsResponse_ProcessKprobe{ProcessKprobe: &tetragon.ProcessKprobe{
+			Process: &tetragon.Process{Binary: "/bin/cat"},
+		}},
+		NodeName: "node2",
+	}))
+	assert.Equal(t, "node2 {\"binary\":\"/bin/cat\"}\n", buf.String())
+}
+
+func TestNewTemplateEncoder_Invalid(t *testing.T) {
+	for _, templates := range []map[string]string{
+		nil,
+		{"PROCESS_EXEC": "{{.process_exec"},
+		{"PROCESS_FOO": "{{.time}}"},
+		{"UNDEF": "{{.time}}"},
+	} {
+		_, err := NewTemplateEncoder(io.Discard, templates)
+		require.Error(t, err, templates)
+	}
+}
@@ -0,0 +1,113 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package exporter
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/cilium/tetragon/pkg/option"
+	"github.com/cilium/tetragon/pkg/ratelimit"
+)
+
+// bandwidth limits the bytes sent by all network exporters together to
+// --export-max-bytes-per-second, or to the limit of the current window of
+// --export-limit-schedule.
+var bandwidth struct {
+	mu sync.Mutex
+	// maxBytesPerSecond and schedule are set by setBandwidthLimits, so
+	// that running exporters do not read the export options, which change
+	// when they are reloaded.
+	maxBytesPerSecond int
+	schedule          *ratelimit.Schedule
+	limit             int
+	limiter           *rate.Limiter
+}
+
+// setBandwidthLimits sets the limits applied by WaitBandwidth: the number of
+// bytes per second outside of the windows of schedule, 0 meaning no limit.
+func setBandwidthLimits(maxBytesPerSecond int, schedule *ratelimit.Schedule) {
+	bandwidth.mu.Lock()
+	defer bandwidth.mu.Unlock()
+	bandwidth.maxBytesPerSecond = maxBytesPerSecond
+	bandwidth.schedule = schedule
+}
+
+// bandwidthLimiter returns the limiter of the bytes sent by exporters, or nil
+// if they are not limited. The burst is a second of traffic.
+func bandwidthLimiter() *rate.Limiter {
+	bandwidth.mu.Lock()
+	defer bandwidth.mu.Unlock()
+	limit := bandwidth.schedule.LimitsAt(time.Now(), ratelimit.Limits{MaxBytesPerSecond: bandwidth.maxBytesPerSecond}).MaxBytesPerSecond
+	if limit == bandwidth.limit {
+		return bandwidth.limiter
+	}
+	bandwidth.limit = limit
+	switch {
+	case limit <= 0:
+		bandwidth.limiter = nil
+	case bandwidth.limiter == nil:
+		bandwidth.limiter = rate.NewLimiter(rate.Limit(limit), limit)
+	default:
+		// Keep the tokens already used when the schedule changes the
+		// limit.
+		bandwidth.limiter.SetLimit(rate.Limit(limit))
+		bandwidth.limiter.SetBurst(limit)
+	}
+	return bandwidth.limiter
+}
+
+// scheduleCache caches the parsed --export-limit-schedule.
+var scheduleCache struct {
+	mu       sync.Mutex
+	value    string
+	parsed   bool
+	schedule *ratelimit.Schedule
+	err      error
+}
+
+// limitSchedule returns the schedule of --export-limit-schedule, or nil if
+// it is not set.
+func limitSchedule() (*ratelimit.Schedule, error) {
+	value := option.Config.ExportLimitSchedule
+	scheduleCache.mu.Lock()
+	defer scheduleCache.mu.Unlock()
+	if !scheduleCache.parsed || value != scheduleCache.value {
+		scheduleCache.value = value
+		scheduleCache.parsed = true
+		scheduleCache.schedule, scheduleCache.err = ratelimit.ParseSchedule(value)
+	}
+	return scheduleCache.schedule, scheduleCache.err
+}
+
+// WaitBandwidth waits until n bytes can be sent without exceeding
+// --export-max-bytes-per-second. Exporters call it before sending each batch,
+// request or datagram, with the number of bytes sent on the network, so that
+// batches are delayed as a whole rather than split. Events keep being
+// buffered meanwhile, and are dropped once the queue of the exporter is
+// full. It returns the error of ctx if ctx is done before the bytes can be
+// sent.
+func WaitBandwidth(ctx context.Context, n int) error {
+	limiter := bandwidthLimiter()
+	if limiter == nil || n <= 0 {
+		return nil
+	}
+	start := time.Now()
+	defer func() {
+		bandwidthWaitSeconds.Add(time.Since(start).Seconds())
+	}()
+	// WaitN fails for more than the burst: wait for larger sends a burst at
+	// a time.
+	for n > 0 {
+		c := min(n, limiter.Burst())
+		if err := limiter.WaitN(ctx, c); err != nil {
+			return err
+		}
+		n -= c
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package exporter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cilium/tetragon/pkg/option"
+)
+
+func TestWaitBandwidth(t *testing.T) {
+	defer setBandwidthLimits(0, nil)
+
+	setBandwidthLimits(0, nil)
+	start := time.Now()
+	require.NoError(t, WaitBandwidth(context.Background(), 1<<30))
+	assert.Less(t, time.Since(start), time.Second, "no limit")
+
+	setBandwidthLimits(10000, nil)
+	start = time.Now()
+	// The burst is a second of traffic, then sends are delayed, including
+	// sends larger than the burst.
+	require.NoError(t, WaitBandwidth(context.Background(), 10000))
+	require.NoError(t, WaitBandwidth(context.Background(), 15000))
+	elapsed := time.Since(start)
+	assert.GreaterOrEqual(t, elapsed, 1400*time.Millisecond)
+	assert.Less(t, elapsed, 5*time.Second)
+
+	// Waits end when the context is cancelled.
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start = time.Now()
+	require.ErrorIs(t, WaitBandwidth(ctx, 50000), context.Canceled)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestBandwidthLimiter_Schedule(t *testing.T) {
+	defer func(schedule string) {
+		option.Config.ExportLimitSchedule = schedule
+		setBandwidthLimits(0, nil)
+	}(option.Config.ExportLimitSchedule)
+
+	option.Config.ExportLimitSchedule = "00:00-24:00 max-bytes-per-second=1000"
+	schedule, err := limitSchedule()
+	require.NoError(t, err)
+	setBandwidthLimits(0, schedule)
+	limiter := bandwidthLimiter()
+	require.NotNil(t, limiter)
+	assert.InDelta(t, 1000.0, float64(limiter.Limit()), 0)
+
+	option.Config.ExportLimitSchedule = "00:00-24:00 rate-limit=10"
+	schedule, err = limitSchedule()
+	require.NoError(t, err)
+	setBandwidthLimits(0, schedule)
+	assert.Nil(t, bandwidthLimiter(), "the window does not limit the bandwidth")
+
+	option.Config.ExportLimitSchedule = "00:00-24:00"
+	_, err = limitSchedule()
+	require.Error(t, err)
+}
@@ -0,0 +1,276 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cilium/tetragon/pkg/logger"
+	"github.com/cilium/tetragon/pkg/logger/logfields"
+	"github.com/cilium/tetragon/pkg/metrics"
+	"github.com/cilium/tetragon/pkg/metrics/consts"
+)
+
+const (
+	// maxPendingBatches is the number of full batches that can wait for
+	// the sender of a Batcher before new batches are dropped.
+	maxPendingBatches = 16
+	// BatchCloseTimeout is how long Batcher.Close waits for pending batches
+	// to be sent before giving up on them.
+	BatchCloseTimeout = 10 * time.Second
+)
+
+// Statuses of the batches, or of their events, counted by batching
+// exporters, see NewBatchCounter.
+const (
+	BatchSent    = "sent"
+	BatchFailed  = "failed"
+	BatchDropped = "dropped"
+)
+
+// NewBatchCounter returns a counter of the batches, or of the events, handled
+// by a batching exporter, by status.
+func NewBatchCounter(subsystem, name, help string) *metrics.Counter {
+	return metrics.MustNewCounter(metrics.NewOpts(
+		consts.MetricsNamespace, subsystem, name, help,
+		nil, []metrics.ConstrainedLabel{{
+			Name:   "status",
+			Values: []string{BatchSent, BatchFailed, BatchDropped},
+		}}, nil,
+	), nil)
+}
+
+// BatcherOptions configure a Batcher.
+type BatcherOptions struct {
+	// Name is the type of the exporter, used in logs and errors.
+	Name string
+	// Destination is the address or URL of the destination, used in logs.
+	Destination string
+	// BatchSize, if positive, is the number of events above which a batch
+	// is sent without waiting for the flush interval.
+	BatchSize int
+	// FlushInterval is the maximum time an event is buffered before a
+	// partial batch is sent.
+	FlushInterval time.Duration
+	// Counter, if not nil, counts the batches by status, or their events
+	// if CountEvents is set.
+	Counter     *metrics.Counter
+	CountEvents bool
+	// DeadLetter, if not nil, receives the events of the batches that were
+	// dropped or could not be sent. It is closed by Close.
+	DeadLetter *DeadLetter
+}
+
+type pendingBatch[B any] struct {
+	batch  B
+	events int
+	// lines are the events as exported in JSON, for the dead-letter file.
+	lines []byte
+}
+
+// Batcher buffers the events of an exporter into batches of type B, and
+// sends them from a separate goroutine, so that a slow or unreachable
+// destination does not block event export. If the destination cannot keep
+// up, batches are dropped. It implements SendReporter.
+type Batcher[B any] struct {
+	opts BatcherOptions
+	send func(ctx context.Context, batch B) error
+	// ctx is cancelled when Close gives up on the pending batches. It
+	// interrupts sends and retries.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// closeTimeout is how long Close waits for the pending batches.
+	closeTimeout time.Duration
+
+	mu     sync.Mutex
+	batch  B
+	events int
+	lines  []byte
+	closed bool
+
+	batches chan pendingBatch[B]
+	done    chan struct{}
+	// onSend, if set, is called with the result of every batch.
+	onSend atomic.Pointer[func(error)]
+}
+
+// NewBatcher returns a Batcher that sends batches with send until it is
+// closed. Sends are not cancelled when ctx is done, since exporters are
+// closed after their context is cancelled: Close still sends the pending
+// batches, and only cancels them after BatchCloseTimeout.
+func NewBatcher[B any](ctx context.Context, opts BatcherOptions, send func(ctx context.Context, batch B) error) *Batcher[B] {
+	b := &Batcher[B]{
+		opts:         opts,
+		send:         send,
+		closeTimeout: BatchCloseTimeout,
+		batches:      make(chan pendingBatch[B], maxPendingBatches),
+		done:         make(chan struct{}),
+	}
+	b.ctx, b.cancel = context.WithCancel(context.WithoutCancel(ctx))
+	go b.run()
+	return b
+}
+
+// Add calls add with the current batch, under the lock of the batcher. add
+// adds events to the batch, and returns them as exported in JSON, one per
+// line, and whether the batch is full.
+func (b *Batcher[B]) Add(add func(batch *B) (lines []byte, full bool, err error)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return fmt.Errorf("%s exporter is closed", b.opts.Name)
+	}
+	lines, full, err := add(&b.batch)
+	if err != nil {
+		return err
+	}
+	for line := range bytes.Lines(lines) {
+		b.events++
+		if b.opts.DeadLetter != nil {
+			b.lines = append(b.lines, line...)
+			if !bytes.HasSuffix(line, []byte{'\n'}) {
+				b.lines = append(b.lines, '\n')
+			}
+		}
+	}
+	if full || (b.opts.BatchSize > 0 && b.events >= b.opts.BatchSize) {
+		b.enqueueLocked()
+	}
+	return nil
+}
+
+// Close sends any buffered events and waits for pending batches to be sent,
+// for up to BatchCloseTimeout. Batches that are not sent by then fail.
+func (b *Batcher[B]) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	b.enqueueLocked()
+	close(b.batches)
+	b.mu.Unlock()
+	timer := time.NewTimer(b.closeTimeout)
+	defer timer.Stop()
+	select {
+	case <-b.done:
+	case <-timer.C:
+		logger.GetLogger().Warn("Timed out sending pending batches", "exporter", b.opts.Name, "destination", b.opts.Destination)
+		b.cancel()
+		<-b.done
+	}
+	b.cancel()
+	return b.opts.DeadLetter.Close()
+}
+
+// enqueueLocked hands the current batch to the sender. Must be called with
+// b.mu held.
+func (b *Batcher[B]) enqueueLocked() {
+	if b.events == 0 {
+		return
+	}
+	p := pendingBatch[B]{batch: b.batch, events: b.events, lines: b.lines}
+	var zero B
+	b.batch, b.events, b.lines = zero, 0, nil
+	select {
+	case b.batches <- p:
+	default:
+		b.count(BatchDropped, p)
+		b.reportSend(ErrQueueFull)
+		b.deadLetter(p, ErrQueueFull)
+		logger.GetLogger().Warn("Export queue is full, dropping batch", "exporter", b.opts.Name, "events", p.events)
+	}
+}
+
+// SetSendResultFunc implements SendReporter.
+func (b *Batcher[B]) SetSendResultFunc(f func(err error)) {
+	b.onSend.Store(&f)
+}
+
+func (b *Batcher[B]) reportSend(err error) {
+	if f := b.onSend.Load(); f != nil {
+		(*f)(err)
+	}
+}
+
+func (b *Batcher[B]) count(status string, p pendingBatch[B]) {
+	if b.opts.Counter == nil {
+		return
+	}
+	n := 1
+	if b.opts.CountEvents {
+		n = p.events
+	}
+	b.opts.Counter.WithLabelValues(status).Add(float64(n))
+}
+
+func (b *Batcher[B]) deadLetter(p pendingBatch[B], err error) {
+	if b.opts.DeadLetter != nil {
+		b.opts.DeadLetter.Write(p.lines, err)
+	}
+}
+
+func (b *Batcher[B]) run() {
+	defer close(b.done)
+	ticker := time.NewTicker(b.opts.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case p, ok := <-b.batches:
+			if !ok {
+				return
+			}
+			b.sendBatch(p)
+		case <-ticker.C:
+			b.mu.Lock()
+			if !b.closed {
+				b.enqueueLocked()
+			}
+			b.mu.Unlock()
+		}
+	}
+}
+
+func (b *Batcher[B]) sendBatch(p pendingBatch[B]) {
+	if err := b.send(b.ctx, p.batch); err != nil {
+		b.count(BatchFailed, p)
+		b.reportSend(err)
+		b.deadLetter(p, err)
+		logger.GetLogger().Warn("Failed to send events", "exporter", b.opts.Name, "destination", b.opts.Destination, "events", p.events, logfields.Error, err)
+		return
+	}
+	b.count(BatchSent, p)
+	b.reportSend(nil)
+}
+
+// Retry calls attempt until it succeeds or returns that it may not be
+// retried, up to maxRetries more times. It waits for backoff before the first
+// retry, doubling it on every subsequent one, and stops waiting once ctx is
+// done. It returns the error of the last attempt.
+func Retry(ctx context.Context, maxRetries int, backoff time.Duration, attempt func(n int) (retry bool, err error)) error {
+	var err error
+	for n := 0; n <= maxRetries; n++ {
+		if n > 0 {
+			timer := time.NewTimer(backoff)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			}
+			backoff *= 2
+		}
+		var retry bool
+		if retry, err = attempt(n); err == nil || !retry {
+			return err
+		}
+	}
+	return err
+}
@@ -0,0 +1,165 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package exporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cilium/tetragon/pkg/option"
+)
+
+var testBatchesTotal = NewBatchCounter("export_test", "batches_total", "Test batches.")
+
+func addLine(b *Batcher[[]string], line string) error {
+	return b.Add(func(batch *[]string) ([]byte, bool, error) {
+		*batch = append(*batch, line)
+		return []byte(line + "\n"), false, nil
+	})
+}
+
+func TestBatcher(t *testing.T) {
+	var mu sync.Mutex
+	var sent [][]string
+	b := NewBatcher(context.Background(), BatcherOptions{
+		Name:          "test",
+		BatchSize:     2,
+		FlushInterval: time.Hour,
+	}, func(_ context.Context, batch []string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		sent = append(sent, batch)
+		return nil
+	})
+	var results []error
+	b.SetSendResultFunc(func(err error) { results = append(results, err) })
+	for i := range 3 {
+		require.NoError(t, addLine(b, fmt.Sprint(i)))
+	}
+	require.NoError(t, b.Close())
+	require.Error(t, addLine(b, "closed"))
+
+	assert.Equal(t, [][]string{{"0", "1"}, {"2"}}, sent)
+	assert.Equal(t, []error{nil, nil}, results)
+}
+
+func TestBatcher_DeadLetter(t *testing.T) {
+	defer func(file string, size int) {
+		option.Config.ExportDeadLetterFile, option.Config.ExportDeadLetterMaxSizeMB = file, size
+	}(option.Config.ExportDeadLetterFile, option.Config.ExportDeadLetterMaxSizeMB)
+	file := filepath.Join(t.TempDir(), "dead-letter.json")
+	option.Config.ExportDeadLetterFile, option.Config.ExportDeadLetterMaxSizeMB = file, 1
+	deadLetter, err := OpenDeadLetter("batcher-test")
+	require.NoError(t, err)
+
+	// The sender is blocked on the first batch, so that the queue fills up.
+	sending := make(chan struct{}, 1)
+	release := make(chan struct{})
+	b := NewBatcher(context.Background(), BatcherOptions{
+		Name:          "test",
+		BatchSize:     1,
+		FlushInterval: time.Hour,
+		Counter:       testBatchesTotal,
+		DeadLetter:    deadLetter,
+	}, func(_ context.Context, _ []string) error {
+		select {
+		case sending <- struct{}{}:
+		default:
+		}
+		<-release
+		return errors.New("unreachable")
+	})
+	dropped := testutil.ToFloat64(testBatchesTotal.WithLabelValues(BatchDropped))
+	failed := testutil.ToFloat64(testBatchesTotal.WithLabelValues(BatchFailed))
+	require.NoError(t, addLine(b, `{"event":0}`))
+	<-sending
+	for i := range maxPendingBatches + 1 {
+		require.NoError(t, addLine(b, fmt.Sprintf(`{"event":%d}`, i+1)))
+	}
+	close(release)
+	require.NoError(t, b.Close())
+
+	assert.InDelta(t, dropped+1, testutil.ToFloat64(testBatchesTotal.WithLabelValues(BatchDropped)), 0)
+	assert.InDelta(t, failed+maxPendingBatches+1, testutil.ToFloat64(testBatchesTotal.WithLabelValues(BatchFailed)), 0)
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Len(t, lines, maxPendingBatches+2)
+	assert.Contains(t, strings.Join(lines, "\n"), ErrQueueFull.Error())
+}
+
+func TestBatcher_CloseAfterCancel(t *testing.T) {
+	// Exporters are closed after their context is cancelled: the batches
+	// still buffered are sent nonetheless.
+	ctx, cancel := context.WithCancel(context.Background())
+	var sent []string
+	b := NewBatcher(ctx, BatcherOptions{Name: "test", BatchSize: 2, FlushInterval: time.Hour},
+		func(ctx context.Context, batch []string) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			sent = append(sent, batch...)
+			return nil
+		})
+	var results []error
+	b.SetSendResultFunc(func(err error) { results = append(results, err) })
+	for _, line := range []string{"a", "b", "c"} {
+		require.NoError(t, addLine(b, line))
+	}
+	cancel()
+	require.NoError(t, b.Close())
+	assert.Equal(t, []string{"a", "b", "c"}, sent)
+	assert.Equal(t, []error{nil, nil}, results)
+}
+
+func TestBatcher_CloseTimeout(t *testing.T) {
+	b := NewBatcher(context.Background(), BatcherOptions{Name: "test", BatchSize: 1, FlushInterval: time.Hour},
+		func(ctx context.Context, _ []string) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+	b.closeTimeout = 10 * time.Millisecond
+	var results []error
+	b.SetSendResultFunc(func(err error) { results = append(results, err) })
+	require.NoError(t, addLine(b, "a"))
+	require.NoError(t, b.Close())
+	assert.Equal(t, []error{context.Canceled}, results)
+}
+
+func TestRetry(t *testing.T) {
+	errFailed := errors.New("failed")
+	attempts := 0
+	err := Retry(context.Background(), 3, time.Millisecond, func(int) (bool, error) {
+		attempts++
+		return true, errFailed
+	})
+	require.ErrorIs(t, err, errFailed)
+	assert.Equal(t, 4, attempts)
+
+	attempts = 0
+	err = Retry(context.Background(), 3, time.Millisecond, func(int) (bool, error) {
+		attempts++
+		return false, errFailed
+	})
+	require.ErrorIs(t, err, errFailed)
+	assert.Equal(t, 1, attempts)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = Retry(ctx, 3, time.Hour, func(int) (bool, error) {
+		return true, errFailed
+	})
+	require.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,170 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package exporter
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/cilium/tetragon/api/v1/tetragon"
+	"github.com/cilium/tetragon/pkg/encoder"
+	pkgEvent "github.com/cilium/tetragon/pkg/event"
+	"github.com/cilium/tetragon/pkg/filters"
+	"github.com/cilium/tetragon/pkg/ratelimit"
+)
+
+// The benchmarks of this file cover the whole export path of an event, as
+// done by server.GetEventsWG and Exporter.Send: filters, stages, rate limit,
+// encoding and write to the output. Use contrib/exporter-bench to compare
+// them against a recorded baseline.
+
+func benchEvent() *tetragon.GetEventsResponse {
+	return &tetragon.GetEventsResponse{
+		Event: &tetragon.GetEventsResponse_ProcessKprobe{
+			ProcessKprobe: &tetragon.ProcessKprobe{
+				Process: &tetragon.Process{
+					ExecId:    "bm9kZTE6MTIzNDU2Nzg5MDoxMjM0",
+					Pid:       wrapperspb.UInt32(1234),
+					Uid:       wrapperspb.UInt32(0),
+					Cwd:       "/",
+					Binary:    "/usr/bin/curl",
+					Arguments: "-s https://cilium.io",
+					Pod:       &tetragon.Pod{Namespace: "kube-system", Name: "tetragon-x7k2p"},
+				},
+				FunctionName: "security_file_permission",
+				Args: []*tetragon.KprobeArgument{
+					{Arg: &tetragon.KprobeArgument_FileArg{FileArg: &tetragon.KprobeFile{Path: "/etc/passwd"}}},
+					{Arg: &tetragon.KprobeArgument_IntArg{IntArg: 4}},
+				},
+				PolicyName: "file-monitoring",
+			},
+		},
+		NodeName: "node1",
+		Time:     timestamppb.New(time.Unix(1700000000, 0)),
+	}
+}
+
+// benchPath runs events through the filters and the exporter, like
+// server.GetEventsWG does.
+type benchPath struct {
+	allow, deny filters.FilterFuncs
+	exporter    *Exporter
+}
+
+func newBenchPath(tb testing.TB, w io.Writer, rateLimiter *ratelimit.RateLimiter, stages ...Stage) *benchPath {
+	allow, err := filters.BuildFilterList(context.Background(), []*tetragon.Filter{{BinaryRegex: []string{"/usr/bin/.*"}}}, filters.Filters)
+	require.NoError(tb, err)
+	deny, err := filters.BuildFilterList(context.Background(), []*tetragon.Filter{{Namespace: []string{"default"}}}, filters.Filters)
+	require.NoError(tb, err)
+	exporter := NewExporter(context.Background(), &tetragon.GetEventsRequest{}, nil, encoder.NewProtojsonEncoder(w), nil, rateLimiter)
+	exporter.name = "bench"
+	exporter.SetStages(stages)
+	return &benchPath{allow: allow, deny: deny, exporter: exporter}
+}
+
+func (p *benchPath) send(event *tetragon.GetEventsResponse) {
+	if filters.Apply(p.allow, p.deny, &pkgEvent.Event{Event: event}) {
+		p.exporter.Send(event)
+	}
+}
+
+// udpWriter returns a connected UDP socket to a local listener that never
+// reads, so that datagrams are dropped by the kernel once its buffer is
+// full.
+func udpWriter(tb testing.TB) io.Writer {
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(tb, err)
+	tb.Cleanup(func() { l.Close() })
+	conn, err := net.Dial("udp", l.LocalAddr().String())
+	require.NoError(tb, err)
+	tb.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func BenchmarkExportPath(b *testing.B) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	exclude, err := newExcludeFieldsStage(map[string]string{"fields": "process.pod,process_kprobe.args"})
+	require.NoError(b, err)
+
+	for _, bc := range []struct {
+		name string
+		path func(b *testing.B) *benchPath
+	}{
+		{"discard", func(b *testing.B) *benchPath {
+			return newBenchPath(b, io.Discard, nil)
+		}},
+		{"ratelimit", func(b *testing.B) *benchPath {
+			// A limit high enough for all events to be exported.
+			return newBenchPath(b, io.Discard, ratelimit.NewRateLimiter(ctx, time.Second, 1<<30, nil))
+		}},
+		{"stages", func(b *testing.B) *benchPath {
+			return newBenchPath(b, io.Discard, nil, exclude)
+		}},
+		{"udp", func(b *testing.B) *benchPath {
+			return newBenchPath(b, udpWriter(b), nil)
+		}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			path := bc.path(b)
+			event := benchEvent()
+			b.ReportAllocs()
+			for b.Loop() {
+				path.send(event)
+			}
+		})
+	}
+}
+
+func BenchmarkExportPath_Filtered(b *testing.B) {
+	path := newBenchPath(b, io.Discard, nil)
+	event := benchEvent()
+	event.GetProcessKprobe().Process.Binary = "/bin/sh"
+	b.ReportAllocs()
+	for b.Loop() {
+		path.send(event)
+	}
+}
+
+// Allocation budgets of the export path, relative to marshalling the event
+// with protojson, which dominates and depends on the protobuf version.
+const (
+	// exportPathAllocBudget is the number of allocations the filters, the
+	// rate limiter and the encoder may add to the marshalling.
+	exportPathAllocBudget = 4
+	// filteredAllocBudget is the number of allocations of an event dropped
+	// by the filters.
+	filteredAllocBudget = 1
+)
+
+func TestExportPath_Allocs(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	event := benchEvent()
+	marshalAllocs := testing.AllocsPerRun(100, func() {
+		protojson.MarshalOptions{UseProtoNames: true}.Marshal(event)
+	})
+
+	path := newBenchPath(t, io.Discard, ratelimit.NewRateLimiter(ctx, time.Second, 1<<30, nil))
+	allocs := testing.AllocsPerRun(100, func() {
+		path.send(event)
+	})
+	assert.LessOrEqual(t, allocs, marshalAllocs+exportPathAllocBudget)
+
+	filtered := benchEvent()
+	filtered.GetProcessKprobe().Process.Binary = "/bin/sh"
+	allocs = testing.AllocsPerRun(100, func() {
+		path.send(filtered)
+	})
+	assert.LessOrEqual(t, allocs, float64(filteredAllocBudget))
+}
@@ -0,0 +1,240 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package exporter
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/cilium/tetragon/api/v1/tetragon"
+)
+
+// Actions of the size-budget stage on the events larger than their budget.
+const (
+	BudgetTruncate  = "truncate"
+	BudgetDrop      = "drop"
+	BudgetTombstone = "tombstone"
+)
+
+// budgetDefaultKey is the key of the budget of the event types without one.
+const budgetDefaultKey = "default"
+
+// maxTruncateRounds bounds the number of fields truncated in an event.
+const maxTruncateRounds = 16
+
+type sizeBudget struct {
+	maxSize int
+	action  string
+}
+
+// sizeBudgetStage limits the size of events, with a budget per event type.
+type sizeBudgetStage struct {
+	eventTypes map[tetragon.EventType]sizeBudget
+	def        *sizeBudget
+}
+
+// parseSizeBudget parses a budget such as "4096" or "4096:drop". The action
+// defaults to truncate.
+func parseSizeBudget(s string) (sizeBudget, error) {
+	size, action, _ := strings.Cut(s, ":")
+	maxSize, err := strconv.Atoi(strings.TrimSpace(size))
+	if err != nil || maxSize <= 0 {
+		return sizeBudget{}, fmt.Errorf("invalid size %q: must be a positive number of bytes", size)
+	}
+	switch action = strings.ToLower(strings.TrimSpace(action)); action {
+	case "":
+		action = BudgetTruncate
+	case BudgetTruncate, BudgetDrop, BudgetTombstone:
+	default:
+		return sizeBudget{}, fmt.Errorf("invalid action %q: must be %s, %s or %s", action, BudgetTruncate, BudgetDrop, BudgetTombstone)
+	}
+	return sizeBudget{maxSize: maxSize, action: action}, nil
+}
+
+// newSizeBudgetStage returns a stage limiting the size of events. Option keys
+// are event types, such as process_kprobe, or "default" for the other event
+// types, and values are a maximum size in bytes, optionally followed by the
+// action on larger events, such as "4096:drop".
+func newSizeBudgetStage(options map[string]string) (Stage, error) {
+	s := &sizeBudgetStage{eventTypes: make(map[tetragon.EventType]sizeBudget)}
+	for k, v := range options {
+		budget, err := parseSizeBudget(v)
+		if err != nil {
+			return nil, fmt.Errorf("budget of %q: %w", k, err)
+		}
+		if k == budgetDefaultKey {
+			s.def = &budget
+			continue
+		}
+		t, ok := tetragon.EventType_value[strings.ToUpper(k)]
+		if !ok {
+			return nil, fmt.Errorf("budget of %q: unknown event type", k)
+		}
+		s.eventTypes[tetragon.EventType(t)] = budget
+	}
+	if len(s.eventTypes) == 0 && s.def == nil {
+		return nil, errors.New("no budgets")
+	}
+	return s, nil
+}
+
+func (s *sizeBudgetStage) Process(event *tetragon.GetEventsResponse) *tetragon.GetEventsResponse {
+	budget, ok := s.eventTypes[event.EventType()]
+	if !ok {
+		if s.def == nil {
+			return event
+		}
+		budget = *s.def
+	}
+	if eventSize(event) <= budget.maxSize {
+		return event
+	}
+	if budget.action == BudgetTruncate {
+		if truncated := truncateEvent(event, budget.maxSize); truncated != nil {
+			oversizedEventsTotal.WithLabelValues(oversizedTruncated).Inc()
+			return truncated
+		}
+	}
+	if budget.action == BudgetTombstone {
+		oversizedEventsTotal.WithLabelValues(oversizedTombstoned).Inc()
+		return tombstone(event)
+	}
+	oversizedEventsTotal.WithLabelValues(oversizedDropped).Inc()
+	return nil
+}
+
+// eventSize returns the size of the JSON encoding of event, as written by
+// JSON exporters without labels.
+func eventSize(event *tetragon.GetEventsResponse) int {
+	b, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(event)
+	if err != nil {
+		return 0
+	}
+	return len(b)
+}
+
+// truncateEvent returns a copy of event with its longest strings and bytes
+// shortened until it fits in maxSize, or nil if it does not.
+func truncateEvent(event *tetragon.GetEventsResponse, maxSize int) *tetragon.GetEventsResponse {
+	event = proto.Clone(event).(*tetragon.GetEventsResponse)
+	for range maxTruncateRounds {
+		size := eventSize(event)
+		if size <= maxSize {
+			return event
+		}
+		f := longestField(event.ProtoReflect())
+		if f == nil || f.len == 0 {
+			return nil
+		}
+		excess := size - maxSize
+		if f.bytes {
+			// Bytes are base64 encoded, 4 characters for 3 bytes.
+			excess = (excess*3+3)/4 + 2
+		}
+		f.truncate(max(0, f.len-excess))
+	}
+	if eventSize(event) <= maxSize {
+		return event
+	}
+	return nil
+}
+
+// truncatable is a string or bytes value of a message.
+type truncatable struct {
+	len      int
+	bytes    bool
+	truncate func(n int)
+}
+
+// longestField returns the longest string or bytes value of m and of its
+// nested messages, including the items of lists.
+func longestField(m protoreflect.Message) *truncatable {
+	var longest *truncatable
+	consider := func(t *truncatable) {
+		if t != nil && (longest == nil || t.len > longest.len) {
+			longest = t
+		}
+	}
+	m.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case fd.IsMap():
+			// Map values, such as pod labels, are left as they are.
+		case fd.IsList():
+			list := m.Mutable(fd).List()
+			for i := range list.Len() {
+				if fd.Message() != nil {
+					consider(longestField(list.Get(i).Message()))
+					continue
+				}
+				consider(truncatableValue(fd, list.Get(i), func(v protoreflect.Value) { list.Set(i, v) }))
+			}
+		case fd.Message() != nil:
+			consider(longestField(m.Mutable(fd).Message()))
+		default:
+			consider(truncatableValue(fd, v, func(v protoreflect.Value) { m.Set(fd, v) }))
+		}
+		return true
+	})
+	return longest
+}
+
+func truncatableValue(fd protoreflect.FieldDescriptor, v protoreflect.Value, set func(protoreflect.Value)) *truncatable {
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		s := v.String()
+		return &truncatable{len: len(s), truncate: func(n int) {
+			// Do not cut a character.
+			for n > 0 && !utf8.RuneStart(s[n]) {
+				n--
+			}
+			set(protoreflect.ValueOfString(s[:n]))
+		}}
+	case protoreflect.BytesKind:
+		b := v.Bytes()
+		return &truncatable{len: len(b), bytes: true, truncate: func(n int) {
+			set(protoreflect.ValueOfBytes(b[:n:n]))
+		}}
+	}
+	return nil
+}
+
+// tombstone returns an event of the same type as event, with only the fields
+// identifying it: its time, node and cluster, the exec ID, PID and binary of
+// its process, and the tracing policy that generated it.
+func tombstone(event *tetragon.GetEventsResponse) *tetragon.GetEventsResponse {
+	t := &tetragon.GetEventsResponse{
+		NodeName:    event.NodeName,
+		Time:        event.Time,
+		ClusterName: event.ClusterName,
+	}
+	m := event.ProtoReflect()
+	fd := m.WhichOneof(m.Descriptor().Oneofs().ByName("event"))
+	if fd == nil {
+		return t
+	}
+	inner := m.Get(fd).Message()
+	out := inner.New()
+	fields := inner.Descriptor().Fields()
+	if pfd := fields.ByName("process"); pfd != nil && inner.Has(pfd) {
+		if p, ok := inner.Get(pfd).Message().Interface().(*tetragon.Process); ok {
+			out.Set(pfd, protoreflect.ValueOfMessage((&tetragon.Process{
+				ExecId: p.ExecId,
+				Pid:    p.Pid,
+				Binary: p.Binary,
+			}).ProtoReflect()))
+		}
+	}
+	if pfd := fields.ByName("policy_name"); pfd != nil && inner.Has(pfd) {
+		out.Set(pfd, inner.Get(pfd))
+	}
+	t.ProtoReflect().Set(fd, protoreflect.ValueOfMessage(out))
+	return t
+}
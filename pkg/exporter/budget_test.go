@@ -0,0 +1,91 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package exporter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/cilium/tetragon/api/v1/tetragon"
+)
+
+func kprobeEvent(arg []byte) *tetragon.GetEventsResponse {
+	return &tetragon.GetEventsResponse{
+		Event: &tetragon.GetEventsResponse_ProcessKprobe{ProcessKprobe: &tetragon.ProcessKprobe{
+			Process: &tetragon.Process{
+				ExecId:    "bm9kZTE6MTIzOjQ1Ng==",
+				Pid:       wrapperspb.UInt32(456),
+				Binary:    "/usr/bin/cat",
+				Arguments: strings.Repeat("a", 200),
+			},
+			FunctionName: "fd_install",
+			PolicyName:   "files",
+			Args:         []*tetragon.KprobeArgument{{Arg: &tetragon.KprobeArgument_BytesArg{BytesArg: arg}}},
+		}},
+		NodeName: "node1",
+	}
+}
+
+func TestSizeBudgetStage(t *testing.T) {
+	stage, err := newSizeBudgetStage(map[string]string{
+		"process_kprobe": "600",
+		"process_exit":   "10:drop",
+		"default":        "20:tombstone",
+	})
+	require.NoError(t, err)
+
+	small := kprobeEvent([]byte("data"))
+	assert.Same(t, small, stage.Process(small))
+
+	large := kprobeEvent([]byte(strings.Repeat("x", 4096)))
+	truncated := stage.Process(large)
+	require.NotNil(t, truncated)
+	assert.LessOrEqual(t, eventSize(truncated), 600)
+	assert.Less(t, len(truncated.GetProcessKprobe().Args[0].GetBytesArg()), 4096)
+	assert.Equal(t, "/usr/bin/cat", truncated.GetProcessKprobe().GetProcess().GetBinary())
+	assert.Len(t, large.GetProcessKprobe().Args[0].GetBytesArg(), 4096, "the original event is not modified")
+
+	assert.Nil(t, stage.Process(&tetragon.GetEventsResponse{
+		Event: &tetragon.GetEventsResponse_ProcessExit{ProcessExit: &tetragon.ProcessExit{
+			Process: &tetragon.Process{Binary: "/usr/bin/cat"},
+		}},
+	}))
+
+	exec := execEvent("/usr/bin/cat")
+	exec.GetProcessExec().Process.Arguments = "--help"
+	exec.GetProcessExec().Process.ExecId = "id"
+	tomb := stage.Process(exec)
+	require.NotNil(t, tomb)
+	assert.Equal(t, "/usr/bin/cat", tomb.GetProcessExec().GetProcess().GetBinary())
+	assert.Equal(t, "id", tomb.GetProcessExec().GetProcess().GetExecId())
+	assert.Empty(t, tomb.GetProcessExec().GetProcess().GetArguments())
+}
+
+func TestSizeBudgetStage_Tombstone(t *testing.T) {
+	stage, err := newSizeBudgetStage(map[string]string{"process_kprobe": "100:tombstone"})
+	require.NoError(t, err)
+	tomb := stage.Process(kprobeEvent([]byte(strings.Repeat("x", 4096))))
+	require.NotNil(t, tomb)
+	kprobe := tomb.GetProcessKprobe()
+	assert.Equal(t, "files", kprobe.GetPolicyName())
+	assert.Empty(t, kprobe.GetArgs())
+	assert.Equal(t, uint32(456), kprobe.GetProcess().GetPid().GetValue())
+	assert.Equal(t, "node1", tomb.GetNodeName())
+}
+
+func TestNewSizeBudgetStage_Invalid(t *testing.T) {
+	for _, options := range []map[string]string{
+		nil,
+		{"process_exec": "0"},
+		{"process_exec": "1024:keep"},
+		{"process_foo": "1024"},
+	} {
+		_, err := newSizeBudgetStage(options)
+		require.Error(t, err, options)
+	}
+}
@@ -0,0 +1,188 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package exporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/cilium/tetragon/pkg/logger"
+	"github.com/cilium/tetragon/pkg/logger/logfields"
+	"github.com/cilium/tetragon/pkg/option"
+)
+
+// DeadLetterRecord is a line of the dead-letter file: an event that could
+// not be sent, with the error of its last attempt.
+type DeadLetterRecord struct {
+	Time     time.Time       `json:"time"`
+	Exporter string          `json:"exporter"`
+	Error    string          `json:"error"`
+	Event    json.RawMessage `json:"event"`
+}
+
+// deadLetterFile is a dead-letter file, shared by all exporters writing to
+// the same path so that their records are not interleaved.
+type deadLetterFile struct {
+	path    string
+	mu      sync.Mutex
+	f       *os.File
+	maxSize int64
+	// refs is the number of open DeadLetters writing to the file.
+	refs int
+}
+
+// openLocked opens the file again if it was moved or removed, for instance
+// by tetra deadletter resend, and returns its size.
+func (file *deadLetterFile) openLocked() (int64, error) {
+	if file.f != nil {
+		cur, err := file.f.Stat()
+		if err != nil {
+			return 0, err
+		}
+		if st, err := os.Stat(file.path); err == nil && os.SameFile(st, cur) {
+			return cur.Size(), nil
+		}
+		file.f.Close()
+		file.f = nil
+	}
+	f, err := os.OpenFile(file.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return 0, err
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return 0, err
+	}
+	file.f = f
+	return st.Size(), nil
+}
+
+var (
+	deadLetterFilesMu sync.Mutex
+	deadLetterFiles   = map[string]*deadLetterFile{}
+)
+
+// DeadLetter writes the events an exporter failed to send, after all its
+// retries, to the file set by --export-dead-letter-file. Once the file
+// reaches --export-dead-letter-max-size-mb, further events are dropped, so
+// that an unreachable destination cannot fill the disk. Events can be sent
+// again with tetra deadletter resend.
+type DeadLetter struct {
+	exporter string
+	file     *deadLetterFile
+	// closed is protected by file.mu.
+	closed bool
+}
+
+// OpenDeadLetter returns the DeadLetter of the exporter named name, or nil if
+// --export-dead-letter-file is not set. It must be closed when the exporter
+// stops, or fails to start.
+func OpenDeadLetter(name string) (*DeadLetter, error) {
+	path := option.Config.ExportDeadLetterFile
+	if path == "" {
+		return nil, nil
+	}
+	path = filepath.Clean(path)
+	deadLetterFilesMu.Lock()
+	defer deadLetterFilesMu.Unlock()
+	file, ok := deadLetterFiles[path]
+	if !ok {
+		file = &deadLetterFile{path: path}
+		deadLetterFiles[path] = file
+	}
+	file.mu.Lock()
+	defer file.mu.Unlock()
+	file.maxSize = int64(option.Config.ExportDeadLetterMaxSizeMB) * 1024 * 1024
+	if _, err := file.openLocked(); err != nil {
+		if file.refs == 0 {
+			delete(deadLetterFiles, path)
+		}
+		return nil, fmt.Errorf("failed to open dead-letter file: %w", err)
+	}
+	file.refs++
+	return &DeadLetter{exporter: name, file: file}, nil
+}
+
+// Close releases the dead-letter file. The file is closed once no exporter
+// writes to it. Events written after Close are dropped. Close may be called
+// on a nil DeadLetter.
+func (d *DeadLetter) Close() error {
+	if d == nil {
+		return nil
+	}
+	deadLetterFilesMu.Lock()
+	defer deadLetterFilesMu.Unlock()
+	file := d.file
+	file.mu.Lock()
+	defer file.mu.Unlock()
+	if d.closed {
+		return nil
+	}
+	d.closed = true
+	file.refs--
+	if file.refs > 0 {
+		return nil
+	}
+	delete(deadLetterFiles, file.path)
+	if file.f == nil {
+		return nil
+	}
+	err := file.f.Close()
+	file.f = nil
+	return err
+}
+
+// Write writes the newline-delimited JSON events of data, which failed to
+// be sent with sendErr.
+func (d *DeadLetter) Write(data []byte, sendErr error) {
+	now := time.Now()
+	for line := range bytes.Lines(data) {
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			d.write(now, line, sendErr)
+		}
+	}
+}
+
+func (d *DeadLetter) write(now time.Time, event []byte, sendErr error) {
+	record, err := json.Marshal(DeadLetterRecord{
+		Time:     now,
+		Exporter: d.exporter,
+		Error:    sendErr.Error(),
+		Event:    event,
+	})
+	if err != nil {
+		deadLetterEventsTotal.WithLabelValues(statusDeadLetterDropped, d.exporter).Inc()
+		logger.GetLogger().Warn("Failed to encode dead-letter record", "exporter", d.exporter, logfields.Error, err)
+		return
+	}
+	record = append(record, '\n')
+
+	file := d.file
+	file.mu.Lock()
+	defer file.mu.Unlock()
+	if d.closed {
+		deadLetterEventsTotal.WithLabelValues(statusDeadLetterDropped, d.exporter).Inc()
+		return
+	}
+	size, err := file.openLocked()
+	if err == nil && size+int64(len(record)) > file.maxSize {
+		deadLetterEventsTotal.WithLabelValues(statusDeadLetterDropped, d.exporter).Inc()
+		return
+	}
+	if err == nil {
+		_, err = file.f.Write(record)
+	}
+	if err != nil {
+		deadLetterEventsTotal.WithLabelValues(statusDeadLetterDropped, d.exporter).Inc()
+		logger.GetLogger().Warn("Failed to write dead-letter record", "exporter", d.exporter, logfields.Error, err)
+		return
+	}
+	deadLetterEventsTotal.WithLabelValues(statusDeadLetterWritten, d.exporter).Inc()
+}
@@ -0,0 +1,70 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package exporter
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cilium/tetragon/pkg/option"
+)
+
+func TestDeadLetter(t *testing.T) {
+	defer func(file string, size int) {
+		option.Config.ExportDeadLetterFile, option.Config.ExportDeadLetterMaxSizeMB = file, size
+	}(option.Config.ExportDeadLetterFile, option.Config.ExportDeadLetterMaxSizeMB)
+
+	option.Config.ExportDeadLetterFile = ""
+	d, err := OpenDeadLetter("dead-letter-test")
+	require.NoError(t, err)
+	assert.Nil(t, d)
+
+	file := filepath.Join(t.TempDir(), "dead-letter.json")
+	option.Config.ExportDeadLetterFile, option.Config.ExportDeadLetterMaxSizeMB = file, 1
+	d, err = OpenDeadLetter("dead-letter-test")
+	require.NoError(t, err)
+	errSend := errors.New("connection refused")
+	d.Write([]byte("{\"a\":1}\n\n{\"a\":2}\n"), errSend)
+
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	lines := bytes.Split(bytes.TrimSpace(data), []byte("\n"))
+	require.Len(t, lines, 2)
+	assert.Contains(t, string(lines[0]), `"exporter":"dead-letter-test","error":"connection refused","event":{"a":1}`)
+
+	// Records are written to a new file once the file is moved away.
+	require.NoError(t, os.Rename(file, file+".old"))
+	d.Write([]byte("{\"a\":3}\n"), errSend)
+	data, err = os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"event":{"a":3}`)
+
+	// Events are dropped once the file is full.
+	d.Write(bytes.Repeat([]byte("{\"a\":4}\n"), 1024*1024/16), errSend)
+	st, err := os.Stat(file)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, st.Size(), int64(1024*1024))
+	assert.Positive(t, testutil.ToFloat64(deadLetterEventsTotal.WithLabelValues(statusDeadLetterDropped, "dead-letter-test")))
+
+	// The file is closed once all its dead letters are closed.
+	other, err := OpenDeadLetter("dead-letter-other")
+	require.NoError(t, err)
+	require.NoError(t, d.Close())
+	require.NoError(t, d.Close())
+	assert.NotNil(t, other.file.f, "the file is still used by the other dead letter")
+	d.Write([]byte("{\"a\":5}\n"), errSend)
+	require.NoError(t, other.Close())
+	assert.Nil(t, other.file.f)
+	assert.NotContains(t, deadLetterFiles, file)
+	data, err = os.ReadFile(file)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), `"event":{"a":5}`, "events written after Close are dropped")
+}
@@ -8,6 +8,8 @@ import (
 	"fmt"
 	"io"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"google.golang.org/grpc/metadata"
 
@@ -23,12 +25,54 @@ type ExportEncoder interface {
 }
 
 type Exporter struct {
+	name        string
 	ctx         context.Context
 	request     *tetragon.GetEventsRequest
 	server      *server.Server
 	encoder     ExportEncoder
 	closer      io.Closer
 	rateLimiter *ratelimit.RateLimiter
+	// stages process events before they are rate limited.
+	stages []Stage
+	// priorities decides which events are dropped first by the rate limiter
+	// and the queue.
+	priorities *Priorities
+	// queue, if not nil, decouples encoding from the event stream. Events
+	// are encoded in order by a single goroutine, since encoders are not
+	// safe for concurrent use.
+	queue     chan *tetragon.GetEventsResponse
+	queueDone chan struct{}
+	// queueMu guards queueClosed, so that events sent while the exporter
+	// closes are dropped rather than sent on the closed queue.
+	queueMu     sync.RWMutex
+	queueClosed bool
+	// shedUnderPressure makes the exporter report the pressure of its queue,
+	// see UnderPressure.
+	shedUnderPressure bool
+	// pressureWindow is the window process_exec events are aggregated for
+	// while the queue is under pressure.
+	pressureWindow time.Duration
+	// pressure is whether the queue is under pressure, see UnderPressure.
+	pressure atomic.Bool
+	// encodeMu serializes the encoding of streamed and replayed events.
+	encodeMu sync.Mutex
+	// writeStart is the time in nanoseconds the current event started to be
+	// written at, or 0 if no event is being written.
+	writeStart atomic.Int64
+	// retention, if not nil, keeps recently exported events for Replay.
+	retention *retention
+	// mirror is set for the exporters that only show events to humans, such
+	// as the stdout exporter: their events are not counted as exported.
+	mirror bool
+	// primary is set for the exporter whose events are counted in
+	// tetragon_events_exported_total, see SetPrimary.
+	primary bool
+	// health, if not nil, tracks the results of sends. They are reported by
+	// the output if sendsReported, and are the results of Encode otherwise.
+	health        *health
+	sendsReported bool
+	// done is closed once the exporter has stopped and its output is closed.
+	done chan struct{}
 }
 
 func NewExporter(
@@ -39,37 +83,313 @@ func NewExporter(
 	closer io.Closer,
 	rateLimiter *ratelimit.RateLimiter,
 ) *Exporter {
-	return &Exporter{ctx, request, server, encoder, closer, rateLimiter}
+	return &Exporter{
+		ctx:         ctx,
+		request:     request,
+		server:      server,
+		encoder:     encoder,
+		closer:      closer,
+		rateLimiter: rateLimiter,
+		done:        make(chan struct{}),
+	}
+}
+
+// SetShedUnderPressure makes the exporter report when its queue is under
+// pressure, so that process_exit events are not sent to it meanwhile, and its
+// process_exec events are aggregated over window. It must be called before
+// Start.
+func (e *Exporter) SetShedUnderPressure(enabled bool, window time.Duration) {
+	e.shedUnderPressure = enabled
+	e.pressureWindow = window
+}
+
+// SetQueueSize makes the exporter encode events asynchronously, buffering up
+// to size events. Events that do not fit in the queue are dropped. It must be
+// called before Start.
+func (e *Exporter) SetQueueSize(size int) {
+	if size <= 0 {
+		e.queue = nil
+		return
+	}
+	e.queue = make(chan *tetragon.GetEventsResponse, size)
+	e.queueDone = make(chan struct{})
+}
+
+// SetRetention makes the exporter keep the events exported in the last
+// window, up to maxEvents events, so that they can be exported again with
+// Replay. It must be called before Start.
+func (e *Exporter) SetRetention(window time.Duration, maxEvents int) {
+	if window <= 0 || maxEvents <= 0 {
+		e.retention = nil
+		return
+	}
+	e.retention = newRetention(window, maxEvents)
+}
+
+// SetPrimary makes the exporter count its events in
+// tetragon_events_exported_total, so that the counter keeps counting every
+// event once when there are several exporters. It must be called before
+// Start.
+func (e *Exporter) SetPrimary(primary bool) {
+	e.primary = primary
+}
+
+// Mirror returns whether the exporter only shows events to humans, in which
+// case its events are not counted as exported nor retained.
+func (e *Exporter) Mirror() bool {
+	return e.mirror
+}
+
+// SetStages sets the stages processing events before they are rate limited
+// and encoded. It must be called before Start.
+func (e *Exporter) SetStages(stages []Stage) {
+	e.stages = stages
+}
+
+// SetPriorities sets the priorities of events, see Priorities. It must be
+// called before Start.
+func (e *Exporter) SetPriorities(priorities *Priorities) {
+	e.priorities = priorities
 }
 
 func (e *Exporter) Start() error {
 	var readyWG sync.WaitGroup
 	var exporterStartErr error
+	closer := e.closer
+	if e.queue != nil {
+		go e.runQueue()
+		closer = queueCloser{e}
+	}
 	readyWG.Add(1)
 	go func() {
-		if err := e.server.GetEventsWG(e.request, e, e.closer, &readyWG); err != nil {
-			exporterStartErr = fmt.Errorf("error starting JSON exporter: %w", err)
+		defer close(e.done)
+		if err := e.server.GetEventsWG(e.request, e, closer, &readyWG); err != nil {
+			exporterStartErr = fmt.Errorf("error starting exporter %q: %w", e.name, err)
+		}
+		if e.health != nil {
+			e.health.stop()
 		}
 	}()
 	readyWG.Wait()
 	return exporterStartErr
 }
 
+// Name returns the name of the exporter.
+func (e *Exporter) Name() string {
+	return e.name
+}
+
+// Health returns the health state of the exporter: HealthHealthy,
+// HealthDegraded or HealthFailing.
+func (e *Exporter) Health() string {
+	if e.health == nil {
+		return HealthHealthy
+	}
+	return e.health.State()
+}
+
+// RateLimitStats returns the state of the rate limiter of the exporter, or
+// false if its events are not rate limited.
+func (e *Exporter) RateLimitStats() (ratelimit.Stats, bool) {
+	if e.rateLimiter == nil {
+		return ratelimit.Stats{}, false
+	}
+	return e.rateLimiter.Stats(), true
+}
+
+// Done returns a channel that is closed once the exporter has stopped, after
+// its context is cancelled.
+func (e *Exporter) Done() <-chan struct{} {
+	return e.done
+}
+
 func (e *Exporter) Send(event *tetragon.GetEventsResponse) error {
-	if e.rateLimiter != nil && !e.rateLimiter.Allow() {
+	for _, stage := range e.stages {
+		if event = stage.Process(event); event == nil {
+			exporterEventsTotal.WithLabelValues(statusStageDropped, e.name).Inc()
+			return nil
+		}
+	}
+	priority := e.priorities.Of(event)
+	if e.rateLimiter != nil && !e.allowRate(priority) {
 		e.rateLimiter.Drop()
 		rateLimitDropped.Inc()
+		exporterEventsTotal.WithLabelValues(statusRateLimited, e.name).Inc()
+		droppedEvents.Add(1)
 		return nil
 	}
 
-	if err := e.encoder.Encode(event); err != nil {
-		logger.GetLogger().Warn("Failed to JSON encode", logfields.Error, err)
+	if e.queue != nil {
+		if e.rateLimiter != nil && len(e.queue) >= cap(e.queue)*3/4 {
+			e.rateLimiter.Backoff()
+		}
+		if priority == PriorityLow && len(e.queue) >= int(float64(cap(e.queue))*(1-lowPriorityReserve)) {
+			exporterEventsTotal.WithLabelValues(statusQueueFull, e.name).Inc()
+			droppedEvents.Add(1)
+			return nil
+		}
+		e.enqueue(event)
+		return nil
+	}
+	e.encode(event)
+	return nil
+}
+
+// PressureAggregationWindow implements server.PressureAggregator. It is zero
+// unless enabled with SetShedUnderPressure.
+func (e *Exporter) PressureAggregationWindow() time.Duration {
+	if !e.shedUnderPressure || e.queue == nil {
+		return 0
+	}
+	return e.pressureWindow
+}
+
+// UnderPressure implements server.PressureReporter. If enabled with
+// SetShedUnderPressure, the exporter is under pressure once its queue is
+// three quarters full, until it is drained to a quarter, so that short bursts
+// do not make producers degrade events.
+func (e *Exporter) UnderPressure() bool {
+	if !e.shedUnderPressure || e.queue == nil {
+		return false
+	}
+	switch n := len(e.queue); {
+	case n >= cap(e.queue)*3/4:
+		e.pressure.Store(true)
+	case n <= cap(e.queue)/4:
+		e.pressure.Store(false)
+	}
+	return e.pressure.Load()
+}
+
+// allowRate applies the rate limit according to the priority of an event.
+// Low priority events cannot use the last part of the burst, and high
+// priority events are exported even when over the limit, while still
+// consuming the allowance of other events.
+func (e *Exporter) allowRate(priority Priority) bool {
+	switch priority {
+	case PriorityLow:
+		return e.rateLimiter.AllowWithReserve(lowPriorityReserve)
+	case PriorityHigh:
+		e.rateLimiter.Allow()
+		return true
+	default:
+		return e.rateLimiter.Allow()
+	}
+}
+
+// enqueue adds an event to the queue, or drops it if the queue is full or
+// closed.
+func (e *Exporter) enqueue(event *tetragon.GetEventsResponse) {
+	e.queueMu.RLock()
+	defer e.queueMu.RUnlock()
+	if !e.queueClosed {
+		select {
+		case e.queue <- event:
+			return
+		default:
+		}
+	}
+	exporterEventsTotal.WithLabelValues(statusQueueFull, e.name).Inc()
+	droppedEvents.Add(1)
+}
+
+func (e *Exporter) runQueue() {
+	defer close(e.queueDone)
+	for event := range e.queue {
+		e.encode(event)
+	}
+}
+
+// queueCloser stops the queue goroutine once the remaining events are
+// encoded, and then closes the exporter.
+type queueCloser struct {
+	e *Exporter
+}
+
+func (c queueCloser) Close() error {
+	c.e.queueMu.Lock()
+	if !c.e.queueClosed {
+		c.e.queueClosed = true
+		close(c.e.queue)
+	}
+	c.e.queueMu.Unlock()
+	<-c.e.queueDone
+	if c.e.closer != nil {
+		return c.e.closer.Close()
 	}
-	eventsExportedTotal.Inc()
-	eventsExportTimestamp.Set(float64(event.GetTime().GetSeconds()))
 	return nil
 }
 
+func (e *Exporter) encode(event *tetragon.GetEventsResponse) {
+	err := e.write(event)
+	if e.mirror {
+		return
+	}
+	if err != nil {
+		exporterEventsTotal.WithLabelValues(statusFailed, e.name).Inc()
+		return
+	}
+	if e.primary {
+		eventsExportedTotal.Inc()
+	}
+	exporterEventsTotal.WithLabelValues(statusExported, e.name).Inc()
+	exportedEvents.Add(1)
+	eventsExportTimestamp.Set(float64(event.GetTime().GetSeconds()))
+	if e.retention != nil {
+		e.retention.add(event, time.Now())
+	}
+}
+
+// Replay exports again the events retained by SetRetention, oldest first,
+// and returns their number. Replayed events keep their original time.
+func (e *Exporter) Replay() int {
+	if e.retention == nil {
+		return 0
+	}
+	events := e.retention.snapshot(time.Now())
+	for _, event := range events {
+		if err := e.write(event); err != nil {
+			exporterEventsTotal.WithLabelValues(statusFailed, e.name).Inc()
+			continue
+		}
+		exporterEventsTotal.WithLabelValues(statusReplayed, e.name).Inc()
+	}
+	return len(events)
+}
+
+// Stalled returns whether the exporter has been writing an event for more
+// than timeout, for instance because its output is blocked.
+func (e *Exporter) Stalled(timeout time.Duration) bool {
+	start := e.writeStart.Load()
+	return start != 0 && time.Since(time.Unix(0, start)) > timeout
+}
+
+// Encode encodes v like the events of the exporter, so that the
+// rate_limit_info events of its rate limiter are serialized with them.
+func (e *Exporter) Encode(v interface{}) error {
+	e.encodeMu.Lock()
+	defer e.encodeMu.Unlock()
+	return e.encoder.Encode(v)
+}
+
+func (e *Exporter) write(event *tetragon.GetEventsResponse) error {
+	e.encodeMu.Lock()
+	defer e.encodeMu.Unlock()
+	e.writeStart.Store(time.Now().UnixNano())
+	defer e.writeStart.Store(0)
+	err := e.encoder.Encode(event)
+	if err != nil {
+		logger.GetLogger().Warn("Failed to JSON encode", logfields.Error, err)
+		if e.rateLimiter != nil {
+			e.rateLimiter.Backoff()
+		}
+	}
+	if e.health != nil && !e.sendsReported {
+		e.health.record(err)
+	}
+	return err
+}
+
 func (e *Exporter) SetHeader(metadata.MD) error {
 	return nil
 }
@@ -10,9 +10,11 @@ import (
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
@@ -198,14 +200,8 @@ func Test_rateLimitExport(t *testing.T) {
 			results := newArrayWriter(tt.totalEvents)
 			encoder := encoder.NewProtojsonEncoder(results)
 			request := &tetragon.GetEventsRequest{}
-			exporter := NewExporter(
-				ctx,
-				request,
-				grpcServer,
-				encoder,
-				results,
-				ratelimit.NewRateLimiter(ctx, 50*time.Millisecond, tt.rateLimit, encoder),
-			)
+			exporter := NewExporter(ctx, request, grpcServer, encoder, results, nil)
+			exporter.rateLimiter = ratelimit.NewRateLimiter(ctx, 50*time.Millisecond, tt.rateLimit, exporter)
 			require.NoError(t, exporter.Start(), "exporter must start without errors")
 			for i := range tt.totalEvents {
 				eventNotifier.NotifyListener(nil, &tetragon.GetEventsResponse{
@@ -223,3 +219,121 @@ func Test_rateLimitExport(t *testing.T) {
 		})
 	}
 }
+
+// overlapWriter fails the test if it is written to concurrently.
+type overlapWriter struct {
+	t       *testing.T
+	writing atomic.Bool
+}
+
+func (w *overlapWriter) Write(p []byte) (int, error) {
+	if !w.writing.CompareAndSwap(false, true) {
+		w.t.Error("concurrent writes")
+	}
+	time.Sleep(time.Millisecond)
+	w.writing.Store(false)
+	return len(p), nil
+}
+
+func TestExporter_RateLimitInfoSerialized(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w := &overlapWriter{t: t}
+	exporter := NewExporter(ctx, &tetragon.GetEventsRequest{}, nil, encoder.NewProtojsonEncoder(w), nil, nil)
+	exporter.rateLimiter = ratelimit.NewRateLimiter(ctx, 5*time.Millisecond, 1, exporter)
+	for deadline := time.Now().Add(200 * time.Millisecond); time.Now().Before(deadline); {
+		require.NoError(t, exporter.Send(&tetragon.GetEventsResponse{
+			Event: &tetragon.GetEventsResponse_ProcessExec{ProcessExec: &tetragon.ProcessExec{}},
+		}))
+	}
+}
+
+func TestExporter_SendQueue(t *testing.T) {
+	results := newArrayWriter(3)
+	exporter := NewExporter(context.Background(), &tetragon.GetEventsRequest{}, nil, encoder.NewProtojsonEncoder(results), results, nil)
+	exporter.name = "queue-test"
+	exporter.SetQueueSize(2)
+	for _, binary := range []string{"a", "b", "c"} {
+		require.NoError(t, exporter.Send(&tetragon.GetEventsResponse{
+			Event: &tetragon.GetEventsResponse_ProcessExec{
+				ProcessExec: &tetragon.ProcessExec{Process: &tetragon.Process{Binary: binary}},
+			}}))
+	}
+	assert.InDelta(t, 1, testutil.ToFloat64(exporterEventsTotal.WithLabelValues(statusQueueFull, "queue-test")), 0)
+
+	// Closing the exporter encodes the queued events before returning.
+	go exporter.runQueue()
+	require.NoError(t, queueCloser{exporter}.Close())
+	assert.Equal(t, []string{`{"process_exec":{"process":{"binary":"a"}}}`, `{"process_exec":{"process":{"binary":"b"}}}`}, results.items)
+}
+
+func TestExporter_SendQueueClosed(t *testing.T) {
+	results := newArrayWriter(1)
+	exporter := NewExporter(context.Background(), &tetragon.GetEventsRequest{}, nil, encoder.NewProtojsonEncoder(results), results, nil)
+	exporter.name = "queue-closed-test"
+	exporter.SetQueueSize(2)
+	go exporter.runQueue()
+	require.NoError(t, queueCloser{exporter}.Close())
+
+	// Events sent after the exporter is closed, such as by an aggregator,
+	// are dropped.
+	require.NoError(t, exporter.Send(&tetragon.GetEventsResponse{}))
+	assert.InDelta(t, 1, testutil.ToFloat64(exporterEventsTotal.WithLabelValues(statusQueueFull, "queue-closed-test")), 0)
+	assert.Empty(t, results.items)
+}
+
+type blockingWriter struct {
+	unblock chan struct{}
+}
+
+func (b blockingWriter) Write(p []byte) (int, error) {
+	<-b.unblock
+	return len(p), nil
+}
+
+func TestExporter_Stalled(t *testing.T) {
+	w := blockingWriter{unblock: make(chan struct{})}
+	exporter := NewExporter(context.Background(), &tetragon.GetEventsRequest{}, nil, encoder.NewProtojsonEncoder(w), nil, nil)
+	assert.False(t, exporter.Stalled(0))
+
+	done := make(chan struct{})
+	go func() {
+		exporter.encode(&tetragon.GetEventsResponse{})
+		close(done)
+	}()
+	require.Eventually(t, func() bool { return exporter.Stalled(10 * time.Millisecond) }, 5*time.Second, 10*time.Millisecond)
+	assert.False(t, exporter.Stalled(time.Hour))
+
+	close(w.unblock)
+	<-done
+	assert.False(t, exporter.Stalled(0))
+}
+
+func TestExporter_UnderPressure(t *testing.T) {
+	exporter := NewExporter(context.Background(), &tetragon.GetEventsRequest{}, nil, nil, nil, nil)
+	assert.False(t, exporter.UnderPressure())
+	exporter.SetQueueSize(8)
+	fill := func(n int) {
+		for len(exporter.queue) < n {
+			exporter.queue <- &tetragon.GetEventsResponse{}
+		}
+		for len(exporter.queue) > n {
+			<-exporter.queue
+		}
+	}
+	// Exporters only report pressure when enabled.
+	fill(8)
+	assert.False(t, exporter.UnderPressure())
+	assert.Zero(t, exporter.PressureAggregationWindow())
+	exporter.SetShedUnderPressure(true, time.Minute)
+	assert.Equal(t, time.Minute, exporter.PressureAggregationWindow())
+	fill(5)
+	assert.False(t, exporter.UnderPressure())
+	fill(6)
+	assert.True(t, exporter.UnderPressure())
+	// The pressure stops once the queue is drained to a quarter.
+	fill(3)
+	assert.True(t, exporter.UnderPressure())
+	fill(2)
+	assert.False(t, exporter.UnderPressure())
+}
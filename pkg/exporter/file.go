@@ -0,0 +1,139 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package exporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/cilium/lumberjack/v2"
+
+	"github.com/cilium/tetragon/pkg/encoder"
+	"github.com/cilium/tetragon/pkg/fileutils"
+	"github.com/cilium/tetragon/pkg/logger"
+	"github.com/cilium/tetragon/pkg/logger/logfields"
+	"github.com/cilium/tetragon/pkg/option"
+)
+
+const TypeFile = "file"
+
+func init() {
+	RegisterAtInit(TypeFile, newFileExporter)
+	RegisterValidatorAtInit(TypeFile, validateFileExporter)
+}
+
+func validateFileExporter(conf *option.ExporterConfig) error {
+	filename := conf.Option("filename", option.Config.ExportFilename)
+	if filename == "" {
+		return errors.New("no export filename")
+	}
+	if finfo, err := os.Stat(filepath.Clean(filename)); err == nil && finfo.IsDir() {
+		return fmt.Errorf("export filename %q is a directory", filename)
+	}
+	if _, err := fileutils.RegularFilePerms(option.Config.ExportFilePerm); err != nil {
+		return fmt.Errorf("invalid --%s: %w", option.KeyExportFilePerm, err)
+	}
+	if option.Config.ExportFileRotationInterval < 0 {
+		return fmt.Errorf("frequency '%s' at which to rotate JSON export files is negative", option.Config.ExportFileRotationInterval)
+	}
+	format := conf.Option("format", option.Config.ExportFileFormat)
+	if err := ValidateFormat(format); err != nil {
+		return err
+	}
+	if format != FormatJSON && len(conf.Templates) > 0 {
+		return fmt.Errorf("exporter %q: templates cannot be used with the %s format", conf.Name, format)
+	}
+	if len(conf.Templates) > 0 {
+		if _, err := encoder.NewTemplateEncoder(io.Discard, conf.Templates); err != nil {
+			return fmt.Errorf("invalid templates of exporter %q: %w", conf.Name, err)
+		}
+	}
+	return nil
+}
+
+// newFileExporter writes events to the file set by the "filename" option, or
+// option.Config.ExportFilename by default, rotating the file by size and, if
+// configured, periodically. Events are written in the format set by the
+// "format" option, or option.Config.ExportFileFormat by default. If the
+// exporter has templates, events are written in the template formats
+// instead.
+func newFileExporter(ctx context.Context, conf *option.ExporterConfig) (ExportEncoder, io.Closer, error) {
+	log := logger.GetLogger()
+	filename := conf.Option("filename", option.Config.ExportFilename)
+	if filename == "" {
+		return nil, nil, errors.New("no export filename")
+	}
+	writer := &lumberjack.Logger{
+		Filename:   filename,
+		MaxSize:    option.Config.ExportFileMaxSizeMB,
+		MaxBackups: option.Config.ExportFileMaxBackups,
+		Compress:   option.Config.ExportFileCompress,
+	}
+
+	perms, err := fileutils.RegularFilePerms(option.Config.ExportFilePerm)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid --%s: %w", option.KeyExportFilePerm, err)
+	}
+	writer.FileMode = perms
+
+	finfo, err := os.Stat(filepath.Clean(filename))
+	if err == nil && finfo.IsDir() {
+		// Error if exportFilename points to a directory
+		return nil, nil, errors.New("passed export JSON logs file point to a directory")
+	}
+	logFile := filepath.Base(filename)
+	logsDir, err := filepath.Abs(filepath.Dir(filepath.Clean(filename)))
+	if err != nil {
+		log.Warn(fmt.Sprintf("Failed to get absolute path of exported JSON logs '%s'", filename), logfields.Error, err)
+		// Do not fail; we let lumberjack handle this. We want to
+		// log the rotate logs operation.
+		logsDir = filepath.Dir(filename)
+	}
+
+	if option.Config.ExportFileRotationInterval < 0 {
+		// Passed an invalid interval let's error out
+		return nil, nil, fmt.Errorf("frequency '%s' at which to rotate JSON export files is negative", option.Config.ExportFileRotationInterval.String())
+	} else if interval := option.Config.ExportFileRotationInterval; interval > 0 {
+		log.Info("Periodically rotating JSON export files",
+			"directory", logsDir,
+			"frequency", interval.String())
+		go func() {
+			ticker := time.NewTicker(interval)
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					log.Info("Rotating JSON logs export", "file", logFile, "directory", logsDir)
+					if rotationErr := writer.Rotate(); rotationErr != nil {
+						log.Warn("Failed to rotate JSON export file", "file", filename, logfields.Error, rotationErr)
+					}
+				}
+			}
+		}()
+	}
+
+	if len(conf.Templates) > 0 {
+		enc, err := encoder.NewTemplateEncoder(NewExportedBytesTotalWriter(writer), conf.Templates)
+		if err != nil {
+			writer.Close()
+			return nil, nil, err
+		}
+		log.Info("Starting template exporter", "logger", writer)
+		return enc, writer, nil
+	}
+	format := conf.Option("format", option.Config.ExportFileFormat)
+	enc, err := NewFormatEncoder(writer, format)
+	if err != nil {
+		writer.Close()
+		return nil, nil, err
+	}
+	log.Info("Starting file exporter", "logger", writer, "format", format)
+	return enc, writer, nil
+}
@@ -0,0 +1,81 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package exporter
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/cilium/tetragon/pkg/encoder"
+	"github.com/cilium/tetragon/pkg/option"
+)
+
+// Formats of the events written by the file and stdout exporters, set by
+// their "format" option.
+const (
+	FormatJSON     = encoder.FormatJSON
+	FormatCBOR     = encoder.FormatCBOR
+	FormatProtobuf = encoder.FormatProtobuf
+	FormatCompact  = encoder.FormatCompact
+)
+
+// Formats returns the names of the formats registered with
+// encoder.RegisterEncoderAtInit, sorted.
+func Formats() []string {
+	return encoder.Formats()
+}
+
+// ValidateFormat returns an error if format is not one of Formats, or if it
+// cannot be used with the export flags: only JSON events can be signed.
+func ValidateFormat(format string) error {
+	if err := validateFormatName(format); err != nil {
+		return err
+	}
+	if format != FormatJSON && option.Config.ExportSigningKey != "" {
+		return fmt.Errorf("--%s cannot be used with the %s format", option.KeyExportSigningKey, format)
+	}
+	return nil
+}
+
+func validateFormatName(format string) error {
+	if !encoder.IsFormat(format) {
+		return fmt.Errorf("invalid export format %q: must be one of %s", format, strings.Join(Formats(), ", "))
+	}
+	return nil
+}
+
+// NewFormatEncoder returns the encoder registered for format, writing events
+// to w. JSON events are written through NewJSONWriter, which adds the labels
+// and the schema version and signs them. The other formats are given the
+// ExportLabels to add in their own way, and their output is only counted.
+func NewFormatEncoder(w io.Writer, format string) (ExportEncoder, error) {
+	if err := ValidateFormat(format); err != nil {
+		return nil, err
+	}
+	return newFormatEncoder(w, format, true)
+}
+
+// newFormatEncoder is NewFormatEncoder without the signing and the byte
+// accounting of events if exported is false, as for the stdout exporter,
+// which only prints a sample of them.
+func newFormatEncoder(w io.Writer, format string, exported bool) (ExportEncoder, error) {
+	opts := encoder.Options{JSON: jsonOptions()}
+	var err error
+	switch {
+	case format == FormatJSON && exported:
+		w, err = NewJSONWriter(w)
+	case format == FormatJSON:
+		w, err = newJSONFieldsWriter(w)
+	default:
+		if exported {
+			w = NewExportedBytesTotalWriter(w)
+		}
+		opts.Labels, err = ExportLabels()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return encoder.NewEncoder(format, w, opts)
+}
@@ -0,0 +1,172 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package exporter
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protodelim"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/cilium/tetragon/api/v1/tetragon"
+	"github.com/cilium/tetragon/pkg/encoder"
+	"github.com/cilium/tetragon/pkg/option"
+	"github.com/cilium/tetragon/pkg/signing"
+)
+
+// binaryEncoder writes the binary of each event on its own line, followed
+// by the labels if any, as an example of a format registered outside of the
+// exporter package.
+type binaryEncoder struct {
+	w      io.Writer
+	labels map[string]string
+}
+
+func (e *binaryEncoder) Encode(v interface{}) error {
+	event, ok := v.(*tetragon.GetEventsResponse)
+	if !ok {
+		return encoder.ErrInvalidEvent
+	}
+	if len(e.labels) > 0 {
+		_, err := fmt.Fprintln(e.w, event.GetProcessExec().GetProcess().GetBinary(), e.labels)
+		return err
+	}
+	_, err := fmt.Fprintln(e.w, event.GetProcessExec().GetProcess().GetBinary())
+	return err
+}
+
+func init() {
+	encoder.RegisterEncoderAtInit("binary", func(w io.Writer, opts encoder.Options) (encoder.EventEncoder, error) {
+		return &binaryEncoder{w: w, labels: opts.Labels}, nil
+	})
+}
+
+func TestNewFormatEncoder(t *testing.T) {
+	event := &tetragon.GetEventsResponse{
+		Event: &tetragon.GetEventsResponse_ProcessExec{
+			ProcessExec: &tetragon.ProcessExec{Process: &tetragon.Process{Binary: "/bin/true"}},
+		},
+		NodeName: "node1",
+	}
+
+	var buf bytes.Buffer
+	enc, err := NewFormatEncoder(&buf, FormatJSON)
+	require.NoError(t, err)
+	require.NoError(t, enc.Encode(event))
+	assert.JSONEq(t, `{"process_exec":{"process":{"binary":"/bin/true"}},"node_name":"node1"}`, buf.String())
+
+	buf.Reset()
+	enc, err = NewFormatEncoder(&buf, FormatCBOR)
+	require.NoError(t, err)
+	require.NoError(t, enc.Encode(event))
+	var data map[string]any
+	require.NoError(t, cbor.Unmarshal(buf.Bytes(), &data))
+	assert.Equal(t, "node1", data["node_name"])
+
+	buf.Reset()
+	enc, err = NewFormatEncoder(&buf, FormatProtobuf)
+	require.NoError(t, err)
+	require.NoError(t, enc.Encode(event))
+	require.NoError(t, enc.Encode(event))
+	r := bufio.NewReader(&buf)
+	for range 2 {
+		got := &tetragon.GetEventsResponse{}
+		require.NoError(t, protodelim.UnmarshalFrom(r, got))
+		assert.True(t, proto.Equal(event, got))
+	}
+
+	buf.Reset()
+	enc, err = NewFormatEncoder(&buf, FormatCompact)
+	require.NoError(t, err)
+	require.NoError(t, enc.Encode(event))
+	assert.Contains(t, buf.String(), "/bin/true")
+
+	buf.Reset()
+	enc, err = NewFormatEncoder(&buf, "binary")
+	require.NoError(t, err)
+	require.NoError(t, enc.Encode(event))
+	assert.Equal(t, "/bin/true\n", buf.String())
+	assert.Equal(t, []string{"binary", FormatCBOR, FormatCompact, FormatJSON, FormatProtobuf}, Formats())
+
+	_, err = NewFormatEncoder(&buf, "ecs")
+	require.ErrorContains(t, err, `invalid export format "ecs"`)
+}
+
+func TestNewFormatEncoder_Labels(t *testing.T) {
+	defer func(labels map[string]string) { option.Config.ExportLabels = labels }(option.Config.ExportLabels)
+	option.Config.ExportLabels = map[string]string{"env": "prod"}
+	event := &tetragon.GetEventsResponse{
+		Event: &tetragon.GetEventsResponse_ProcessExec{
+			ProcessExec: &tetragon.ProcessExec{Process: &tetragon.Process{Binary: "/bin/true"}},
+		},
+	}
+
+	var buf bytes.Buffer
+	enc, err := NewFormatEncoder(&buf, FormatJSON)
+	require.NoError(t, err)
+	require.NoError(t, enc.Encode(event))
+	assert.JSONEq(t, `{"process_exec":{"process":{"binary":"/bin/true"}},"labels":{"env":"prod"}}`, buf.String())
+
+	buf.Reset()
+	enc, err = NewFormatEncoder(&buf, FormatCBOR)
+	require.NoError(t, err)
+	require.NoError(t, enc.Encode(event))
+	var data map[string]any
+	require.NoError(t, cbor.Unmarshal(buf.Bytes(), &data))
+	assert.Equal(t, map[any]any{"env": "prod"}, data["labels"])
+
+	buf.Reset()
+	enc, err = NewFormatEncoder(&buf, "binary")
+	require.NoError(t, err)
+	require.NoError(t, enc.Encode(event))
+	assert.Equal(t, "/bin/true map[env:prod]\n", buf.String())
+}
+
+func TestValidateFormat(t *testing.T) {
+	defer func(key string) { option.Config.ExportSigningKey = key }(option.Config.ExportSigningKey)
+	option.Config.ExportSigningKey = "key.pem"
+	require.NoError(t, ValidateFormat(FormatJSON))
+	require.Error(t, ValidateFormat(FormatProtobuf))
+	require.Error(t, ValidateFormat(FormatCBOR))
+	require.Error(t, ValidateFormat("binary"))
+}
+
+func TestNewStdoutExporter_NotExported(t *testing.T) {
+	saved := option.Config
+	defer func() { option.Config = saved }()
+	key := filepath.Join(t.TempDir(), "key")
+	require.NoError(t, os.WriteFile(key, []byte("secret"), 0o600))
+	option.Config.ExportSigningAlgorithm = signing.AlgHMACSHA256
+	option.Config.ExportSigningKey = key
+	option.Config.ExportLabels = map[string]string{"env": "prod"}
+	event := &tetragon.GetEventsResponse{NodeName: "n1"}
+
+	var buf bytes.Buffer
+	enc, err := NewFormatEncoder(&buf, FormatJSON)
+	require.NoError(t, err)
+	before := testutil.ToFloat64(eventsExportedBytesTotal)
+	require.NoError(t, enc.Encode(event))
+	assert.Contains(t, buf.String(), `"signature":`)
+	assert.Equal(t, before+float64(buf.Len()), testutil.ToFloat64(eventsExportedBytesTotal))
+
+	// The stdout exporter does not sign or count the events it prints.
+	require.NoError(t, validateStdoutExporter(&option.ExporterConfig{Options: map[string]string{"format": FormatCBOR}}))
+	buf.Reset()
+	enc, err = newFormatEncoder(&buf, FormatJSON, false)
+	require.NoError(t, err)
+	before = testutil.ToFloat64(eventsExportedBytesTotal)
+	require.NoError(t, enc.Encode(event))
+	assert.JSONEq(t, `{"node_name":"n1","labels":{"env":"prod"}}`, buf.String())
+	assert.Equal(t, before, testutil.ToFloat64(eventsExportedBytesTotal))
+}
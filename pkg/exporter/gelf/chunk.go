@@ -0,0 +1,109 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package gelf
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+
+	"github.com/cilium/tetragon/pkg/exporter"
+)
+
+const (
+	CompressionNone = "none"
+	CompressionZlib = "zlib"
+	CompressionGzip = "gzip"
+
+	// chunkHeaderSize is the size of the header of a GELF chunk: two magic
+	// bytes, the message ID, the sequence number and the sequence count.
+	chunkHeaderSize = 12
+	// maxChunks is the maximum number of chunks of a message accepted by
+	// Graylog.
+	maxChunks = 128
+
+	minChunkSize = chunkHeaderSize + 1
+	maxChunkSize = 65507
+)
+
+var chunkMagic = [2]byte{0x1e, 0x0f}
+
+var errTooManyChunks = errors.New("message is too large for GELF chunking")
+
+// sender compresses GELF messages and writes them to a connection, one
+// datagram per message, or as chunks if a message does not fit in a
+// datagram.
+type sender struct {
+	w           io.Writer
+	chunkSize   int
+	compression string
+	buf         bytes.Buffer
+}
+
+func newSender(w io.Writer, chunkSize int, compression string) *sender {
+	return &sender{
+		w:           w,
+		chunkSize:   chunkSize,
+		compression: compression,
+	}
+}
+
+func (s *sender) send(msg []byte) error {
+	data, err := s.compress(msg)
+	if err != nil {
+		return err
+	}
+	// The chunks of a message are sent together.
+	exporter.WaitBandwidth(context.Background(), len(data))
+	if len(data) <= s.chunkSize {
+		_, err := s.w.Write(data)
+		return err
+	}
+
+	payload := s.chunkSize - chunkHeaderSize
+	count := (len(data) + payload - 1) / payload
+	if count > maxChunks {
+		return errTooManyChunks
+	}
+	chunk := make([]byte, 0, s.chunkSize)
+	chunk = append(chunk, chunkMagic[:]...)
+	var id [8]byte
+	rand.Read(id[:])
+	chunk = append(chunk, id[:]...)
+	for seq := range count {
+		end := min(len(data), (seq+1)*payload)
+		chunk = append(chunk[:chunkHeaderSize-2], byte(seq), byte(count))
+		chunk = append(chunk, data[seq*payload:end]...)
+		if _, err := s.w.Write(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compress returns msg compressed with the configured compression. The
+// result is only valid until the next call.
+func (s *sender) compress(msg []byte) ([]byte, error) {
+	var w io.WriteCloser
+	s.buf.Reset()
+	switch s.compression {
+	case CompressionZlib:
+		w = zlib.NewWriter(&s.buf)
+	case CompressionGzip:
+		w = gzip.NewWriter(&s.buf)
+	default:
+		return msg, nil
+	}
+	if _, err := w.Write(msg); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return s.buf.Bytes(), nil
+}
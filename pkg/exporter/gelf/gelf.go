@@ -0,0 +1,254 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+// Package gelf implements an event export destination that sends events to
+// Graylog as GELF messages over UDP.
+package gelf
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+
+	"github.com/cilium/tetragon/api/v1/tetragon"
+	"github.com/cilium/tetragon/pkg/encoder"
+	"github.com/cilium/tetragon/pkg/exporter"
+	"github.com/cilium/tetragon/pkg/logger"
+	"github.com/cilium/tetragon/pkg/option"
+)
+
+const TypeGELF = "gelf"
+
+func init() {
+	exporter.RegisterAtInit(TypeGELF, newExporter)
+	exporter.RegisterValidatorAtInit(TypeGELF, validateExporter)
+	exporter.RegisterCheckerAtInit(TypeGELF, checkExporter)
+}
+
+// levelInfo is the syslog severity of every message.
+const levelInfo = 6
+
+// optionsFromConfig returns the GELF options set by the --export-gelf-*
+// flags. The "address" option overrides the destination.
+func optionsFromConfig(conf *option.ExporterConfig) (Options, error) {
+	labels, err := exporter.ExportLabels()
+	if err != nil {
+		return Options{}, err
+	}
+	return Options{
+		Address:     conf.Option("address", option.Config.ExportGELFAddress),
+		Compression: option.Config.ExportGELFCompression,
+		ChunkSize:   option.Config.ExportGELFChunkSize,
+		Labels:      labels,
+	}, nil
+}
+
+func validateExporter(conf *option.ExporterConfig) error {
+	opts, err := optionsFromConfig(conf)
+	if err != nil {
+		return err
+	}
+	return opts.validate()
+}
+
+// checkExporter resolves the host of the Graylog input, for --check-config.
+func checkExporter(conf *option.ExporterConfig) error {
+	opts, err := optionsFromConfig(conf)
+	if err != nil {
+		return err
+	}
+	host, _, _ := net.SplitHostPort(opts.Address)
+	return exporter.ResolveHost(host)
+}
+
+func newExporter(_ context.Context, conf *option.ExporterConfig) (exporter.ExportEncoder, io.Closer, error) {
+	opts, err := optionsFromConfig(conf)
+	if err != nil {
+		return nil, nil, err
+	}
+	enc, err := NewEncoder(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	logger.GetLogger().Info("Starting GELF exporter", "address", opts.Address)
+	return enc, enc, nil
+}
+
+type Options struct {
+	// Address is the host:port of the Graylog GELF UDP input.
+	Address string
+	// Compression is CompressionZlib, CompressionGzip or CompressionNone.
+	Compression string
+	// ChunkSize is the maximum size of a datagram. Larger messages are
+	// sent as GELF chunks.
+	ChunkSize int
+	// Labels are added to every message as additional fields.
+	Labels map[string]string
+}
+
+func (o *Options) validate() error {
+	if _, _, err := net.SplitHostPort(o.Address); err != nil {
+		return fmt.Errorf("invalid GELF address %q: %w", o.Address, err)
+	}
+	switch o.Compression {
+	case CompressionNone, CompressionZlib, CompressionGzip:
+	default:
+		return fmt.Errorf("invalid GELF compression %q: must be %q, %q or %q", o.Compression, CompressionZlib, CompressionGzip, CompressionNone)
+	}
+	if o.ChunkSize < minChunkSize || o.ChunkSize > maxChunkSize {
+		return fmt.Errorf("invalid GELF chunk size %d: must be between %d and %d", o.ChunkSize, minChunkSize, maxChunkSize)
+	}
+	return nil
+}
+
+// Encoder is an ExportEncoder sending events as GELF messages.
+type Encoder struct {
+	conn    net.Conn
+	sender  *sender
+	host    string
+	labels  map[string]string
+	compact *encoder.CompactEncoder
+}
+
+// NewEncoder returns an Encoder sending events to opts.Address.
+func NewEncoder(opts Options) (*Encoder, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	conn, err := net.Dial("udp", opts.Address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to GELF input %q: %w", opts.Address, err)
+	}
+	host, _ := os.Hostname()
+	return &Encoder{
+		conn:    conn,
+		sender:  newSender(conn, opts.ChunkSize, opts.Compression),
+		host:    host,
+		labels:  opts.Labels,
+		compact: encoder.NewCompactEncoder(io.Discard, encoder.Never, false, false, false),
+	}, nil
+}
+
+// Encode implements ExportEncoder.Encode.
+func (e *Encoder) Encode(v interface{}) error {
+	event, ok := v.(*tetragon.GetEventsResponse)
+	if !ok {
+		return encoder.ErrInvalidEvent
+	}
+	msg, err := e.marshal(event)
+	if err != nil {
+		return err
+	}
+	return e.sender.send(msg)
+}
+
+// Close closes the connection.
+func (e *Encoder) Close() error {
+	return e.conn.Close()
+}
+
+// marshal returns the GELF message of event. The fields of the event are
+// flattened into additional fields, named by their path with "_" separators,
+// without the event type: for example, process.binary of an exec event is
+// sent as _process_binary, and the type as _event_type.
+func (e *Encoder) marshal(event *tetragon.GetEventsResponse) ([]byte, error) {
+	b, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var fields map[string]any
+	if err := dec.Decode(&fields); err != nil {
+		return nil, err
+	}
+
+	host := event.GetNodeName()
+	if host == "" {
+		host = e.host
+	}
+	ts := time.Now()
+	if event.GetTime() != nil {
+		ts = event.GetTime().AsTime()
+	}
+	short, err := e.compact.EventToString(event)
+	if err != nil {
+		short = event.EventType().String()
+	}
+	msg := map[string]any{
+		"version":       "1.1",
+		"host":          host,
+		"short_message": strings.TrimSpace(short),
+		"timestamp":     json.Number(strconv.FormatFloat(float64(ts.UnixMilli())/1000, 'f', 3, 64)),
+		"level":         levelInfo,
+		"_event_type":   event.EventType().String(),
+	}
+	delete(fields, "node_name")
+	delete(fields, "time")
+	for name, value := range fields {
+		if inner, ok := value.(map[string]any); ok && isEventField(name) {
+			flatten(msg, "", inner)
+			continue
+		}
+		flatten(msg, name, value)
+	}
+	for k, v := range e.labels {
+		msg[fieldName(k)] = v
+	}
+	return json.Marshal(msg)
+}
+
+// isEventField returns whether name is the field holding the event itself,
+// such as "process_exec".
+func isEventField(name string) bool {
+	_, ok := tetragon.EventType_value[strings.ToUpper(name)]
+	return ok
+}
+
+// flatten adds value to msg as additional fields. Objects are flattened,
+// lists are sent as JSON since GELF fields are strings or numbers.
+func flatten(msg map[string]any, prefix string, value any) {
+	switch v := value.(type) {
+	case map[string]any:
+		for k, inner := range v {
+			if prefix != "" {
+				k = prefix + "_" + k
+			}
+			flatten(msg, k, inner)
+		}
+	case []any:
+		b, _ := json.Marshal(v)
+		msg[fieldName(prefix)] = string(b)
+	case json.Number, string:
+		msg[fieldName(prefix)] = v
+	case nil:
+	default:
+		msg[fieldName(prefix)] = fmt.Sprint(v)
+	}
+}
+
+// fieldName returns the name of an additional field. Names are prefixed with
+// "_", and characters other than letters, digits, "_", "." and "-" are
+// replaced. "_id" is reserved by Graylog.
+func fieldName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '.', r == '-':
+			return r
+		}
+		return '_'
+	}, name)
+	if name == "id" {
+		name = "id_"
+	}
+	return "_" + name
+}
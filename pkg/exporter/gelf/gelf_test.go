@@ -0,0 +1,160 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package gelf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/json"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/cilium/tetragon/api/v1/tetragon"
+	"github.com/cilium/tetragon/pkg/encoder"
+)
+
+// datagrams records every write as a datagram.
+type datagrams [][]byte
+
+func (d *datagrams) Write(p []byte) (int, error) {
+	*d = append(*d, bytes.Clone(p))
+	return len(p), nil
+}
+
+func TestMarshal(t *testing.T) {
+	e := &Encoder{
+		host:    "fallback",
+		labels:  map[string]string{"cluster": "prod"},
+		compact: encoder.NewCompactEncoder(io.Discard, encoder.Never, false, false, false),
+	}
+	msg, err := e.marshal(&tetragon.GetEventsResponse{
+		Event: &tetragon.GetEventsResponse_ProcessExec{ProcessExec: &tetragon.ProcessExec{
+			Process: &tetragon.Process{
+				Binary: "/usr/bin/curl",
+				Pod:    &tetragon.Pod{Namespace: "default", Name: "web"},
+			},
+			Ancestors: []*tetragon.Process{{Binary: "/bin/bash"}},
+		}},
+		NodeName: "node1",
+		Time:     timestamppb.New(time.Unix(1700000000, 123456789)),
+	})
+	require.NoError(t, err)
+
+	var fields map[string]any
+	require.NoError(t, json.Unmarshal(msg, &fields))
+	assert.Equal(t, map[string]any{
+		"version":                "1.1",
+		"host":                   "node1",
+		"short_message":          "🚀 process default/web /usr/bin/curl",
+		"timestamp":              1700000000.123,
+		"level":                  float64(levelInfo),
+		"_event_type":            "PROCESS_EXEC",
+		"_process_binary":        "/usr/bin/curl",
+		"_process_pod_name":      "web",
+		"_process_pod_namespace": "default",
+		"_ancestors":             `[{"binary":"/bin/bash"}]`,
+		"_cluster":               "prod",
+	}, fields)
+}
+
+func TestFieldName(t *testing.T) {
+	assert.Equal(t, "_process_binary", fieldName("process_binary"))
+	assert.Equal(t, "_app_kubernetes_io", fieldName("app/kubernetes io"))
+	assert.Equal(t, "_id_", fieldName("id"))
+}
+
+func TestSender(t *testing.T) {
+	var out datagrams
+	s := newSender(&out, 1420, CompressionNone)
+	require.NoError(t, s.send([]byte(`{"short_message":"small"}`)))
+	require.Len(t, out, 1)
+	assert.JSONEq(t, `{"short_message":"small"}`, string(out[0]))
+
+	// An incompressible message larger than a datagram is chunked.
+	out = nil
+	msg := make([]byte, 3000)
+	for i := range msg {
+		msg[i] = byte('a' + i*7%26)
+	}
+	s = newSender(&out, 1000, CompressionNone)
+	require.NoError(t, s.send(msg))
+	require.Len(t, out, 4)
+	var data []byte
+	for seq, chunk := range out {
+		require.LessOrEqual(t, len(chunk), 1000)
+		assert.Equal(t, chunkMagic[:], chunk[:2])
+		assert.Equal(t, out[0][2:10], chunk[2:10], "all chunks have the message ID")
+		assert.Equal(t, []byte{byte(seq), 4}, chunk[10:12])
+		data = append(data, chunk[chunkHeaderSize:]...)
+	}
+	assert.Equal(t, msg, data)
+
+	// Messages needing more than 128 chunks are dropped.
+	out = nil
+	s = newSender(&out, minChunkSize, CompressionNone)
+	require.ErrorIs(t, s.send(make([]byte, 129)), errTooManyChunks)
+	assert.Empty(t, out)
+}
+
+func TestSender_Zlib(t *testing.T) {
+	var out datagrams
+	s := newSender(&out, 1420, CompressionZlib)
+	msg := []byte(`{"short_message":"` + strings.Repeat("x", 10000) + `"}`)
+	require.NoError(t, s.send(msg))
+	require.Len(t, out, 1, "compressed message fits in a datagram")
+	r, err := zlib.NewReader(bytes.NewReader(out[0]))
+	require.NoError(t, err)
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, msg, got)
+}
+
+func TestEncoder(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	enc, err := NewEncoder(Options{
+		Address:     conn.LocalAddr().String(),
+		Compression: CompressionNone,
+		ChunkSize:   1420,
+	})
+	require.NoError(t, err)
+	defer enc.Close()
+	require.NoError(t, enc.Encode(&tetragon.GetEventsResponse{
+		Event: &tetragon.GetEventsResponse_ProcessExit{ProcessExit: &tetragon.ProcessExit{
+			Process: &tetragon.Process{Binary: "/bin/sh"},
+		}},
+		NodeName: "node1",
+	}))
+
+	buf := make([]byte, 1420)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	var fields map[string]any
+	require.NoError(t, json.Unmarshal(buf[:n], &fields))
+	assert.Equal(t, "PROCESS_EXIT", fields["_event_type"])
+	assert.Equal(t, "/bin/sh", fields["_process_binary"])
+}
+
+func TestOptionsValidate(t *testing.T) {
+	valid := Options{Address: "graylog:12201", Compression: CompressionZlib, ChunkSize: 1420}
+	require.NoError(t, valid.validate())
+	for _, opts := range []Options{
+		{Address: "graylog", Compression: CompressionZlib, ChunkSize: 1420},
+		{Address: "graylog:12201", Compression: "lz4", ChunkSize: 1420},
+		{Address: "graylog:12201", Compression: CompressionZlib, ChunkSize: 12},
+		{Address: "graylog:12201", Compression: CompressionZlib, ChunkSize: 70000},
+	} {
+		require.Error(t, opts.validate(), opts)
+	}
+}
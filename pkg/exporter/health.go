@@ -0,0 +1,147 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package exporter
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/cilium/tetragon/pkg/logger"
+	"github.com/cilium/tetragon/pkg/logger/logfields"
+)
+
+// Health states of an exporter, from the ratio of its sends that failed
+// over the last healthWindow to healthWindow*2.
+const (
+	HealthHealthy  = "healthy"
+	HealthDegraded = "degraded"
+	HealthFailing  = "failing"
+)
+
+const (
+	healthWindow = 30 * time.Second
+	// degradedErrorRatio and failingErrorRatio are the ratios of failed
+	// sends from which an exporter is degraded and failing.
+	degradedErrorRatio = 0.01
+	failingErrorRatio  = 0.5
+)
+
+// SendReporter is implemented by the outputs of exporters that send events
+// asynchronously, so that Encode does not return send errors, such as
+// webhooks. The exporter health is then driven by the result of every send
+// they report, instead of by the result of Encode.
+type SendReporter interface {
+	// SetSendResultFunc sets the function called with the result of every
+	// send, which may send several events.
+	SetSendResultFunc(f func(err error))
+}
+
+// ErrQueueFull is reported to SendReporter functions for the events dropped
+// because the queue of the sender is full.
+var ErrQueueFull = errors.New("export queue is full")
+
+// health tracks the state of an exporter from the results of its sends,
+// counted over the current and the previous window.
+type health struct {
+	name string
+	now  func() time.Time
+
+	mu sync.Mutex
+	// start is the start of the current window.
+	start time.Time
+	// sent and failed count the sends of the current window, and of the
+	// previous one.
+	sent, failed [2]int
+	state        string
+}
+
+func newHealth(name string) *health {
+	h := &health{name: name, now: time.Now}
+	h.start = h.now()
+	h.setStateLocked(HealthHealthy)
+	return h
+}
+
+// record records the result of a send.
+func (h *health) record(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.rotateLocked()
+	if err != nil {
+		h.failed[0]++
+	} else {
+		h.sent[0]++
+	}
+	h.updateLocked(err)
+}
+
+// State returns the current state.
+func (h *health) State() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.rotateLocked()
+	h.updateLocked(nil)
+	return h.state
+}
+
+// rotateLocked starts a new window once the current one is over.
+func (h *health) rotateLocked() {
+	now := h.now()
+	elapsed := now.Sub(h.start)
+	if elapsed < healthWindow {
+		return
+	}
+	if elapsed < 2*healthWindow {
+		h.sent[1], h.failed[1] = h.sent[0], h.failed[0]
+	} else {
+		h.sent[1], h.failed[1] = 0, 0
+	}
+	h.sent[0], h.failed[0] = 0, 0
+	h.start = now
+}
+
+// updateLocked updates the state from the sends of both windows. err is the
+// last send error, if any, logged when the state changes.
+func (h *health) updateLocked(err error) {
+	state := HealthHealthy
+	if total := h.sent[0] + h.sent[1] + h.failed[0] + h.failed[1]; total > 0 {
+		switch ratio := float64(h.failed[0]+h.failed[1]) / float64(total); {
+		case ratio >= failingErrorRatio:
+			state = HealthFailing
+		case ratio >= degradedErrorRatio:
+			state = HealthDegraded
+		}
+	}
+	if state == h.state {
+		return
+	}
+	if state == HealthHealthy {
+		logger.GetLogger().Info("Exporter is healthy again", "exporter", h.name, "previous", h.state)
+	} else {
+		logger.GetLogger().Warn("Exporter health changed", "exporter", h.name, "state", state, "previous", h.state, logfields.Error, err)
+	}
+	h.setStateLocked(state)
+}
+
+func (h *health) setStateLocked(state string) {
+	h.state = state
+	for _, s := range healthStateLabel.Values {
+		value := 0.0
+		if s == state {
+			value = 1
+		}
+		exporterHealth.WithLabelValues(s, h.name).Set(value)
+	}
+}
+
+// stop clears the state metric of the exporter, so that exporters removed
+// by a reload are not reported.
+func (h *health) stop() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, s := range healthStateLabel.Values {
+		exporterHealth.WithLabelValues(s, h.name).Set(0)
+	}
+}
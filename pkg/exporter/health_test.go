@@ -0,0 +1,94 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package exporter
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cilium/tetragon/api/v1/tetragon"
+	"github.com/cilium/tetragon/pkg/option"
+)
+
+func TestHealth(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	h := newHealth("health-test")
+	h.now = func() time.Time { return now }
+	h.start = now
+	errSend := errors.New("send failed")
+
+	assert.Equal(t, HealthHealthy, h.State())
+	assert.InDelta(t, 1.0, testutil.ToFloat64(exporterHealth.WithLabelValues(HealthHealthy, "health-test")), 0)
+
+	for range 99 {
+		h.record(nil)
+	}
+	h.record(errSend)
+	assert.Equal(t, HealthDegraded, h.State())
+
+	for range 100 {
+		h.record(errSend)
+	}
+	assert.Equal(t, HealthFailing, h.State())
+	assert.InDelta(t, 1.0, testutil.ToFloat64(exporterHealth.WithLabelValues(HealthFailing, "health-test")), 0)
+	assert.InDelta(t, 0.0, testutil.ToFloat64(exporterHealth.WithLabelValues(HealthHealthy, "health-test")), 0)
+
+	// The failures of the previous window still count.
+	now = now.Add(healthWindow)
+	h.record(nil)
+	assert.Equal(t, HealthFailing, h.State())
+
+	// Without sends for two windows, the exporter is healthy again.
+	now = now.Add(2 * healthWindow)
+	assert.Equal(t, HealthHealthy, h.State())
+
+	h.stop()
+	assert.InDelta(t, 0.0, testutil.ToFloat64(exporterHealth.WithLabelValues(HealthHealthy, "health-test")), 0)
+}
+
+var testSendReporter = &fakeSendReporter{}
+
+func init() {
+	RegisterAtInit("send-reporter-test", func(_ context.Context, _ *option.ExporterConfig) (ExportEncoder, io.Closer, error) {
+		return testSendReporter, testSendReporter, nil
+	})
+}
+
+func TestHealth_SendReporter(t *testing.T) {
+	defer func(limit int) { option.Config.ExportRateLimit = limit }(option.Config.ExportRateLimit)
+	option.Config.ExportRateLimit = -1
+	conf := &option.ExporterConfig{Name: "send-reporter-test", Type: "send-reporter-test"}
+	e, err := NewFromConfig(context.Background(), conf, &tetragon.GetEventsRequest{}, nil)
+	require.NoError(t, err)
+	require.NotNil(t, testSendReporter.onSend)
+
+	// Encode succeeds, but the sends fail.
+	e.write(&tetragon.GetEventsResponse{})
+	testSendReporter.onSend(ErrQueueFull)
+	assert.Equal(t, HealthFailing, e.Health())
+}
+
+// fakeSendReporter is an output whose sends are reported asynchronously.
+type fakeSendReporter struct {
+	onSend func(err error)
+}
+
+func (f *fakeSendReporter) Encode(interface{}) error {
+	return nil
+}
+
+func (f *fakeSendReporter) Close() error {
+	return nil
+}
+
+func (f *fakeSendReporter) SetSendResultFunc(onSend func(err error)) {
+	f.onSend = onSend
+}
@@ -0,0 +1,87 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package exporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strconv"
+)
+
+// SchemaVersion is the version of the schema of exported events, added as
+// "schema_version" with --export-schema-version. It is bumped when fields
+// are renamed or removed, or change type, which breaks parsers. New fields
+// do not change it.
+const SchemaVersion = 1
+
+// fieldsWriter adds fields to every JSON event written to it. Each call to
+// Write is expected to contain exactly one JSON object followed by a
+// newline, as produced by the protojson encoder.
+type fieldsWriter struct {
+	w      io.Writer
+	suffix []byte
+	buf    []byte
+}
+
+// newFieldsWriter returns a writer adding fields, such as `"a":1,"b":2`, to
+// the JSON events written to w.
+func newFieldsWriter(w io.Writer, fields []byte) *fieldsWriter {
+	suffix := append(fields, "}\n"...)
+	return &fieldsWriter{w: w, suffix: suffix}
+}
+
+// NewLabelsWriter returns a writer that injects labels into the JSON events
+// written to w, or w itself if there are no labels.
+func NewLabelsWriter(w io.Writer, labels map[string]string) (io.Writer, error) {
+	if len(labels) == 0 {
+		return w, nil
+	}
+	data, err := json.Marshal(labels)
+	if err != nil {
+		return nil, err
+	}
+	return newFieldsWriter(w, append([]byte(`"labels":`), data...)), nil
+}
+
+// NewFlatLabelsWriter is like NewLabelsWriter, but adds every label as a
+// top-level field named by its path, such as labels.env, for the events
+// flattened by --export-json-flatten.
+func NewFlatLabelsWriter(w io.Writer, labels map[string]string) (io.Writer, error) {
+	if len(labels) == 0 {
+		return w, nil
+	}
+	flat := make(map[string]string, len(labels))
+	for k, v := range labels {
+		flat["labels."+k] = v
+	}
+	data, err := json.Marshal(flat)
+	if err != nil {
+		return nil, err
+	}
+	// Strip the braces, data has the fields of a single object.
+	return newFieldsWriter(w, data[1:len(data)-1]), nil
+}
+
+// NewSchemaVersionWriter returns a writer that adds the SchemaVersion to the
+// JSON events written to w.
+func NewSchemaVersionWriter(w io.Writer) io.Writer {
+	return newFieldsWriter(w, []byte(`"schema_version":`+strconv.Itoa(SchemaVersion)))
+}
+
+func (l *fieldsWriter) Write(p []byte) (int, error) {
+	line := bytes.TrimRight(p, "\n")
+	if len(line) < 2 || line[len(line)-1] != '}' {
+		return l.w.Write(p)
+	}
+	l.buf = append(l.buf[:0], line[:len(line)-1]...)
+	if len(line) > 2 {
+		l.buf = append(l.buf, ',')
+	}
+	l.buf = append(l.buf, l.suffix...)
+	if _, err := l.w.Write(l.buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
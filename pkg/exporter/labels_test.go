@@ -0,0 +1,61 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package exporter
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cilium/tetragon/api/v1/tetragon"
+	"github.com/cilium/tetragon/pkg/encoder"
+)
+
+func TestLabelsWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewLabelsWriter(&buf, nil)
+	require.NoError(t, err)
+	assert.Same(t, &buf, w)
+
+	w, err = NewLabelsWriter(&buf, map[string]string{"region": "eu-west-1", "env": "prod"})
+	require.NoError(t, err)
+	enc := encoder.NewProtojsonEncoder(w)
+	require.NoError(t, enc.Encode(&tetragon.GetEventsResponse{
+		Event: &tetragon.GetEventsResponse_ProcessExec{
+			ProcessExec: &tetragon.ProcessExec{Process: &tetragon.Process{Binary: "a"}},
+		}}))
+	require.NoError(t, enc.Encode(&tetragon.GetEventsResponse{}))
+	assert.Equal(t,
+		`{"process_exec":{"process":{"binary":"a"}},"labels":{"env":"prod","region":"eu-west-1"}}`+"\n"+
+			`{"labels":{"env":"prod","region":"eu-west-1"}}`+"\n",
+		buf.String())
+}
+
+func TestFlatLabelsWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewFlatLabelsWriter(&buf, map[string]string{"region": "eu-west-1", "env": "prod"})
+	require.NoError(t, err)
+	enc := encoder.NewProtojsonEncoderWithOptions(w, encoder.JSONOptions{Flatten: true})
+	require.NoError(t, enc.Encode(&tetragon.GetEventsResponse{
+		Event: &tetragon.GetEventsResponse_ProcessExec{
+			ProcessExec: &tetragon.ProcessExec{Process: &tetragon.Process{Binary: "a"}},
+		}}))
+	assert.JSONEq(t, `{
+		"event_type": "PROCESS_EXEC",
+		"process.binary": "a",
+		"labels.env": "prod",
+		"labels.region": "eu-west-1"
+	}`, buf.String())
+}
+
+func TestSchemaVersionWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewLabelsWriter(&buf, map[string]string{"env": "prod"})
+	require.NoError(t, err)
+	enc := encoder.NewProtojsonEncoder(NewSchemaVersionWriter(w))
+	require.NoError(t, enc.Encode(&tetragon.GetEventsResponse{NodeName: "n1"}))
+	assert.Equal(t, `{"node_name":"n1","schema_version":1,"labels":{"env":"prod"}}`+"\n", buf.String())
+}
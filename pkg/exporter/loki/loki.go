@@ -0,0 +1,302 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+// Package loki implements an event export destination that pushes events
+// to Grafana Loki.
+package loki
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/cilium/tetragon/api/v1/tetragon"
+	"github.com/cilium/tetragon/api/v1/tetragon/codegen/helpers"
+	"github.com/cilium/tetragon/pkg/encoder"
+	"github.com/cilium/tetragon/pkg/exporter"
+	"github.com/cilium/tetragon/pkg/logger"
+	"github.com/cilium/tetragon/pkg/logger/logfields"
+	"github.com/cilium/tetragon/pkg/option"
+)
+
+const TypeLoki = "loki"
+
+// Labels of the Loki streams. Other fields are part of the log line, which
+// keeps the number of streams low.
+const (
+	LabelNodeName  = "node_name"
+	LabelNamespace = "namespace"
+	LabelEventType = "event_type"
+)
+
+// TenantHeader sets the tenant of pushed events in multi-tenant Loki
+// deployments.
+const TenantHeader = "X-Scope-OrgID"
+
+func init() {
+	exporter.RegisterAtInit(TypeLoki, newExporter)
+	exporter.RegisterValidatorAtInit(TypeLoki, validateExporter)
+	exporter.RegisterCheckerAtInit(TypeLoki, checkExporter)
+}
+
+// optionsFromConfig returns the Loki options set by the --export-loki-*
+// flags. The "url" and "tenant" options override the destination.
+func optionsFromConfig(conf *option.ExporterConfig) Options {
+	return Options{
+		URL:           conf.Option("url", option.Config.ExportLokiURL),
+		Tenant:        conf.Option("tenant", option.Config.ExportLokiTenant),
+		BatchSize:     option.Config.ExportLokiBatchSize,
+		FlushInterval: option.Config.ExportLokiFlushInterval,
+		MaxRetries:    option.Config.ExportLokiMaxRetries,
+		RetryBackoff:  option.Config.ExportLokiRetryBackoff,
+		Timeout:       option.Config.ExportLokiTimeout,
+	}
+}
+
+func validateExporter(conf *option.ExporterConfig) error {
+	opts := optionsFromConfig(conf)
+	return opts.validate()
+}
+
+// checkExporter resolves the host of the push endpoint, for --check-config.
+func checkExporter(conf *option.ExporterConfig) error {
+	u, err := url.Parse(optionsFromConfig(conf).URL)
+	if err != nil {
+		return err
+	}
+	return exporter.ResolveHost(u.Hostname())
+}
+
+func newExporter(ctx context.Context, conf *option.ExporterConfig) (exporter.ExportEncoder, io.Closer, error) {
+	opts := optionsFromConfig(conf)
+	deadLetter, err := exporter.OpenDeadLetter(conf.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+	opts.DeadLetter = deadLetter
+	enc, err := NewEncoder(ctx, opts)
+	if err != nil {
+		deadLetter.Close()
+		return nil, nil, err
+	}
+	logger.GetLogger().Info("Starting Loki exporter", "url", opts.URL, "tenant", opts.Tenant)
+	return enc, enc, nil
+}
+
+type Options struct {
+	// URL is the push endpoint, such as
+	// http://loki:3100/loki/api/v1/push.
+	URL string
+	// Tenant, if set, is sent in the TenantHeader.
+	Tenant string
+	// BatchSize is the maximum number of events in a single request.
+	BatchSize int
+	// FlushInterval is the maximum time an event is buffered before a
+	// partial batch is sent.
+	FlushInterval time.Duration
+	// MaxRetries is the number of times a failed request is retried.
+	MaxRetries int
+	// RetryBackoff is the delay before the first retry. It doubles on
+	// every subsequent retry.
+	RetryBackoff time.Duration
+	// Timeout is the timeout of a single request.
+	Timeout time.Duration
+	// DeadLetter, if not nil, receives the events of the batches that
+	// could not be pushed.
+	DeadLetter *exporter.DeadLetter
+}
+
+func (o *Options) validate() error {
+	u, err := url.Parse(o.URL)
+	if err != nil {
+		return fmt.Errorf("invalid Loki URL %q: %w", o.URL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("invalid Loki URL %q: scheme must be http or https", o.URL)
+	}
+	if o.BatchSize <= 0 {
+		return fmt.Errorf("invalid Loki batch size %d: must be positive", o.BatchSize)
+	}
+	if o.FlushInterval <= 0 {
+		return fmt.Errorf("invalid Loki flush interval %s: must be positive", o.FlushInterval)
+	}
+	if o.MaxRetries < 0 {
+		return fmt.Errorf("invalid Loki max retries %d: must not be negative", o.MaxRetries)
+	}
+	return nil
+}
+
+// streamKey identifies a Loki stream by its labels.
+type streamKey struct {
+	nodeName, namespace, eventType string
+}
+
+func (k streamKey) labels() map[string]string {
+	labels := map[string]string{LabelEventType: k.eventType}
+	if k.nodeName != "" {
+		labels[LabelNodeName] = k.nodeName
+	}
+	if k.namespace != "" {
+		labels[LabelNamespace] = k.namespace
+	}
+	return labels
+}
+
+// pushRequest is the JSON body of the Loki push API.
+type pushRequest struct {
+	Streams []pushStream `json:"streams"`
+}
+
+type pushStream struct {
+	Stream map[string]string `json:"stream"`
+	// Values are pairs of a timestamp in nanoseconds and a log line.
+	Values [][2]string `json:"values"`
+}
+
+// streams are the streams of a batch, by labels.
+type streams map[streamKey]*pushStream
+
+// Encoder is an ExportEncoder pushing events to Loki. Each event is a log
+// line holding the event as exported in JSON, in a stream labeled with its
+// node, Kubernetes namespace and type.
+//
+// Batches are sent by an exporter.Batcher, so that a slow or unreachable
+// Loki does not block event export.
+type Encoder struct {
+	opts    Options
+	client  *http.Client
+	batcher *exporter.Batcher[streams]
+
+	// line and json are only used by Encode, under the lock of batcher.
+	line bytes.Buffer
+	json encoder.EventEncoder
+}
+
+// NewEncoder validates opts and returns an Encoder that sends batches until
+// it is closed, see exporter.NewBatcher.
+func NewEncoder(ctx context.Context, opts Options) (*Encoder, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	e := &Encoder{
+		opts:   opts,
+		client: &http.Client{Timeout: opts.Timeout},
+	}
+	// Lines are signed and labeled like the events of other JSON
+	// exporters.
+	w, err := exporter.NewJSONWriter(&e.line)
+	if err != nil {
+		return nil, err
+	}
+	e.json = exporter.NewJSONEncoder(w)
+	e.batcher = exporter.NewBatcher(ctx, exporter.BatcherOptions{
+		Name:          TypeLoki,
+		Destination:   opts.URL,
+		BatchSize:     opts.BatchSize,
+		FlushInterval: opts.FlushInterval,
+		Counter:       batchesTotal,
+		DeadLetter:    opts.DeadLetter,
+	}, e.send)
+	return e, nil
+}
+
+// Encode implements ExportEncoder.Encode.
+func (e *Encoder) Encode(v interface{}) error {
+	event, ok := v.(*tetragon.GetEventsResponse)
+	if !ok {
+		return encoder.ErrInvalidEvent
+	}
+	ts := time.Now()
+	if t := event.GetTime(); t != nil {
+		ts = t.AsTime()
+	}
+	key := streamKey{
+		nodeName:  event.GetNodeName(),
+		namespace: helpers.ResponseGetProcess(event).GetPod().GetNamespace(),
+		eventType: event.EventType().String(),
+	}
+	return e.batcher.Add(func(batch *streams) ([]byte, bool, error) {
+		e.line.Reset()
+		if err := e.json.Encode(event); err != nil {
+			return nil, false, err
+		}
+		if *batch == nil {
+			*batch = make(streams)
+		}
+		s := (*batch)[key]
+		if s == nil {
+			s = &pushStream{Stream: key.labels()}
+			(*batch)[key] = s
+		}
+		line := bytes.TrimRight(e.line.Bytes(), "\n")
+		s.Values = append(s.Values, [2]string{strconv.FormatInt(ts.UnixNano(), 10), string(line)})
+		return e.line.Bytes(), false, nil
+	})
+}
+
+// Close sends any buffered events and waits for pending batches to be sent,
+// for up to exporter.BatchCloseTimeout.
+func (e *Encoder) Close() error {
+	return e.batcher.Close()
+}
+
+// SetSendResultFunc implements exporter.SendReporter.
+func (e *Encoder) SetSendResultFunc(f func(err error)) {
+	e.batcher.SetSendResultFunc(f)
+}
+
+func (e *Encoder) send(ctx context.Context, batch streams) error {
+	var req pushRequest
+	for _, s := range batch {
+		req.Streams = append(req.Streams, *s)
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to encode Loki batch: %w", err)
+	}
+	return exporter.Retry(ctx, e.opts.MaxRetries, e.opts.RetryBackoff, func(attempt int) (bool, error) {
+		retry, err := e.push(ctx, body)
+		if err != nil && retry {
+			logger.GetLogger().Debug("Loki push request failed, retrying", "attempt", attempt+1, logfields.Error, err)
+		}
+		return retry, err
+	})
+}
+
+// push sends a single request. It returns whether a failed request may be
+// retried.
+func (e *Encoder) push(ctx context.Context, body []byte) (bool, error) {
+	if err := exporter.WaitBandwidth(ctx, len(body)); err != nil {
+		return false, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.opts.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.opts.Tenant != "" {
+		req.Header.Set(TenantHeader, e.opts.Tenant)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("unexpected status: %s", resp.Status)
+	default:
+		return false, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+}
@@ -0,0 +1,98 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package loki
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/cilium/tetragon/api/v1/tetragon"
+)
+
+func execEvent(node, namespace, binary string) *tetragon.GetEventsResponse {
+	return &tetragon.GetEventsResponse{
+		Event: &tetragon.GetEventsResponse_ProcessExec{ProcessExec: &tetragon.ProcessExec{
+			Process: &tetragon.Process{Binary: binary, Pod: &tetragon.Pod{Namespace: namespace}},
+		}},
+		NodeName: node,
+		Time:     timestamppb.New(time.Unix(1700000000, 5)),
+	}
+}
+
+func TestEncoder(t *testing.T) {
+	var mu sync.Mutex
+	var requests []pushRequest
+	var tenants []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req pushRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		requests = append(requests, req)
+		tenants = append(tenants, r.Header.Get(TenantHeader))
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	e, err := NewEncoder(context.Background(), Options{
+		URL:           srv.URL + "/loki/api/v1/push",
+		Tenant:        "security",
+		BatchSize:     3,
+		FlushInterval: time.Hour,
+		Timeout:       5 * time.Second,
+	})
+	require.NoError(t, err)
+	require.NoError(t, e.Encode(execEvent("node1", "default", "/bin/a")))
+	require.NoError(t, e.Encode(execEvent("node1", "kube-system", "/bin/b")))
+	require.NoError(t, e.Encode(execEvent("node1", "default", "/bin/c")))
+	require.NoError(t, e.Encode(&tetragon.GetEventsResponse{
+		Event:    &tetragon.GetEventsResponse_ProcessExit{ProcessExit: &tetragon.ProcessExit{}},
+		NodeName: "node2",
+	}))
+	require.NoError(t, e.Close())
+
+	require.Len(t, requests, 2)
+	assert.Equal(t, []string{"security", "security"}, tenants)
+	streams := requests[0].Streams
+	sort.Slice(streams, func(i, j int) bool {
+		return streams[i].Stream[LabelNamespace] < streams[j].Stream[LabelNamespace]
+	})
+	require.Len(t, streams, 2)
+	assert.Equal(t, map[string]string{LabelNodeName: "node1", LabelNamespace: "default", LabelEventType: "PROCESS_EXEC"}, streams[0].Stream)
+	assert.Equal(t, map[string]string{LabelNodeName: "node1", LabelNamespace: "kube-system", LabelEventType: "PROCESS_EXEC"}, streams[1].Stream)
+	for i, binaries := range [][]string{{"/bin/a", "/bin/c"}, {"/bin/b"}} {
+		require.Len(t, streams[i].Values, len(binaries))
+		namespace := streams[i].Stream[LabelNamespace]
+		for j, binary := range binaries {
+			assert.Equal(t, "1700000000000000005", streams[i].Values[j][0])
+			assert.JSONEq(t, `{"process_exec":{"process":{"binary":"`+binary+`","pod":{"namespace":"`+namespace+`"}}},"node_name":"node1","time":"2023-11-14T22:13:20.000000005Z"}`, streams[i].Values[j][1])
+		}
+	}
+	// Events without a pod have no namespace label.
+	require.Len(t, requests[1].Streams, 1)
+	assert.Equal(t, map[string]string{LabelNodeName: "node2", LabelEventType: "PROCESS_EXIT"}, requests[1].Streams[0].Stream)
+}
+
+func TestOptions_validate(t *testing.T) {
+	opts := Options{URL: "http://loki:3100/loki/api/v1/push", BatchSize: 1, FlushInterval: time.Second}
+	require.NoError(t, opts.validate())
+	opts.URL = "loki:3100"
+	require.ErrorContains(t, opts.validate(), "invalid Loki URL")
+	opts.URL = "http://loki:3100/loki/api/v1/push"
+	opts.BatchSize = 0
+	require.ErrorContains(t, opts.validate(), "batch size")
+}
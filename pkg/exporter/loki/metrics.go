@@ -0,0 +1,16 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package loki
+
+import (
+	"github.com/cilium/tetragon/pkg/exporter"
+	"github.com/cilium/tetragon/pkg/metrics"
+)
+
+var batchesTotal = exporter.NewBatchCounter("export_loki", "batches_total",
+	"Number of event batches handled by the Loki exporter, by outcome.")
+
+func RegisterMetrics(group metrics.Group) {
+	group.MustRegister(batchesTotal)
+}
@@ -0,0 +1,76 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package exporter
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"strings"
+
+	"github.com/cilium/tetragon/pkg/option"
+	"github.com/cilium/tetragon/pkg/reader/node"
+	"github.com/cilium/tetragon/pkg/version"
+)
+
+// Node metadata fields that can be added to exported events with
+// --export-node-metadata.
+const (
+	MetadataNodeName     = "node_name"
+	MetadataHostname     = "hostname"
+	MetadataAgentVersion = "agent_version"
+	MetadataBootID       = "boot_id"
+)
+
+// bootIDPath holds a random ID generated by the kernel at boot, which tells
+// apart two boots of the same node.
+const bootIDPath = "/proc/sys/kernel/random/boot_id"
+
+var metadataFields = map[string]func() (string, error){
+	MetadataNodeName: func() (string, error) { return node.GetNodeNameForExport(), nil },
+	MetadataHostname: os.Hostname,
+	MetadataAgentVersion: func() (string, error) {
+		return version.Version, nil
+	},
+	MetadataBootID: func() (string, error) {
+		id, err := os.ReadFile(bootIDPath)
+		if err != nil {
+			return "", fmt.Errorf("failed to read boot ID: %w", err)
+		}
+		return strings.TrimSpace(string(id)), nil
+	},
+}
+
+// nodeMetadata returns the values of the node metadata fields.
+func nodeMetadata(fields []string) (map[string]string, error) {
+	metadata := make(map[string]string, len(fields))
+	for _, field := range fields {
+		get, ok := metadataFields[field]
+		if !ok {
+			return nil, fmt.Errorf("invalid node metadata field %q: must be one of %s, %s, %s or %s",
+				field, MetadataNodeName, MetadataHostname, MetadataAgentVersion, MetadataBootID)
+		}
+		value, err := get()
+		if err != nil {
+			return nil, err
+		}
+		metadata[field] = value
+	}
+	return metadata, nil
+}
+
+// ExportLabels returns the labels added to every exported event: the
+// --export-node-metadata fields and the --export-labels, which take
+// precedence.
+func ExportLabels() (map[string]string, error) {
+	if len(option.Config.ExportNodeMetadata) == 0 {
+		return option.Config.ExportLabels, nil
+	}
+	labels, err := nodeMetadata(option.Config.ExportNodeMetadata)
+	if err != nil {
+		return nil, err
+	}
+	maps.Copy(labels, option.Config.ExportLabels)
+	return labels, nil
+}
@@ -0,0 +1,56 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package exporter
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cilium/tetragon/pkg/option"
+	"github.com/cilium/tetragon/pkg/reader/node"
+	"github.com/cilium/tetragon/pkg/version"
+)
+
+func TestNodeMetadata(t *testing.T) {
+	metadata, err := nodeMetadata([]string{MetadataNodeName, MetadataAgentVersion})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		MetadataNodeName:     node.GetNodeNameForExport(),
+		MetadataAgentVersion: version.Version,
+	}, metadata)
+
+	if _, err := os.Stat(bootIDPath); err == nil {
+		metadata, err = nodeMetadata([]string{MetadataBootID})
+		require.NoError(t, err)
+		assert.Len(t, metadata[MetadataBootID], 36, "boot ID is a UUID")
+	}
+
+	_, err = nodeMetadata([]string{"kernel"})
+	require.Error(t, err)
+}
+
+func TestExportLabels(t *testing.T) {
+	oldLabels, oldMetadata := option.Config.ExportLabels, option.Config.ExportNodeMetadata
+	defer func() {
+		option.Config.ExportLabels, option.Config.ExportNodeMetadata = oldLabels, oldMetadata
+	}()
+
+	option.Config.ExportLabels = map[string]string{"env": "prod", MetadataAgentVersion: "custom"}
+	option.Config.ExportNodeMetadata = nil
+	labels, err := ExportLabels()
+	require.NoError(t, err)
+	assert.Equal(t, option.Config.ExportLabels, labels)
+
+	option.Config.ExportNodeMetadata = []string{MetadataNodeName, MetadataAgentVersion}
+	labels, err = ExportLabels()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"env":                "prod",
+		MetadataNodeName:     node.GetNodeNameForExport(),
+		MetadataAgentVersion: "custom",
+	}, labels, "--export-labels take precedence")
+}
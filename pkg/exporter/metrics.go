@@ -5,6 +5,7 @@ package exporter
 
 import (
 	"io"
+	"sync/atomic"
 
 	"github.com/prometheus/client_golang/prometheus"
 
@@ -12,6 +13,73 @@ import (
 	"github.com/cilium/tetragon/pkg/metrics/consts"
 )
 
+const (
+	statusExported    = "exported"
+	statusRateLimited = "rate_limited"
+	statusQueueFull   = "queue_full"
+	statusReplayed    = "replayed"
+	// statusFailed counts events the exporter failed to encode or write.
+	statusFailed = "failed"
+	// statusStageDropped counts events dropped by a stage of the exporter.
+	statusStageDropped = "stage_dropped"
+)
+
+// Actions on the events larger than their size budget.
+const (
+	oversizedTruncated  = "truncated"
+	oversizedDropped    = "dropped"
+	oversizedTombstoned = "tombstoned"
+)
+
+// Statuses of the events an exporter failed to send, see DeadLetter.
+const (
+	statusDeadLetterWritten = "written"
+	statusDeadLetterDropped = "dropped"
+)
+
+var (
+	exporterLabel = metrics.UnconstrainedLabel{Name: "exporter", ExampleValue: "file"}
+	statusLabel   = metrics.ConstrainedLabel{
+		Name:   "status",
+		Values: []string{statusExported, statusRateLimited, statusQueueFull, statusReplayed, statusStageDropped, statusFailed},
+	}
+
+	exporterEventsTotal = metrics.MustNewCounter(metrics.NewOpts(
+		consts.MetricsNamespace, "exporter", "events_total",
+		"Number of events handled by each exporter, by outcome.",
+		nil, []metrics.ConstrainedLabel{statusLabel}, []metrics.UnconstrainedLabel{exporterLabel},
+	), nil)
+
+	deadLetterEventsTotal = metrics.MustNewCounter(metrics.NewOpts(
+		consts.MetricsNamespace, "exporter", "dead_letter_events_total",
+		"Number of events each exporter failed to send, by whether they were written to the dead-letter file.",
+		nil, []metrics.ConstrainedLabel{{
+			Name:   "status",
+			Values: []string{statusDeadLetterWritten, statusDeadLetterDropped},
+		}}, []metrics.UnconstrainedLabel{exporterLabel},
+	), nil)
+
+	oversizedEventsTotal = metrics.MustNewCounter(metrics.NewOpts(
+		consts.MetricsNamespace, "exporter", "oversized_events_total",
+		"Number of events larger than their size budget, by action taken.",
+		nil, []metrics.ConstrainedLabel{{
+			Name:   "action",
+			Values: []string{oversizedTruncated, oversizedDropped, oversizedTombstoned},
+		}}, nil,
+	), nil)
+
+	healthStateLabel = metrics.ConstrainedLabel{
+		Name:   "state",
+		Values: []string{HealthHealthy, HealthDegraded, HealthFailing},
+	}
+
+	exporterHealth = metrics.MustNewGauge(metrics.NewOpts(
+		consts.MetricsNamespace, "exporter", "health",
+		"Health state of each running exporter, from the ratio of its failed sends. The gauge of the current state is 1.",
+		nil, []metrics.ConstrainedLabel{healthStateLabel}, []metrics.UnconstrainedLabel{exporterLabel},
+	), nil)
+)
+
 var (
 	eventsExportedTotal = prometheus.NewCounter(prometheus.CounterOpts{
 		Namespace: consts.MetricsNamespace,
@@ -37,14 +105,35 @@ var (
 		Help:        "Number of events dropped on export due to rate limiting",
 		ConstLabels: nil,
 	})
+
+	bandwidthWaitSeconds = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: consts.MetricsNamespace,
+		Name:      "export_bandwidth_wait_seconds_total",
+		Help:      "Time exporters waited to send events because of --export-max-bytes-per-second",
+	})
 )
 
+// exportedEvents and droppedEvents count the events exported and dropped by
+// rate limits or full queues by all exporters, for Totals.
+var exportedEvents, droppedEvents atomic.Uint64
+
+// Totals returns the number of events exported and dropped by all exporters
+// since the agent started. Events dropped by stages are not counted.
+func Totals() (exported, dropped uint64) {
+	return exportedEvents.Load(), droppedEvents.Load()
+}
+
 func RegisterMetrics(group metrics.Group) {
 	group.MustRegister(
 		eventsExportedTotal,
 		eventsExportedBytesTotal,
 		eventsExportTimestamp,
 		rateLimitDropped,
+		exporterEventsTotal,
+		exporterHealth,
+		deadLetterEventsTotal,
+		oversizedEventsTotal,
+		bandwidthWaitSeconds,
 	)
 }
 
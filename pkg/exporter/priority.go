@@ -0,0 +1,107 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package exporter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cilium/tetragon/api/v1/tetragon"
+)
+
+// Priority ranks events when an exporter has to drop some of them, because
+// of rate limiting or a full queue.
+type Priority int
+
+const (
+	PriorityLow Priority = iota - 1
+	PriorityNormal
+	PriorityHigh
+)
+
+const (
+	// policyPrefix selects events by tracing policy name in priority keys.
+	policyPrefix = "policy:"
+
+	// lowPriorityReserve is the fraction of the rate limiter burst and of
+	// the queue that low priority events cannot use, so that they are
+	// dropped before other events.
+	lowPriorityReserve = 0.5
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityHigh:
+		return "high"
+	default:
+		return "normal"
+	}
+}
+
+// ParsePriority parses "low", "normal" or "high".
+func ParsePriority(s string) (Priority, error) {
+	for _, p := range []Priority{PriorityLow, PriorityNormal, PriorityHigh} {
+		if strings.EqualFold(s, p.String()) {
+			return p, nil
+		}
+	}
+	return PriorityNormal, fmt.Errorf("invalid priority %q: must be low, normal or high", s)
+}
+
+// Priorities assigns priorities to events, by tracing policy or event type.
+// Events that match neither have PriorityNormal.
+type Priorities struct {
+	eventTypes map[tetragon.EventType]Priority
+	policies   map[string]Priority
+}
+
+// ParsePriorities parses the priorities set with --export-priorities. Keys
+// are event types, such as PROCESS_EXEC, or tracing policy names prefixed
+// with "policy:". It returns nil if m is empty.
+func ParsePriorities(m map[string]string) (*Priorities, error) {
+	if len(m) == 0 {
+		return nil, nil
+	}
+	p := &Priorities{
+		eventTypes: make(map[tetragon.EventType]Priority),
+		policies:   make(map[string]Priority),
+	}
+	for k, v := range m {
+		priority, err := ParsePriority(v)
+		if err != nil {
+			return nil, fmt.Errorf("priority of %q: %w", k, err)
+		}
+		if name, ok := strings.CutPrefix(k, policyPrefix); ok {
+			p.policies[name] = priority
+			continue
+		}
+		t, ok := tetragon.EventType_value[strings.ToUpper(k)]
+		if !ok {
+			return nil, fmt.Errorf("priority of %q: unknown event type", k)
+		}
+		p.eventTypes[tetragon.EventType(t)] = priority
+	}
+	return p, nil
+}
+
+// Of returns the priority of event. The priority of the tracing policy that
+// generated the event takes precedence over the one of its type.
+func (p *Priorities) Of(event *tetragon.GetEventsResponse) Priority {
+	if p == nil {
+		return PriorityNormal
+	}
+	if len(p.policies) > 0 {
+		if ev, ok := tetragon.UnwrapGetEventsResponse(event).(interface{ GetPolicyName() string }); ok {
+			if priority, ok := p.policies[ev.GetPolicyName()]; ok {
+				return priority
+			}
+		}
+	}
+	if priority, ok := p.eventTypes[event.EventType()]; ok {
+		return priority
+	}
+	return PriorityNormal
+}
@@ -0,0 +1,94 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cilium/tetragon/api/v1/tetragon"
+	"github.com/cilium/tetragon/pkg/encoder"
+	"github.com/cilium/tetragon/pkg/ratelimit"
+)
+
+func TestPriorities(t *testing.T) {
+	p, err := ParsePriorities(nil)
+	require.NoError(t, err)
+	assert.Nil(t, p)
+	assert.Equal(t, PriorityNormal, p.Of(&tetragon.GetEventsResponse{}))
+
+	p, err = ParsePriorities(map[string]string{
+		"PROCESS_EXIT":           "low",
+		"process_kprobe":         "normal",
+		"policy:sensitive-files": "HIGH",
+	})
+	require.NoError(t, err)
+	exit := &tetragon.GetEventsResponse{Event: &tetragon.GetEventsResponse_ProcessExit{ProcessExit: &tetragon.ProcessExit{}}}
+	kprobe := &tetragon.GetEventsResponse{Event: &tetragon.GetEventsResponse_ProcessKprobe{ProcessKprobe: &tetragon.ProcessKprobe{PolicyName: "other"}}}
+	sensitive := &tetragon.GetEventsResponse{Event: &tetragon.GetEventsResponse_ProcessKprobe{ProcessKprobe: &tetragon.ProcessKprobe{PolicyName: "sensitive-files"}}}
+	exec := &tetragon.GetEventsResponse{Event: &tetragon.GetEventsResponse_ProcessExec{ProcessExec: &tetragon.ProcessExec{}}}
+	assert.Equal(t, PriorityLow, p.Of(exit))
+	assert.Equal(t, PriorityNormal, p.Of(kprobe))
+	assert.Equal(t, PriorityHigh, p.Of(sensitive))
+	assert.Equal(t, PriorityNormal, p.Of(exec))
+
+	_, err = ParsePriorities(map[string]string{"PROCESS_EXIT": "urgent"})
+	require.Error(t, err)
+	_, err = ParsePriorities(map[string]string{"PROCESS_FOO": "low"})
+	require.Error(t, err)
+}
+
+func TestExporter_SendQueuePriority(t *testing.T) {
+	results := newArrayWriter(5)
+	exporter := NewExporter(context.Background(), &tetragon.GetEventsRequest{}, nil, encoder.NewProtojsonEncoder(results), results, nil)
+	exporter.name = "priority-test"
+	exporter.SetQueueSize(4)
+	priorities, err := ParsePriorities(map[string]string{"PROCESS_EXIT": "low"})
+	require.NoError(t, err)
+	exporter.SetPriorities(priorities)
+
+	exit := &tetragon.GetEventsResponse{Event: &tetragon.GetEventsResponse_ProcessExit{ProcessExit: &tetragon.ProcessExit{}}}
+	exec := &tetragon.GetEventsResponse{Event: &tetragon.GetEventsResponse_ProcessExec{ProcessExec: &tetragon.ProcessExec{}}}
+	// Low priority events only use half of the queue.
+	for _, ev := range []*tetragon.GetEventsResponse{exit, exit, exit, exec, exec, exec} {
+		require.NoError(t, exporter.Send(ev))
+	}
+	assert.InDelta(t, 2, testutil.ToFloat64(exporterEventsTotal.WithLabelValues(statusQueueFull, "priority-test")), 0)
+
+	go exporter.runQueue()
+	require.NoError(t, queueCloser{exporter}.Close())
+	assert.Equal(t, []string{`{"process_exit":{}}`, `{"process_exit":{}}`, `{"process_exec":{}}`, `{"process_exec":{}}`}, results.items)
+}
+
+func TestExporter_LowPriorityOutsideSchedule(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	results := newArrayWriter(4)
+	exporter := NewExporter(ctx, &tetragon.GetEventsRequest{}, nil, encoder.NewProtojsonEncoder(results), results, nil)
+	exporter.name = "priority-schedule-test"
+	priorities, err := ParsePriorities(map[string]string{"PROCESS_EXIT": "low"})
+	require.NoError(t, err)
+	exporter.SetPriorities(priorities)
+
+	// Without --export-rate-limit, events are only limited in a window of
+	// the schedule, which starts in 12 hours.
+	start := time.Now().Add(12 * time.Hour)
+	schedule, err := ratelimit.ParseSchedule(fmt.Sprintf("%s-%s rate-limit=1", start.Format("15:04"), start.Add(time.Minute).Format("15:04")))
+	require.NoError(t, err)
+	exporter.rateLimiter = ratelimit.NewRateLimiter(ctx, time.Hour, 0, exporter)
+	exporter.rateLimiter.SetSchedule(schedule, -1, 0)
+
+	exit := &tetragon.GetEventsResponse{Event: &tetragon.GetEventsResponse_ProcessExit{ProcessExit: &tetragon.ProcessExit{}}}
+	for range 3 {
+		require.NoError(t, exporter.Send(exit))
+	}
+	assert.Len(t, results.items, 3, "low priority events are not limited outside of the schedule")
+	assert.InDelta(t, 0, testutil.ToFloat64(exporterEventsTotal.WithLabelValues(statusRateLimited, "priority-schedule-test")), 0)
+}
@@ -0,0 +1,16 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package redis
+
+import (
+	"github.com/cilium/tetragon/pkg/exporter"
+	"github.com/cilium/tetragon/pkg/metrics"
+)
+
+var eventsTotal = exporter.NewBatchCounter("export_redis", "events_total",
+	"Number of events handled by the Redis exporter, by outcome.")
+
+func RegisterMetrics(group metrics.Group) {
+	group.MustRegister(eventsTotal)
+}
@@ -0,0 +1,346 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+// Package redis implements an event export destination that adds events to
+// a Redis stream with XADD.
+package redis
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/cilium/tetragon/pkg/exporter"
+	"github.com/cilium/tetragon/pkg/logger"
+	"github.com/cilium/tetragon/pkg/option"
+)
+
+const TypeRedis = "redis"
+
+// eventField is the field of stream entries holding the JSON event.
+const eventField = "event"
+
+func init() {
+	exporter.RegisterAtInit(TypeRedis, newExporter)
+	exporter.RegisterValidatorAtInit(TypeRedis, validateExporter)
+	exporter.RegisterCheckerAtInit(TypeRedis, checkExporter)
+}
+
+// optionsFromConfig returns the Redis options set by the --export-redis-*
+// flags. The "address" and "stream" options override the destination.
+func optionsFromConfig(conf *option.ExporterConfig) (Options, error) {
+	opts := Options{
+		Address:       conf.Option("address", option.Config.ExportRedisAddress),
+		Stream:        conf.Option("stream", option.Config.ExportRedisStream),
+		MaxLen:        option.Config.ExportRedisMaxLen,
+		Username:      option.Config.ExportRedisUsername,
+		TLS:           option.Config.ExportRedisTLS,
+		TLSCAFile:     option.Config.ExportRedisTLSCAFile,
+		BatchSize:     option.Config.ExportRedisBatchSize,
+		FlushInterval: option.Config.ExportRedisFlushInterval,
+		Timeout:       option.Config.ExportRedisTimeout,
+	}
+	if file := option.Config.ExportRedisPasswordFile; file != "" {
+		password, err := os.ReadFile(file)
+		if err != nil {
+			return Options{}, fmt.Errorf("failed to read Redis password: %w", err)
+		}
+		opts.Password = string(bytes.TrimRight(password, "\n"))
+	}
+	return opts, nil
+}
+
+func validateExporter(conf *option.ExporterConfig) error {
+	opts, err := optionsFromConfig(conf)
+	if err != nil {
+		return err
+	}
+	return opts.validate()
+}
+
+// checkExporter resolves the host of the server and loads the TLS CA, for
+// --check-config.
+func checkExporter(conf *option.ExporterConfig) error {
+	opts, err := optionsFromConfig(conf)
+	if err != nil {
+		return err
+	}
+	host, _, _ := net.SplitHostPort(opts.Address)
+	if err := exporter.ResolveHost(host); err != nil {
+		return err
+	}
+	_, err = opts.tlsConfig()
+	return err
+}
+
+func newExporter(ctx context.Context, conf *option.ExporterConfig) (exporter.ExportEncoder, io.Closer, error) {
+	opts, err := optionsFromConfig(conf)
+	if err != nil {
+		return nil, nil, err
+	}
+	if opts.DeadLetter, err = exporter.OpenDeadLetter(conf.Name); err != nil {
+		return nil, nil, err
+	}
+	writer, err := NewWriter(ctx, opts)
+	if err != nil {
+		opts.DeadLetter.Close()
+		return nil, nil, err
+	}
+	w, err := exporter.NewJSONWriter(writer)
+	if err != nil {
+		writer.Close()
+		return nil, nil, err
+	}
+	logger.GetLogger().Info("Starting Redis exporter", "address", opts.Address, "stream", opts.Stream)
+	return exporter.NewJSONEncoder(w), writer, nil
+}
+
+type Options struct {
+	// Address is the host:port of the Redis server.
+	Address string
+	// Stream is the key of the stream events are added to.
+	Stream string
+	// MaxLen, if positive, trims the stream to about this number of
+	// entries. Trimming is approximate, which is much cheaper for Redis.
+	MaxLen int
+	// Username and Password authenticate with AUTH if Password is set.
+	// Username may be empty for the default user.
+	Username string
+	Password string
+	// TLS enables TLS, verifying the server with the system CAs, or with
+	// the CAs of TLSCAFile if set.
+	TLS       bool
+	TLSCAFile string
+	// BatchSize is the maximum number of events sent at once.
+	BatchSize int
+	// FlushInterval is the maximum time an event is buffered before a
+	// partial batch is sent.
+	FlushInterval time.Duration
+	// Timeout is the timeout of connecting and of sending a batch.
+	Timeout time.Duration
+	// DeadLetter, if not nil, receives the events of the batches that
+	// could not be sent.
+	DeadLetter *exporter.DeadLetter
+}
+
+func (o *Options) validate() error {
+	if _, _, err := net.SplitHostPort(o.Address); err != nil {
+		return fmt.Errorf("invalid Redis address %q: %w", o.Address, err)
+	}
+	if o.Stream == "" {
+		return errors.New("invalid Redis stream: must not be empty")
+	}
+	if o.MaxLen < 0 {
+		return fmt.Errorf("invalid Redis stream max length %d: must not be negative", o.MaxLen)
+	}
+	if o.BatchSize <= 0 {
+		return fmt.Errorf("invalid Redis batch size %d: must be positive", o.BatchSize)
+	}
+	if o.FlushInterval <= 0 {
+		return fmt.Errorf("invalid Redis flush interval %s: must be positive", o.FlushInterval)
+	}
+	if o.Timeout <= 0 {
+		return fmt.Errorf("invalid Redis timeout %s: must be positive", o.Timeout)
+	}
+	return nil
+}
+
+// tlsConfig returns the TLS configuration of opts, or nil if TLS is not
+// enabled.
+func (o *Options) tlsConfig() (*tls.Config, error) {
+	if !o.TLS {
+		return nil, nil
+	}
+	host, _, _ := net.SplitHostPort(o.Address)
+	conf := &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+	if o.TLSCAFile != "" {
+		pem, err := os.ReadFile(o.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Redis CA file: %w", err)
+		}
+		conf.RootCAs = x509.NewCertPool()
+		if !conf.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in Redis CA file %s", o.TLSCAFile)
+		}
+	}
+	return conf, nil
+}
+
+// batch holds the XADD commands of a batch of events.
+type batch struct {
+	events int
+	data   []byte
+}
+
+// Writer is an io.WriteCloser that adds the JSON events written to it to a
+// Redis stream. Each call to Write is expected to contain one event followed
+// by a newline, as produced by the export encoders.
+//
+// Events are sent in batches of pipelined XADD commands by an
+// exporter.Batcher, so that a slow or unreachable server does not block
+// event export.
+type Writer struct {
+	opts      Options
+	tlsConfig *tls.Config
+	// prefix is the XADD command up to the event field.
+	prefix  [][]byte
+	batcher *exporter.Batcher[batch]
+
+	// conn and reader are only used by the sender goroutine of batcher.
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// NewWriter validates opts and returns a Writer that sends batches until it
+// is closed, see exporter.NewBatcher. It connects to the server when sending
+// the first batch.
+func NewWriter(ctx context.Context, opts Options) (*Writer, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	tlsConfig, err := opts.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	w := &Writer{opts: opts, tlsConfig: tlsConfig}
+	w.prefix = [][]byte{[]byte("XADD"), []byte(opts.Stream)}
+	if opts.MaxLen > 0 {
+		w.prefix = append(w.prefix, []byte("MAXLEN"), []byte("~"), []byte(strconv.Itoa(opts.MaxLen)))
+	}
+	// Clip the prefix so that appending the event never modifies it.
+	w.prefix = slices.Clip(append(w.prefix, []byte("*"), []byte(eventField)))
+	w.batcher = exporter.NewBatcher(ctx, exporter.BatcherOptions{
+		Name:          TypeRedis,
+		Destination:   opts.Address,
+		BatchSize:     opts.BatchSize,
+		FlushInterval: opts.FlushInterval,
+		Counter:       eventsTotal,
+		CountEvents:   true,
+		DeadLetter:    opts.DeadLetter,
+	}, w.send)
+	return w, nil
+}
+
+// Write implements io.Writer.
+func (w *Writer) Write(p []byte) (int, error) {
+	err := w.batcher.Add(func(b *batch) ([]byte, bool, error) {
+		b.data = appendCommand(b.data, append(w.prefix, bytes.TrimRight(p, "\n"))...)
+		b.events++
+		return p, false, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close sends any buffered events, waits for pending batches to be sent, for
+// up to exporter.BatchCloseTimeout, and closes the connection.
+func (w *Writer) Close() error {
+	err := w.batcher.Close()
+	w.disconnect()
+	return err
+}
+
+// SetSendResultFunc implements exporter.SendReporter.
+func (w *Writer) SetSendResultFunc(f func(err error)) {
+	w.batcher.SetSendResultFunc(f)
+}
+
+// send sends a batch, reconnecting once if the connection fails.
+func (w *Writer) send(ctx context.Context, b batch) error {
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		var retry bool
+		if retry, err = w.xadd(ctx, b); err == nil || !retry {
+			break
+		}
+	}
+	return err
+}
+
+// xadd sends the XADD commands of a batch and reads their replies. It
+// returns whether the batch may be sent again on a new connection.
+func (w *Writer) xadd(ctx context.Context, b batch) (bool, error) {
+	if w.conn == nil {
+		if err := w.connect(ctx); err != nil {
+			return false, err
+		}
+	}
+	if err := exporter.WaitBandwidth(ctx, len(b.data)); err != nil {
+		return false, err
+	}
+	w.conn.SetDeadline(time.Now().Add(w.opts.Timeout))
+	if _, err := w.conn.Write(b.data); err != nil {
+		w.disconnect()
+		return true, err
+	}
+	var errs error
+	for range b.events {
+		_, err := readReply(w.reader)
+		var replyErr replyError
+		if errors.As(err, &replyErr) {
+			// The server is fine but refused the event, for example
+			// because the key holds another type.
+			errs = errors.Join(errs, err)
+			continue
+		}
+		if err != nil {
+			// Some of the events may have been added already, so the
+			// batch is not sent again.
+			w.disconnect()
+			return false, err
+		}
+	}
+	return false, errs
+}
+
+func (w *Writer) connect(ctx context.Context) error {
+	dialer := &net.Dialer{Timeout: w.opts.Timeout}
+	var conn net.Conn
+	var err error
+	if w.tlsConfig != nil {
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: w.tlsConfig}
+		conn, err = tlsDialer.DialContext(ctx, "tcp", w.opts.Address)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", w.opts.Address)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+	w.conn, w.reader = conn, bufio.NewReader(conn)
+	if w.opts.Password == "" {
+		return nil
+	}
+	args := [][]byte{[]byte("AUTH")}
+	if w.opts.Username != "" {
+		args = append(args, []byte(w.opts.Username))
+	}
+	args = append(args, []byte(w.opts.Password))
+	conn.SetDeadline(time.Now().Add(w.opts.Timeout))
+	if _, err = conn.Write(appendCommand(nil, args...)); err == nil {
+		_, err = readReply(w.reader)
+	}
+	if err != nil {
+		w.disconnect()
+		return fmt.Errorf("failed to authenticate to Redis: %w", err)
+	}
+	return nil
+}
+
+func (w *Writer) disconnect() {
+	if w.conn != nil {
+		w.conn.Close()
+		w.conn, w.reader = nil, nil
+	}
+}
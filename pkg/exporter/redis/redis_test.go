@@ -0,0 +1,225 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package redis
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cilium/tetragon/pkg/exporter"
+	"github.com/cilium/tetragon/pkg/option"
+)
+
+func TestReadReply(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("+OK\r\n-ERR wrong type\r\n:3\r\n$5\r\na\r\nbc\r\n$-1\r\n*2\r\n$1\r\nx\r\n:1\r\n"))
+	for _, expected := range []any{"OK", nil, int64(3), "a\r\nbc", nil, []any{"x", int64(1)}} {
+		reply, err := readReply(r)
+		if expected == nil && reply == nil && err != nil {
+			assert.Equal(t, replyError("ERR wrong type"), err)
+			continue
+		}
+		require.NoError(t, err)
+		assert.Equal(t, expected, reply)
+	}
+}
+
+// fakeServer records the commands it receives, and replies to them with
+// reply.
+type fakeServer struct {
+	l     net.Listener
+	reply func(cmd []string) string
+
+	mu       sync.Mutex
+	commands [][]string
+	conns    []net.Conn
+}
+
+func newFakeServer(t *testing.T, reply func(cmd []string) string) *fakeServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	s := &fakeServer{l: l, reply: reply}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns = append(s.conns, conn)
+			s.mu.Unlock()
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		v, err := readReply(r)
+		if err != nil {
+			return
+		}
+		var cmd []string
+		for _, arg := range v.([]any) {
+			cmd = append(cmd, arg.(string))
+		}
+		s.mu.Lock()
+		s.commands = append(s.commands, cmd)
+		s.mu.Unlock()
+		if _, err := conn.Write([]byte(s.reply(cmd))); err != nil {
+			return
+		}
+	}
+}
+
+// closeConns closes the connections of the clients.
+func (s *fakeServer) closeConns() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+}
+
+func (s *fakeServer) received() [][]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.commands
+}
+
+func testOptions(address string) Options {
+	return Options{
+		Address:       address,
+		Stream:        "events",
+		BatchSize:     2,
+		FlushInterval: time.Hour,
+		Timeout:       5 * time.Second,
+	}
+}
+
+func TestWriter(t *testing.T) {
+	s := newFakeServer(t, func(cmd []string) string {
+		if cmd[0] == "AUTH" {
+			return "+OK\r\n"
+		}
+		return "$15\r\n1700000000000-0\r\n"
+	})
+	opts := testOptions(s.l.Addr().String())
+	opts.MaxLen = 1000
+	opts.Username = "tetragon"
+	opts.Password = "secret"
+	w, err := NewWriter(context.Background(), opts)
+	require.NoError(t, err)
+
+	for _, event := range []string{`{"a":1}`, `{"b":2}`, `{"c":3}`} {
+		_, err := w.Write([]byte(event + "\n"))
+		require.NoError(t, err)
+	}
+	// The first batch is full and sent, the second one is sent on close.
+	require.Eventually(t, func() bool { return len(s.received()) == 3 }, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, w.Close())
+	assert.Equal(t, [][]string{
+		{"AUTH", "tetragon", "secret"},
+		{"XADD", "events", "MAXLEN", "~", "1000", "*", "event", `{"a":1}`},
+		{"XADD", "events", "MAXLEN", "~", "1000", "*", "event", `{"b":2}`},
+		{"XADD", "events", "MAXLEN", "~", "1000", "*", "event", `{"c":3}`},
+	}, s.received())
+}
+
+func TestWriter_Reconnect(t *testing.T) {
+	s := newFakeServer(t, func(_ []string) string {
+		return "$3\r\n1-0\r\n"
+	})
+	w, err := NewWriter(context.Background(), testOptions(s.l.Addr().String()))
+	require.NoError(t, err)
+	defer w.Close()
+
+	w.Write([]byte(`{"a":1}` + "\n"))
+	w.Write([]byte(`{"b":2}` + "\n"))
+	require.Eventually(t, func() bool { return len(s.received()) == 2 }, 5*time.Second, 10*time.Millisecond)
+
+	// Once the server closes the connection, events are sent on a new
+	// one. The batch sent when the connection is closed may be lost.
+	s.closeConns()
+	failed := testutil.ToFloat64(eventsTotal.WithLabelValues(exporter.BatchFailed))
+	w.Write([]byte(`{"c":3}` + "\n"))
+	w.Write([]byte(`{"d":4}` + "\n"))
+	require.Eventually(t, func() bool {
+		return len(s.received()) == 4 || testutil.ToFloat64(eventsTotal.WithLabelValues(exporter.BatchFailed)) > failed
+	}, 5*time.Second, 10*time.Millisecond)
+	w.Write([]byte(`{"e":5}` + "\n"))
+	w.Write([]byte(`{"f":6}` + "\n"))
+	require.Eventually(t, func() bool {
+		received := s.received()
+		return len(received) >= 4 && slices.Equal(received[len(received)-1], []string{"XADD", "events", "*", "event", `{"f":6}`})
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestWriter_DeadLetter(t *testing.T) {
+	s := newFakeServer(t, func(_ []string) string {
+		return "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"
+	})
+	file := filepath.Join(t.TempDir(), "dead-letter.json")
+	defer func(file string, size int) {
+		option.Config.ExportDeadLetterFile, option.Config.ExportDeadLetterMaxSizeMB = file, size
+	}(option.Config.ExportDeadLetterFile, option.Config.ExportDeadLetterMaxSizeMB)
+	option.Config.ExportDeadLetterFile, option.Config.ExportDeadLetterMaxSizeMB = file, 1
+	opts := testOptions(s.l.Addr().String())
+	var err error
+	opts.DeadLetter, err = exporter.OpenDeadLetter("redis-test")
+	require.NoError(t, err)
+
+	w, err := NewWriter(context.Background(), opts)
+	require.NoError(t, err)
+	w.Write([]byte(`{"a":1}` + "\n"))
+	w.Write([]byte(`{"b":2}` + "\n"))
+	require.NoError(t, w.Close())
+
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 2)
+	for i, line := range lines {
+		var record exporter.DeadLetterRecord
+		require.NoError(t, json.Unmarshal([]byte(line), &record))
+		assert.Equal(t, "redis-test", record.Exporter)
+		assert.Contains(t, record.Error, "WRONGTYPE")
+		assert.JSONEq(t, []string{`{"a":1}`, `{"b":2}`}[i], string(record.Event))
+	}
+}
+
+func TestOptions_validate(t *testing.T) {
+	opts := testOptions("redis:6379")
+	require.NoError(t, opts.validate())
+	opts.Address = "redis"
+	require.ErrorContains(t, opts.validate(), "invalid Redis address")
+	opts = testOptions("redis:6379")
+	opts.Stream = ""
+	require.ErrorContains(t, opts.validate(), "invalid Redis stream")
+	opts = testOptions("redis:6379")
+	opts.MaxLen = -1
+	require.ErrorContains(t, opts.validate(), "max length")
+}
+
+func TestAppendCommand(t *testing.T) {
+	assert.Equal(t, "*2\r\n$4\r\nPING\r\n$0\r\n\r\n", string(appendCommand(nil, []byte("PING"), nil)))
+	assert.True(t, bytes.HasPrefix(appendCommand([]byte("x"), []byte("a")), []byte("x*1")))
+}
@@ -0,0 +1,81 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package redis
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// appendCommand appends a command in the RESP2 protocol of Redis: an array
+// of bulk strings.
+func appendCommand(dst []byte, args ...[]byte) []byte {
+	dst = append(dst, '*')
+	dst = strconv.AppendInt(dst, int64(len(args)), 10)
+	dst = append(dst, "\r\n"...)
+	for _, arg := range args {
+		dst = append(dst, '$')
+		dst = strconv.AppendInt(dst, int64(len(arg)), 10)
+		dst = append(dst, "\r\n"...)
+		dst = append(dst, arg...)
+		dst = append(dst, "\r\n"...)
+	}
+	return dst
+}
+
+// replyError is an error reply of the server, such as "WRONGPASS invalid
+// username-password pair".
+type replyError string
+
+func (e replyError) Error() string {
+	return "redis: " + string(e)
+}
+
+// readReply reads a reply. Simple and bulk strings are returned as strings,
+// integers as int64, arrays as []any and nil replies as nil. Error replies
+// are returned as a replyError.
+func readReply(r *bufio.Reader) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("redis: invalid reply %q", line)
+	}
+	kind, line := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return line, nil
+	case '-':
+		return nil, replyError(line)
+	case ':':
+		return strconv.ParseInt(line, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return string(data[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		array := make([]any, n)
+		for i := range array {
+			if array[i], err = readReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return array, nil
+	}
+	return nil, errors.New("redis: invalid reply type " + strconv.Quote(string(kind)))
+}
@@ -0,0 +1,202 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"slices"
+
+	"github.com/cilium/tetragon/api/v1/tetragon"
+	"github.com/cilium/tetragon/pkg/option"
+	"github.com/cilium/tetragon/pkg/ratelimit"
+	"github.com/cilium/tetragon/pkg/server"
+)
+
+// Factory creates the encoder that writes events to an export destination.
+// The returned io.Closer, if not nil, is closed when the exporter stops.
+type Factory func(ctx context.Context, conf *option.ExporterConfig) (ExportEncoder, io.Closer, error)
+
+// Validator checks the configuration of an exporter without creating it, for
+// example to report configuration errors before the agent starts.
+type Validator func(conf *option.ExporterConfig) error
+
+// Checker checks the destination of an exporter, for example by resolving
+// its host and loading its TLS material. Unlike validators, checkers are only
+// run by --check-config and not on reloads, which must not fail because a
+// host is temporarily unresolvable.
+type Checker func(conf *option.ExporterConfig) error
+
+var (
+	registeredFactories  = map[string]Factory{}
+	registeredValidators = map[string]Validator{}
+	registeredCheckers   = map[string]Checker{}
+)
+
+// RegisterAtInit registers a factory for an exporter type.
+//
+// This function is meant to be called in an init() by exporter
+// implementations.
+func RegisterAtInit(typ string, f Factory) {
+	if _, exists := registeredFactories[typ]; exists {
+		panic(fmt.Sprintf("RegisterAtInit called, but %s is already registered", typ))
+	}
+	registeredFactories[typ] = f
+}
+
+// RegisterValidatorAtInit registers a validator for an exporter type.
+//
+// This function is meant to be called in an init() by exporter
+// implementations.
+func RegisterValidatorAtInit(typ string, v Validator) {
+	if _, exists := registeredValidators[typ]; exists {
+		panic(fmt.Sprintf("RegisterValidatorAtInit called, but %s is already registered", typ))
+	}
+	registeredValidators[typ] = v
+}
+
+// RegisterCheckerAtInit registers a checker for an exporter type.
+//
+// This function is meant to be called in an init() by exporter
+// implementations.
+func RegisterCheckerAtInit(typ string, c Checker) {
+	if _, exists := registeredCheckers[typ]; exists {
+		panic(fmt.Sprintf("RegisterCheckerAtInit called, but %s is already registered", typ))
+	}
+	registeredCheckers[typ] = c
+}
+
+// Validate checks that the type of conf is registered, and runs the
+// validator of the type if there is one.
+func Validate(conf *option.ExporterConfig) error {
+	if _, ok := registeredFactories[conf.Type]; !ok {
+		return fmt.Errorf("unknown exporter type %q, known types are %v", conf.Type, Types())
+	}
+	if _, _, err := conf.RateLimitSettings(); err != nil {
+		return err
+	}
+	if _, err := ParsePriorities(option.Config.ExportPriorities); err != nil {
+		return err
+	}
+	if _, err := limitSchedule(); err != nil {
+		return err
+	}
+	if _, err := newSigner(); err != nil {
+		return err
+	}
+	if _, err := ExportLabels(); err != nil {
+		return err
+	}
+	if _, err := newStages(conf); err != nil {
+		return err
+	}
+	if len(conf.Templates) > 0 && conf.Type != TypeFile {
+		return fmt.Errorf("exporter %q: templates are only supported by the %s exporter", conf.Name, TypeFile)
+	}
+	if v, ok := registeredValidators[conf.Type]; ok {
+		return v(conf)
+	}
+	return nil
+}
+
+// Check runs Validate, and then the checker of the type of conf if there is
+// one.
+func Check(conf *option.ExporterConfig) error {
+	if err := Validate(conf); err != nil {
+		return err
+	}
+	if c, ok := registeredCheckers[conf.Type]; ok {
+		return c(conf)
+	}
+	return nil
+}
+
+// ResolveHost returns an error if host cannot be resolved, for checkers.
+func ResolveHost(host string) error {
+	if _, err := net.LookupHost(host); err != nil {
+		return fmt.Errorf("failed to resolve %q: %w", host, err)
+	}
+	return nil
+}
+
+// Types returns the sorted list of registered exporter types.
+func Types() []string {
+	return slices.Sorted(maps.Keys(registeredFactories))
+}
+
+// NewFromConfig creates an exporter for conf using the factory registered
+// for its type. The exporter sends the events matching request and must be
+// started with Start. Like Validate, it reads the export options of
+// option.Config, and is called with option.RLockExportFlags held when they
+// can be reloaded. The running exporter does not read them.
+func NewFromConfig(
+	ctx context.Context,
+	conf *option.ExporterConfig,
+	request *tetragon.GetEventsRequest,
+	server *server.Server,
+) (*Exporter, error) {
+	f, ok := registeredFactories[conf.Type]
+	if !ok {
+		return nil, fmt.Errorf("unknown exporter type %q, known types are %v", conf.Type, Types())
+	}
+	limit, interval, err := conf.RateLimitSettings()
+	if err != nil {
+		return nil, err
+	}
+	priorities, err := ParsePriorities(option.Config.ExportPriorities)
+	if err != nil {
+		return nil, err
+	}
+	schedule, err := limitSchedule()
+	if err != nil {
+		return nil, err
+	}
+	stages, err := newStages(conf)
+	if err != nil {
+		return nil, err
+	}
+	setBandwidthLimits(option.Config.ExportMaxBytesPerSecond, schedule)
+	encoder, closer, err := f(ctx, conf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s exporter %q: %w", conf.Type, conf.Name, err)
+	}
+	e := NewExporter(ctx, request, server, encoder, closer, nil)
+	rateLimiter := ratelimit.NewRateLimiter(ctx, interval, limit, e)
+	if rateLimiter == nil && schedule.HasRateLimits() {
+		// Events are only limited in some windows of the schedule.
+		rateLimiter = ratelimit.NewRateLimiter(ctx, interval, 0, e)
+	}
+	if rateLimiter != nil {
+		if burst := conf.RateLimitBurstSetting(); burst > 0 {
+			rateLimiter.SetBurst(burst)
+		}
+		if conf.RateLimitAdaptiveSetting() {
+			rateLimiter.EnableAdaptive()
+		}
+		if schedule.HasRateLimits() {
+			rateLimiter.SetSchedule(schedule, limit, conf.RateLimitBurstSetting())
+		}
+	}
+	e.rateLimiter = rateLimiter
+	e.name = conf.Name
+	e.health = newHealth(conf.Name)
+	if r, ok := closer.(SendReporter); ok {
+		r.SetSendResultFunc(e.health.record)
+		e.sendsReported = true
+	}
+	e.SetQueueSize(conf.QueueSizeSetting())
+	e.SetShedUnderPressure(option.Config.ExportShedExitEvents, option.Config.ExportAggregationWindowSize)
+	e.SetPriorities(priorities)
+	e.SetStages(stages)
+	if conf.Type == TypeStdout {
+		// The stdout exporter only prints a sample of the events.
+		e.mirror = true
+	} else {
+		e.SetRetention(option.Config.ExportRetentionWindow, option.Config.ExportRetentionMaxEvents)
+	}
+	return e, nil
+}
@@ -0,0 +1,68 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package exporter
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cilium/tetragon/api/v1/tetragon"
+	"github.com/cilium/tetragon/pkg/encoder"
+	"github.com/cilium/tetragon/pkg/option"
+	"github.com/cilium/tetragon/pkg/rthooks"
+	"github.com/cilium/tetragon/pkg/server"
+)
+
+var testResults = newArrayWriter(1)
+
+func init() {
+	RegisterAtInit("test", func(_ context.Context, _ *option.ExporterConfig) (ExportEncoder, io.Closer, error) {
+		return encoder.NewProtojsonEncoder(testResults), testResults, nil
+	})
+}
+
+func TestRegistry(t *testing.T) {
+	assert.Subset(t, Types(), []string{TypeFile, TypeStdout, "test"})
+	assert.Panics(t, func() { RegisterAtInit(TypeFile, newFileExporter) })
+
+	option.Config.ExportRateLimit = -1
+
+	var wg sync.WaitGroup
+	ctx, cancel := context.WithCancel(context.Background())
+	eventNotifier := newFakeNotifier()
+	grpcServer := server.NewServer(ctx, &wg, eventNotifier, &server.FakeObserver{}, rthooks.DummyHookRunner{})
+	request := &tetragon.GetEventsRequest{}
+
+	_, err := NewFromConfig(ctx, &option.ExporterConfig{Name: "bogus", Type: "bogus"}, request, grpcServer)
+	require.Error(t, err)
+	require.Error(t, Validate(&option.ExporterConfig{Name: "bogus", Type: "bogus"}))
+	require.NoError(t, Validate(&option.ExporterConfig{Name: "test", Type: "test"}))
+	require.Error(t, Validate(&option.ExporterConfig{Name: "file", Type: TypeFile, Options: map[string]string{"filename": t.TempDir()}}))
+	savedPerm := option.Config.ExportFilePerm
+	option.Config.ExportFilePerm = "0800"
+	_, _, err = newFileExporter(ctx, &option.ExporterConfig{Name: "file", Type: TypeFile, Options: map[string]string{"filename": filepath.Join(t.TempDir(), "events.log")}})
+	require.Error(t, err, "invalid permissions are not ignored")
+	option.Config.ExportFilePerm = savedPerm
+
+	exporter, err := NewFromConfig(ctx, &option.ExporterConfig{Name: "test", Type: "test"}, request, grpcServer)
+	require.NoError(t, err)
+	require.NoError(t, exporter.Start())
+	eventNotifier.NotifyListener(nil, &tetragon.GetEventsResponse{
+		Event: &tetragon.GetEventsResponse_ProcessExec{
+			ProcessExec: &tetragon.ProcessExec{Process: &tetragon.Process{Binary: "a"}},
+		}})
+	<-testResults.done
+	assert.Equal(t, []string{`{"process_exec":{"process":{"binary":"a"}}}`}, testResults.items)
+	assert.InDelta(t, 1, testutil.ToFloat64(exporterEventsTotal.WithLabelValues(statusExported, "test")), 0)
+	cancel()
+	<-eventNotifier.removed
+	<-exporter.Done()
+}
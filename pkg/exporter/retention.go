@@ -0,0 +1,63 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package exporter
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cilium/tetragon/api/v1/tetragon"
+)
+
+type retainedEvent struct {
+	event    *tetragon.GetEventsResponse
+	exported time.Time
+}
+
+// retention keeps the most recently exported events in a ring buffer, so
+// that they can be exported again after a collector outage. Events are kept
+// for at most window, and at most len(events) events are kept.
+type retention struct {
+	mu     sync.Mutex
+	window time.Duration
+	events []retainedEvent
+	// next is the index the next event is written to, and count the number
+	// of events in the buffer.
+	next  int
+	count int
+}
+
+func newRetention(window time.Duration, maxEvents int) *retention {
+	return &retention{
+		window: window,
+		events: make([]retainedEvent, maxEvents),
+	}
+}
+
+func (r *retention) add(event *tetragon.GetEventsResponse, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events[r.next] = retainedEvent{event: event, exported: now}
+	r.next = (r.next + 1) % len(r.events)
+	r.count = min(r.count+1, len(r.events))
+}
+
+// snapshot returns the events exported within the window before now, oldest
+// first.
+func (r *retention) snapshot(now time.Time) []*tetragon.GetEventsResponse {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	events := make([]*tetragon.GetEventsResponse, 0, r.count)
+	start := r.next - r.count
+	if start < 0 {
+		start += len(r.events)
+	}
+	for i := range r.count {
+		e := r.events[(start+i)%len(r.events)]
+		if now.Sub(e.exported) <= r.window {
+			events = append(events, e.event)
+		}
+	}
+	return events
+}
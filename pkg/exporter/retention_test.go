@@ -0,0 +1,72 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package exporter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cilium/tetragon/api/v1/tetragon"
+	"github.com/cilium/tetragon/pkg/encoder"
+)
+
+func execEvent(binary string) *tetragon.GetEventsResponse {
+	return &tetragon.GetEventsResponse{
+		Event: &tetragon.GetEventsResponse_ProcessExec{
+			ProcessExec: &tetragon.ProcessExec{Process: &tetragon.Process{Binary: binary}},
+		}}
+}
+
+func binaries(events []*tetragon.GetEventsResponse) []string {
+	var res []string
+	for _, ev := range events {
+		res = append(res, ev.GetProcessExec().GetProcess().GetBinary())
+	}
+	return res
+}
+
+func TestRetention(t *testing.T) {
+	now := time.Now()
+	r := newRetention(time.Minute, 3)
+	assert.Empty(t, r.snapshot(now))
+
+	r.add(execEvent("a"), now.Add(-2*time.Minute))
+	r.add(execEvent("b"), now.Add(-30*time.Second))
+	assert.Equal(t, []string{"b"}, binaries(r.snapshot(now)), "old events are not replayed")
+
+	r.add(execEvent("c"), now)
+	r.add(execEvent("d"), now)
+	assert.Equal(t, []string{"b", "c", "d"}, binaries(r.snapshot(now)))
+	r.add(execEvent("e"), now)
+	assert.Equal(t, []string{"c", "d", "e"}, binaries(r.snapshot(now)), "buffer is bounded")
+}
+
+func TestExporter_Replay(t *testing.T) {
+	results := newArrayWriter(10)
+	exporter := NewExporter(context.Background(), &tetragon.GetEventsRequest{}, nil, encoder.NewProtojsonEncoder(results), results, nil)
+	exporter.name = "replay-test"
+	assert.Equal(t, 0, exporter.Replay())
+
+	exporter.SetRetention(time.Minute, 2)
+	for _, binary := range []string{"a", "b", "c"} {
+		require.NoError(t, exporter.Send(execEvent(binary)))
+	}
+	assert.Equal(t, 2, exporter.Replay())
+	assert.Equal(t, []string{
+		`{"process_exec":{"process":{"binary":"a"}}}`,
+		`{"process_exec":{"process":{"binary":"b"}}}`,
+		`{"process_exec":{"process":{"binary":"c"}}}`,
+		`{"process_exec":{"process":{"binary":"b"}}}`,
+		`{"process_exec":{"process":{"binary":"c"}}}`,
+	}, results.items)
+	assert.InDelta(t, 2, testutil.ToFloat64(exporterEventsTotal.WithLabelValues(statusReplayed, "replay-test")), 0)
+
+	// Replayed events are not retained again.
+	assert.Equal(t, 2, exporter.Replay())
+}
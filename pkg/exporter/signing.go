@@ -0,0 +1,42 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package exporter
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/cilium/tetragon/pkg/signing"
+)
+
+// signingWriter adds a signature to every JSON event written to it. Like
+// labelsWriter, it expects one JSON object followed by a newline per Write.
+// Events that cannot be signed are not written.
+type signingWriter struct {
+	w      io.Writer
+	signer *signing.Signer
+	buf    []byte
+}
+
+// NewSigningWriter returns a writer that signs the JSON events written to w,
+// or w itself if signer is nil.
+func NewSigningWriter(w io.Writer, signer *signing.Signer) io.Writer {
+	if signer == nil {
+		return w
+	}
+	return &signingWriter{w: w, signer: signer}
+}
+
+func (s *signingWriter) Write(p []byte) (int, error) {
+	buf, err := s.signer.AppendSigned(s.buf[:0], bytes.TrimRight(p, "\n"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to sign event: %w", err)
+	}
+	s.buf = append(buf, '\n')
+	if _, err := s.w.Write(s.buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,74 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cilium/tetragon/api/v1/tetragon"
+	"github.com/cilium/tetragon/pkg/encoder"
+	"github.com/cilium/tetragon/pkg/signing"
+)
+
+func TestSigningWriter(t *testing.T) {
+	var buf bytes.Buffer
+	assert.Same(t, &buf, NewSigningWriter(&buf, nil))
+
+	signer, err := signing.NewSigner(signing.AlgHMACSHA256, "k1", []byte("secret"))
+	require.NoError(t, err)
+	w, err := NewLabelsWriter(NewSigningWriter(&buf, signer), map[string]string{"env": "prod"})
+	require.NoError(t, err)
+	enc := encoder.NewProtojsonEncoder(w)
+	require.NoError(t, enc.Encode(&tetragon.GetEventsResponse{
+		Event: &tetragon.GetEventsResponse_ProcessExec{
+			ProcessExec: &tetragon.ProcessExec{Process: &tetragon.Process{Binary: "a"}},
+		}}))
+	require.NoError(t, enc.Encode(&tetragon.GetEventsResponse{}))
+
+	verifier, err := signing.NewVerifier(signing.AlgHMACSHA256, []byte("secret"))
+	require.NoError(t, err)
+	lines := bytes.Split(bytes.TrimSuffix(buf.Bytes(), []byte("\n")), []byte("\n"))
+	require.Len(t, lines, 2)
+	for _, line := range lines {
+		assert.Contains(t, string(line), `"labels":{"env":"prod"},"signature":`, "labels are signed")
+		keyID, err := verifier.Verify(line)
+		require.NoError(t, err)
+		assert.Equal(t, "k1", keyID)
+	}
+}
+
+// rawEncoder writes its values as they are, so that they are not JSON
+// objects.
+type rawEncoder struct {
+	w io.Writer
+}
+
+func (e rawEncoder) Encode(v interface{}) error {
+	_, err := io.WriteString(e.w, v.(*tetragon.GetEventsResponse).GetNodeName()+"\n")
+	return err
+}
+
+func TestSigningWriter_Failure(t *testing.T) {
+	var buf bytes.Buffer
+	signer, err := signing.NewSigner(signing.AlgHMACSHA256, "k1", []byte("secret"))
+	require.NoError(t, err)
+	w := NewSigningWriter(&buf, signer)
+	_, err = w.Write([]byte("not json\n"))
+	require.Error(t, err)
+	assert.Empty(t, buf.String(), "events that cannot be signed are not written")
+
+	exporter := NewExporter(context.Background(), &tetragon.GetEventsRequest{}, nil, rawEncoder{w}, nil, nil)
+	exporter.name = "signing-test"
+	require.NoError(t, exporter.Send(&tetragon.GetEventsResponse{NodeName: "n1"}))
+	assert.Empty(t, buf.String())
+	assert.InDelta(t, 1, testutil.ToFloat64(exporterEventsTotal.WithLabelValues(statusFailed, "signing-test")), 0)
+	assert.InDelta(t, 0, testutil.ToFloat64(exporterEventsTotal.WithLabelValues(statusExported, "signing-test")), 0)
+}
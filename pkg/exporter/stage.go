@@ -0,0 +1,144 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package exporter
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cilium/tetragon/api/v1/tetragon"
+	"github.com/cilium/tetragon/pkg/fieldfilters"
+	"github.com/cilium/tetragon/pkg/option"
+)
+
+// Stage processes the events of an exporter before they are rate limited
+// and encoded. Stages run in order, each one on the output of the previous
+// one. Rate limiting, queueing and encoding are not stages: they are set up
+// by the Exporter from its own configuration, and always run after the
+// stages.
+type Stage interface {
+	// Process returns the event to pass to the next stage, or nil to drop
+	// it. Events are shared between exporters, so a stage changing an
+	// event must return a copy.
+	Process(event *tetragon.GetEventsResponse) *tetragon.GetEventsResponse
+}
+
+// StageFunc is a Stage implemented by a function.
+type StageFunc func(event *tetragon.GetEventsResponse) *tetragon.GetEventsResponse
+
+func (f StageFunc) Process(event *tetragon.GetEventsResponse) *tetragon.GetEventsResponse {
+	return f(event)
+}
+
+// StageFactory creates a stage from its options.
+type StageFactory func(options map[string]string) (Stage, error)
+
+var registeredStages = map[string]StageFactory{}
+
+// RegisterStageAtInit registers a factory for a stage type, so that the
+// stage can be used in the stages of exporters.
+//
+// This function is meant to be called in an init() by stage
+// implementations.
+func RegisterStageAtInit(typ string, f StageFactory) {
+	if _, exists := registeredStages[typ]; exists {
+		panic(fmt.Sprintf("RegisterStageAtInit called, but %s is already registered", typ))
+	}
+	registeredStages[typ] = f
+}
+
+// StageTypes returns the sorted list of registered stage types.
+func StageTypes() []string {
+	return slices.Sorted(maps.Keys(registeredStages))
+}
+
+// newStages creates the stages of an exporter.
+func newStages(conf *option.ExporterConfig) ([]Stage, error) {
+	var stages []Stage
+	for i, sc := range conf.Stages {
+		f, ok := registeredStages[sc.Type]
+		if !ok {
+			return nil, fmt.Errorf("exporter %q: unknown stage type %q at index %d, known types are %v", conf.Name, sc.Type, i, StageTypes())
+		}
+		s, err := f(sc.Options)
+		if err != nil {
+			return nil, fmt.Errorf("exporter %q: invalid %s stage at index %d: %w", conf.Name, sc.Type, i, err)
+		}
+		stages = append(stages, s)
+	}
+	return stages, nil
+}
+
+const (
+	StageSample        = "sample"
+	StageExcludeFields = "exclude-fields"
+	StageSizeBudget    = "size-budget"
+)
+
+func init() {
+	RegisterStageAtInit(StageSample, newSampleStage)
+	RegisterStageAtInit(StageExcludeFields, newExcludeFieldsStage)
+	RegisterStageAtInit(StageSizeBudget, newSizeBudgetStage)
+}
+
+// sampleStage keeps a ratio of the events, evenly spread.
+type sampleStage struct {
+	mu    sync.Mutex
+	ratio float64
+	seen  uint64
+}
+
+// newSampleStage returns a stage keeping the ratio of events set by the
+// "ratio" option, between 0 and 1.
+func newSampleStage(options map[string]string) (Stage, error) {
+	ratio, err := strconv.ParseFloat(options["ratio"], 64)
+	if err != nil || ratio <= 0 || ratio > 1 {
+		return nil, fmt.Errorf("invalid ratio %q: must be more than 0 and at most 1", options["ratio"])
+	}
+	return &sampleStage{ratio: ratio}, nil
+}
+
+func (s *sampleStage) Process(event *tetragon.GetEventsResponse) *tetragon.GetEventsResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Keep an event each time the number of events to keep so far
+	// increases.
+	before := uint64(float64(s.seen) * s.ratio)
+	s.seen++
+	if uint64(float64(s.seen)*s.ratio) == before {
+		return nil
+	}
+	return event
+}
+
+// newExcludeFieldsStage returns a stage removing the comma-separated fields
+// of the "fields" option, such as "process.arguments,process.pod.labels",
+// from all events.
+func newExcludeFieldsStage(options map[string]string) (Stage, error) {
+	var fields []string
+	for f := range strings.SplitSeq(options["fields"], ",") {
+		if f = strings.TrimSpace(f); f != "" {
+			fields = append(fields, f)
+		}
+	}
+	if len(fields) == 0 {
+		return nil, errors.New("no fields")
+	}
+	filter, err := fieldfilters.NewExcludeFieldFilter(nil, fields, false)
+	if err != nil {
+		return nil, err
+	}
+	return StageFunc(func(event *tetragon.GetEventsResponse) *tetragon.GetEventsResponse {
+		filtered, err := filter.Filter(event)
+		if err != nil {
+			return event
+		}
+		return filtered
+	}), nil
+}
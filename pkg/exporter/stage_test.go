@@ -0,0 +1,84 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package exporter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cilium/tetragon/api/v1/tetragon"
+	"github.com/cilium/tetragon/pkg/encoder"
+	"github.com/cilium/tetragon/pkg/option"
+)
+
+func TestNewStages(t *testing.T) {
+	stages, err := newStages(&option.ExporterConfig{Name: "test", Stages: []option.StageConfig{
+		{Type: StageSample, Options: map[string]string{"ratio": "0.25"}},
+		{Type: StageExcludeFields, Options: map[string]string{"fields": "process.arguments, process.pid"}},
+	}})
+	require.NoError(t, err)
+	require.Len(t, stages, 2)
+
+	for _, sc := range []option.StageConfig{
+		{Type: "unknown"},
+		{Type: StageSample},
+		{Type: StageSample, Options: map[string]string{"ratio": "1.5"}},
+		{Type: StageExcludeFields},
+	} {
+		_, err := newStages(&option.ExporterConfig{Name: "test", Stages: []option.StageConfig{sc}})
+		require.Error(t, err, sc)
+	}
+}
+
+func TestSampleStage(t *testing.T) {
+	stage, err := newSampleStage(map[string]string{"ratio": "0.25"})
+	require.NoError(t, err)
+	var kept []int
+	for i := range 12 {
+		if stage.Process(execEvent("a")) != nil {
+			kept = append(kept, i)
+		}
+	}
+	assert.Equal(t, []int{3, 7, 11}, kept)
+}
+
+func TestExcludeFieldsStage(t *testing.T) {
+	stage, err := newExcludeFieldsStage(map[string]string{"fields": "process.arguments"})
+	require.NoError(t, err)
+	event := &tetragon.GetEventsResponse{
+		Event: &tetragon.GetEventsResponse_ProcessExec{ProcessExec: &tetragon.ProcessExec{
+			Process: &tetragon.Process{Binary: "/bin/sh", Arguments: "-c secret"},
+		}},
+		NodeName: "node1",
+	}
+	filtered := stage.Process(event)
+	assert.Equal(t, "/bin/sh", filtered.GetProcessExec().GetProcess().GetBinary())
+	assert.Empty(t, filtered.GetProcessExec().GetProcess().GetArguments())
+	assert.Equal(t, "node1", filtered.GetNodeName())
+	assert.Equal(t, "-c secret", event.GetProcessExec().GetProcess().GetArguments(), "the original event is not modified")
+}
+
+func TestExporter_Stages(t *testing.T) {
+	results := newArrayWriter(10)
+	exporter := NewExporter(context.Background(), &tetragon.GetEventsRequest{}, nil, encoder.NewProtojsonEncoder(results), results, nil)
+	exporter.name = "stages-test"
+	exporter.SetStages([]Stage{StageFunc(func(event *tetragon.GetEventsResponse) *tetragon.GetEventsResponse {
+		if event.GetProcessExec().GetProcess().GetBinary() == "drop" {
+			return nil
+		}
+		return event
+	})})
+	for _, binary := range []string{"a", "drop", "b"} {
+		require.NoError(t, exporter.Send(execEvent(binary)))
+	}
+	assert.Equal(t, []string{
+		`{"process_exec":{"process":{"binary":"a"}}}`,
+		`{"process_exec":{"process":{"binary":"b"}}}`,
+	}, results.items)
+	assert.InDelta(t, 1, testutil.ToFloat64(exporterEventsTotal.WithLabelValues(statusStageDropped, "stages-test")), 0)
+}
@@ -0,0 +1,84 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package exporter
+
+import (
+	"context"
+	"io"
+	"os"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/cilium/tetragon/pkg/encoder"
+	"github.com/cilium/tetragon/pkg/logger"
+	"github.com/cilium/tetragon/pkg/logger/logfields"
+	"github.com/cilium/tetragon/pkg/option"
+)
+
+const TypeStdout = "stdout"
+
+func init() {
+	RegisterAtInit(TypeStdout, newStdoutExporter)
+	RegisterValidatorAtInit(TypeStdout, validateStdoutExporter)
+}
+
+func validateStdoutExporter(conf *option.ExporterConfig) error {
+	return validateFormatName(conf.Option("format", FormatCompact))
+}
+
+// newStdoutExporter prints a sample of the exported events to stdout, so
+// that they can be inspected on the console. Events are printed in compact
+// format, or in the format set by the "format" option. They are not signed
+// or counted in the exported bytes.
+func newStdoutExporter(_ context.Context, conf *option.ExporterConfig) (ExportEncoder, io.Closer, error) {
+	var stdout ExportEncoder = encoder.NewCompactEncoder(os.Stdout, encoder.Never, true, false, false)
+	format := conf.Option("format", FormatCompact)
+	if format != FormatCompact {
+		var err error
+		if stdout, err = newFormatEncoder(os.Stdout, format, false); err != nil {
+			return nil, nil, err
+		}
+	}
+	logger.GetLogger().Info("Printing exported events to stdout", "rateLimit", option.Config.StdoutOutputRateLimit, "format", format)
+	return NewSampledEncoder(stdout, 1*time.Minute, option.Config.StdoutOutputRateLimit), nil, nil
+}
+
+// SampledEncoder is an ExportEncoder that passes at most a fixed number of
+// events per interval to the underlying encoder and silently skips the rest.
+// Unlike the export rate limiter it does not account for skipped events.
+type SampledEncoder struct {
+	encoder ExportEncoder
+	limiter *rate.Limiter
+}
+
+// NewSampledEncoder returns a SampledEncoder that encodes at most numEvents
+// events per interval. A negative numEvents disables sampling.
+func NewSampledEncoder(enc ExportEncoder, interval time.Duration, numEvents int) *SampledEncoder {
+	var limiter *rate.Limiter
+	if numEvents >= 0 {
+		limit := rate.Limit(0)
+		if numEvents > 0 {
+			limit = rate.Every(interval / time.Duration(numEvents))
+		}
+		limiter = rate.NewLimiter(limit, numEvents)
+	}
+	return &SampledEncoder{
+		encoder: enc,
+		limiter: limiter,
+	}
+}
+
+// Encode implements ExportEncoder.Encode.
+func (s *SampledEncoder) Encode(v interface{}) error {
+	if s.limiter != nil && !s.limiter.Allow() {
+		return nil
+	}
+	if err := s.encoder.Encode(v); err != nil {
+		// Not every event has a compact representation, and this
+		// output is only meant for humans anyway.
+		logger.GetLogger().Debug("Failed to print event", logfields.Error, err)
+	}
+	return nil
+}
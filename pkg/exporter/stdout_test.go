@@ -0,0 +1,91 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cilium/tetragon/api/v1/tetragon"
+	"github.com/cilium/tetragon/pkg/encoder"
+	"github.com/cilium/tetragon/pkg/option"
+)
+
+func TestSampledEncoder(t *testing.T) {
+	tests := []struct {
+		name        string
+		rateLimit   int
+		totalEvents int
+		wantEvents  int
+	}{
+		{"sampled", 3, 10, 3},
+		{"unlimited", -1, 10, 10},
+		{"disabled", 0, 10, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			compact := encoder.NewCompactEncoder(&buf, encoder.Never, false, false, false)
+			enc := NewSampledEncoder(compact, time.Hour, tt.rateLimit)
+
+			for i := range tt.totalEvents {
+				require.NoError(t, enc.Encode(&tetragon.GetEventsResponse{
+					Event: &tetragon.GetEventsResponse_ProcessExec{
+						ProcessExec: &tetragon.ProcessExec{Process: &tetragon.Process{Binary: fmt.Sprintf("a%d", i)}},
+					}}))
+			}
+			// events without a compact representation are skipped
+			require.NoError(t, enc.Encode(&tetragon.GetEventsResponse{
+				Event: &tetragon.GetEventsResponse_RateLimitInfo{RateLimitInfo: &tetragon.RateLimitInfo{}},
+			}))
+
+			assert.Equal(t, tt.wantEvents, strings.Count(buf.String(), "\n"))
+		})
+	}
+}
+
+func TestStdoutExporter_NotCounted(t *testing.T) {
+	saved := option.Config
+	defer func() { option.Config = saved }()
+	option.Config.StdoutOutputRateLimit = 0
+	option.Config.ExportRetentionWindow = time.Hour
+	option.Config.ExportRetentionMaxEvents = 10
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	exporter, err := NewFromConfig(ctx, &option.ExporterConfig{Name: "stdout-test", Type: TypeStdout}, &tetragon.GetEventsRequest{}, nil)
+	require.NoError(t, err)
+	assert.True(t, exporter.Mirror())
+	exporter.SetPrimary(true)
+
+	exportedTotal := testutil.ToFloat64(eventsExportedTotal)
+	exported, _ := Totals()
+	require.NoError(t, exporter.Send(&tetragon.GetEventsResponse{NodeName: "n1"}))
+	assert.InDelta(t, exportedTotal, testutil.ToFloat64(eventsExportedTotal), 0)
+	assert.InDelta(t, 0, testutil.ToFloat64(exporterEventsTotal.WithLabelValues(statusExported, "stdout-test")), 0)
+	exportedAfter, _ := Totals()
+	assert.Equal(t, exported, exportedAfter)
+	assert.Zero(t, exporter.Replay(), "the stdout exporter does not retain events")
+}
+
+func TestExporter_Primary(t *testing.T) {
+	results := newArrayWriter(3)
+	primary := NewExporter(context.Background(), &tetragon.GetEventsRequest{}, nil, encoder.NewProtojsonEncoder(results), results, nil)
+	primary.SetPrimary(true)
+	other := NewExporter(context.Background(), &tetragon.GetEventsRequest{}, nil, encoder.NewProtojsonEncoder(results), results, nil)
+
+	before := testutil.ToFloat64(eventsExportedTotal)
+	event := &tetragon.GetEventsResponse{NodeName: "n1"}
+	require.NoError(t, primary.Send(event))
+	require.NoError(t, other.Send(event))
+	assert.InDelta(t, before+1, testutil.ToFloat64(eventsExportedTotal), 0, "each event is counted once")
+}
@@ -0,0 +1,16 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package syslog
+
+import (
+	"github.com/cilium/tetragon/pkg/exporter"
+	"github.com/cilium/tetragon/pkg/metrics"
+)
+
+var messagesTotal = exporter.NewBatchCounter("export_syslog", "messages_total",
+	"Number of messages handled by the syslog exporter, by outcome.")
+
+func RegisterMetrics(group metrics.Group) {
+	group.MustRegister(messagesTotal)
+}
@@ -0,0 +1,355 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+// Package syslog implements an event export destination that sends events
+// as RFC 5424 syslog messages over TCP, or over TLS as specified by RFC
+// 5425, for instance to enterprise syslog collectors.
+package syslog
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cilium/tetragon/api/v1/tetragon"
+	"github.com/cilium/tetragon/pkg/encoder"
+	"github.com/cilium/tetragon/pkg/exporter"
+	"github.com/cilium/tetragon/pkg/logger"
+	"github.com/cilium/tetragon/pkg/option"
+)
+
+const TypeSyslog = "syslog"
+
+const (
+	TransportTCP = "tcp"
+	TransportTLS = "tls"
+)
+
+const (
+	// maxBatchSize is the size of buffered messages above which they are
+	// sent without waiting for the flush interval.
+	maxBatchSize = 64 * 1024
+	// severityInfo is the severity of every message.
+	severityInfo = 6
+)
+
+// facilities are the syslog facilities, by name.
+var facilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+func init() {
+	exporter.RegisterAtInit(TypeSyslog, newExporter)
+	exporter.RegisterValidatorAtInit(TypeSyslog, validateExporter)
+	exporter.RegisterCheckerAtInit(TypeSyslog, checkExporter)
+}
+
+// optionsFromConfig returns the syslog options set by the --export-syslog-*
+// flags. The "address" and "transport" options override the destination.
+func optionsFromConfig(conf *option.ExporterConfig) Options {
+	return Options{
+		Address:       conf.Option("address", option.Config.ExportSyslogAddress),
+		Transport:     conf.Option("transport", option.Config.ExportSyslogTransport),
+		TLSCAFile:     option.Config.ExportSyslogTLSCAFile,
+		TLSCertFile:   option.Config.ExportSyslogTLSCertFile,
+		TLSKeyFile:    option.Config.ExportSyslogTLSKeyFile,
+		Facility:      option.Config.ExportSyslogFacility,
+		AppName:       option.Config.ExportSyslogAppName,
+		FlushInterval: option.Config.ExportSyslogFlushInterval,
+		Timeout:       option.Config.ExportSyslogTimeout,
+	}
+}
+
+func validateExporter(conf *option.ExporterConfig) error {
+	opts := optionsFromConfig(conf)
+	return opts.validate()
+}
+
+// checkExporter resolves the host of the collector and loads the TLS CA and
+// client certificate, for --check-config.
+func checkExporter(conf *option.ExporterConfig) error {
+	opts := optionsFromConfig(conf)
+	host, _, _ := net.SplitHostPort(opts.Address)
+	if err := exporter.ResolveHost(host); err != nil {
+		return err
+	}
+	if opts.Transport == TransportTLS {
+		_, err := opts.tlsConfig()
+		return err
+	}
+	return nil
+}
+
+func newExporter(ctx context.Context, conf *option.ExporterConfig) (exporter.ExportEncoder, io.Closer, error) {
+	opts := optionsFromConfig(conf)
+	var err error
+	if opts.DeadLetter, err = exporter.OpenDeadLetter(conf.Name); err != nil {
+		return nil, nil, err
+	}
+	enc, err := NewEncoder(ctx, opts)
+	if err != nil {
+		opts.DeadLetter.Close()
+		return nil, nil, err
+	}
+	logger.GetLogger().Info("Starting syslog exporter", "address", opts.Address, "transport", opts.Transport)
+	return enc, enc, nil
+}
+
+type Options struct {
+	// Address is the host:port of the syslog collector.
+	Address string
+	// Transport is TransportTCP or TransportTLS.
+	Transport string
+	// TLSCAFile, if set, holds the CAs the collector is verified with,
+	// instead of the system ones.
+	TLSCAFile string
+	// TLSCertFile and TLSKeyFile, if set, are the client certificate and
+	// key presented to the collector.
+	TLSCertFile string
+	TLSKeyFile  string
+	// Facility is the name of the syslog facility, such as "local0".
+	Facility string
+	// AppName is the APP-NAME of messages.
+	AppName string
+	// FlushInterval is the maximum time a message is buffered before
+	// being sent.
+	FlushInterval time.Duration
+	// Timeout is the timeout of connecting and of sending messages.
+	Timeout time.Duration
+	// DeadLetter, if not nil, receives the events of the messages that
+	// could not be sent.
+	DeadLetter *exporter.DeadLetter
+}
+
+func (o *Options) validate() error {
+	if _, _, err := net.SplitHostPort(o.Address); err != nil {
+		return fmt.Errorf("invalid syslog address %q: %w", o.Address, err)
+	}
+	if o.Transport != TransportTCP && o.Transport != TransportTLS {
+		return fmt.Errorf("invalid syslog transport %q: must be %q or %q", o.Transport, TransportTCP, TransportTLS)
+	}
+	if (o.TLSCertFile == "") != (o.TLSKeyFile == "") {
+		return errors.New("invalid syslog TLS client certificate: both the certificate and key files must be set")
+	}
+	if o.Transport != TransportTLS && (o.TLSCAFile != "" || o.TLSCertFile != "") {
+		return fmt.Errorf("invalid syslog TLS options: transport is %q", o.Transport)
+	}
+	if _, ok := facilities[o.Facility]; !ok {
+		return fmt.Errorf("invalid syslog facility %q", o.Facility)
+	}
+	if o.AppName == "" || len(o.AppName) > 48 || strings.ContainsAny(o.AppName, " \t\n") {
+		return fmt.Errorf("invalid syslog app name %q: must be 1 to 48 characters without spaces", o.AppName)
+	}
+	if o.FlushInterval <= 0 {
+		return fmt.Errorf("invalid syslog flush interval %s: must be positive", o.FlushInterval)
+	}
+	if o.Timeout <= 0 {
+		return fmt.Errorf("invalid syslog timeout %s: must be positive", o.Timeout)
+	}
+	return nil
+}
+
+// tlsConfig returns the TLS configuration of opts.
+func (o *Options) tlsConfig() (*tls.Config, error) {
+	host, _, _ := net.SplitHostPort(o.Address)
+	conf := &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+	if o.TLSCAFile != "" {
+		pem, err := os.ReadFile(o.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read syslog CA file: %w", err)
+		}
+		conf.RootCAs = x509.NewCertPool()
+		if !conf.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in syslog CA file %s", o.TLSCAFile)
+		}
+	}
+	if o.TLSCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.TLSCertFile, o.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load syslog client certificate: %w", err)
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+	return conf, nil
+}
+
+// Encoder is an ExportEncoder sending events as syslog messages. The MSG of
+// each message is the event as exported in JSON, and its MSGID the type of
+// the event. Messages are framed with their length (octet counting), as
+// required by RFC 5425 and supported by most collectors over TCP.
+//
+// Messages are sent in batches by an exporter.Batcher, so that a slow or
+// unreachable collector does not block event export.
+type Encoder struct {
+	opts      Options
+	tlsConfig *tls.Config
+	pri       string
+	hostname  string
+	procID    string
+	batcher   *exporter.Batcher[[]byte]
+
+	// line and json are only used by Encode, under the lock of batcher.
+	line bytes.Buffer
+	json encoder.EventEncoder
+
+	// conn is only used by the sender goroutine of batcher.
+	conn net.Conn
+}
+
+// NewEncoder validates opts and returns an Encoder that sends messages until
+// it is closed, see exporter.NewBatcher. It connects to the collector when
+// sending the first messages.
+func NewEncoder(ctx context.Context, opts Options) (*Encoder, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	e := &Encoder{
+		opts:     opts,
+		pri:      "<" + strconv.Itoa(facilities[opts.Facility]*8+severityInfo) + ">1 ",
+		hostname: hostname,
+		procID:   strconv.Itoa(os.Getpid()),
+	}
+	if opts.Transport == TransportTLS {
+		if e.tlsConfig, err = opts.tlsConfig(); err != nil {
+			return nil, err
+		}
+	}
+	// Messages are signed and labeled like the events of other JSON
+	// exporters.
+	w, err := exporter.NewJSONWriter(&e.line)
+	if err != nil {
+		return nil, err
+	}
+	e.json = exporter.NewJSONEncoder(w)
+	e.batcher = exporter.NewBatcher(ctx, exporter.BatcherOptions{
+		Name:          TypeSyslog,
+		Destination:   opts.Address,
+		FlushInterval: opts.FlushInterval,
+		Counter:       messagesTotal,
+		CountEvents:   true,
+		DeadLetter:    opts.DeadLetter,
+	}, e.send)
+	return e, nil
+}
+
+// appendMessage appends the framed syslog message of an event, whose JSON
+// form is msg, to dst.
+func (e *Encoder) appendMessage(dst []byte, event *tetragon.GetEventsResponse, msg []byte) []byte {
+	ts := time.Now()
+	if t := event.GetTime(); t != nil {
+		ts = t.AsTime()
+	}
+	hostname := event.GetNodeName()
+	if hostname == "" || len(hostname) > 255 {
+		hostname = e.hostname
+	}
+	var header []byte
+	header = append(header, e.pri...)
+	header = ts.UTC().AppendFormat(header, "2006-01-02T15:04:05.000000Z07:00")
+	header = append(header, ' ')
+	header = append(header, hostname...)
+	header = append(header, ' ')
+	header = append(header, e.opts.AppName...)
+	header = append(header, ' ')
+	header = append(header, e.procID...)
+	header = append(header, ' ')
+	header = append(header, event.EventType().String()...)
+	// No structured data: event fields are in the message.
+	header = append(header, " - "...)
+
+	dst = strconv.AppendInt(dst, int64(len(header)+len(msg)), 10)
+	dst = append(dst, ' ')
+	dst = append(dst, header...)
+	return append(dst, msg...)
+}
+
+// Encode implements ExportEncoder.Encode.
+func (e *Encoder) Encode(v interface{}) error {
+	event, ok := v.(*tetragon.GetEventsResponse)
+	if !ok {
+		return encoder.ErrInvalidEvent
+	}
+	return e.batcher.Add(func(buf *[]byte) ([]byte, bool, error) {
+		e.line.Reset()
+		if err := e.json.Encode(event); err != nil {
+			return nil, false, err
+		}
+		*buf = e.appendMessage(*buf, event, bytes.TrimRight(e.line.Bytes(), "\n"))
+		return e.line.Bytes(), len(*buf) >= maxBatchSize, nil
+	})
+}
+
+// Close sends any buffered messages, waits for them to be sent, for up to
+// exporter.BatchCloseTimeout, and closes the connection.
+func (e *Encoder) Close() error {
+	err := e.batcher.Close()
+	e.disconnect()
+	return err
+}
+
+// SetSendResultFunc implements exporter.SendReporter.
+func (e *Encoder) SetSendResultFunc(f func(err error)) {
+	e.batcher.SetSendResultFunc(f)
+}
+
+// send sends a batch of messages, reconnecting once if the connection
+// fails. Syslog has no acknowledgements, so messages written to a
+// connection that was closed by the collector may be lost.
+func (e *Encoder) send(ctx context.Context, data []byte) error {
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if e.conn == nil {
+			if err = e.connect(ctx); err != nil {
+				break
+			}
+		}
+		if err = exporter.WaitBandwidth(ctx, len(data)); err != nil {
+			break
+		}
+		e.conn.SetWriteDeadline(time.Now().Add(e.opts.Timeout))
+		if _, err = e.conn.Write(data); err == nil {
+			return nil
+		}
+		e.disconnect()
+	}
+	return err
+}
+
+func (e *Encoder) connect(ctx context.Context) error {
+	dialer := &net.Dialer{Timeout: e.opts.Timeout}
+	var err error
+	if e.tlsConfig != nil {
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: e.tlsConfig}
+		e.conn, err = tlsDialer.DialContext(ctx, "tcp", e.opts.Address)
+	} else {
+		e.conn, err = dialer.DialContext(ctx, "tcp", e.opts.Address)
+	}
+	if err != nil {
+		e.conn = nil
+		return fmt.Errorf("failed to connect to syslog collector: %w", err)
+	}
+	return nil
+}
+
+func (e *Encoder) disconnect() {
+	if e.conn != nil {
+		e.conn.Close()
+		e.conn = nil
+	}
+}
@@ -0,0 +1,250 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package syslog
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/cilium/tetragon/api/v1/tetragon"
+	"github.com/cilium/tetragon/pkg/exporter"
+	"github.com/cilium/tetragon/pkg/option"
+)
+
+// writeCert writes a self-signed certificate for 127.0.0.1 and its key to
+// dir, and returns their paths.
+func writeCert(t *testing.T, dir, name string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return certFile, keyFile
+}
+
+// readFrame reads an octet-counted message.
+func readFrame(r *bufio.Reader) (string, error) {
+	length, err := r.ReadString(' ')
+	if err != nil {
+		return "", err
+	}
+	n, err := strconv.Atoi(length[:len(length)-1])
+	if err != nil {
+		return "", err
+	}
+	msg := make([]byte, n)
+	_, err = io.ReadFull(r, msg)
+	return string(msg), err
+}
+
+func TestEncoder_TLS(t *testing.T) {
+	dir := t.TempDir()
+	serverCert, serverKey := writeCert(t, dir, "server")
+	clientCert, clientKey := writeCert(t, dir, "client")
+
+	cert, err := tls.LoadX509KeyPair(serverCert, serverKey)
+	require.NoError(t, err)
+	clientPEM, err := os.ReadFile(clientCert)
+	require.NoError(t, err)
+	clientCAs := x509.NewCertPool()
+	require.True(t, clientCAs.AppendCertsFromPEM(clientPEM))
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+	})
+	require.NoError(t, err)
+	defer l.Close()
+	messages := make(chan string, 10)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		for {
+			msg, err := readFrame(r)
+			if err != nil {
+				close(messages)
+				return
+			}
+			messages <- msg
+		}
+	}()
+
+	e, err := NewEncoder(context.Background(), Options{
+		Address:       l.Addr().String(),
+		Transport:     TransportTLS,
+		TLSCAFile:     serverCert,
+		TLSCertFile:   clientCert,
+		TLSKeyFile:    clientKey,
+		Facility:      "auth",
+		AppName:       "tetragon",
+		FlushInterval: time.Hour,
+		Timeout:       5 * time.Second,
+	})
+	require.NoError(t, err)
+	require.NoError(t, e.Encode(&tetragon.GetEventsResponse{
+		Event: &tetragon.GetEventsResponse_ProcessExec{ProcessExec: &tetragon.ProcessExec{
+			Process: &tetragon.Process{Binary: "/bin/a b"},
+		}},
+		NodeName: "node1",
+		Time:     timestamppb.New(time.Unix(1700000000, 123456789)),
+	}))
+	require.NoError(t, e.Encode(&tetragon.GetEventsResponse{
+		Event:    &tetragon.GetEventsResponse_ProcessExit{ProcessExit: &tetragon.ProcessExit{}},
+		NodeName: "node1",
+		Time:     timestamppb.New(time.Unix(1700000001, 0)),
+	}))
+	require.NoError(t, e.Close())
+
+	pid := strconv.Itoa(os.Getpid())
+	for _, expected := range []struct{ header, msg string }{
+		// auth is facility 4: 4*8+6.
+		{`<38>1 2023-11-14T22:13:20.123456Z node1 tetragon ` + pid + ` PROCESS_EXEC - `,
+			`{"process_exec":{"process":{"binary":"/bin/a b"}},"node_name":"node1","time":"2023-11-14T22:13:20.123456789Z"}`},
+		{`<38>1 2023-11-14T22:13:21.000000Z node1 tetragon ` + pid + ` PROCESS_EXIT - `,
+			`{"process_exit":{},"node_name":"node1","time":"2023-11-14T22:13:21Z"}`},
+	} {
+		msg := <-messages
+		require.True(t, strings.HasPrefix(msg, expected.header), msg)
+		assert.JSONEq(t, expected.msg, strings.TrimPrefix(msg, expected.header))
+	}
+	_, ok := <-messages
+	assert.False(t, ok)
+}
+
+func TestEncoder_DeadLetter(t *testing.T) {
+	// Nothing listens on the address of the collector.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := l.Addr().String()
+	l.Close()
+
+	file := filepath.Join(t.TempDir(), "dead-letter.json")
+	defer func(file string, size int) {
+		option.Config.ExportDeadLetterFile, option.Config.ExportDeadLetterMaxSizeMB = file, size
+	}(option.Config.ExportDeadLetterFile, option.Config.ExportDeadLetterMaxSizeMB)
+	option.Config.ExportDeadLetterFile, option.Config.ExportDeadLetterMaxSizeMB = file, 1
+	deadLetter, err := exporter.OpenDeadLetter("syslog-test")
+	require.NoError(t, err)
+
+	e, err := NewEncoder(context.Background(), Options{
+		Address:       address,
+		Transport:     TransportTCP,
+		Facility:      "local0",
+		AppName:       "tetragon",
+		FlushInterval: time.Hour,
+		Timeout:       5 * time.Second,
+		DeadLetter:    deadLetter,
+	})
+	require.NoError(t, err)
+	require.NoError(t, e.Encode(&tetragon.GetEventsResponse{
+		Event: &tetragon.GetEventsResponse_ProcessExit{ProcessExit: &tetragon.ProcessExit{}},
+	}))
+	require.NoError(t, e.Close())
+
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	var record exporter.DeadLetterRecord
+	require.NoError(t, json.Unmarshal(data, &record))
+	assert.Equal(t, "syslog-test", record.Exporter)
+	assert.Contains(t, record.Error, "failed to connect")
+	assert.JSONEq(t, `{"process_exit":{}}`, string(record.Event))
+}
+
+func TestOptions_validate(t *testing.T) {
+	valid := func() Options {
+		return Options{
+			Address:       "syslog:6514",
+			Transport:     TransportTLS,
+			Facility:      "local0",
+			AppName:       "tetragon",
+			FlushInterval: time.Second,
+			Timeout:       time.Second,
+		}
+	}
+	opts := valid()
+	require.NoError(t, opts.validate())
+	opts.Transport = "udp"
+	require.ErrorContains(t, opts.validate(), "invalid syslog transport")
+	opts = valid()
+	opts.TLSCertFile = "client.crt"
+	require.ErrorContains(t, opts.validate(), "both the certificate and key")
+	opts = valid()
+	opts.Transport = TransportTCP
+	opts.TLSCAFile = "ca.crt"
+	require.ErrorContains(t, opts.validate(), "invalid syslog TLS options")
+	opts = valid()
+	opts.Facility = "local8"
+	require.ErrorContains(t, opts.validate(), "invalid syslog facility")
+	opts = valid()
+	opts.AppName = "tetra gon"
+	require.ErrorContains(t, opts.validate(), "invalid syslog app name")
+}
+
+func TestCheckExporter(t *testing.T) {
+	saved := option.Config
+	defer func() { option.Config = saved }()
+	dir := t.TempDir()
+	caFile, _ := writeCert(t, dir, "ca")
+	option.Config.ExportSyslogAddress = "127.0.0.1:6514"
+	option.Config.ExportSyslogTransport = TransportTLS
+	option.Config.ExportSyslogTLSCAFile = caFile
+	option.Config.ExportSyslogFacility = "local0"
+	option.Config.ExportSyslogAppName = "tetragon"
+	option.Config.ExportSyslogFlushInterval = time.Second
+	option.Config.ExportSyslogTimeout = time.Second
+	conf := &option.ExporterConfig{Name: "syslog", Type: TypeSyslog}
+	require.NoError(t, checkExporter(conf))
+
+	// Unlike validation, checking loads the TLS material and resolves the
+	// host of the collector.
+	option.Config.ExportSyslogTLSCAFile = filepath.Join(dir, "missing.crt")
+	require.NoError(t, validateExporter(conf))
+	require.ErrorContains(t, checkExporter(conf), "failed to read syslog CA file")
+	option.Config.ExportSyslogTLSCAFile = caFile
+	option.Config.ExportSyslogAddress = "collector.invalid:6514"
+	require.NoError(t, validateExporter(conf))
+	require.ErrorContains(t, checkExporter(conf), "failed to resolve")
+}
@@ -0,0 +1,16 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package webhook
+
+import (
+	"github.com/cilium/tetragon/pkg/exporter"
+	"github.com/cilium/tetragon/pkg/metrics"
+)
+
+var batchesTotal = exporter.NewBatchCounter("export_webhook", "batches_total",
+	"Number of event batches handled by the webhook exporter, by outcome.")
+
+func RegisterMetrics(group metrics.Group) {
+	group.MustRegister(batchesTotal)
+}
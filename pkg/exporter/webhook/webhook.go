@@ -0,0 +1,309 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+// Package webhook implements an event export destination that POSTs batches
+// of newline-delimited JSON events to an HTTP(S) endpoint.
+package webhook
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/cilium/tetragon/pkg/exporter"
+	"github.com/cilium/tetragon/pkg/logger"
+	"github.com/cilium/tetragon/pkg/logger/logfields"
+	"github.com/cilium/tetragon/pkg/option"
+)
+
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+
+	// BatchIDHeader carries the ID of the batch in every request, so that
+	// batches reported by a collector can be matched to agent logs.
+	BatchIDHeader = "X-Tetragon-Batch-Id"
+	// BatchIDField carries the ID of the batch in every event of the
+	// request, for collectors that only store request bodies. It is not
+	// added to signed events, since the signature must be their last field.
+	BatchIDField = "batch_id"
+)
+
+const TypeWebhook = "webhook"
+
+func init() {
+	exporter.RegisterAtInit(TypeWebhook, newExporter)
+	exporter.RegisterValidatorAtInit(TypeWebhook, validateExporter)
+	exporter.RegisterCheckerAtInit(TypeWebhook, checkExporter)
+}
+
+// optionsFromConfig returns the webhook options set by the
+// --export-webhook-* flags. The "url" option overrides the endpoint.
+func optionsFromConfig(conf *option.ExporterConfig) Options {
+	return Options{
+		URL:           conf.Option("url", option.Config.ExportWebhookURL),
+		Headers:       option.Config.ExportWebhookHeaders,
+		BatchSize:     option.Config.ExportWebhookBatchSize,
+		FlushInterval: option.Config.ExportWebhookFlushInterval,
+		Compression:   option.Config.ExportWebhookCompression,
+		MaxRetries:    option.Config.ExportWebhookMaxRetries,
+		RetryBackoff:  option.Config.ExportWebhookRetryBackoff,
+		Timeout:       option.Config.ExportWebhookTimeout,
+		OmitBatchID:   option.Config.ExportSigningKey != "",
+	}
+}
+
+// validateExporter checks the webhook options. The host of the endpoint is
+// not resolved: it may be temporarily unavailable, and is resolved again for
+// every request.
+func validateExporter(conf *option.ExporterConfig) error {
+	opts := optionsFromConfig(conf)
+	return opts.validate()
+}
+
+// checkExporter resolves the host of the endpoint, for --check-config.
+func checkExporter(conf *option.ExporterConfig) error {
+	u, err := url.Parse(optionsFromConfig(conf).URL)
+	if err != nil {
+		return err
+	}
+	return exporter.ResolveHost(u.Hostname())
+}
+
+func newExporter(ctx context.Context, conf *option.ExporterConfig) (exporter.ExportEncoder, io.Closer, error) {
+	opts := optionsFromConfig(conf)
+	deadLetter, err := exporter.OpenDeadLetter(conf.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+	opts.DeadLetter = deadLetter
+	writer, err := NewWriter(ctx, opts)
+	if err != nil {
+		deadLetter.Close()
+		return nil, nil, err
+	}
+	w, err := exporter.NewJSONWriter(writer)
+	if err != nil {
+		writer.Close()
+		return nil, nil, err
+	}
+	logger.GetLogger().Info("Starting webhook exporter", "url", opts.URL)
+	return exporter.NewJSONEncoder(w), writer, nil
+}
+
+type Options struct {
+	// URL is the endpoint batches are POSTed to.
+	URL string
+	// Headers are added to every request.
+	Headers map[string]string
+	// BatchSize is the maximum number of events in a single request.
+	BatchSize int
+	// FlushInterval is the maximum time an event is buffered before a
+	// partial batch is sent.
+	FlushInterval time.Duration
+	// Compression is either CompressionNone or CompressionGzip.
+	Compression string
+	// MaxRetries is the number of times a failed request is retried.
+	MaxRetries int
+	// RetryBackoff is the delay before the first retry. It doubles on
+	// every subsequent retry.
+	RetryBackoff time.Duration
+	// Timeout is the timeout of a single request.
+	Timeout time.Duration
+	// OmitBatchID only sends the batch ID in BatchIDHeader, and not in
+	// BatchIDField, such as when events are signed.
+	OmitBatchID bool
+	// DeadLetter, if not nil, receives the events of the batches that
+	// could not be sent.
+	DeadLetter *exporter.DeadLetter
+}
+
+func (o *Options) validate() error {
+	u, err := url.Parse(o.URL)
+	if err != nil {
+		return fmt.Errorf("invalid webhook URL %q: %w", o.URL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("invalid webhook URL %q: scheme must be http or https", o.URL)
+	}
+	if o.BatchSize <= 0 {
+		return fmt.Errorf("invalid webhook batch size %d: must be positive", o.BatchSize)
+	}
+	if o.FlushInterval <= 0 {
+		return fmt.Errorf("invalid webhook flush interval %s: must be positive", o.FlushInterval)
+	}
+	if o.Compression != CompressionNone && o.Compression != CompressionGzip {
+		return fmt.Errorf("invalid webhook compression %q: must be %q or %q", o.Compression, CompressionNone, CompressionGzip)
+	}
+	if o.MaxRetries < 0 {
+		return fmt.Errorf("invalid webhook max retries %d: must not be negative", o.MaxRetries)
+	}
+	return nil
+}
+
+// newBatchID returns a short random ID used to trace a batch across the
+// agent and collector logs.
+func newBatchID() string {
+	var b [6]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// Writer is an io.WriteCloser that accumulates newline-delimited events and
+// sends them in batches to an HTTP endpoint. Each call to Write is expected
+// to contain one or more complete lines, as produced by the export encoders.
+// The ID of the batch is added to the JSON object of each event as
+// BatchIDField, unless Options.OmitBatchID is set.
+//
+// Batches are sent by an exporter.Batcher, so that a slow or unreachable
+// endpoint does not block event export.
+type Writer struct {
+	opts    Options
+	client  *http.Client
+	batcher *exporter.Batcher[[]byte]
+}
+
+// NewWriter validates opts and returns a Writer that sends batches until
+// it is closed, see exporter.NewBatcher.
+func NewWriter(ctx context.Context, opts Options) (*Writer, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	w := &Writer{
+		opts:   opts,
+		client: &http.Client{Timeout: opts.Timeout},
+	}
+	w.batcher = exporter.NewBatcher(ctx, exporter.BatcherOptions{
+		Name:          TypeWebhook,
+		Destination:   opts.URL,
+		BatchSize:     opts.BatchSize,
+		FlushInterval: opts.FlushInterval,
+		Counter:       batchesTotal,
+		DeadLetter:    opts.DeadLetter,
+	}, w.send)
+	return w, nil
+}
+
+// Write implements io.Writer.
+func (w *Writer) Write(p []byte) (int, error) {
+	err := w.batcher.Add(func(buf *[]byte) ([]byte, bool, error) {
+		*buf = append(*buf, p...)
+		return p, false, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close sends any buffered events and waits for pending batches to be sent,
+// for up to exporter.BatchCloseTimeout. Batches that are not sent by then
+// fail, and are written to the dead-letter file.
+func (w *Writer) Close() error {
+	return w.batcher.Close()
+}
+
+// SetSendResultFunc implements exporter.SendReporter.
+func (w *Writer) SetSendResultFunc(f func(err error)) {
+	w.batcher.SetSendResultFunc(f)
+}
+
+func (w *Writer) send(ctx context.Context, data []byte) error {
+	id := newBatchID()
+	events := bytes.Count(data, []byte{'\n'})
+	payload := data
+	if !w.opts.OmitBatchID {
+		payload = appendBatchID(nil, data, id)
+	}
+	err := exporter.Retry(ctx, w.opts.MaxRetries, w.opts.RetryBackoff, func(attempt int) (bool, error) {
+		retry, err := w.post(ctx, id, payload)
+		if err != nil && retry {
+			logger.GetLogger().Debug("Webhook export request failed, retrying",
+				"batchID", id, "attempt", attempt+1, "events", events, logfields.Error, err)
+		}
+		return retry, err
+	})
+	if err != nil {
+		return fmt.Errorf("batch %s: %w", id, err)
+	}
+	logger.GetLogger().Debug("Webhook batch sent", "batchID", id, "events", events)
+	return nil
+}
+
+// appendBatchID appends the events of data to dst, with the batch ID added
+// to each JSON object. Other lines are appended unchanged.
+func appendBatchID(dst, data []byte, id string) []byte {
+	field := `"` + BatchIDField + `":"` + id + `"}`
+	for line := range bytes.Lines(data) {
+		obj := bytes.TrimRight(line, "\n")
+		if len(obj) < 2 || obj[0] != '{' || obj[len(obj)-1] != '}' {
+			dst = append(dst, line...)
+			continue
+		}
+		dst = append(dst, obj[:len(obj)-1]...)
+		if len(obj) > 2 {
+			dst = append(dst, ',')
+		}
+		dst = append(dst, field...)
+		dst = append(dst, '\n')
+	}
+	return dst
+}
+
+// post sends a single request with the payload data of the batch id. It
+// returns whether a failed request may be retried.
+func (w *Writer) post(ctx context.Context, id string, data []byte) (bool, error) {
+	var body io.Reader = bytes.NewReader(data)
+	size := len(data)
+	if w.opts.Compression == CompressionGzip {
+		var gz bytes.Buffer
+		zw := gzip.NewWriter(&gz)
+		if _, err := zw.Write(data); err != nil {
+			return false, err
+		}
+		if err := zw.Close(); err != nil {
+			return false, err
+		}
+		body = &gz
+		size = gz.Len()
+	}
+
+	if err := exporter.WaitBandwidth(ctx, size); err != nil {
+		return false, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.opts.URL, body)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	req.Header.Set(BatchIDHeader, id)
+	if w.opts.Compression == CompressionGzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	for k, v := range w.opts.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("unexpected status: %s", resp.Status)
+	default:
+		return false, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+}
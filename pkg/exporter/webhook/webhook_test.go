@@ -0,0 +1,283 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package webhook
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cilium/tetragon/api/v1/tetragon"
+	"github.com/cilium/tetragon/pkg/exporter"
+	"github.com/cilium/tetragon/pkg/option"
+	"github.com/cilium/tetragon/pkg/signing"
+)
+
+type fakeCollector struct {
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   []string
+	// fail is the number of requests to answer with an error
+	fail int
+}
+
+func (c *fakeCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.fail > 0 {
+		c.fail--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body = zr
+	}
+	data, _ := io.ReadAll(body)
+	c.requests = append(c.requests, r)
+	c.bodies = append(c.bodies, string(data))
+}
+
+func testOptions(url string) Options {
+	return Options{
+		URL:           url,
+		BatchSize:     2,
+		FlushInterval: time.Hour,
+		Compression:   CompressionNone,
+		MaxRetries:    2,
+		RetryBackoff:  time.Millisecond,
+		Timeout:       time.Second,
+	}
+}
+
+func writeEvents(t *testing.T, w io.Writer, n int) {
+	for i := range n {
+		_, err := fmt.Fprintf(w, "{\"event\":%d}\n", i)
+		require.NoError(t, err)
+	}
+}
+
+func TestWriter_Batching(t *testing.T) {
+	collector := &fakeCollector{}
+	srv := httptest.NewServer(collector)
+	defer srv.Close()
+
+	opts := testOptions(srv.URL)
+	opts.Headers = map[string]string{"Authorization": "Bearer token"}
+	w, err := NewWriter(context.Background(), opts)
+	require.NoError(t, err)
+	writeEvents(t, w, 5)
+	require.NoError(t, w.Close())
+
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	require.Len(t, collector.bodies, 3)
+	ids := make(map[string]struct{})
+	for i, r := range collector.requests {
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		assert.Equal(t, "application/x-ndjson", r.Header.Get("Content-Type"))
+		id := r.Header.Get(BatchIDHeader)
+		assert.Len(t, id, 12)
+		ids[id] = struct{}{}
+		// The payload carries the batch ID too.
+		for line := range strings.Lines(collector.bodies[i]) {
+			var event map[string]any
+			require.NoError(t, json.Unmarshal([]byte(line), &event))
+			assert.Equal(t, id, event[BatchIDField])
+		}
+	}
+	assert.Equal(t, fmt.Sprintf("{\"event\":0,\"batch_id\":%q}\n{\"event\":1,\"batch_id\":%q}\n",
+		collector.requests[0].Header.Get(BatchIDHeader), collector.requests[0].Header.Get(BatchIDHeader)), collector.bodies[0])
+	assert.Equal(t, fmt.Sprintf("{\"event\":4,\"batch_id\":%q}\n", collector.requests[2].Header.Get(BatchIDHeader)), collector.bodies[2])
+	assert.Len(t, ids, len(collector.requests), "batch IDs must be unique")
+}
+
+func TestAppendBatchID(t *testing.T) {
+	data := "{\"a\":1}\n{}\nnot json\n"
+	assert.Equal(t, "{\"a\":1,\"batch_id\":\"abc\"}\n{\"batch_id\":\"abc\"}\nnot json\n",
+		string(appendBatchID(nil, []byte(data), "abc")))
+}
+
+func TestWriter_FlushInterval(t *testing.T) {
+	collector := &fakeCollector{}
+	srv := httptest.NewServer(collector)
+	defer srv.Close()
+
+	opts := testOptions(srv.URL)
+	opts.BatchSize = 100
+	opts.FlushInterval = 10 * time.Millisecond
+	w, err := NewWriter(context.Background(), opts)
+	require.NoError(t, err)
+	defer w.Close()
+	writeEvents(t, w, 1)
+
+	assert.Eventually(t, func() bool {
+		collector.mu.Lock()
+		defer collector.mu.Unlock()
+		return len(collector.bodies) == 1
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestWriter_GzipAndRetry(t *testing.T) {
+	collector := &fakeCollector{fail: 2}
+	srv := httptest.NewServer(collector)
+	defer srv.Close()
+
+	opts := testOptions(srv.URL)
+	opts.Compression = CompressionGzip
+	w, err := NewWriter(context.Background(), opts)
+	require.NoError(t, err)
+	writeEvents(t, w, 2)
+	require.NoError(t, w.Close())
+
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	require.Len(t, collector.bodies, 1)
+	assert.Equal(t, 2, strings.Count(collector.bodies[0], "\n"))
+}
+
+func TestWriter_DeadLetter(t *testing.T) {
+	collector := &fakeCollector{fail: 3}
+	srv := httptest.NewServer(collector)
+	defer srv.Close()
+
+	file := filepath.Join(t.TempDir(), "dead-letter.json")
+	defer func(file string, size int) {
+		option.Config.ExportDeadLetterFile, option.Config.ExportDeadLetterMaxSizeMB = file, size
+	}(option.Config.ExportDeadLetterFile, option.Config.ExportDeadLetterMaxSizeMB)
+	option.Config.ExportDeadLetterFile, option.Config.ExportDeadLetterMaxSizeMB = file, 1
+	opts := testOptions(srv.URL)
+	var err error
+	opts.DeadLetter, err = exporter.OpenDeadLetter("webhook-test")
+	require.NoError(t, err)
+
+	// The first batch fails after all retries, the second one is sent.
+	w, err := NewWriter(context.Background(), opts)
+	require.NoError(t, err)
+	writeEvents(t, w, 4)
+	require.NoError(t, w.Close())
+
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 2)
+	for i, line := range lines {
+		var record exporter.DeadLetterRecord
+		require.NoError(t, json.Unmarshal([]byte(line), &record))
+		assert.Equal(t, "webhook-test", record.Exporter)
+		assert.Contains(t, record.Error, "503")
+		assert.JSONEq(t, fmt.Sprintf(`{"event":%d}`, i), string(record.Event))
+	}
+}
+
+func TestWriter_CloseAfterCancel(t *testing.T) {
+	collector := &fakeCollector{}
+	srv := httptest.NewServer(collector)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w, err := NewWriter(ctx, testOptions(srv.URL))
+	require.NoError(t, err)
+	writeEvents(t, w, 5)
+
+	// Exporters are closed after their context is cancelled, on shutdown
+	// and reload: the pending and buffered batches are still delivered.
+	cancel()
+	require.NoError(t, w.Close())
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	assert.Len(t, collector.bodies, 3)
+}
+
+func TestNewWriter_InvalidOptions(t *testing.T) {
+	valid := testOptions("https://collector:8443/events")
+	tests := []struct {
+		name   string
+		modify func(o *Options)
+	}{
+		{"scheme", func(o *Options) { o.URL = "udp://collector:514" }},
+		{"batch size", func(o *Options) { o.BatchSize = 0 }},
+		{"flush interval", func(o *Options) { o.FlushInterval = 0 }},
+		{"compression", func(o *Options) { o.Compression = "zstd" }},
+		{"retries", func(o *Options) { o.MaxRetries = -1 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := valid
+			tt.modify(&opts)
+			_, err := NewWriter(context.Background(), opts)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestNewExporter_Signed(t *testing.T) {
+	saved := option.Config
+	defer func() { option.Config = saved }()
+	key := filepath.Join(t.TempDir(), "key")
+	require.NoError(t, os.WriteFile(key, []byte("secret"), 0600))
+	option.Config.ExportSigningAlgorithm, option.Config.ExportSigningKey = signing.AlgHMACSHA256, key
+	option.Config.ExportWebhookBatchSize = 10
+	option.Config.ExportWebhookFlushInterval = time.Hour
+	option.Config.ExportWebhookCompression = CompressionNone
+	option.Config.ExportWebhookTimeout = time.Second
+
+	collector := &fakeCollector{}
+	srv := httptest.NewServer(collector)
+	defer srv.Close()
+	conf := &option.ExporterConfig{Name: "webhook", Type: TypeWebhook, Options: map[string]string{"url": srv.URL}}
+	require.NoError(t, validateExporter(conf))
+	enc, closer, err := newExporter(context.Background(), conf)
+	require.NoError(t, err)
+	require.NoError(t, enc.Encode(&tetragon.GetEventsResponse{NodeName: "node1"}))
+	require.NoError(t, closer.Close())
+
+	// The batch ID is only sent in the header, so that signatures can be
+	// verified.
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	require.Len(t, collector.bodies, 1)
+	assert.NotEmpty(t, collector.requests[0].Header.Get(BatchIDHeader))
+	assert.NotContains(t, collector.bodies[0], BatchIDField)
+	verifier, err := signing.NewVerifier(signing.AlgHMACSHA256, []byte("secret"))
+	require.NoError(t, err)
+	_, err = verifier.Verify([]byte(collector.bodies[0]))
+	require.NoError(t, err)
+}
+
+func TestValidateExporter_Unresolvable(t *testing.T) {
+	saved := option.Config
+	defer func() { option.Config = saved }()
+	option.Config.ExportWebhookBatchSize = 10
+	option.Config.ExportWebhookFlushInterval = time.Hour
+	option.Config.ExportWebhookCompression = CompressionNone
+
+	// The host is resolved when sending, so that a DNS outage does not
+	// fail reloads. Only --check-config resolves it.
+	conf := &option.ExporterConfig{Name: "webhook", Type: TypeWebhook, Options: map[string]string{"url": "https://collector.invalid:8443/events"}}
+	require.NoError(t, validateExporter(conf))
+	require.ErrorContains(t, checkExporter(conf), "failed to resolve")
+	conf.Options["url"] = "http://127.0.0.1:8080/events"
+	require.NoError(t, checkExporter(conf))
+	conf.Options["url"] = "udp://collector:514"
+	require.Error(t, validateExporter(conf))
+}
@@ -0,0 +1,73 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package exporter
+
+import (
+	"io"
+
+	"github.com/cilium/tetragon/pkg/encoder"
+	"github.com/cilium/tetragon/pkg/option"
+	"github.com/cilium/tetragon/pkg/signing"
+)
+
+// NewJSONWriter wraps the output w of a JSON exporter. It counts the
+// exported bytes, signs events if --export-signing-key is set, and adds the
+// ExportLabels, and the SchemaVersion if --export-schema-version is set.
+// The labels are flattened with the events by --export-json-flatten. These
+// fields are added before signing, so they are covered by the signature.
+func NewJSONWriter(w io.Writer) (io.Writer, error) {
+	signer, err := newSigner()
+	if err != nil {
+		return nil, err
+	}
+	return newJSONFieldsWriter(NewSigningWriter(NewExportedBytesTotalWriter(w), signer))
+}
+
+// newJSONFieldsWriter returns a writer that adds the ExportLabels, and the
+// SchemaVersion if --export-schema-version is set, to the JSON events
+// written to w.
+func newJSONFieldsWriter(w io.Writer) (io.Writer, error) {
+	labels, err := ExportLabels()
+	if err != nil {
+		return nil, err
+	}
+	newLabelsWriter := NewLabelsWriter
+	if option.Config.ExportJSONFlatten {
+		newLabelsWriter = NewFlatLabelsWriter
+	}
+	w, err = newLabelsWriter(w, labels)
+	if err != nil {
+		return nil, err
+	}
+	if option.Config.ExportSchemaVersion {
+		w = NewSchemaVersionWriter(w)
+	}
+	return w, nil
+}
+
+// newSigner returns the signer configured by the --export-signing-* flags,
+// or nil if signing is disabled.
+func newSigner() (*signing.Signer, error) {
+	if option.Config.ExportSigningKey == "" {
+		return nil, nil
+	}
+	return signing.LoadSigner(option.Config.ExportSigningAlgorithm, option.Config.ExportSigningKeyID, option.Config.ExportSigningKey)
+}
+
+// NewJSONEncoder returns the encoder of JSON exporters, encoding events as
+// set by the --export-json-* flags.
+func NewJSONEncoder(w io.Writer) *encoder.ProtojsonEncoder {
+	return encoder.NewProtojsonEncoderWithOptions(w, jsonOptions())
+}
+
+// jsonOptions returns the encoding of JSON events set by the --export-json-*
+// flags.
+func jsonOptions() encoder.JSONOptions {
+	return encoder.JSONOptions{
+		CamelCase:       option.Config.ExportJSONFieldNames == option.JSONFieldNamesCamelCase,
+		EmitUnpopulated: option.Config.ExportJSONEmitUnpopulated,
+		EpochMillis:     option.Config.ExportJSONTimestampFormat == option.JSONTimestampEpochMillis,
+		Flatten:         option.Config.ExportJSONFlatten,
+	}
+}
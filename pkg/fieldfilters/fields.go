@@ -13,6 +13,7 @@ import (
 
 	fieldmask_utils "github.com/mennanov/fieldmask-utils"
 	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
 
 	"github.com/cilium/tetragon/api/v1/tetragon"
 )
@@ -42,6 +43,20 @@ func ParseFieldFilterList(filters string) ([]*tetragon.FieldFilter, error) {
 	return results, nil
 }
 
+// IncludeFieldsFilter returns a field filter that only keeps the given fields
+// of all event types, or nil if fields is empty. Fields are snake_case paths
+// relative to the event, such as "process.binary". Fields that do not exist
+// in an event type are ignored.
+func IncludeFieldsFilter(fields []string) *tetragon.FieldFilter {
+	if len(fields) == 0 {
+		return nil
+	}
+	return &tetragon.FieldFilter{
+		Fields: &fieldmaskpb.FieldMask{Paths: fields},
+		Action: tetragon.FieldFilterAction_INCLUDE,
+	}
+}
+
 // Converts a string to camel case.
 func fixupSnakeCaseString(s string, upper bool) string {
 	var builder strings.Builder
@@ -630,3 +630,41 @@ func TestSlimExecEventsFieldFilterExample(t *testing.T) {
 		}
 	}
 }
+
+func TestIncludeFieldsFilter(t *testing.T) {
+	assert.Nil(t, IncludeFieldsFilter(nil))
+
+	ev := &tetragon.GetEventsResponse{
+		Event: &tetragon.GetEventsResponse_ProcessKprobe{
+			ProcessKprobe: &tetragon.ProcessKprobe{
+				Process: &tetragon.Process{
+					Binary:    "/bin/bash",
+					Arguments: "-c hello.sh",
+					Cwd:       "/",
+				},
+				Parent:       &tetragon.Process{Binary: "/bin/sh"},
+				FunctionName: "fd_install",
+			},
+		},
+		NodeName: "node",
+		Time:     &timestamppb.Timestamp{Seconds: 1337},
+	}
+	expected := &tetragon.GetEventsResponse{
+		Event: &tetragon.GetEventsResponse_ProcessKprobe{
+			ProcessKprobe: &tetragon.ProcessKprobe{
+				Process: &tetragon.Process{
+					Binary:    "/bin/bash",
+					Arguments: "-c hello.sh",
+				},
+			},
+		},
+		NodeName: "node",
+		Time:     &timestamppb.Timestamp{Seconds: 1337},
+	}
+
+	filter, err := FieldFilterFromProto(IncludeFieldsFilter([]string{"process.binary", "process.arguments", "process.pod"}))
+	require.NoError(t, err)
+	ev, err = filter.Filter(ev)
+	require.NoError(t, err)
+	assert.True(t, proto.Equal(ev, expected), "events are equal after filter")
+}
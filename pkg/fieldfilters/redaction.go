@@ -4,8 +4,12 @@
 package fieldfilters
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"hash"
 	"io"
 	"regexp"
 	"strings"
@@ -15,9 +19,26 @@ import (
 
 const REDACTION_STR = "*****"
 
+const (
+	// RedactionModeMask replaces redacted strings with REDACTION_STR.
+	RedactionModeMask = "mask"
+	// RedactionModeHash replaces redacted strings with a hash of their
+	// value, so that events with the same secret can still be correlated.
+	RedactionModeHash = "hash"
+
+	// redactionHashPrefix is prepended to hashed strings, and redactionHashLen
+	// is the number of bytes of the hash that are kept.
+	redactionHashPrefix = "sha256:"
+	redactionHashLen    = 8
+)
+
 type RedactionFilter struct {
 	binaryRegex []*regexp.Regexp
 	redact      []*regexp.Regexp
+	// hashKey, if not nil, makes the filter replace redacted strings with
+	// their HMAC-SHA256 under hashKey instead of REDACTION_STR. An empty key
+	// gives a plain SHA-256.
+	hashKey []byte
 }
 
 type RedactionFilterList struct {
@@ -88,6 +109,29 @@ func redactionFilterFromProto(protoFilter *tetragon.RedactionFilter) (*Redaction
 	return filter, nil
 }
 
+// SetMode sets how the filters of the list replace redacted strings: with
+// RedactionModeMask (the default) or RedactionModeHash. In hash mode, key is
+// used as HMAC key. Without a key, low-entropy secrets can be recovered by
+// hashing candidate values. SetMode can be called on a nil list to validate
+// the mode.
+func (f *RedactionFilterList) SetMode(mode string, key string) error {
+	var hashKey []byte
+	switch mode {
+	case "", RedactionModeMask:
+	case RedactionModeHash:
+		hashKey = []byte(key)
+	default:
+		return fmt.Errorf("invalid redaction mode %q: must be %q or %q", mode, RedactionModeMask, RedactionModeHash)
+	}
+	if f == nil {
+		return nil
+	}
+	for _, filter := range f.list {
+		filter.hashKey = hashKey
+	}
+	return nil
+}
+
 // Redact redacts a string based on redaction filters.
 func (f RedactionFilterList) Redact(binary, args string) string {
 	for _, filter := range f.list {
@@ -111,13 +155,38 @@ func (f RedactionFilter) Redact(binary, args string) string {
 	if !binaryMatch {
 		return args
 	}
+	replace := maskString
+	if f.hashKey != nil {
+		replace = f.hashString
+	}
 	for _, re := range f.redact {
-		args, _ = redactString(re, args)
+		args, _ = redactStringFunc(re, args, replace)
 	}
 	return args
 }
 
+func maskString(string) string {
+	return REDACTION_STR
+}
+
+func (f RedactionFilter) hashString(s string) string {
+	var h hash.Hash
+	if len(f.hashKey) > 0 {
+		h = hmac.New(sha256.New, f.hashKey)
+	} else {
+		h = sha256.New()
+	}
+	h.Write([]byte(s))
+	return redactionHashPrefix + hex.EncodeToString(h.Sum(nil)[:redactionHashLen])
+}
+
 func redactString(re *regexp.Regexp, s string) (string, bool) {
+	return redactStringFunc(re, s, maskString)
+}
+
+// redactStringFunc replaces the strings in the capture groups of re with the
+// result of replace.
+func redactStringFunc(re *regexp.Regexp, s string, replace func(string) string) (string, bool) {
 	modified := false
 	res := re.ReplaceAllStringFunc(s, func(s string) string {
 		var redacted strings.Builder
@@ -136,7 +205,7 @@ func redactString(re *regexp.Regexp, s string) (string, bool) {
 			}
 			modified = true
 			redacted.WriteString(s[lastOffset:idx[i]])
-			redacted.WriteString(REDACTION_STR)
+			redacted.WriteString(replace(s[idx[i]:idx[i+1]]))
 			lastOffset = idx[i+1]
 		}
 		// Write the rest of the string
@@ -102,3 +102,28 @@ func TestRedact_Multi(t *testing.T) {
 	redacted := filters.Redact("", args)
 	assert.Equal(t, "--verbose=true --password "+REDACTION_STR+" --username foobar "+REDACTION_STR+"cake "+REDACTION_STR+" innocent", redacted)
 }
+
+func TestRedact_HashMode(t *testing.T) {
+	args := "--password ybx511!ackt544 --username foobar"
+
+	filterList := `{"redact": ["(?:--password|-p)[\\s=]+(\\S+)"]}`
+	filters, err := ParseRedactionFilterList(filterList)
+	require.NoError(t, err)
+
+	require.NoError(t, filters.SetMode(RedactionModeHash, ""))
+	hashed := filters.Redact("", args)
+	assert.Regexp(t, `^--password sha256:[0-9a-f]{16} --username foobar$`, hashed)
+	assert.Equal(t, hashed, filters.Redact("", args), "hash must be stable")
+
+	require.NoError(t, filters.SetMode(RedactionModeHash, "key"))
+	keyed := filters.Redact("", args)
+	assert.Regexp(t, `^--password sha256:[0-9a-f]{16} --username foobar$`, keyed)
+	assert.NotEqual(t, hashed, keyed, "HMAC must depend on the key")
+
+	require.NoError(t, filters.SetMode(RedactionModeMask, ""))
+	assert.Equal(t, "--password "+REDACTION_STR+" --username foobar", filters.Redact("", args))
+
+	require.Error(t, filters.SetMode("drop", ""))
+	var nilFilters *RedactionFilterList
+	require.NoError(t, nilFilters.SetMode(RedactionModeHash, ""))
+}
@@ -5,7 +5,11 @@ package filters
 
 import (
 	"context"
+	"fmt"
+	"slices"
+	"strings"
 
+	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protoreflect"
 
 	"github.com/cilium/tetragon/api/v1/tetragon"
@@ -47,3 +51,63 @@ func (f *EventTypeFilter) OnBuildFilter(_ context.Context, ff *tetragon.Filter)
 	}
 	return fs, nil
 }
+
+// ParseEventTypes parses a list of event type names, such as PROCESS_EXEC or
+// PROCESS_KPROBE. Names are case-insensitive.
+func ParseEventTypes(names []string) ([]tetragon.EventType, error) {
+	var types []tetragon.EventType
+	for _, name := range names {
+		name = strings.ToUpper(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		t, ok := tetragon.EventType_value[name]
+		if !ok || tetragon.EventType(t) == tetragon.EventType_UNDEF {
+			return nil, fmt.Errorf("unknown event type %q", name)
+		}
+		types = append(types, tetragon.EventType(t))
+	}
+	return types, nil
+}
+
+// AllowEventTypes restricts allowList to events of the given types. Filters
+// that already have an event set keep only the types that are in both sets,
+// and are removed if no type is left.
+func AllowEventTypes(allowList []*tetragon.Filter, types []tetragon.EventType) []*tetragon.Filter {
+	if len(types) == 0 {
+		return allowList
+	}
+	if len(allowList) == 0 {
+		return []*tetragon.Filter{{EventSet: types}}
+	}
+	var res []*tetragon.Filter
+	for _, f := range allowList {
+		f = proto.Clone(f).(*tetragon.Filter)
+		if len(f.EventSet) == 0 {
+			f.EventSet = types
+		} else {
+			f.EventSet = slices.DeleteFunc(f.EventSet, func(t tetragon.EventType) bool {
+				return !slices.Contains(types, t)
+			})
+			if len(f.EventSet) == 0 {
+				continue
+			}
+		}
+		res = append(res, f)
+	}
+	if len(res) == 0 {
+		// None of the filters can match any more. An empty allow list would
+		// allow everything, so use a filter that no event matches.
+		return []*tetragon.Filter{{EventSet: []tetragon.EventType{tetragon.EventType_UNDEF}}}
+	}
+	return res
+}
+
+// DenyEventTypes adds a filter to denyList that denies events of the given
+// types.
+func DenyEventTypes(denyList []*tetragon.Filter, types []tetragon.EventType) []*tetragon.Filter {
+	if len(types) == 0 {
+		return denyList
+	}
+	return append(denyList, &tetragon.Filter{EventSet: types})
+}
@@ -111,3 +111,35 @@ func TestEventTypeFilterNoMatch(t *testing.T) {
 	}
 	assert.False(t, fl.MatchOne(&ev))
 }
+
+func TestEventTypesFilterLists(t *testing.T) {
+	types, err := ParseEventTypes([]string{"process_exec", " PROCESS_KPROBE", ""})
+	require.NoError(t, err)
+	assert.Equal(t, []tetragon.EventType{tetragon.EventType_PROCESS_EXEC, tetragon.EventType_PROCESS_KPROBE}, types)
+	_, err = ParseEventTypes([]string{"PROCESS_FOO"})
+	require.Error(t, err)
+	_, err = ParseEventTypes([]string{"UNDEF"})
+	require.Error(t, err)
+
+	allow := AllowEventTypes(nil, types)
+	assert.Equal(t, []*tetragon.Filter{{EventSet: types}}, allow)
+
+	binaryFilter := &tetragon.Filter{BinaryRegex: []string{"curl"}}
+	exitFilter := &tetragon.Filter{EventSet: []tetragon.EventType{tetragon.EventType_PROCESS_EXIT}}
+	allow = AllowEventTypes([]*tetragon.Filter{binaryFilter, exitFilter}, types)
+	require.Len(t, allow, 1)
+	assert.Equal(t, []string{"curl"}, allow[0].BinaryRegex)
+	assert.Equal(t, types, allow[0].EventSet)
+	assert.Empty(t, binaryFilter.EventSet, "original filter must not be modified")
+
+	allow = AllowEventTypes([]*tetragon.Filter{exitFilter}, types)
+	fl, err := BuildFilterList(context.Background(), allow, []OnBuildFilter{&EventTypeFilter{}})
+	require.NoError(t, err)
+	ev := &event.Event{Event: &tetragon.GetEventsResponse{Event: &tetragon.GetEventsResponse_ProcessExit{ProcessExit: &tetragon.ProcessExit{}}}}
+	assert.False(t, fl.MatchOne(ev))
+
+	deny := DenyEventTypes(nil, []tetragon.EventType{tetragon.EventType_PROCESS_EXIT})
+	fl, err = BuildFilterList(context.Background(), deny, []OnBuildFilter{&EventTypeFilter{}})
+	require.NoError(t, err)
+	assert.True(t, fl.MatchOne(ev))
+}
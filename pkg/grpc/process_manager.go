@@ -25,6 +25,8 @@ type ProcessManager struct {
 	// synchronize access to the listeners map.
 	mux       sync.Mutex
 	listeners map[server.Listener]struct{}
+	// degraded is whether a listener was under pressure at the last event.
+	degraded bool
 }
 
 // NewProcessManager returns a pointer to an initialized ProcessManager struct.
@@ -82,8 +84,29 @@ func (pm *ProcessManager) NotifyListener(original interface{}, processed *tetrag
 	pm.mux.Lock()
 	defer pm.mux.Unlock()
 	node.SetCommonFields(processed)
+	// Listeners under pressure do not get process_exit events, which are
+	// the least useful, so that they can keep up with the other events
+	// instead of dropping them arbitrarily. Their process_exec events are
+	// aggregated by the server.
+	exit := processed.GetProcessExit() != nil
+	degraded := false
 	for l := range pm.listeners {
+		if pr, ok := l.(server.PressureReporter); ok && pr.UnderPressure() {
+			degraded = true
+			if exit {
+				eventmetrics.PressureDroppedEvents.Inc()
+				continue
+			}
+		}
 		l.Notify(processed)
 	}
+	if degraded != pm.degraded {
+		pm.degraded = degraded
+		if degraded {
+			logger.GetLogger().Warn("Event listeners under pressure, not sending them process_exit events and aggregating their process_exec events")
+		} else {
+			logger.GetLogger().Info("Event listeners no longer under pressure, sending all events")
+		}
+	}
 	eventmetrics.ProcessEvent(original, processed)
 }
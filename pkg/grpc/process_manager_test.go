@@ -23,6 +23,7 @@ import (
 	"github.com/cilium/tetragon/pkg/option"
 	"github.com/cilium/tetragon/pkg/process"
 	"github.com/cilium/tetragon/pkg/rthooks"
+	"github.com/cilium/tetragon/pkg/server"
 	"github.com/cilium/tetragon/pkg/watcher"
 )
 
@@ -212,3 +213,35 @@ func TestProcessManager_GetProcessExec(t *testing.T) {
 		},
 		exec.GetProcessExec(pi, false).Process.BinaryProperties)
 }
+
+type pressureListener struct {
+	pressure bool
+	events   []*tetragon.GetEventsResponse
+}
+
+func (l *pressureListener) Notify(res *tetragon.GetEventsResponse) {
+	l.events = append(l.events, res)
+}
+
+func (l *pressureListener) UnderPressure() bool {
+	return l.pressure
+}
+
+func TestProcessManager_NotifyListenerPressure(t *testing.T) {
+	relaxed := &pressureListener{}
+	pressured := &pressureListener{pressure: true}
+	pm := &ProcessManager{listeners: map[server.Listener]struct{}{relaxed: {}, pressured: {}}}
+
+	exec := &tetragon.GetEventsResponse{Event: &tetragon.GetEventsResponse_ProcessExec{ProcessExec: &tetragon.ProcessExec{}}}
+	exit := &tetragon.GetEventsResponse{Event: &tetragon.GetEventsResponse_ProcessExit{ProcessExit: &tetragon.ProcessExit{}}}
+	pm.NotifyListener(nil, exec)
+	pm.NotifyListener(nil, exit)
+	assert.True(t, pm.degraded)
+	assert.Equal(t, []*tetragon.GetEventsResponse{exec, exit}, relaxed.events)
+	assert.Equal(t, []*tetragon.GetEventsResponse{exec}, pressured.events)
+
+	pressured.pressure = false
+	pm.NotifyListener(nil, exit)
+	assert.False(t, pm.degraded)
+	assert.Equal(t, []*tetragon.GetEventsResponse{exec, exit}, pressured.events)
+}
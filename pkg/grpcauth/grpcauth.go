@@ -0,0 +1,268 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+// Package grpcauth secures the gRPC server with TLS, optionally requiring
+// client certificates, and with a static bearer token. Certificates and the
+// token are reloaded when their files change, so that they can be rotated
+// without restarting the agent.
+package grpcauth
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/cilium/tetragon/pkg/logger"
+	"github.com/cilium/tetragon/pkg/logger/logfields"
+)
+
+// bearerPrefix starts the authorization header of requests.
+const bearerPrefix = "Bearer "
+
+type Options struct {
+	// CertFile and KeyFile are the PEM encoded certificate and key of the
+	// server. If set, the server only accepts TLS connections.
+	CertFile string
+	KeyFile  string
+	// ClientCAFile, if set, holds the PEM encoded certificates of the CAs
+	// that client certificates must be signed by, and makes client
+	// certificates mandatory.
+	ClientCAFile string
+	// TokenFile, if set, holds a token that requests must send in the
+	// "authorization" metadata, as "Bearer <token>".
+	TokenFile string
+	// ListenAddr is the address the server listens on. Without TLS, a
+	// token is only accepted on unix sockets, so that it is not sent in
+	// plaintext over the network.
+	ListenAddr string
+}
+
+// Enabled returns whether any authentication is configured.
+func (o *Options) Enabled() bool {
+	return o.CertFile != "" || o.KeyFile != "" || o.ClientCAFile != "" || o.TokenFile != ""
+}
+
+// Validate checks that the options can be used together.
+func (o *Options) Validate() error {
+	if (o.CertFile == "") != (o.KeyFile == "") {
+		return errors.New("the TLS certificate and key of the gRPC server must be set together")
+	}
+	if o.ClientCAFile != "" && o.CertFile == "" {
+		return errors.New("client certificates of the gRPC server cannot be verified without a TLS certificate")
+	}
+	if o.TokenFile != "" && o.CertFile == "" && !strings.HasPrefix(o.ListenAddr, "unix://") {
+		return errors.New("the token of the gRPC server requires a TLS certificate unless it listens on a unix socket")
+	}
+	return nil
+}
+
+func (o *Options) files() []string {
+	var files []string
+	for _, f := range []string{o.CertFile, o.KeyFile, o.ClientCAFile, o.TokenFile} {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// Authenticator holds the current certificates and token of the server.
+type Authenticator struct {
+	opts Options
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	token     []byte
+}
+
+// New returns an Authenticator with the certificates and token read from
+// the files of opts.
+func New(opts Options) (*Authenticator, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	a := &Authenticator{opts: opts}
+	if err := a.reload(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// reload reads the files again. On error, the current certificates and
+// token are kept.
+func (a *Authenticator) reload() error {
+	var cert *tls.Certificate
+	if a.opts.CertFile != "" {
+		c, err := tls.LoadX509KeyPair(a.opts.CertFile, a.opts.KeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to load gRPC server certificate: %w", err)
+		}
+		cert = &c
+	}
+	var clientCAs *x509.CertPool
+	if a.opts.ClientCAFile != "" {
+		pem, err := os.ReadFile(a.opts.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read gRPC client CA: %w", err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificate found in gRPC client CA file %q", a.opts.ClientCAFile)
+		}
+	}
+	var token []byte
+	if a.opts.TokenFile != "" {
+		t, err := os.ReadFile(a.opts.TokenFile)
+		if err != nil {
+			return fmt.Errorf("failed to read gRPC token: %w", err)
+		}
+		if token = bytes.TrimSpace(t); len(token) == 0 {
+			return fmt.Errorf("gRPC token file %q is empty", a.opts.TokenFile)
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.cert, a.clientCAs, a.token = cert, clientCAs, token
+	return nil
+}
+
+// Watch reloads the certificates and token when their files change, until
+// ctx is done. Directories are watched rather than files, so that files
+// replaced by a rename, as done for Kubernetes secrets, are reloaded too.
+func (a *Authenticator) Watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	dirs := map[string]struct{}{}
+	for _, f := range a.opts.files() {
+		dirs[filepath.Dir(f)] = struct{}{}
+	}
+	for dir := range dirs {
+		if err := watcher.Add(dir); err != nil {
+			watcher.Close()
+			return fmt.Errorf("failed to watch %q: %w", dir, err)
+		}
+	}
+	go func() {
+		defer watcher.Close()
+		log := logger.GetLogger()
+		for {
+			select {
+			case ev, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if ev.Op == fsnotify.Chmod {
+					continue
+				}
+				if err := a.reload(); err != nil {
+					log.Warn("Failed to reload gRPC server credentials, keeping the current ones", logfields.Error, err)
+					continue
+				}
+				log.Debug("Reloaded gRPC server credentials", "event", ev.String())
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Warn("Failed to watch gRPC server credentials", logfields.Error, err)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// ServerOptions returns the options of a gRPC server using the
+// authenticator.
+func (a *Authenticator) ServerOptions() []grpc.ServerOption {
+	var opts []grpc.ServerOption
+	if a.opts.CertFile != "" {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(a.tlsConfig())))
+	}
+	if a.opts.TokenFile != "" {
+		opts = append(opts,
+			grpc.ChainUnaryInterceptor(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+				if err := a.authorize(ctx); err != nil {
+					return nil, err
+				}
+				return handler(ctx, req)
+			}),
+			grpc.ChainStreamInterceptor(func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+				if err := a.authorize(ss.Context()); err != nil {
+					return err
+				}
+				return handler(srv, ss)
+			}),
+		)
+	}
+	return opts
+}
+
+// tlsConfig returns a TLS configuration using the current certificates for
+// every new connection.
+func (a *Authenticator) tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			a.mu.RLock()
+			defer a.mu.RUnlock()
+			conf := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*a.cert},
+			}
+			if a.clientCAs != nil {
+				conf.ClientCAs = a.clientCAs
+				conf.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+			return conf, nil
+		},
+	}
+}
+
+// authorize checks the token of a request.
+func (a *Authenticator) authorize(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) != 1 || !strings.HasPrefix(values[0], bearerPrefix) {
+		return status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+	a.mu.RLock()
+	token := a.token
+	a.mu.RUnlock()
+	if subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(values[0], bearerPrefix)), token) != 1 {
+		return status.Error(codes.Unauthenticated, "invalid bearer token")
+	}
+	return nil
+}
+
+// TokenCredentials sends a bearer token with every request of a gRPC client.
+// The token is only sent over secure transports: TLS, or local credentials
+// for servers on unix sockets.
+type TokenCredentials string
+
+func (t TokenCredentials) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{"authorization": bearerPrefix + string(t)}, nil
+}
+
+func (t TokenCredentials) RequireTransportSecurity() bool {
+	return true
+}
@@ -0,0 +1,125 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package grpcauth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestOptionsValidate(t *testing.T) {
+	require.NoError(t, (&Options{}).Validate())
+	require.NoError(t, (&Options{TokenFile: "token", ListenAddr: "unix:///var/run/tetragon/tetragon.sock"}).Validate())
+	require.NoError(t, (&Options{TokenFile: "token", CertFile: "cert", KeyFile: "key", ListenAddr: "localhost:54321"}).Validate())
+	require.Error(t, (&Options{TokenFile: "token", ListenAddr: "localhost:54321"}).Validate())
+	require.NoError(t, (&Options{CertFile: "cert", KeyFile: "key", ClientCAFile: "ca"}).Validate())
+	require.Error(t, (&Options{CertFile: "cert"}).Validate())
+	require.Error(t, (&Options{ClientCAFile: "ca"}).Validate())
+}
+
+func TestAuthorize(t *testing.T) {
+	dir := t.TempDir()
+	tokenFile := filepath.Join(dir, "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("secret\n"), 0600))
+	a, err := New(Options{TokenFile: tokenFile, ListenAddr: "unix:///var/run/tetragon/tetragon.sock"})
+	require.NoError(t, err)
+	assert.Len(t, a.ServerOptions(), 2)
+
+	withToken := func(v string) context.Context {
+		return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", v))
+	}
+	require.NoError(t, a.authorize(withToken("Bearer secret")))
+	assert.Equal(t, codes.Unauthenticated, status.Code(a.authorize(context.Background())))
+	assert.Equal(t, codes.Unauthenticated, status.Code(a.authorize(withToken("Bearer other"))))
+	assert.Equal(t, codes.Unauthenticated, status.Code(a.authorize(withToken("secret"))))
+
+	// The token is rotated when its file changes.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, a.Watch(ctx))
+	require.NoError(t, os.WriteFile(tokenFile, []byte("rotated"), 0600))
+	require.Eventually(t, func() bool {
+		return a.authorize(withToken("Bearer rotated")) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// An empty token is rejected and the current one is kept.
+	require.NoError(t, a.reload())
+	require.NoError(t, os.WriteFile(tokenFile, nil, 0600))
+	require.Error(t, a.reload())
+	require.NoError(t, a.authorize(withToken("Bearer rotated")))
+}
+
+// writeCert writes a self-signed certificate and its key to dir, and
+// returns their paths.
+func writeCert(t *testing.T, dir, name string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		DNSNames:              []string{name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return certFile, keyFile
+}
+
+func TestTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, "server")
+	clientCert, clientKey := writeCert(t, dir, "client")
+
+	_, err := New(Options{CertFile: certFile, KeyFile: keyFile, ClientCAFile: keyFile})
+	require.Error(t, err)
+
+	a, err := New(Options{CertFile: certFile, KeyFile: keyFile, ClientCAFile: clientCert})
+	require.NoError(t, err)
+	assert.Len(t, a.ServerOptions(), 1)
+	conf, err := a.tlsConfig().GetConfigForClient(&tls.ClientHelloInfo{})
+	require.NoError(t, err)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, conf.ClientAuth)
+	require.Len(t, conf.Certificates, 1)
+	first := conf.Certificates[0].Certificate[0]
+
+	// New connections use the rotated certificate.
+	writeCert(t, dir, "server")
+	require.NoError(t, a.reload())
+	conf, err = a.tlsConfig().GetConfigForClient(&tls.ClientHelloInfo{})
+	require.NoError(t, err)
+	assert.NotEqual(t, first, conf.Certificates[0].Certificate[0])
+
+	// A certificate that does not match the key is rejected.
+	a.opts.KeyFile = clientKey
+	require.Error(t, a.reload())
+}
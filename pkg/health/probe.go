@@ -0,0 +1,63 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package health
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/cilium/tetragon/pkg/logger/logfields"
+)
+
+// ProbePing is the datagram a probe client sends. Other datagrams are
+// ignored.
+const ProbePing = "ping"
+
+// StartProbeServer answers the ping datagrams received on the UDP address
+// with the JSON encoding of status(), until ctx is done. It lets external
+// monitoring check agents that have no health server, such as in minimal
+// mode.
+func StartProbeServer(ctx context.Context, address string, status func() any) error {
+	conn, err := net.ListenPacket("udp", address)
+	if err != nil {
+		return fmt.Errorf("failed to listen for health probes on %q: %w", address, err)
+	}
+	log.Info("Starting UDP health probe server", "address", conn.LocalAddr().String())
+	go ServeProbes(ctx, conn, status)
+	return nil
+}
+
+// ServeProbes answers the ping datagrams received on conn until ctx is done,
+// and then closes conn.
+func ServeProbes(ctx context.Context, conn net.PacketConn, status func() any) {
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+	buf := make([]byte, 64)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Warn("UDP health probe server stopped", logfields.Error, err)
+			}
+			return
+		}
+		if string(bytes.TrimSpace(buf[:n])) != ProbePing {
+			continue
+		}
+		resp, err := json.Marshal(status())
+		if err != nil {
+			log.Warn("Failed to encode health probe response", logfields.Error, err)
+			continue
+		}
+		if _, err := conn.WriteTo(resp, addr); err != nil {
+			log.Debug("Failed to answer health probe", "address", addr.String(), logfields.Error, err)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package health
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeProbes(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go ServeProbes(ctx, conn, func() any {
+		return map[string]any{"status": "running", "events_exported": 42}
+	})
+
+	client, err := net.Dial("udp", conn.LocalAddr().String())
+	require.NoError(t, err)
+	defer client.Close()
+	buf := make([]byte, 1024)
+
+	// Other datagrams are not answered.
+	_, err = client.Write([]byte("hello"))
+	require.NoError(t, err)
+	_, err = client.Write([]byte("ping\n"))
+	require.NoError(t, err)
+	require.NoError(t, client.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, err := client.Read(buf)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"status":"running","events_exported":42}`, string(buf[:n]))
+
+	require.NoError(t, client.SetReadDeadline(time.Now().Add(50*time.Millisecond)))
+	_, err = client.Read(buf)
+	require.Error(t, err)
+}
@@ -21,7 +21,11 @@ var (
 	log = logger.GetLogger()
 )
 
-func StartHealthServer(ctx context.Context, address string, interval int) {
+// StartHealthServer serves the gRPC health service on address. The
+// "liveness" service follows the agent health. If services is not nil, the
+// services it returns, such as the exporters, are also reported. Both are
+// updated every interval seconds.
+func StartHealthServer(ctx context.Context, address string, interval int, services func() map[string]grpc_health_v1.HealthCheckResponse_ServingStatus) {
 	// Create a new health server and mark it as serving.
 	healthServer := gh.NewServer()
 	healthServer.SetServingStatus("liveness", grpc_health_v1.HealthCheckResponse_SERVING)
@@ -48,6 +52,7 @@ func StartHealthServer(ctx context.Context, address string, interval int) {
 	// health.GetHealth() and we report the status to the healthServer.
 	go func() {
 		ticker := time.NewTicker(time.Duration(interval) * time.Second)
+		var reported map[string]grpc_health_v1.HealthCheckResponse_ServingStatus
 		for {
 			select {
 			case <-ticker.C:
@@ -58,6 +63,20 @@ func StartHealthServer(ctx context.Context, address string, interval int) {
 					}
 				}
 				healthServer.SetServingStatus("liveness", servingStatus)
+				if services != nil {
+					current := services()
+					for service, status := range current {
+						healthServer.SetServingStatus(service, status)
+					}
+					// Services that are gone, such as exporters removed
+					// by a reload, are unknown again.
+					for service := range reported {
+						if _, ok := current[service]; !ok {
+							healthServer.SetServingStatus(service, grpc_health_v1.HealthCheckResponse_SERVICE_UNKNOWN)
+						}
+					}
+					reported = current
+				}
 			case <-ctx.Done():
 				ticker.Stop()
 				healthServer.Shutdown() // set all services to NOT_SERVING
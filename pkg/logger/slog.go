@@ -51,9 +51,11 @@ var slogLeveler = func() *slog.LevelVar {
 // phase.
 func initializeSlog(logOpts LogOptions, useStdout bool) {
 	opts := *slogHandlerOpts
-	opts.Level = logOpts.GetLogLevel()
+	// Keep the leveler, so that SetLogLevel changes the level at runtime.
+	level := logOpts.GetLogLevel()
+	slogLeveler.Set(level)
 
-	if opts.Level == slog.LevelDebug {
+	if level == slog.LevelDebug {
 		opts.AddSource = true
 	}
 
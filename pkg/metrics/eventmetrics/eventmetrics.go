@@ -64,6 +64,12 @@ var (
 		Help:        "The total number of events dropped because listener buffer was full",
 		ConstLabels: nil,
 	})
+	PressureDroppedEvents = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace:   consts.MetricsNamespace,
+		Name:        "notify_pressure_dropped_events_total",
+		Help:        "The total number of process_exit events not sent to listeners under pressure, to keep other events",
+		ConstLabels: nil,
+	})
 
 	policyStats = metrics.MustNewGranularCounter[metrics.ProcessLabels](prometheus.CounterOpts{
 		Namespace:   consts.MetricsNamespace,
@@ -83,6 +89,7 @@ func RegisterHealthMetrics(group metrics.Group) {
 	group.MustRegister(
 		FlagCount,
 		NotifyOverflowedEvents,
+		PressureDroppedEvents,
 		NewBPFCollector(),
 		missingProcessInfo,
 	)
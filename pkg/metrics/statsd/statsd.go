@@ -0,0 +1,141 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+// Package statsd periodically pushes Prometheus metrics to a statsd
+// endpoint over UDP, for agents that are not scraped.
+package statsd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/cilium/tetragon/pkg/logger"
+	"github.com/cilium/tetragon/pkg/logger/logfields"
+)
+
+// maxPacketSize keeps datagrams within the MTU of common networks.
+const maxPacketSize = 1432
+
+// Pusher sends the metrics of a gatherer to a statsd endpoint. Labels are
+// sent as DogStatsD tags. Counters are sent as statsd counters with the
+// increase since the previous push, gauges and untyped metrics as gauges.
+// Histograms and summaries are not sent.
+type Pusher struct {
+	gatherer prometheus.Gatherer
+	conn     net.Conn
+	interval time.Duration
+	// last holds the value of counters at the previous push.
+	last map[string]float64
+}
+
+// New returns a Pusher sending the metrics of gatherer to the UDP address
+// every interval.
+func New(gatherer prometheus.Gatherer, address string, interval time.Duration) (*Pusher, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("invalid statsd push interval %s: must be positive", interval)
+	}
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to statsd endpoint %q: %w", address, err)
+	}
+	return &Pusher{
+		gatherer: gatherer,
+		conn:     conn,
+		interval: interval,
+		last:     make(map[string]float64),
+	}, nil
+}
+
+// Run pushes metrics until ctx is done, and then closes the connection.
+func (p *Pusher) Run(ctx context.Context) {
+	defer p.conn.Close()
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := p.Push(); err != nil {
+				logger.GetLogger().Debug("Failed to push metrics to statsd", logfields.Error, err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Push sends the current value of the metrics.
+func (p *Pusher) Push() error {
+	families, err := p.gatherer.Gather()
+	if err != nil {
+		return err
+	}
+	var packet bytes.Buffer
+	for _, line := range p.lines(families) {
+		if packet.Len() > 0 && packet.Len()+1+len(line) > maxPacketSize {
+			if _, err := p.conn.Write(packet.Bytes()); err != nil {
+				return err
+			}
+			packet.Reset()
+		}
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+	if packet.Len() > 0 {
+		_, err = p.conn.Write(packet.Bytes())
+	}
+	return err
+}
+
+// lines returns the statsd lines of families, and records the value of
+// counters for the next push.
+func (p *Pusher) lines(families []*dto.MetricFamily) []string {
+	var lines []string
+	for _, mf := range families {
+		for _, m := range mf.GetMetric() {
+			tags := formatTags(m.GetLabel())
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				key := mf.GetName() + tags
+				value := m.GetCounter().GetValue()
+				delta := value - p.last[key]
+				p.last[key] = value
+				if delta > 0 {
+					lines = append(lines, formatLine(mf.GetName(), delta, "c", tags))
+				}
+			case dto.MetricType_GAUGE:
+				lines = append(lines, formatLine(mf.GetName(), m.GetGauge().GetValue(), "g", tags))
+			case dto.MetricType_UNTYPED:
+				lines = append(lines, formatLine(mf.GetName(), m.GetUntyped().GetValue(), "g", tags))
+			}
+		}
+	}
+	return lines
+}
+
+func formatLine(name string, value float64, kind, tags string) string {
+	return name + ":" + strconv.FormatFloat(value, 'f', -1, 64) + "|" + kind + tags
+}
+
+// formatTags returns labels as a DogStatsD tags suffix, sorted by name.
+func formatTags(labels []*dto.LabelPair) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	tags := make([]string, 0, len(labels))
+	for _, l := range labels {
+		tags = append(tags, l.GetName()+":"+strings.NewReplacer(",", "_", "|", "_").Replace(l.GetValue()))
+	}
+	sort.Strings(tags)
+	return "|#" + strings.Join(tags, ",")
+}
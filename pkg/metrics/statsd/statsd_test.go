@@ -0,0 +1,62 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package statsd
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readPacket(t *testing.T, conn net.PacketConn) []string {
+	buf := make([]byte, maxPacketSize)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	return strings.Split(string(buf[:n]), "\n")
+}
+
+func TestPusher(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	reg := prometheus.NewRegistry()
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "events_total"}, []string{"status", "exporter"})
+	gauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "queue_length"})
+	reg.MustRegister(counter, gauge)
+	counter.WithLabelValues("exported", "file").Add(10)
+	gauge.Set(3)
+
+	p, err := New(reg, conn.LocalAddr().String(), time.Second)
+	require.NoError(t, err)
+	defer p.conn.Close()
+
+	require.NoError(t, p.Push())
+	assert.Equal(t, []string{
+		"events_total:10|c|#exporter:file,status:exported",
+		"queue_length:3|g",
+	}, readPacket(t, conn))
+
+	// Counters are sent as the increase since the previous push, and are
+	// not sent if they did not change.
+	counter.WithLabelValues("exported", "file").Add(5)
+	require.NoError(t, p.Push())
+	assert.Equal(t, []string{
+		"events_total:5|c|#exporter:file,status:exported",
+		"queue_length:3|g",
+	}, readPacket(t, conn))
+	require.NoError(t, p.Push())
+	assert.Equal(t, []string{"queue_length:3|g"}, readPacket(t, conn))
+}
+
+func TestPusher_InvalidInterval(t *testing.T) {
+	_, err := New(prometheus.NewRegistry(), "127.0.0.1:8125", 0)
+	require.Error(t, err)
+}
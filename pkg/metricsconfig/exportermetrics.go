@@ -0,0 +1,67 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package metricsconfig
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/cilium/tetragon/pkg/exporter"
+	"github.com/cilium/tetragon/pkg/exporter/loki"
+	"github.com/cilium/tetragon/pkg/exporter/redis"
+	"github.com/cilium/tetragon/pkg/exporter/syslog"
+	"github.com/cilium/tetragon/pkg/exporter/webhook"
+	"github.com/cilium/tetragon/pkg/logger"
+	"github.com/cilium/tetragon/pkg/logger/logfields"
+	"github.com/cilium/tetragon/pkg/metrics"
+	"github.com/cilium/tetragon/pkg/metrics/statsd"
+)
+
+// NewExporterRegistry returns a registry with the metrics of the event
+// exporters only. The same metrics are also part of the health metrics.
+func NewExporterRegistry() *prometheus.Registry {
+	group := metrics.NewMetricsGroup(false)
+	exporter.RegisterMetrics(group)
+	webhook.RegisterMetrics(group)
+	redis.RegisterMetrics(group)
+	loki.RegisterMetrics(group)
+	syslog.RegisterMetrics(group)
+	group.Init()
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(group)
+	return reg
+}
+
+// EnableExporterMetrics serves the exporter metrics on address. It is meant
+// for agents running without the metrics server, such as in minimal mode.
+func EnableExporterMetrics(address string) {
+	reg := NewExporterRegistry()
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{Registry: reg}))
+
+	logger.GetLogger().Info("Starting exporter metrics server", "addr", address)
+	if err := http.ListenAndServe(address, mux); err != nil {
+		logger.GetLogger().Warn("Exporter metrics server stopped", logfields.Error, err)
+	}
+}
+
+// EnableStatsd pushes the exporter metrics and the process resource metrics
+// to the statsd endpoint at address every interval, until ctx is done.
+func EnableStatsd(ctx context.Context, address string, interval time.Duration) error {
+	reg := NewExporterRegistry()
+	reg.MustRegister(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	p, err := statsd.New(reg, address, interval)
+	if err != nil {
+		return err
+	}
+	logger.GetLogger().Info("Pushing metrics to statsd", "addr", address, "interval", interval)
+	go p.Run(ctx)
+	return nil
+}
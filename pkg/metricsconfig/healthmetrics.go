@@ -12,6 +12,10 @@ import (
 	"github.com/cilium/tetragon/pkg/errmetrics"
 	"github.com/cilium/tetragon/pkg/eventcache"
 	"github.com/cilium/tetragon/pkg/exporter"
+	"github.com/cilium/tetragon/pkg/exporter/loki"
+	"github.com/cilium/tetragon/pkg/exporter/redis"
+	"github.com/cilium/tetragon/pkg/exporter/syslog"
+	"github.com/cilium/tetragon/pkg/exporter/webhook"
 	"github.com/cilium/tetragon/pkg/grpc/tracing"
 	"github.com/cilium/tetragon/pkg/metrics"
 	"github.com/cilium/tetragon/pkg/metrics/cgroupratemetrics"
@@ -86,6 +90,10 @@ func registerHealthMetrics(group metrics.Group) {
 	group.ExtendInit(tracing.InitMetrics)
 	// exporter metrics
 	exporter.RegisterMetrics(group)
+	webhook.RegisterMetrics(group)
+	redis.RegisterMetrics(group)
+	loki.RegisterMetrics(group)
+	syslog.RegisterMetrics(group)
 	// cgrup rate metrics
 	cgroupratemetrics.RegisterMetrics(group)
 
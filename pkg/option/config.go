@@ -30,6 +30,8 @@ type config struct {
 	ForceSmallProgs bool
 	ForceLargeProgs bool
 	ClusterName     string
+	NodeName        string
+	NodeLabels      map[string]string
 
 	EnablePodAnnotations bool
 
@@ -65,11 +67,22 @@ type config struct {
 	DataCacheSize          int
 	ProcessCacheGCInterval time.Duration
 
-	MetricsServer      string
-	MetricsLabelFilter metrics.LabelFilter
-	ServerAddress      string
-	TracingPolicy      string
-	TracingPolicyDir   string
+	MetricsServer         string
+	ExporterMetricsServer string
+	MetricsStatsd         string
+	MetricsStatsdInterval time.Duration
+	MetricsLabelFilter    metrics.LabelFilter
+	ServerAddress         string
+	ControlSocket         string
+	// ServerTLSCertFile, ServerTLSKeyFile, ServerTLSClientCAFile and
+	// ServerAuthTokenFile secure the gRPC server, see grpcauth.Options.
+	ServerTLSCertFile     string
+	ServerTLSKeyFile      string
+	ServerTLSClientCAFile string
+	ServerAuthTokenFile   string
+	TracingPolicy         string
+	TracingPolicyDir      string
+	TracingPolicyDirWatch bool
 
 	ExportFilename             string
 	ExportFileMaxSizeMB        int
@@ -77,7 +90,87 @@ type config struct {
 	ExportFileMaxBackups       int
 	ExportFileCompress         bool
 	ExportRateLimit            int
+	ExportRateLimitInterval    time.Duration
+	ExportRateLimitBurst       int
+	ExportRateLimitAdaptive    bool
+	ExportMaxBytesPerSecond    int
+	ExportLimitSchedule        string
+	ExportQueueSize            int
+	ExportShedExitEvents       bool
+	ExportLabels               map[string]string
+	ExportNodeMetadata         []string
+	ExportSchemaVersion        bool
+	ExportJSONFieldNames       string
+	ExportJSONEmitUnpopulated  bool
+	ExportJSONTimestampFormat  string
+	ExportJSONFlatten          bool
+	ExportPriorities           map[string]string
+	ExportRetentionWindow      time.Duration
+	ExportRetentionMaxEvents   int
+	ExportDeadLetterFile       string
+	ExportDeadLetterMaxSizeMB  int
+	ExportSigningKey           string
+	ExportSigningKeyID         string
+	ExportSigningAlgorithm     string
+	ExportAllowEventTypes      []string
+	ExportDenyEventTypes       []string
+	ExportFields               []string
 	ExportFilePerm             string
+	ExportFileFormat           string
+
+	StdoutOutput          bool
+	StdoutOutputRateLimit int
+
+	ExportWebhookURL           string
+	ExportWebhookHeaders       map[string]string
+	ExportWebhookBatchSize     int
+	ExportWebhookFlushInterval time.Duration
+	ExportWebhookCompression   string
+	ExportWebhookMaxRetries    int
+	ExportWebhookRetryBackoff  time.Duration
+	ExportWebhookTimeout       time.Duration
+
+	ExportGELFAddress     string
+	ExportGELFCompression string
+	ExportGELFChunkSize   int
+
+	ExportRedisAddress       string
+	ExportRedisStream        string
+	ExportRedisMaxLen        int
+	ExportRedisUsername      string
+	ExportRedisPasswordFile  string
+	ExportRedisTLS           bool
+	ExportRedisTLSCAFile     string
+	ExportRedisBatchSize     int
+	ExportRedisFlushInterval time.Duration
+	ExportRedisTimeout       time.Duration
+
+	ExportLokiURL           string
+	ExportLokiTenant        string
+	ExportLokiBatchSize     int
+	ExportLokiFlushInterval time.Duration
+	ExportLokiMaxRetries    int
+	ExportLokiRetryBackoff  time.Duration
+	ExportLokiTimeout       time.Duration
+
+	ExportSyslogAddress       string
+	ExportSyslogTransport     string
+	ExportSyslogTLSCAFile     string
+	ExportSyslogTLSCertFile   string
+	ExportSyslogTLSKeyFile    string
+	ExportSyslogFacility      string
+	ExportSyslogAppName       string
+	ExportSyslogFlushInterval time.Duration
+	ExportSyslogTimeout       time.Duration
+
+	// Exporters lists the enabled event export destinations.
+	Exporters []ExporterConfig
+
+	// MinimalMode disables everything that is not needed to observe and
+	// export events. MinimalModeDisabled lists the keys of the settings
+	// that it turned off.
+	MinimalMode         bool
+	MinimalModeDisabled []string
 
 	// Export aggregation options
 	EnableExportAggregation     bool
@@ -111,6 +204,7 @@ type config struct {
 
 	HealthServerAddress  string
 	HealthServerInterval int
+	HealthProbeAddress   string
 
 	KeepSensorsOnExit bool
 
@@ -150,6 +244,10 @@ var (
 		// mainly used in the case of testing
 		EventCacheNumRetries: defaults.DefaultEventCacheNumRetries,
 		EventCacheRetryDelay: defaults.DefaultEventCacheRetryDelay,
+
+		// File exporters fail with invalid permissions, so default them
+		// like the --export-file-perm flag for configs built without flags.
+		ExportFilePerm: defaults.DefaultLogsPermission,
 	}
 )
 
@@ -223,6 +321,11 @@ func ReadDirConfig(dirName string) (map[string]interface{}, error) {
 }
 
 func ReadConfigFile(path string, file string) error {
+	return ReadConfigFileTo(viper.GetViper(), path, file)
+}
+
+// ReadConfigFileTo merges the configuration file in path into v.
+func ReadConfigFileTo(v *viper.Viper, path string, file string) error {
 	filePath := filepath.Join(path, file)
 	st, err := os.Stat(filePath)
 	if err != nil {
@@ -232,8 +335,8 @@ func ReadConfigFile(path string, file string) error {
 		return fmt.Errorf("failed to read config file '%s' not a regular file", file)
 	}
 
-	viper.AddConfigPath(path)
-	err = viper.MergeInConfig()
+	v.AddConfigPath(path)
+	err = v.MergeInConfig()
 	if err != nil {
 		return err
 	}
@@ -242,6 +345,12 @@ func ReadConfigFile(path string, file string) error {
 }
 
 func ReadConfigDir(path string) error {
+	return ReadConfigDirTo(viper.GetViper(), path)
+}
+
+// ReadConfigDirTo merges the configuration directory path, holding a file
+// for each option, into v.
+func ReadConfigDirTo(v *viper.Viper, path string) error {
 	st, err := os.Stat(path)
 	if err != nil {
 		return err
@@ -254,7 +363,7 @@ func ReadConfigDir(path string) error {
 	if err != nil {
 		return err
 	}
-	if err := viper.MergeConfigMap(cm); err != nil {
+	if err := v.MergeConfigMap(cm); err != nil {
 		return fmt.Errorf("merge config failed %w", err)
 	}
 
@@ -0,0 +1,257 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package option
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"sigs.k8s.io/yaml"
+)
+
+// ExporterConfig describes a single event export destination.
+type ExporterConfig struct {
+	// Name identifies the exporter in logs and metrics. It defaults to the
+	// exporter type.
+	Name string `json:"name"`
+	// Type selects the exporter implementation, as registered in
+	// pkg/exporter (e.g. "file", "stdout", "webhook", "gelf", "redis", "loki" or "syslog").
+	Type string `json:"type"`
+	// AllowList and DenyList select the exported events, using the same
+	// syntax as --export-allowlist and --export-denylist. If empty, the
+	// global export filters are used.
+	AllowList string `json:"allowList,omitempty"`
+	DenyList  string `json:"denyList,omitempty"`
+	// FieldFilters uses the same syntax as --field-filters. If empty, the
+	// global field filters are used.
+	FieldFilters string `json:"fieldFilters,omitempty"`
+	// AllowEventTypes and DenyEventTypes restrict the exported event types,
+	// on top of AllowList and DenyList. If empty,
+	// --export-allow-event-types and --export-deny-event-types are used.
+	AllowEventTypes []string `json:"allowEventTypes,omitempty"`
+	DenyEventTypes  []string `json:"denyEventTypes,omitempty"`
+	// Fields restricts the exported fields, on top of FieldFilters. If
+	// empty, --export-fields is used.
+	Fields []string `json:"fields,omitempty"`
+	// RateLimit is the number of events exported per RateLimitInterval,
+	// -1 disables rate limiting. If not set, --export-rate-limit is used.
+	RateLimit *int `json:"rateLimit,omitempty"`
+	// RateLimitInterval is a duration such as "1m". If empty,
+	// --export-rate-limit-interval is used.
+	RateLimitInterval string `json:"rateLimitInterval,omitempty"`
+	// RateLimitBurst is the number of events that can be exported at once
+	// before the rate limit applies, 0 uses RateLimit. If not set,
+	// --export-rate-limit-burst is used.
+	RateLimitBurst *int `json:"rateLimitBurst,omitempty"`
+	// RateLimitAdaptive lowers the rate limit while the exporter cannot keep
+	// up. If not set, --export-rate-limit-adaptive is used.
+	RateLimitAdaptive *bool `json:"rateLimitAdaptive,omitempty"`
+	// QueueSize is the number of events buffered between the event stream
+	// and the exporter, 0 encodes events synchronously. If not set,
+	// --export-queue-size is used.
+	QueueSize *int `json:"queueSize,omitempty"`
+	// Templates maps event types, such as "PROCESS_EXEC", or "default" to
+	// Go text/template formats. If set, events are written in these formats
+	// instead of JSON. Only the file exporter supports templates.
+	Templates map[string]string `json:"templates,omitempty"`
+	// Stages process events before they are rate limited and exported, in
+	// order, see exporter.Stage.
+	Stages []StageConfig `json:"stages,omitempty"`
+	// Options holds settings specific to the exporter type. Option names
+	// are lowercase.
+	Options map[string]string `json:"options,omitempty"`
+}
+
+// StageConfig describes a processing stage of an exporter.
+type StageConfig struct {
+	// Type selects the stage implementation, as registered in
+	// pkg/exporter (e.g. "sample" or "exclude-fields").
+	Type string `json:"type"`
+	// Options holds settings specific to the stage type. Option names are
+	// lowercase.
+	Options map[string]string `json:"options,omitempty"`
+}
+
+// Option returns the value of the type-specific option key, or def if the
+// option is not set.
+func (c *ExporterConfig) Option(key, def string) string {
+	if v, ok := c.Options[key]; ok {
+		return v
+	}
+	return def
+}
+
+// RateLimitSettings returns the number of events allowed per interval for
+// the exporter, falling back to the global export rate limit flags.
+func (c *ExporterConfig) RateLimitSettings() (int, time.Duration, error) {
+	limit := Config.ExportRateLimit
+	if c.RateLimit != nil {
+		limit = *c.RateLimit
+	}
+	interval := Config.ExportRateLimitInterval
+	if c.RateLimitInterval != "" {
+		var err error
+		if interval, err = time.ParseDuration(c.RateLimitInterval); err != nil {
+			return 0, 0, fmt.Errorf("invalid rateLimitInterval of exporter %q: %w", c.Name, err)
+		}
+	}
+	if limit >= 0 && interval <= 0 {
+		return 0, 0, fmt.Errorf("invalid rate limit interval %s of exporter %q: must be positive", interval, c.Name)
+	}
+	return limit, interval, nil
+}
+
+// RateLimitBurstSetting returns the burst of the exporter rate limiter,
+// falling back to --export-rate-limit-burst. Zero means that the burst is the
+// rate limit, so that the whole allowance of an interval can be used at once.
+func (c *ExporterConfig) RateLimitBurstSetting() int {
+	if c.RateLimitBurst != nil {
+		return *c.RateLimitBurst
+	}
+	return Config.ExportRateLimitBurst
+}
+
+// RateLimitAdaptiveSetting returns whether the rate limit of the exporter is
+// adaptive, falling back to --export-rate-limit-adaptive.
+func (c *ExporterConfig) RateLimitAdaptiveSetting() bool {
+	if c.RateLimitAdaptive != nil {
+		return *c.RateLimitAdaptive
+	}
+	return Config.ExportRateLimitAdaptive
+}
+
+// QueueSizeSetting returns the queue size of the exporter, falling back to
+// --export-queue-size.
+func (c *ExporterConfig) QueueSizeSetting() int {
+	if c.QueueSize != nil {
+		return *c.QueueSize
+	}
+	return Config.ExportQueueSize
+}
+
+// exportersFromFlags returns the export destinations enabled by the
+// individual export flags of c.
+func exportersFromFlags(c *config) []ExporterConfig {
+	var exporters []ExporterConfig
+	if c.ExportFilename != "" {
+		exporters = append(exporters, ExporterConfig{Name: "file", Type: "file"})
+	}
+	if c.StdoutOutput {
+		exporters = append(exporters, ExporterConfig{Name: "stdout", Type: "stdout"})
+	}
+	if c.ExportWebhookURL != "" {
+		exporters = append(exporters, ExporterConfig{Name: "webhook", Type: "webhook"})
+	}
+	if c.ExportGELFAddress != "" {
+		exporters = append(exporters, ExporterConfig{Name: "gelf", Type: "gelf"})
+	}
+	if c.ExportRedisAddress != "" {
+		exporters = append(exporters, ExporterConfig{Name: "redis", Type: "redis"})
+	}
+	if c.ExportLokiURL != "" {
+		exporters = append(exporters, ExporterConfig{Name: "loki", Type: "loki"})
+	}
+	if c.ExportSyslogAddress != "" {
+		exporters = append(exporters, ExporterConfig{Name: "syslog", Type: "syslog"})
+	}
+	return exporters
+}
+
+// exportersFromConfig returns the exporters listed under the "exporters"
+// key. In tetragon.yaml, this is a YAML list. With --exporters or a drop-in
+// file, it is a string containing that list.
+func exportersFromConfig(v *viper.Viper) ([]ExporterConfig, error) {
+	value := v.Get(KeyExporters)
+	if s, ok := value.(string); ok || value == nil {
+		return ParseExporters(s)
+	}
+	data, err := yaml.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse exporters: %w", err)
+	}
+	return ParseExporters(string(data))
+}
+
+// ParseExporters parses a YAML (or JSON) list of exporter configurations, as
+// passed to --exporters. For example, the following sends all events to a
+// file and only kprobe events to a webhook:
+//
+//	[{name: all, type: file, options: {filename: /var/log/tetragon/all.log}},
+//	 {name: kprobes, type: webhook, allowList: '{"event_set":["PROCESS_KPROBE"]}'}]
+func ParseExporters(s string) ([]ExporterConfig, error) {
+	var exporters []ExporterConfig
+	if s == "" {
+		return exporters, nil
+	}
+	if err := yaml.UnmarshalStrict([]byte(s), &exporters); err != nil {
+		return nil, fmt.Errorf("failed to parse exporters: %w", err)
+	}
+	for i := range exporters {
+		if err := exporters[i].validate(i); err != nil {
+			return nil, err
+		}
+	}
+	return exporters, nil
+}
+
+// validate checks the exporter configuration at index i of the exporters
+// list and sets defaults for missing fields.
+func (c *ExporterConfig) validate(i int) error {
+	if c.Type == "" {
+		return fmt.Errorf("exporter at index %d has no type", i)
+	}
+	if c.Name == "" {
+		c.Name = c.Type
+	}
+	if c.RateLimit != nil && *c.RateLimit < -1 {
+		return fmt.Errorf("invalid rateLimit of exporter %q: must be -1 or more", c.Name)
+	}
+	if c.RateLimitInterval != "" {
+		if _, err := time.ParseDuration(c.RateLimitInterval); err != nil {
+			return fmt.Errorf("invalid rateLimitInterval of exporter %q: %w", c.Name, err)
+		}
+	}
+	if c.RateLimitBurst != nil && *c.RateLimitBurst < 0 {
+		return fmt.Errorf("invalid rateLimitBurst of exporter %q: must not be negative", c.Name)
+	}
+	if c.QueueSize != nil && *c.QueueSize < 0 {
+		return fmt.Errorf("invalid queueSize of exporter %q: must not be negative", c.Name)
+	}
+	c.Options = lowerKeys(c.Options)
+	for j := range c.Stages {
+		if c.Stages[j].Type == "" {
+			return fmt.Errorf("stage at index %d of exporter %q has no type", j, c.Name)
+		}
+		c.Stages[j].Options = lowerKeys(c.Stages[j].Options)
+	}
+	return nil
+}
+
+// lowerKeys returns options with lowercase keys.
+func lowerKeys(options map[string]string) map[string]string {
+	if len(options) == 0 {
+		return options
+	}
+	lower := make(map[string]string, len(options))
+	for k, v := range options {
+		lower[strings.ToLower(k)] = v
+	}
+	return lower
+}
+
+// mergeExporters appends extra to exporters, failing if a name is used more
+// than once.
+func mergeExporters(exporters, extra []ExporterConfig) ([]ExporterConfig, error) {
+	names := make(map[string]struct{}, len(exporters)+len(extra))
+	all := append(exporters, extra...)
+	for i := range all {
+		if _, ok := names[all[i].Name]; ok {
+			return nil, fmt.Errorf("duplicate exporter name %q", all[i].Name)
+		}
+		names[all[i].Name] = struct{}{}
+	}
+	return all, nil
+}
@@ -0,0 +1,154 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package option
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseExporters(t *testing.T) {
+	exporters, err := ParseExporters(`
+- name: all-events
+  type: file
+  options:
+    filename: /var/log/tetragon/all.log
+- name: kprobes
+  type: webhook
+  allowList: '{"event_set":["PROCESS_KPROBE"]}'
+`)
+	require.NoError(t, err)
+	require.Len(t, exporters, 2)
+	assert.Equal(t, "/var/log/tetragon/all.log", exporters[0].Option("filename", ""))
+	assert.Equal(t, "default", exporters[1].Option("filename", "default"))
+	assert.JSONEq(t, `{"event_set":["PROCESS_KPROBE"]}`, exporters[1].AllowList)
+
+	exporters, err = ParseExporters("")
+	require.NoError(t, err)
+	assert.Empty(t, exporters)
+
+	_, err = ParseExporters("- name: foo")
+	require.Error(t, err)
+	exporters, err = ParseExporters("- type: file\n  options: {FileName: /tmp/out.log}")
+	require.NoError(t, err)
+	assert.Equal(t, "file", exporters[0].Name, "name defaults to type")
+	assert.Equal(t, "/tmp/out.log", exporters[0].Option("filename", ""))
+	_, err = ParseExporters("- type: file\n  rateLimit: -2")
+	require.Error(t, err)
+	_, err = ParseExporters("- type: file\n  queueSize: -1")
+	require.Error(t, err)
+	_, err = ParseExporters("- name: foo\n  type: file\n  unknown: true")
+	require.Error(t, err)
+	exporters, err = ParseExporters("- type: file\n  stages: [{type: sample, options: {Ratio: '0.5'}}]")
+	require.NoError(t, err)
+	assert.Equal(t, []StageConfig{{Type: "sample", Options: map[string]string{"ratio": "0.5"}}}, exporters[0].Stages)
+	_, err = ParseExporters("- type: file\n  stages: [{options: {ratio: '0.5'}}]")
+	require.Error(t, err)
+}
+
+func TestExportersFromConfig(t *testing.T) {
+	v := viper.New()
+
+	// Structured list, as read from tetragon.yaml. Viper lowercases keys.
+	v.Set(KeyExporters, []any{
+		map[string]any{"type": "file", "ratelimit": 10, "options": map[string]any{"filename": "/tmp/out.log"}},
+		map[string]any{"name": "kprobes", "type": "webhook", "allowlist": `{"event_set":["PROCESS_KPROBE"]}`},
+	})
+	exporters, err := exportersFromConfig(v)
+	require.NoError(t, err)
+	require.Len(t, exporters, 2)
+	assert.Equal(t, "file", exporters[0].Name)
+	require.NotNil(t, exporters[0].RateLimit)
+	assert.Equal(t, 10, *exporters[0].RateLimit)
+	assert.Equal(t, "/tmp/out.log", exporters[0].Option("filename", ""))
+	assert.JSONEq(t, `{"event_set":["PROCESS_KPROBE"]}`, exporters[1].AllowList)
+
+	// String, as passed with --exporters or a drop-in file.
+	v.Set(KeyExporters, "[{type: stdout}]")
+	exporters, err = exportersFromConfig(v)
+	require.NoError(t, err)
+	assert.Equal(t, []ExporterConfig{{Name: "stdout", Type: "stdout"}}, exporters)
+}
+
+func TestMergeExporters(t *testing.T) {
+	flags := []ExporterConfig{{Name: "file", Type: "file"}}
+	all, err := mergeExporters(flags, []ExporterConfig{{Name: "kprobes", Type: "file"}})
+	require.NoError(t, err)
+	assert.Len(t, all, 2)
+
+	_, err = mergeExporters(flags, []ExporterConfig{{Name: "file", Type: "webhook"}})
+	require.Error(t, err)
+}
+
+func TestExporterRateLimitSettings(t *testing.T) {
+	Config.ExportRateLimit = 100
+	Config.ExportRateLimitInterval = time.Minute
+
+	limit, interval, err := (&ExporterConfig{Name: "file"}).RateLimitSettings()
+	require.NoError(t, err)
+	assert.Equal(t, 100, limit)
+	assert.Equal(t, time.Minute, interval)
+
+	disabled := -1
+	limit, _, err = (&ExporterConfig{Name: "file", RateLimit: &disabled}).RateLimitSettings()
+	require.NoError(t, err)
+	assert.Equal(t, -1, limit)
+
+	limit, interval, err = (&ExporterConfig{Name: "file", RateLimitInterval: "1s"}).RateLimitSettings()
+	require.NoError(t, err)
+	assert.Equal(t, 100, limit)
+	assert.Equal(t, time.Second, interval)
+
+	_, _, err = (&ExporterConfig{Name: "file", RateLimitInterval: "0s"}).RateLimitSettings()
+	require.Error(t, err)
+}
+
+func TestExporterRateLimitBurstSetting(t *testing.T) {
+	Config.ExportRateLimitBurst = 0
+	assert.Equal(t, 0, (&ExporterConfig{Name: "file"}).RateLimitBurstSetting())
+
+	Config.ExportRateLimitBurst = 500
+	assert.Equal(t, 500, (&ExporterConfig{Name: "file"}).RateLimitBurstSetting())
+	burst := 50
+	assert.Equal(t, 50, (&ExporterConfig{Name: "file", RateLimitBurst: &burst}).RateLimitBurstSetting())
+	Config.ExportRateLimitBurst = 0
+
+	_, err := ParseExporters(`[{type: file, rateLimitBurst: -1}]`)
+	require.Error(t, err)
+}
+
+func TestReloadExportFlags(t *testing.T) {
+	saved := Config
+	defer func() { Config = saved }()
+	prev := viper.New()
+	prev.Set(KeyExportRateLimit, 10)
+	require.NoError(t, readExportFlags(prev, &Config))
+
+	v := viper.New()
+	v.Set(KeyExportRateLimit, 20)
+	var seen int
+	err := ReloadExportFlags(v, prev, func() error {
+		seen = Config.ExportRateLimit
+		return errors.New("invalid")
+	})
+	require.Error(t, err)
+	assert.Equal(t, 20, seen, "check sees the new options")
+	assert.Equal(t, 10, Config.ExportRateLimit, "failed reloads restore the options")
+
+	invalid := viper.New()
+	invalid.Set(KeyExportNodeMetadata, map[string]any{"a": 1})
+	err = ReloadExportFlags(invalid, prev, func() error {
+		t.Fatal("options that cannot be parsed are not set")
+		return nil
+	})
+	require.Error(t, err)
+
+	require.NoError(t, ReloadExportFlags(v, prev, func() error { return nil }))
+	assert.Equal(t, 20, Config.ExportRateLimit)
+}
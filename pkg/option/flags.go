@@ -10,6 +10,7 @@ import (
 	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-viper/mapstructure/v2"
@@ -36,6 +37,8 @@ const (
 	KeyForceSmallProgs        = "force-small-progs"
 	KeyForceLargeProgs        = "force-large-progs"
 	KeyClusterName            = "cluster-name"
+	KeyNodeName               = "node-name"
+	KeyNodeLabels             = "node-labels"
 
 	KeyLogLevel  = "log-level"
 	KeyLogFormat = "log-format"
@@ -46,16 +49,25 @@ const (
 
 	KeyEnablePodAnnotations = "enable-pod-annotations"
 
-	KeyMetricsServer      = "metrics-server"
-	KeyMetricsLabelFilter = "metrics-label-filter"
-	KeyServerAddress      = "server-address"
-	KeyGopsAddr           = "gops-address"
-
-	KeyEnableAncestors   = "enable-ancestors"
-	KeyEnableProcessCred = "enable-process-cred"
-	KeyEnableProcessNs   = "enable-process-ns"
-	KeyTracingPolicy     = "tracing-policy"
-	KeyTracingPolicyDir  = "tracing-policy-dir"
+	KeyMetricsServer         = "metrics-server"
+	KeyExporterMetricsServer = "exporter-metrics-server"
+	KeyMetricsStatsd         = "metrics-statsd-address"
+	KeyMetricsStatsdInterval = "metrics-statsd-interval"
+	KeyMetricsLabelFilter    = "metrics-label-filter"
+	KeyServerAddress         = "server-address"
+	KeyControlSocket         = "control-socket"
+	KeyServerTLSCertFile     = "server-tls-cert-file"
+	KeyServerTLSKeyFile      = "server-tls-key-file"
+	KeyServerTLSClientCAFile = "server-tls-client-ca-file"
+	KeyServerAuthTokenFile   = "server-auth-token-file"
+	KeyGopsAddr              = "gops-address"
+
+	KeyEnableAncestors       = "enable-ancestors"
+	KeyEnableProcessCred     = "enable-process-cred"
+	KeyEnableProcessNs       = "enable-process-ns"
+	KeyTracingPolicy         = "tracing-policy"
+	KeyTracingPolicyDir      = "tracing-policy-dir"
+	KeyTracingPolicyDirWatch = "tracing-policy-dir-watch"
 
 	KeyCpuProfile = "cpuprofile"
 	KeyMemProfile = "memprofile"
@@ -67,7 +79,83 @@ const (
 	KeyExportFileMaxBackups       = "export-file-max-backups"
 	KeyExportFileCompress         = "export-file-compress"
 	KeyExportRateLimit            = "export-rate-limit"
+	KeyExportRateLimitInterval    = "export-rate-limit-interval"
+	KeyExportRateLimitBurst       = "export-rate-limit-burst"
+	KeyExportRateLimitAdaptive    = "export-rate-limit-adaptive"
+	KeyExportMaxBytesPerSecond    = "export-max-bytes-per-second"
+	KeyExportLimitSchedule        = "export-limit-schedule"
+	KeyExportQueueSize            = "export-queue-size"
+	KeyExportShedExitEvents       = "export-shed-exit-events"
+	KeyExportLabels               = "export-labels"
+	KeyExportNodeMetadata         = "export-node-metadata"
+	KeyExportSchemaVersion        = "export-schema-version"
+	KeyExportJSONFieldNames       = "export-json-field-names"
+	KeyExportJSONEmitUnpopulated  = "export-json-emit-unpopulated"
+	KeyExportJSONTimestampFormat  = "export-json-timestamp-format"
+	KeyExportJSONFlatten          = "export-json-flatten"
+	KeyExportAllowEventTypes      = "export-allow-event-types"
+	KeyExportDenyEventTypes       = "export-deny-event-types"
+	KeyExportFields               = "export-fields"
+	KeyExportPriorities           = "export-priorities"
+	KeyExportRetentionWindow      = "export-retention-window"
+	KeyExportRetentionMaxEvents   = "export-retention-max-events"
+	KeyExportDeadLetterFile       = "export-dead-letter-file"
+	KeyExportDeadLetterMaxSizeMB  = "export-dead-letter-max-size-mb"
+	KeyExportSigningKey           = "export-signing-key"
+	KeyExportSigningKeyID         = "export-signing-key-id"
+	KeyExportSigningAlgorithm     = "export-signing-algorithm"
 	KeyExportFilePerm             = "export-file-perm"
+	KeyExportFileFormat           = "export-file-format"
+
+	KeyStdoutOutput          = "stdout-output"
+	KeyStdoutOutputRateLimit = "stdout-output-rate-limit"
+
+	KeyExportWebhookURL           = "export-webhook-url"
+	KeyExportWebhookHeaders       = "export-webhook-headers"
+	KeyExportWebhookBatchSize     = "export-webhook-batch-size"
+	KeyExportWebhookFlushInterval = "export-webhook-flush-interval"
+	KeyExportWebhookCompression   = "export-webhook-compression"
+	KeyExportWebhookMaxRetries    = "export-webhook-max-retries"
+	KeyExportWebhookRetryBackoff  = "export-webhook-retry-backoff"
+	KeyExportWebhookTimeout       = "export-webhook-timeout"
+
+	KeyExportGELFAddress     = "export-gelf-address"
+	KeyExportGELFCompression = "export-gelf-compression"
+	KeyExportGELFChunkSize   = "export-gelf-chunk-size"
+
+	KeyExportRedisAddress       = "export-redis-address"
+	KeyExportRedisStream        = "export-redis-stream"
+	KeyExportRedisMaxLen        = "export-redis-max-len"
+	KeyExportRedisUsername      = "export-redis-username"
+	KeyExportRedisPasswordFile  = "export-redis-password-file"
+	KeyExportRedisTLS           = "export-redis-tls"
+	KeyExportRedisTLSCAFile     = "export-redis-tls-ca-file"
+	KeyExportRedisBatchSize     = "export-redis-batch-size"
+	KeyExportRedisFlushInterval = "export-redis-flush-interval"
+	KeyExportRedisTimeout       = "export-redis-timeout"
+
+	KeyExportLokiURL           = "export-loki-url"
+	KeyExportLokiTenant        = "export-loki-tenant"
+	KeyExportLokiBatchSize     = "export-loki-batch-size"
+	KeyExportLokiFlushInterval = "export-loki-flush-interval"
+	KeyExportLokiMaxRetries    = "export-loki-max-retries"
+	KeyExportLokiRetryBackoff  = "export-loki-retry-backoff"
+	KeyExportLokiTimeout       = "export-loki-timeout"
+
+	KeyExportSyslogAddress       = "export-syslog-address"
+	KeyExportSyslogTransport     = "export-syslog-transport"
+	KeyExportSyslogTLSCAFile     = "export-syslog-tls-ca-file"
+	KeyExportSyslogTLSCertFile   = "export-syslog-tls-cert-file"
+	KeyExportSyslogTLSKeyFile    = "export-syslog-tls-key-file"
+	KeyExportSyslogFacility      = "export-syslog-facility"
+	KeyExportSyslogAppName       = "export-syslog-app-name"
+	KeyExportSyslogFlushInterval = "export-syslog-flush-interval"
+	KeyExportSyslogTimeout       = "export-syslog-timeout"
+
+	KeyExporters = "exporters"
+
+	KeyMinimalMode     = "minimal-mode"
+	KeyMinimalModeKeep = "minimal-mode-keep"
 
 	KeyEnableExportAggregation     = "enable-export-aggregation"
 	KeyExportAggregationWindowSize = "export-aggregation-window-size"
@@ -78,6 +166,8 @@ const (
 
 	KeyFieldFilters     = "field-filters"
 	KeyRedactionFilters = "redaction-filters"
+	KeyRedactionMode    = "redaction-mode"
+	KeyRedactionHashKey = "redaction-hash-key"
 
 	KeyNetnsDir = "netns-dir"
 
@@ -107,6 +197,7 @@ const (
 	KeyExposeStackAddresses = "expose-stack-addresses"
 
 	KeyGenerateDocs = "generate-docs"
+	KeyCheckConfig  = "check-config"
 
 	KeyCgroupRate = "cgroup-rate"
 
@@ -114,6 +205,7 @@ const (
 
 	KeyHealthServerAddress = "health-server-address"
 	KeyHealthTimeInterval  = "health-server-interval"
+	KeyHealthProbeAddress  = "health-probe-address"
 
 	KeyBpfDir = "bpf-dir"
 
@@ -135,6 +227,15 @@ const (
 	KeyExecveMapSize    = "execve-map-size"
 )
 
+// Values of --export-json-field-names and --export-json-timestamp-format.
+const (
+	JSONFieldNamesSnakeCase = "snake_case"
+	JSONFieldNamesCamelCase = "camelCase"
+
+	JSONTimestampRFC3339     = "rfc3339"
+	JSONTimestampEpochMillis = "epoch-millis"
+)
+
 type UsernameMetadaCode int
 
 const (
@@ -160,6 +261,8 @@ func ReadAndSetFlags() error {
 	Config.ForceLargeProgs = viper.GetBool(KeyForceLargeProgs)
 	Config.Debug = viper.GetBool(KeyDebug)
 	Config.ClusterName = viper.GetString(KeyClusterName)
+	Config.NodeName = viper.GetString(KeyNodeName)
+	Config.NodeLabels = viper.GetStringMapString(KeyNodeLabels)
 
 	Config.EnableProcessCred = viper.GetBool(KeyEnableProcessCred)
 	Config.EnableProcessNs = viper.GetBool(KeyEnableProcessNs)
@@ -210,20 +313,20 @@ func ReadAndSetFlags() error {
 	}
 
 	Config.MetricsServer = viper.GetString(KeyMetricsServer)
+	Config.ExporterMetricsServer = viper.GetString(KeyExporterMetricsServer)
+	Config.MetricsStatsd = viper.GetString(KeyMetricsStatsd)
+	Config.MetricsStatsdInterval = viper.GetDuration(KeyMetricsStatsdInterval)
 	Config.MetricsLabelFilter = DefaultLabelFilter().WithEnabledLabels(ParseMetricsLabelFilter(viper.GetString(KeyMetricsLabelFilter)))
 	Config.ServerAddress = viper.GetString(KeyServerAddress)
-
-	Config.ExportFilename = viper.GetString(KeyExportFilename)
-	Config.ExportFileMaxSizeMB = viper.GetInt(KeyExportFileMaxSizeMB)
-	Config.ExportFileRotationInterval = viper.GetDuration(KeyExportFileRotationInterval)
-	Config.ExportFileMaxBackups = viper.GetInt(KeyExportFileMaxBackups)
-	Config.ExportFileCompress = viper.GetBool(KeyExportFileCompress)
-	Config.ExportRateLimit = viper.GetInt(KeyExportRateLimit)
-	Config.ExportFilePerm = viper.GetString(KeyExportFilePerm)
-
-	Config.EnableExportAggregation = viper.GetBool(KeyEnableExportAggregation)
-	Config.ExportAggregationWindowSize = viper.GetDuration(KeyExportAggregationWindowSize)
-	Config.ExportAggregationBufferSize = viper.GetUint64(KeyExportAggregationBufferSize)
+	Config.ControlSocket = viper.GetString(KeyControlSocket)
+	Config.ServerTLSCertFile = viper.GetString(KeyServerTLSCertFile)
+	Config.ServerTLSKeyFile = viper.GetString(KeyServerTLSKeyFile)
+	Config.ServerTLSClientCAFile = viper.GetString(KeyServerTLSClientCAFile)
+	Config.ServerAuthTokenFile = viper.GetString(KeyServerAuthTokenFile)
+
+	if err := ReadExportFlags(); err != nil {
+		return err
+	}
 
 	Config.CpuProfile = viper.GetString(KeyCpuProfile)
 	Config.MemProfile = viper.GetString(KeyMemProfile)
@@ -240,6 +343,7 @@ func ReadAndSetFlags() error {
 	Config.EnablePidSetFilter = viper.GetBool(KeyEnablePidSetFilter)
 
 	Config.TracingPolicyDir = viper.GetString(KeyTracingPolicyDir)
+	Config.TracingPolicyDirWatch = viper.GetBool(KeyTracingPolicyDirWatch)
 
 	Config.EnablePodInfo = viper.GetBool(KeyEnablePodInfo)
 	Config.EnablePodAnnotations = viper.GetBool(KeyEnablePodAnnotations)
@@ -261,6 +365,7 @@ func ReadAndSetFlags() error {
 	Config.CgroupRate = ParseCgroupRate(viper.GetString(KeyCgroupRate))
 	Config.HealthServerAddress = viper.GetString(KeyHealthServerAddress)
 	Config.HealthServerInterval = viper.GetInt(KeyHealthTimeInterval)
+	Config.HealthProbeAddress = viper.GetString(KeyHealthProbeAddress)
 
 	Config.BpfDir = viper.GetString(KeyBpfDir)
 
@@ -285,9 +390,172 @@ func ReadAndSetFlags() error {
 
 	Config.ExecveMapEntries = viper.GetInt(KeyExecveMapEntries)
 	Config.ExecveMapSize = viper.GetString(KeyExecveMapSize)
+
+	Config.MinimalMode = viper.GetBool(KeyMinimalMode)
+	if Config.MinimalMode {
+		var keep []string
+		if err := viper.UnmarshalKey(KeyMinimalModeKeep, &keep, viper.DecodeHook(stringToSliceHookFunc(","))); err != nil {
+			return fmt.Errorf("failed to parse %s value: %w", KeyMinimalModeKeep, err)
+		}
+		disabled, err := applyMinimalMode(keep)
+		if err != nil {
+			return err
+		}
+		Config.MinimalModeDisabled = disabled
+	}
+	return nil
+}
+
+// exportMu guards the event export options of Config, which are replaced
+// while the agent runs when the export configuration is reloaded.
+var exportMu sync.RWMutex
+
+// RLockExportFlags locks the event export options of Config for reading, so
+// that a reload does not replace them while they are read, such as while
+// exporters are validated and created. RUnlockExportFlags releases it.
+func RLockExportFlags() {
+	exportMu.RLock()
+}
+
+// RUnlockExportFlags releases the lock taken by RLockExportFlags.
+func RUnlockExportFlags() {
+	exportMu.RUnlock()
+}
+
+// ReadExportFlags sets the event export options. It is called by
+// ReadAndSetFlags.
+func ReadExportFlags() error {
+	exportMu.Lock()
+	defer exportMu.Unlock()
+	return readExportFlags(viper.GetViper(), &Config)
+}
+
+// ReloadExportFlags replaces the event export options, read from prev, with
+// the ones of v if check succeeds, when the export configuration is
+// reloaded. v is parsed before Config is changed. check is called with the
+// options of v set and the readers of RLockExportFlags locked out, so that
+// the new options can be validated by the functions reading Config. If it
+// fails, the options of prev are set back before the readers see the new
+// ones.
+func ReloadExportFlags(v, prev *viper.Viper, check func() error) error {
+	var c config
+	if err := readExportFlags(v, &c); err != nil {
+		return err
+	}
+	exportMu.Lock()
+	defer exportMu.Unlock()
+	if err := readExportFlags(v, &Config); err != nil {
+		return err
+	}
+	if err := check(); err != nil {
+		if restoreErr := readExportFlags(prev, &Config); restoreErr != nil {
+			return errors.Join(err, fmt.Errorf("failed to restore the export options: %w", restoreErr))
+		}
+		return err
+	}
 	return nil
 }
 
+func readExportFlags(v *viper.Viper, c *config) error {
+	c.ExportFilename = v.GetString(KeyExportFilename)
+	c.ExportFileMaxSizeMB = v.GetInt(KeyExportFileMaxSizeMB)
+	c.ExportFileRotationInterval = v.GetDuration(KeyExportFileRotationInterval)
+	c.ExportFileMaxBackups = v.GetInt(KeyExportFileMaxBackups)
+	c.ExportFileCompress = v.GetBool(KeyExportFileCompress)
+	c.ExportRateLimit = v.GetInt(KeyExportRateLimit)
+	c.ExportRateLimitInterval = v.GetDuration(KeyExportRateLimitInterval)
+	c.ExportRateLimitBurst = v.GetInt(KeyExportRateLimitBurst)
+	c.ExportRateLimitAdaptive = v.GetBool(KeyExportRateLimitAdaptive)
+	c.ExportMaxBytesPerSecond = v.GetInt(KeyExportMaxBytesPerSecond)
+	c.ExportLimitSchedule = v.GetString(KeyExportLimitSchedule)
+	c.ExportQueueSize = v.GetInt(KeyExportQueueSize)
+	c.ExportShedExitEvents = v.GetBool(KeyExportShedExitEvents)
+	c.ExportLabels = v.GetStringMapString(KeyExportLabels)
+	if err := v.UnmarshalKey(KeyExportNodeMetadata, &c.ExportNodeMetadata, viper.DecodeHook(stringToSliceHookFunc(","))); err != nil {
+		return fmt.Errorf("failed to parse %s value: %w", KeyExportNodeMetadata, err)
+	}
+	c.ExportSchemaVersion = v.GetBool(KeyExportSchemaVersion)
+	c.ExportJSONFieldNames = v.GetString(KeyExportJSONFieldNames)
+	c.ExportJSONEmitUnpopulated = v.GetBool(KeyExportJSONEmitUnpopulated)
+	c.ExportJSONTimestampFormat = v.GetString(KeyExportJSONTimestampFormat)
+	c.ExportJSONFlatten = v.GetBool(KeyExportJSONFlatten)
+	c.ExportPriorities = v.GetStringMapString(KeyExportPriorities)
+	c.ExportRetentionWindow = v.GetDuration(KeyExportRetentionWindow)
+	c.ExportRetentionMaxEvents = v.GetInt(KeyExportRetentionMaxEvents)
+	c.ExportDeadLetterFile = v.GetString(KeyExportDeadLetterFile)
+	c.ExportDeadLetterMaxSizeMB = v.GetInt(KeyExportDeadLetterMaxSizeMB)
+	c.ExportSigningKey = v.GetString(KeyExportSigningKey)
+	c.ExportSigningKeyID = v.GetString(KeyExportSigningKeyID)
+	c.ExportSigningAlgorithm = v.GetString(KeyExportSigningAlgorithm)
+	if err := v.UnmarshalKey(KeyExportAllowEventTypes, &c.ExportAllowEventTypes, viper.DecodeHook(stringToSliceHookFunc(","))); err != nil {
+		return fmt.Errorf("failed to parse %s value: %w", KeyExportAllowEventTypes, err)
+	}
+	if err := v.UnmarshalKey(KeyExportDenyEventTypes, &c.ExportDenyEventTypes, viper.DecodeHook(stringToSliceHookFunc(","))); err != nil {
+		return fmt.Errorf("failed to parse %s value: %w", KeyExportDenyEventTypes, err)
+	}
+	if err := v.UnmarshalKey(KeyExportFields, &c.ExportFields, viper.DecodeHook(stringToSliceHookFunc(","))); err != nil {
+		return fmt.Errorf("failed to parse %s value: %w", KeyExportFields, err)
+	}
+	c.ExportFilePerm = v.GetString(KeyExportFilePerm)
+	c.ExportFileFormat = v.GetString(KeyExportFileFormat)
+
+	c.StdoutOutput = v.GetBool(KeyStdoutOutput)
+	c.StdoutOutputRateLimit = v.GetInt(KeyStdoutOutputRateLimit)
+
+	c.ExportWebhookURL = v.GetString(KeyExportWebhookURL)
+	c.ExportWebhookHeaders = v.GetStringMapString(KeyExportWebhookHeaders)
+	c.ExportWebhookBatchSize = v.GetInt(KeyExportWebhookBatchSize)
+	c.ExportWebhookFlushInterval = v.GetDuration(KeyExportWebhookFlushInterval)
+	c.ExportWebhookCompression = v.GetString(KeyExportWebhookCompression)
+	c.ExportWebhookMaxRetries = v.GetInt(KeyExportWebhookMaxRetries)
+	c.ExportWebhookRetryBackoff = v.GetDuration(KeyExportWebhookRetryBackoff)
+	c.ExportWebhookTimeout = v.GetDuration(KeyExportWebhookTimeout)
+
+	c.ExportGELFAddress = v.GetString(KeyExportGELFAddress)
+	c.ExportGELFCompression = v.GetString(KeyExportGELFCompression)
+	c.ExportGELFChunkSize = v.GetInt(KeyExportGELFChunkSize)
+
+	c.ExportRedisAddress = v.GetString(KeyExportRedisAddress)
+	c.ExportRedisStream = v.GetString(KeyExportRedisStream)
+	c.ExportRedisMaxLen = v.GetInt(KeyExportRedisMaxLen)
+	c.ExportRedisUsername = v.GetString(KeyExportRedisUsername)
+	c.ExportRedisPasswordFile = v.GetString(KeyExportRedisPasswordFile)
+	c.ExportRedisTLS = v.GetBool(KeyExportRedisTLS)
+	c.ExportRedisTLSCAFile = v.GetString(KeyExportRedisTLSCAFile)
+	c.ExportRedisBatchSize = v.GetInt(KeyExportRedisBatchSize)
+	c.ExportRedisFlushInterval = v.GetDuration(KeyExportRedisFlushInterval)
+	c.ExportRedisTimeout = v.GetDuration(KeyExportRedisTimeout)
+
+	c.ExportLokiURL = v.GetString(KeyExportLokiURL)
+	c.ExportLokiTenant = v.GetString(KeyExportLokiTenant)
+	c.ExportLokiBatchSize = v.GetInt(KeyExportLokiBatchSize)
+	c.ExportLokiFlushInterval = v.GetDuration(KeyExportLokiFlushInterval)
+	c.ExportLokiMaxRetries = v.GetInt(KeyExportLokiMaxRetries)
+	c.ExportLokiRetryBackoff = v.GetDuration(KeyExportLokiRetryBackoff)
+	c.ExportLokiTimeout = v.GetDuration(KeyExportLokiTimeout)
+
+	c.ExportSyslogAddress = v.GetString(KeyExportSyslogAddress)
+	c.ExportSyslogTransport = v.GetString(KeyExportSyslogTransport)
+	c.ExportSyslogTLSCAFile = v.GetString(KeyExportSyslogTLSCAFile)
+	c.ExportSyslogTLSCertFile = v.GetString(KeyExportSyslogTLSCertFile)
+	c.ExportSyslogTLSKeyFile = v.GetString(KeyExportSyslogTLSKeyFile)
+	c.ExportSyslogFacility = v.GetString(KeyExportSyslogFacility)
+	c.ExportSyslogAppName = v.GetString(KeyExportSyslogAppName)
+	c.ExportSyslogFlushInterval = v.GetDuration(KeyExportSyslogFlushInterval)
+	c.ExportSyslogTimeout = v.GetDuration(KeyExportSyslogTimeout)
+
+	c.EnableExportAggregation = v.GetBool(KeyEnableExportAggregation)
+	c.ExportAggregationWindowSize = v.GetDuration(KeyExportAggregationWindowSize)
+	c.ExportAggregationBufferSize = v.GetUint64(KeyExportAggregationBufferSize)
+
+	exporters, err := exportersFromConfig(v)
+	if err != nil {
+		return err
+	}
+	c.Exporters, err = mergeExporters(exportersFromFlags(c), exporters)
+	return err
+}
+
 type CgroupRate struct {
 	Events   uint64
 	Interval uint64
@@ -355,6 +623,8 @@ func AddFlags(flags *pflag.FlagSet) {
 	flags.String(KeyHubbleLib, defaults.DefaultTetragonLib, "Location of Tetragon libs (btf and bpf files)")
 	flags.String(KeyBTF, "", "Location of btf")
 	flags.String(KeyClusterName, "", "Name of the cluster where Tetragon is installed")
+	flags.String(KeyNodeName, "", "Name of the node set in every event, instead of the NODE_NAME or HUBBLE_NODE_NAME environment variables or the host name")
+	flags.StringToString(KeyNodeLabels, map[string]string{}, "Labels of the node set in every event (e.g. 'topology.kubernetes.io/zone=eu-west-1a'). They take precedence over the labels read from the Kubernetes API, which is not needed for them, as in minimal mode")
 
 	flags.String(KeyProcFS, "/proc/", "Location of procfs to consume existing PIDs")
 	flags.String(KeyKernelVersion, "", "Kernel version")
@@ -370,15 +640,103 @@ func AddFlags(flags *pflag.FlagSet) {
 	flags.Int(KeyExportFileMaxBackups, 5, "Number of rotated JSON export files to retain")
 	flags.Bool(KeyExportFileCompress, false, "Compress rotated JSON export files")
 	flags.String(KeyExportFilePerm, defaults.DefaultLogsPermission, "Access permissions on JSON export files")
-	flags.Int(KeyExportRateLimit, -1, "Rate limit (per minute) for event export. Set to -1 to disable")
+	flags.String(KeyExportFileFormat, "json", "Format of export files: 'json' (one JSON event per line), 'cbor' (a sequence of CBOR events, smaller and faster to parse), 'protobuf' (size-delimited protobuf messages), 'compact' (human-readable) or any other registered format")
+	flags.Int(KeyExportRateLimit, -1, "Rate limit (per interval, see --export-rate-limit-interval) for event export. Set to -1 to disable")
+	flags.Duration(KeyExportRateLimitInterval, time.Minute, "Interval over which --export-rate-limit is applied")
+	flags.Int(KeyExportRateLimitBurst, 0, "Number of events that can be exported at once before --export-rate-limit applies, the limit itself being the sustained rate. 0 uses --export-rate-limit, which lets a whole interval worth of events through at once")
+	flags.Bool(KeyExportRateLimitAdaptive, false, "Lower the export rate limit while an exporter cannot keep up (its queue is filling up or writes fail), and raise it back to --export-rate-limit once healthy")
+	flags.Int(KeyExportMaxBytesPerSecond, 0, "Maximum number of bytes per second sent by all network exporters together (webhook, loki, redis, syslog and gelf), e.g. 1250000 for 10 Mbit/s. Batches are delayed rather than split. 0 disables the limit")
+	flags.String(KeyExportLimitSchedule, "", "Time windows, separated by ';', overriding --export-rate-limit and --export-max-bytes-per-second, in local time (e.g. 'Mon-Fri 08:00-18:00 rate-limit=100 max-bytes-per-second=125000; 22:00-06:00 rate-limit=-1')")
+	flags.StringToString(KeyExportLabels, map[string]string{}, "Static labels added to every exported JSON event under \"labels\" (e.g. 'env=prod,region=eu-west-1')")
+	flags.StringSlice(KeyExportNodeMetadata, []string{}, "Node metadata added to the labels of every exported event: any of 'node_name', 'hostname', 'agent_version' and 'boot_id'")
+	flags.Bool(KeyExportSchemaVersion, false, "Add the version of the schema of exported events as \"schema_version\" to every exported JSON event")
+	flags.String(KeyExportJSONFieldNames, JSONFieldNamesSnakeCase, "Names of the fields of exported JSON events: 'snake_case' (e.g. start_time) or 'camelCase' (e.g. startTime)")
+	flags.Bool(KeyExportJSONEmitUnpopulated, false, "Include the fields that are not set, with their zero value, in exported JSON events")
+	flags.String(KeyExportJSONTimestampFormat, JSONTimestampRFC3339, "Format of the timestamps of exported JSON events: 'rfc3339' (e.g. \"2024-01-01T00:00:00.123456789Z\") or 'epoch-millis' (milliseconds since the epoch, as a number)")
+	flags.Bool(KeyExportJSONFlatten, false, "Flatten exported JSON events into a single-level object, with the fields of nested objects named by their path (e.g. process.pod.namespace)")
+	flags.StringSlice(KeyExportAllowEventTypes, []string{}, "Only export events of these types (e.g. 'PROCESS_EXEC,PROCESS_KPROBE'), in addition to --export-allowlist")
+	flags.StringSlice(KeyExportDenyEventTypes, []string{}, "Do not export events of these types (e.g. 'PROCESS_EXIT'), in addition to --export-denylist")
+	flags.StringToString(KeyExportPriorities, map[string]string{}, "Priority of exported events, by event type or by tracing policy with a 'policy:' prefix (e.g. 'PROCESS_EXIT=low,policy:file-monitoring=high'). Under rate limiting or with a full queue, low priority events are dropped first and high priority events are not rate limited")
+	flags.Duration(KeyExportRetentionWindow, 0, "Keep the events exported in this window in memory, and export them again when the agent receives SIGUSR2 (e.g. after a collector outage). Disabled by default")
+	flags.Int(KeyExportRetentionMaxEvents, 100000, "Maximum number of events kept by each exporter for --export-retention-window")
+	flags.String(KeyExportDeadLetterFile, "", "File the events that webhook, Loki, Redis and syslog exporters failed to send after all retries, or dropped, are written to, with the error. Disabled by default")
+	flags.Int(KeyExportDeadLetterMaxSizeMB, 100, "Size in MB of --export-dead-letter-file above which further events are dropped")
+	flags.String(KeyExportSigningKey, "", "Path of a key used to sign every exported JSON event, adding a \"signature\" field. Signatures can be checked with 'tetra verify'. Disabled by default")
+	flags.String(KeyExportSigningKeyID, "", "Key ID added to the signature of exported events, to tell keys apart when they are rotated")
+	flags.String(KeyExportSigningAlgorithm, "ed25519", "Algorithm used to sign exported events: 'ed25519' (the key is a PEM encoded PKCS #8 private key) or 'hmac-sha256' (the key is the secret)")
+	flags.StringSlice(KeyExportFields, []string{}, "Only export these fields of events (e.g. 'process.binary,process.arguments,process.pid,process.pod'), in addition to --field-filters. Paths are relative to the event, the time and node name are always exported")
+	flags.Int(KeyExportQueueSize, 0, "Number of events buffered per exporter so that a slow export destination does not stall event processing. Events are dropped when the queue is full. Set to 0 to encode events synchronously")
+	flags.Bool(KeyExportShedExitEvents, false, "Stop sending process_exit events to an exporter, and aggregate its process_exec events over --export-aggregation-window-size, while its queue (see --export-queue-size) is under pressure, from three quarters full until drained to a quarter, so that it keeps up with other events")
+	flags.Bool(KeyStdoutOutput, false, "Mirror exported events to stdout in compact format, in addition to any other export destination")
+	flags.Int(KeyStdoutOutputRateLimit, 60, "Rate limit (per minute) for events mirrored to stdout. Set to -1 to mirror all events")
+
+	// HTTP webhook export options
+	flags.String(KeyExportWebhookURL, "", "URL to POST batches of JSON events to (e.g. 'https://collector:8443/events'). Disabled by default")
+	flags.StringToString(KeyExportWebhookHeaders, map[string]string{}, "HTTP headers added to webhook export requests (e.g. 'Authorization=Bearer xyz')")
+	flags.Int(KeyExportWebhookBatchSize, 100, "Maximum number of events in a single webhook export request")
+	flags.Duration(KeyExportWebhookFlushInterval, 5*time.Second, "Maximum time events are buffered before being sent to the webhook")
+	flags.String(KeyExportWebhookCompression, "none", "Compression of webhook export requests ('none' or 'gzip')")
+	flags.Int(KeyExportWebhookMaxRetries, 3, "Number of times a failed webhook export request is retried")
+	flags.Duration(KeyExportWebhookRetryBackoff, 1*time.Second, "Delay before retrying a failed webhook export request, doubled on every retry")
+	flags.Duration(KeyExportWebhookTimeout, 10*time.Second, "Timeout of a single webhook export request")
+
+	// GELF export options
+	flags.String(KeyExportGELFAddress, "", "Address of a Graylog GELF UDP input to send events to (e.g. 'graylog:12201'). Disabled by default")
+	flags.String(KeyExportGELFCompression, "zlib", "Compression of GELF messages ('zlib', 'gzip' or 'none')")
+	flags.Int(KeyExportGELFChunkSize, 1420, "Maximum size of a GELF datagram. Larger messages are split into GELF chunks")
+
+	// Redis export options
+	flags.String(KeyExportRedisAddress, "", "Address of a Redis server to add events to a stream of (e.g. 'redis:6379'). Disabled by default")
+	flags.String(KeyExportRedisStream, "tetragon", "Key of the Redis stream events are added to")
+	flags.Int(KeyExportRedisMaxLen, 0, "Trim the Redis stream to about this number of events. 0 disables trimming")
+	flags.String(KeyExportRedisUsername, "", "User to authenticate to Redis as, the default user if empty")
+	flags.String(KeyExportRedisPasswordFile, "", "File holding the password to authenticate to Redis with. Authentication is disabled if empty")
+	flags.Bool(KeyExportRedisTLS, false, "Connect to Redis with TLS")
+	flags.String(KeyExportRedisTLSCAFile, "", "CA certificates to verify the Redis server with, instead of the system ones")
+	flags.Int(KeyExportRedisBatchSize, 100, "Maximum number of events sent to Redis at once")
+	flags.Duration(KeyExportRedisFlushInterval, 1*time.Second, "Maximum time events are buffered before being sent to Redis")
+	flags.Duration(KeyExportRedisTimeout, 10*time.Second, "Timeout of connecting to Redis and of sending a batch of events")
+
+	// Loki export options
+	flags.String(KeyExportLokiURL, "", "Loki push API URL to send events to (e.g. 'http://loki:3100/loki/api/v1/push'). Disabled by default")
+	flags.String(KeyExportLokiTenant, "", "Tenant of the events pushed to Loki, sent in the X-Scope-OrgID header")
+	flags.Int(KeyExportLokiBatchSize, 1000, "Maximum number of events in a single Loki push request")
+	flags.Duration(KeyExportLokiFlushInterval, 5*time.Second, "Maximum time events are buffered before being pushed to Loki")
+	flags.Int(KeyExportLokiMaxRetries, 3, "Number of times a failed Loki push request is retried")
+	flags.Duration(KeyExportLokiRetryBackoff, 1*time.Second, "Delay before retrying a failed Loki push request, doubled on every retry")
+	flags.Duration(KeyExportLokiTimeout, 10*time.Second, "Timeout of a single Loki push request")
+
+	// Syslog export options
+	flags.String(KeyExportSyslogAddress, "", "Address of a syslog collector to send events to (e.g. 'syslog:6514'). Disabled by default")
+	flags.String(KeyExportSyslogTransport, "tls", "Transport of syslog messages ('tls' as in RFC 5425, or 'tcp')")
+	flags.String(KeyExportSyslogTLSCAFile, "", "CA certificates to verify the syslog collector with, instead of the system ones")
+	flags.String(KeyExportSyslogTLSCertFile, "", "Client certificate presented to the syslog collector")
+	flags.String(KeyExportSyslogTLSKeyFile, "", "Key of the client certificate presented to the syslog collector")
+	flags.String(KeyExportSyslogFacility, "local0", "Syslog facility of messages (e.g. 'local0' or 'auth')")
+	flags.String(KeyExportSyslogAppName, "tetragon", "APP-NAME of syslog messages")
+	flags.Duration(KeyExportSyslogFlushInterval, 1*time.Second, "Maximum time syslog messages are buffered before being sent")
+	flags.Duration(KeyExportSyslogTimeout, 10*time.Second, "Timeout of connecting to the syslog collector and of sending messages")
+
+	flags.Bool(KeyMinimalMode, false, "Only observe and export events: disable the health, gops, metrics and pprof servers, the Kubernetes API, CRI and policy filtering")
+	flags.StringSlice(KeyMinimalModeKeep, []string{}, "Comma-separated list of settings that --minimal-mode keeps. Supported settings are: "+strings.Join(minimalModeKeys(), ", ")+". For instance, 'enable-policy-filter' keeps the cgroup based filtering of policies loaded from files, which does not need the Kubernetes API")
+
+	flags.String(KeyExporters, "", "YAML list of additional exporters, each with a type, an optional name, allowList, denyList, fieldFilters, fields, rateLimit, rateLimitInterval, rateLimitBurst, rateLimitAdaptive, queueSize, templates and stages, and type-specific options")
 	flags.String(KeyLogLevel, "info", "Set log level")
 	flags.String(KeyLogFormat, "text", "Set log format")
 	flags.Bool(KeyEnableK8sAPI, false, "Access Kubernetes API to associate Tetragon events with Kubernetes pods")
 	flags.String(KeyK8sKubeConfigPath, "", "Absolute path of the kubernetes kubeconfig file")
 	flags.Int(KeyK8sControlPlaneRetry, 1, "Number of attempts for Kubernetes control plane connection (negative for infinite, zero is invalid, positive for max attempts)")
 	flags.String(KeyMetricsServer, "", "Metrics server address (e.g. ':2112'). Disabled by default")
+	flags.String(KeyExporterMetricsServer, "", "Address of a metrics server exposing only the event exporter metrics (e.g. 'localhost:2113'). It is not turned off by --minimal-mode. Disabled by default")
+	flags.String(KeyMetricsStatsd, "", "Address of a statsd endpoint (e.g. 'localhost:8125') the exporter and process metrics are pushed to over UDP, with labels as DogStatsD tags. It is not turned off by --minimal-mode. Disabled by default")
+	flags.Duration(KeyMetricsStatsdInterval, 10*time.Second, "Interval between two pushes of metrics to --metrics-statsd-address")
 	flags.String(KeyMetricsLabelFilter, "namespace,workload,pod,binary", "Comma-separated list of enabled metrics labels. Unknown labels will be ignored.")
 	flags.String(KeyServerAddress, "localhost:54321", "gRPC server address (e.g. 'localhost:54321' or 'unix:///var/run/tetragon/tetragon.sock'). An empty address disables the gRPC server")
+	flags.String(KeyControlSocket, "", "Path of a unix socket to change the log level, reload exporters and inspect the agent at runtime, also in minimal mode (e.g. '/var/run/tetragon/control.sock'). Disabled by default")
+	flags.String(KeyServerTLSCertFile, "", "Path of the PEM encoded TLS certificate of the gRPC server. If set with the key, the server only accepts TLS connections. Reloaded when changed")
+	flags.String(KeyServerTLSKeyFile, "", "Path of the PEM encoded TLS key of the gRPC server. Reloaded when changed")
+	flags.String(KeyServerTLSClientCAFile, "", "Path of the PEM encoded CA certificates of the gRPC clients. If set, clients must present a certificate signed by one of them (mutual TLS). Reloaded when changed")
+	flags.String(KeyServerAuthTokenFile, "", "Path of a file holding a static token that gRPC clients must send as 'authorization: Bearer <token>'. Requires --server-tls-cert-file unless the server listens on a unix socket. Reloaded when changed")
 	flags.String(KeyGopsAddr, "", "gops server address (e.g. 'localhost:8118'). Disabled by default")
 	flags.Bool(KeyEnableProcessCred, false, "Enable process_cred events")
 	flags.Bool(KeyEnableProcessNs, false, "Enable namespace information in process_exec and process_kprobe events")
@@ -390,6 +748,7 @@ func AddFlags(flags *pflag.FlagSet) {
 	flags.String(KeyTracingPolicy, "", "Tracing policy file to load at startup")
 
 	flags.String(KeyTracingPolicyDir, defaults.DefaultTpDir, "Directory from where to load Tracing Policies")
+	flags.Bool(KeyTracingPolicyDirWatch, false, "Watch the Tracing Policies directory, and add, replace or delete policies when their files are created, changed or removed. Hidden subdirectories are ignored")
 
 	// Options for debugging/development, not visible to users
 	flags.String(KeyCpuProfile, "", "Store CPU profile into provided file")
@@ -401,7 +760,7 @@ func AddFlags(flags *pflag.FlagSet) {
 	flags.String(KeyPprofAddr, "", "Serves runtime profile data via HTTP (e.g. 'localhost:6060'). Disabled by default")
 
 	// JSON export aggregation options.
-	flags.Bool(KeyEnableExportAggregation, false, "Enable JSON export aggregation")
+	flags.Bool(KeyEnableExportAggregation, false, "Enable JSON export aggregation. Identical process exec and exit events (same binary, arguments and pod) are sent once per window, with a count in aggregation_info")
 	flags.Duration(KeyExportAggregationWindowSize, 15*time.Second, "JSON export aggregation time window")
 	flags.Uint64(KeyExportAggregationBufferSize, 10000, "Aggregator channel buffer size")
 
@@ -414,6 +773,8 @@ func AddFlags(flags *pflag.FlagSet) {
 
 	// Redaction filters
 	flags.String(KeyRedactionFilters, "", "Redaction filters for events")
+	flags.String(KeyRedactionMode, "mask", "How redaction filters replace matched strings: 'mask' or 'hash' (truncated SHA-256, to correlate events without exposing values)")
+	flags.String(KeyRedactionHashKey, "", "HMAC key used by --redaction-mode=hash. Without a key, short secrets can be recovered by brute force")
 
 	// Network namespace options
 	flags.String(KeyNetnsDir, "/var/run/docker/netns/", "Network namespace dir")
@@ -451,6 +812,7 @@ func AddFlags(flags *pflag.FlagSet) {
 	flags.Bool(KeyExposeStackAddresses, false, "Expose real linear addresses in events stack traces")
 
 	flags.Bool(KeyGenerateDocs, false, "Generate documentation in YAML format to stdout")
+	flags.Bool(KeyCheckConfig, false, "Check the configuration, filters and TLS material, resolve the export destinations, print a report and exit without loading BPF programs")
 
 	flags.String(KeyUsernameMetadata, "disabled", "Resolve UIDs to user names for processes running in host namespace")
 
@@ -458,6 +820,7 @@ func AddFlags(flags *pflag.FlagSet) {
 
 	flags.String(KeyHealthServerAddress, ":6789", "Health server address (e.g. ':6789')(use '' to disabled it)")
 	flags.Int(KeyHealthTimeInterval, 10, "Health server interval in seconds")
+	flags.String(KeyHealthProbeAddress, "", "UDP address answering \"ping\" datagrams with the agent status as JSON (e.g. '127.0.0.1:6790'). It is not turned off by --minimal-mode. Disabled by default")
 
 	flags.String(KeyBpfDir, defaults.DefaultMapPrefix, "Set tetragon bpf directory (default 'tetragon')")
 
@@ -0,0 +1,90 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package option
+
+import (
+	"fmt"
+	"slices"
+)
+
+type minimalModeSetting struct {
+	key     string
+	enabled func() bool
+	disable func()
+}
+
+// minimalModeSettings are the services and features turned off by
+// --minimal-mode, so that the agent only observes and exports events.
+var minimalModeSettings = []minimalModeSetting{
+	{
+		key:     KeyHealthServerAddress,
+		enabled: func() bool { return Config.HealthServerAddress != "" },
+		disable: func() { Config.HealthServerAddress = "" },
+	},
+	{
+		key:     KeyGopsAddr,
+		enabled: func() bool { return Config.GopsAddr != "" },
+		disable: func() { Config.GopsAddr = "" },
+	},
+	{
+		key:     KeyMetricsServer,
+		enabled: func() bool { return Config.MetricsServer != "" },
+		disable: func() { Config.MetricsServer = "" },
+	},
+	{
+		key:     KeyPprofAddr,
+		enabled: func() bool { return Config.PprofAddr != "" },
+		disable: func() { Config.PprofAddr = "" },
+	},
+	{
+		key:     KeyEnableK8sAPI,
+		enabled: K8SControlPlaneEnabled,
+		disable: func() {
+			Config.EnableK8s = false
+			Config.K8sKubeConfigPath = ""
+		},
+	},
+	{
+		key:     KeyEnableCRI,
+		enabled: func() bool { return Config.EnableCRI },
+		disable: func() { Config.EnableCRI = false },
+	},
+	{
+		key:     KeyEnablePolicyFilter,
+		enabled: func() bool { return Config.EnablePolicyFilter || Config.EnablePolicyFilterCgroupMap },
+		disable: func() {
+			Config.EnablePolicyFilter = false
+			Config.EnablePolicyFilterCgroupMap = false
+		},
+	},
+}
+
+// minimalModeKeys returns the keys of the settings turned off by minimal
+// mode.
+func minimalModeKeys() []string {
+	keys := make([]string, 0, len(minimalModeSettings))
+	for _, s := range minimalModeSettings {
+		keys = append(keys, s.key)
+	}
+	return keys
+}
+
+// applyMinimalMode turns off the settings that are not needed in minimal
+// mode, except the ones in keep, and returns the keys of the ones that were
+// enabled.
+func applyMinimalMode(keep []string) ([]string, error) {
+	for _, k := range keep {
+		if !slices.Contains(minimalModeKeys(), k) {
+			return nil, fmt.Errorf("unknown setting %q in %s, supported settings are %v", k, KeyMinimalModeKeep, minimalModeKeys())
+		}
+	}
+	var disabled []string
+	for _, s := range minimalModeSettings {
+		if s.enabled() && !slices.Contains(keep, s.key) {
+			s.disable()
+			disabled = append(disabled, s.key)
+		}
+	}
+	return disabled, nil
+}
@@ -0,0 +1,55 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package option
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyMinimalMode(t *testing.T) {
+	saved := Config
+	defer func() { Config = saved }()
+
+	Config.HealthServerAddress = ":6789"
+	Config.MetricsServer = ":2112"
+	Config.GopsAddr = ""
+	Config.PprofAddr = ""
+	Config.EnableK8s = true
+	Config.EnableCRI = false
+	Config.EnablePolicyFilter = true
+
+	disabled, err := applyMinimalMode(nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{KeyHealthServerAddress, KeyMetricsServer, KeyEnableK8sAPI, KeyEnablePolicyFilter}, disabled)
+	assert.Empty(t, Config.HealthServerAddress)
+	assert.Empty(t, Config.MetricsServer)
+	assert.False(t, Config.EnableK8s)
+	assert.False(t, Config.EnablePolicyFilter)
+
+	disabled, err = applyMinimalMode(nil)
+	require.NoError(t, err)
+	assert.Empty(t, disabled)
+}
+
+func TestApplyMinimalModeKeep(t *testing.T) {
+	saved := Config
+	defer func() { Config = saved }()
+
+	Config.EnableK8s = true
+	Config.EnablePolicyFilter = true
+	Config.EnablePolicyFilterCgroupMap = true
+
+	disabled, err := applyMinimalMode([]string{KeyEnablePolicyFilter})
+	require.NoError(t, err)
+	assert.Equal(t, []string{KeyEnableK8sAPI}, disabled)
+	assert.False(t, Config.EnableK8s)
+	assert.True(t, Config.EnablePolicyFilter)
+	assert.True(t, Config.EnablePolicyFilterCgroupMap)
+
+	_, err = applyMinimalMode([]string{"unknown"})
+	require.Error(t, err)
+}
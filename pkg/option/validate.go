@@ -0,0 +1,58 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package option
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+)
+
+// Validate checks the configuration for settings that are invalid or that
+// cannot be used together. It does not check settings that need other
+// packages to be parsed, such as export filters.
+func Validate() error {
+	var errs []error
+	if !filepath.IsAbs(Config.TracingPolicyDir) {
+		errs = append(errs, fmt.Errorf("path specified by --%s '%q' is not absolute", KeyTracingPolicyDir, Config.TracingPolicyDir))
+	}
+	if Config.RBSize != 0 && Config.RBSizeTotal != 0 {
+		errs = append(errs, fmt.Errorf("can't specify --%s and --%s together", KeyRBSize, KeyRBSizeTotal))
+	}
+	if Config.ExecveMapEntries != 0 && len(Config.ExecveMapSize) != 0 {
+		errs = append(errs, fmt.Errorf("can't specify --%s and --%s together", KeyExecveMapEntries, KeyExecveMapSize))
+	}
+	if Config.ForceLargeProgs && Config.ForceSmallProgs {
+		errs = append(errs, fmt.Errorf("can't specify --%s and --%s together", KeyForceSmallProgs, KeyForceLargeProgs))
+	}
+	if Config.ExportFileRotationInterval < 0 {
+		errs = append(errs, fmt.Errorf("--%s must not be negative", KeyExportFileRotationInterval))
+	}
+	if Config.ExportMaxBytesPerSecond < 0 {
+		errs = append(errs, fmt.Errorf("--%s must not be negative", KeyExportMaxBytesPerSecond))
+	}
+	if Config.ExportRateLimitBurst < 0 {
+		errs = append(errs, fmt.Errorf("--%s must not be negative", KeyExportRateLimitBurst))
+	}
+	if Config.ExportRetentionWindow > 0 && Config.ExportRetentionMaxEvents <= 0 {
+		errs = append(errs, fmt.Errorf("--%s must be positive when --%s is set", KeyExportRetentionMaxEvents, KeyExportRetentionWindow))
+	}
+	if Config.ExportDeadLetterFile != "" && Config.ExportDeadLetterMaxSizeMB <= 0 {
+		errs = append(errs, fmt.Errorf("--%s must be positive when --%s is set", KeyExportDeadLetterMaxSizeMB, KeyExportDeadLetterFile))
+	}
+	switch Config.ExportJSONFieldNames {
+	case "", JSONFieldNamesSnakeCase, JSONFieldNamesCamelCase:
+	default:
+		errs = append(errs, fmt.Errorf("--%s must be %q or %q", KeyExportJSONFieldNames, JSONFieldNamesSnakeCase, JSONFieldNamesCamelCase))
+	}
+	switch Config.ExportJSONTimestampFormat {
+	case "", JSONTimestampRFC3339, JSONTimestampEpochMillis:
+	default:
+		errs = append(errs, fmt.Errorf("--%s must be %q or %q", KeyExportJSONTimestampFormat, JSONTimestampRFC3339, JSONTimestampEpochMillis))
+	}
+	if Config.ExportQueueSize < 0 {
+		errs = append(errs, fmt.Errorf("--%s must not be negative", KeyExportQueueSize))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,27 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package option
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	saved := Config
+	defer func() { Config = saved }()
+
+	Config.TracingPolicyDir = "/etc/tetragon/tetragon.tp.d"
+	require.NoError(t, Validate())
+
+	Config.TracingPolicyDir = "tetragon.tp.d"
+	Config.RBSize = 4096
+	Config.RBSizeTotal = 8192
+	err := Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), KeyTracingPolicyDir)
+	assert.Contains(t, err.Error(), KeyRBSizeTotal)
+}
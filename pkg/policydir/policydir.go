@@ -0,0 +1,250 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+// Package policydir keeps the tracing policies loaded from a directory in
+// sync with its files: policies are added, replaced and deleted when their
+// files are created, changed and removed. It allows updating policies
+// without the TracingPolicy CRD, as in minimal mode.
+package policydir
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/cilium/tetragon/pkg/logger"
+	"github.com/cilium/tetragon/pkg/logger/logfields"
+	"github.com/cilium/tetragon/pkg/tracingpolicy"
+)
+
+// maxDepth is the number of directory levels under the policy directory
+// that policies are loaded from, as at startup.
+const maxDepth = 1
+
+// debounce is the time to wait after a change before syncing, so that the
+// several events of a file write result in a single reload.
+const debounce = 500 * time.Millisecond
+
+// Manager adds and deletes tracing policies, such as the sensor manager.
+type Manager interface {
+	AddTracingPolicy(ctx context.Context, tp tracingpolicy.TracingPolicy) error
+	DeleteTracingPolicy(ctx context.Context, name string, namespace string) error
+}
+
+// policy is the policy loaded from a file.
+type policy struct {
+	sum       [sha256.Size]byte
+	name      string
+	namespace string
+	// loaded is false if the policy could not be added, in which case it is
+	// retried only once its file changes.
+	loaded bool
+}
+
+// Watcher syncs the policies of a directory with a Manager.
+type Watcher struct {
+	dir string
+	mgr Manager
+
+	mu       sync.Mutex
+	policies map[string]*policy
+}
+
+func New(dir string, mgr Manager) *Watcher {
+	return &Watcher{
+		dir:      dir,
+		mgr:      mgr,
+		policies: make(map[string]*policy),
+	}
+}
+
+// skipDir returns whether policies are not loaded from the directory at
+// path, relative to the policy directory: if it is more than maxDepth levels
+// deep, or hidden, like the timestamped directories of Kubernetes config
+// maps, whose files are also linked from the top directory.
+func skipDir(path string) bool {
+	if path == "." {
+		return false
+	}
+	return strings.Count(path, string(os.PathSeparator)) >= maxDepth || strings.HasPrefix(filepath.Base(path), ".")
+}
+
+// files returns the regular files of the directory, up to maxDepth levels
+// deep.
+func (w *Watcher) files() ([]string, error) {
+	var files []string
+	err := fs.WalkDir(os.DirFS(w.dir), ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if skipDir(path) {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		file := filepath.Join(w.dir, path)
+		// Follow symlinks, as used by Kubernetes config maps.
+		if st, err := os.Stat(file); err == nil && st.Mode().IsRegular() {
+			files = append(files, file)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// Sync adds the policies of new files, replaces the policies of changed
+// files and deletes the policies of removed files. It returns the errors of
+// the files that could not be loaded.
+func (w *Watcher) Sync(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	files, err := w.files()
+	if err != nil {
+		return fmt.Errorf("failed to list tracing policies dir %s: %w", w.dir, err)
+	}
+
+	var errs error
+	for file, p := range w.policies {
+		if !slices.Contains(files, file) {
+			w.unload(ctx, file, p)
+			delete(w.policies, file)
+		}
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			errs = errors.Join(errs, err)
+			continue
+		}
+		sum := sha256.Sum256(data)
+		old := w.policies[file]
+		if old != nil && old.sum == sum {
+			continue
+		}
+		tp, err := tracingpolicy.FromYAML(string(data))
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("failed to parse tracing policy %s: %w", file, err))
+			// Keep the policy of the previous version of the file.
+			if old == nil {
+				old = &policy{}
+				w.policies[file] = old
+			}
+			old.sum = sum
+			continue
+		}
+		if old != nil {
+			w.unload(ctx, file, old)
+		}
+		p, err := w.add(ctx, file, tp)
+		p.sum = sum
+		w.policies[file] = p
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("failed to add tracing policy %s: %w", file, err))
+		}
+	}
+	return errs
+}
+
+func (w *Watcher) add(ctx context.Context, file string, tp tracingpolicy.TracingPolicy) (*policy, error) {
+	p := &policy{name: tp.TpName()}
+	if tpNs, ok := tp.(tracingpolicy.TracingPolicyNamespaced); ok {
+		p.namespace = tpNs.TpNamespace()
+	}
+	if err := w.mgr.AddTracingPolicy(ctx, tp); err != nil {
+		return p, err
+	}
+	p.loaded = true
+	logger.GetLogger().Info("Added TracingPolicy with success",
+		"TracingPolicy", file,
+		"metadata.namespace", p.namespace,
+		"metadata.name", p.name)
+	return p, nil
+}
+
+func (w *Watcher) unload(ctx context.Context, file string, p *policy) {
+	if !p.loaded {
+		return
+	}
+	if err := w.mgr.DeleteTracingPolicy(ctx, p.name, p.namespace); err != nil {
+		logger.GetLogger().Warn("Failed to delete TracingPolicy", "TracingPolicy", file, "metadata.name", p.name, logfields.Error, err)
+		return
+	}
+	logger.GetLogger().Info("Deleted TracingPolicy", "TracingPolicy", file, "metadata.namespace", p.namespace, "metadata.name", p.name)
+}
+
+// Run syncs the policies once, and then whenever the directory or its
+// subdirectories change, until ctx is done.
+func (w *Watcher) Run(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+	if err := w.watchDirs(watcher); err != nil {
+		return err
+	}
+
+	log := logger.GetLogger()
+	// Sync the changes made before the directory was watched.
+	timer := time.NewTimer(0)
+	for {
+		select {
+		case ev, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if ev.Op != fsnotify.Chmod {
+				timer.Reset(debounce)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			log.Warn("Failed to watch tracing policies dir", "tracing-policy-dir", w.dir, logfields.Error, err)
+		case <-timer.C:
+			// Subdirectories may have been added.
+			if err := w.watchDirs(watcher); err != nil {
+				log.Warn("Failed to watch tracing policies dir", "tracing-policy-dir", w.dir, logfields.Error, err)
+			}
+			if err := w.Sync(ctx); err != nil {
+				log.Warn("Failed to sync tracing policies dir", "tracing-policy-dir", w.dir, logfields.Error, err)
+			}
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		}
+	}
+}
+
+// watchDirs adds the directory and its subdirectories, up to maxDepth, to
+// watcher.
+func (w *Watcher) watchDirs(watcher *fsnotify.Watcher) error {
+	return fs.WalkDir(os.DirFS(w.dir), ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if skipDir(path) {
+			return fs.SkipDir
+		}
+		dir := filepath.Join(w.dir, path)
+		if slices.Contains(watcher.WatchList(), dir) {
+			return nil
+		}
+		return watcher.Add(dir)
+	})
+}
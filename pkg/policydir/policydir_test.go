@@ -0,0 +1,124 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package policydir
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cilium/tetragon/pkg/tracingpolicy"
+)
+
+type fakeManager struct {
+	mu       sync.Mutex
+	policies []string
+}
+
+func (m *fakeManager) AddTracingPolicy(_ context.Context, tp tracingpolicy.TracingPolicy) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if slices.Contains(m.policies, tp.TpName()) {
+		return fmt.Errorf("policy %s already exists", tp.TpName())
+	}
+	m.policies = append(m.policies, tp.TpName())
+	return nil
+}
+
+func (m *fakeManager) DeleteTracingPolicy(_ context.Context, name string, _ string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := slices.Index(m.policies, name)
+	if i < 0 {
+		return fmt.Errorf("policy %s not found", name)
+	}
+	m.policies = slices.Delete(m.policies, i, i+1)
+	return nil
+}
+
+func (m *fakeManager) names() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Sorted(slices.Values(m.policies))
+}
+
+func writePolicy(t *testing.T, file, name string) {
+	require.NoError(t, os.WriteFile(file, []byte(`apiVersion: cilium.io/v1alpha1
+kind: TracingPolicy
+metadata:
+  name: `+name+`
+spec: {}
+`), 0644))
+}
+
+func TestWatcher_Sync(t *testing.T) {
+	dir := t.TempDir()
+	mgr := &fakeManager{}
+	w := New(dir, mgr)
+	ctx := context.Background()
+
+	writePolicy(t, filepath.Join(dir, "a.yaml"), "a")
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0755))
+	writePolicy(t, filepath.Join(dir, "sub", "b.yaml"), "b")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "sub", "deeper"), 0755))
+	writePolicy(t, filepath.Join(dir, "sub", "deeper", "c.yaml"), "c")
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "..data"), 0755))
+	writePolicy(t, filepath.Join(dir, "..data", "d.yaml"), "d")
+	require.NoError(t, w.Sync(ctx))
+	assert.Equal(t, []string{"a", "b"}, mgr.names())
+
+	// Unchanged files are not loaded again.
+	require.NoError(t, w.Sync(ctx))
+	assert.Equal(t, []string{"a", "b"}, mgr.names())
+
+	// Changed policies are replaced, and removed ones deleted.
+	writePolicy(t, filepath.Join(dir, "a.yaml"), "a2")
+	require.NoError(t, os.Remove(filepath.Join(dir, "sub", "b.yaml")))
+	require.NoError(t, w.Sync(ctx))
+	assert.Equal(t, []string{"a2"}, mgr.names())
+
+	// An invalid file keeps the previous policy, and is reported once.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.yaml"), []byte("kind: Unknown"), 0644))
+	require.Error(t, w.Sync(ctx))
+	require.NoError(t, w.Sync(ctx))
+	assert.Equal(t, []string{"a2"}, mgr.names())
+	writePolicy(t, filepath.Join(dir, "a.yaml"), "a3")
+	require.NoError(t, w.Sync(ctx))
+	assert.Equal(t, []string{"a3"}, mgr.names())
+
+	// A policy that cannot be added is retried once its file changes.
+	writePolicy(t, filepath.Join(dir, "dup.yaml"), "a3")
+	require.Error(t, w.Sync(ctx))
+	writePolicy(t, filepath.Join(dir, "dup.yaml"), "e")
+	require.NoError(t, w.Sync(ctx))
+	assert.Equal(t, []string{"a3", "e"}, mgr.names())
+}
+
+func TestWatcher_Run(t *testing.T) {
+	dir := t.TempDir()
+	mgr := &fakeManager{}
+	w := New(dir, mgr)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+
+	// Changes made before Run watches the directory are synced too.
+	writePolicy(t, filepath.Join(dir, "a.yaml"), "a")
+	require.Eventually(t, func() bool {
+		return slices.Equal(mgr.names(), []string{"a"})
+	}, 10*time.Second, 50*time.Millisecond)
+
+	require.NoError(t, os.Remove(filepath.Join(dir, "a.yaml")))
+	require.Eventually(t, func() bool {
+		return len(mgr.names()) == 0
+	}, 10*time.Second, 50*time.Millisecond)
+}
@@ -5,6 +5,7 @@ package ratelimit
 
 import (
 	"context"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -18,11 +19,41 @@ import (
 	"github.com/cilium/tetragon/pkg/reader/node"
 )
 
+const (
+	// minAdaptiveFraction is the lowest fraction of the configured limit
+	// that the adaptive mode backs off to.
+	minAdaptiveFraction = 1.0 / 16
+	// adaptiveRecoverySteps is the number of healthy intervals it takes to
+	// ramp back up from zero to the configured limit.
+	adaptiveRecoverySteps = 10
+)
+
 type RateLimiter struct {
 	*rate.Limiter
 	ctx            context.Context
 	reportInterval time.Duration
 	dropped        atomic.Uint64
+	// lastDropped is the number of events dropped in the last report
+	// interval, and droppedTotal since the rate limiter was created.
+	lastDropped  atomic.Uint64
+	droppedTotal atomic.Uint64
+	// mu protects maxLimit and the schedule state, which change at
+	// runtime when a schedule is set.
+	mu sync.Mutex
+	// maxLimit is the configured limit if the adaptive mode is enabled, and
+	// zero otherwise.
+	maxLimit  rate.Limit
+	adaptive  bool
+	backedOff atomic.Bool
+	// schedule, if not nil, changes the limit over the day, see
+	// SetSchedule.
+	schedule     *Schedule
+	defaultLimit int
+	burst        int
+	// scheduledLimit is the number of events per interval last set by the
+	// schedule, if scheduleApplied.
+	scheduledLimit  int
+	scheduleApplied bool
 }
 
 // getLimit converts an numEvents and interval to rate.Limit which is a floating point value
@@ -34,10 +65,17 @@ func getLimit(numEvents int, interval time.Duration) rate.Limit {
 	return rate.Every(interval / time.Duration(numEvents))
 }
 
+// NewRateLimiter returns a rate limiter allowing numEvents per interval and
+// reporting the dropped events with encoder every interval. It returns nil if
+// numEvents is negative, meaning no limit, or if interval is not positive.
 func NewRateLimiter(ctx context.Context, interval time.Duration, numEvents int, encoder encoder.EventEncoder) *RateLimiter {
 	if numEvents < 0 {
 		return nil
 	}
+	if interval <= 0 {
+		logger.GetLogger().Warn("Ignoring rate limiter with a non-positive interval", "interval", interval)
+		return nil
+	}
 	r := &RateLimiter{
 		Limiter:        rate.NewLimiter(getLimit(numEvents, interval), numEvents),
 		ctx:            ctx,
@@ -52,7 +90,10 @@ func (r *RateLimiter) reportRateLimitInfo(encoder encoder.EventEncoder) {
 	for {
 		select {
 		case <-ticker.C:
+			r.applySchedule(time.Now())
+			r.adapt()
 			dropped := r.dropped.Swap(0)
+			r.lastDropped.Store(dropped)
 			if dropped > 0 {
 				ev := tetragon.GetEventsResponse{
 					Event: &tetragon.GetEventsResponse_RateLimitInfo{
@@ -75,6 +116,144 @@ func (r *RateLimiter) reportRateLimitInfo(encoder encoder.EventEncoder) {
 	}
 }
 
+// AllowWithReserve is like Allow, but keeps a fraction of the burst for
+// other events: the event is only allowed if more than reserve times the
+// burst is left. Events are always allowed if there is no limit, since the
+// burst is then meaningless and can be zero.
+func (r *RateLimiter) AllowWithReserve(reserve float64) bool {
+	if r.Limit() == rate.Inf {
+		return true
+	}
+	if reserve > 0 && r.Tokens() < 1+reserve*float64(r.Burst()) {
+		return false
+	}
+	return r.Allow()
+}
+
+// EnableAdaptive makes the limit adapt to the health of the destination:
+// Backoff halves it, down to a fraction of the configured limit, and every
+// report interval without a backoff brings it closer to the configured limit.
+// It must be called before the rate limiter is used.
+func (r *RateLimiter) EnableAdaptive() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.adaptive = true
+	r.setMaxLimitLocked()
+}
+
+// setMaxLimitLocked sets the limit the adaptive mode recovers to from the
+// current limit.
+func (r *RateLimiter) setMaxLimitLocked() {
+	r.maxLimit = 0
+	if limit := r.Limit(); r.adaptive && limit > 0 && limit != rate.Inf {
+		r.maxLimit = limit
+	}
+}
+
+// SetSchedule makes the limit follow schedule: in each of its windows, the
+// number of events per interval is the rate limit of the window, and
+// defaultLimit outside of the windows, -1 meaning no limit. The burst is
+// burst if positive, and the limit otherwise. The schedule is checked every
+// interval. It must be called before the rate limiter is used.
+func (r *RateLimiter) SetSchedule(schedule *Schedule, defaultLimit, burst int) {
+	r.mu.Lock()
+	r.schedule = schedule
+	r.defaultLimit = defaultLimit
+	r.burst = burst
+	r.scheduleApplied = false
+	r.mu.Unlock()
+	r.applySchedule(time.Now())
+}
+
+// applySchedule sets the limit of the schedule at now, if it changed.
+func (r *RateLimiter) applySchedule(now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.schedule == nil {
+		return
+	}
+	limit := r.schedule.LimitsAt(now, Limits{RateLimit: r.defaultLimit}).RateLimit
+	if r.scheduleApplied && limit == r.scheduledLimit {
+		return
+	}
+	changed := r.scheduleApplied
+	r.scheduledLimit = limit
+	r.scheduleApplied = true
+	if limit < 0 {
+		r.SetLimit(rate.Inf)
+	} else {
+		r.SetLimit(getLimit(limit, r.reportInterval))
+		burst := limit
+		if r.burst > 0 {
+			burst = r.burst
+		}
+		r.SetBurst(burst)
+	}
+	r.setMaxLimitLocked()
+	if changed {
+		logger.GetLogger().Info("Export rate limit changed by schedule", "eventsPerInterval", limit, "interval", r.reportInterval)
+	}
+}
+
+// Backoff signals that the destination cannot keep up, for example because
+// writes fail or the export queue fills up. In adaptive mode, the limit is
+// halved at most once per report interval.
+func (r *RateLimiter) Backoff() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.maxLimit == 0 || r.backedOff.Swap(true) {
+		return
+	}
+	limit := max(r.Limit()/2, r.maxLimit*minAdaptiveFraction)
+	r.SetLimit(limit)
+	logger.GetLogger().Debug("Export rate limit decreased", "eventsPerSecond", float64(limit))
+}
+
+// adapt raises the limit if there was no backoff since the last call.
+func (r *RateLimiter) adapt() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.maxLimit == 0 || r.backedOff.Swap(false) {
+		return
+	}
+	if limit := r.Limit(); limit < r.maxLimit {
+		limit = min(limit+r.maxLimit/adaptiveRecoverySteps, r.maxLimit)
+		r.SetLimit(limit)
+		logger.GetLogger().Debug("Export rate limit increased", "eventsPerSecond", float64(limit))
+	}
+}
+
 func (r *RateLimiter) Drop() {
 	r.dropped.Add(1)
+	r.droppedTotal.Add(1)
+}
+
+// Stats is the state of a rate limiter, to tune its limit.
+type Stats struct {
+	// EventsPerSecond is the current limit, lower than the configured one
+	// when the adaptive mode backed off. It is negative if events are not
+	// limited.
+	EventsPerSecond float64 `json:"events_per_second"`
+	Burst           int     `json:"burst"`
+	// Tokens is the number of events that can be allowed right away.
+	Tokens float64 `json:"tokens"`
+	// DroppedLastInterval is the number of events dropped in the last
+	// report interval, and DroppedTotal since the rate limiter was created.
+	DroppedLastInterval uint64 `json:"dropped_last_interval"`
+	DroppedTotal        uint64 `json:"dropped_total"`
+}
+
+// Stats returns the current state of the rate limiter.
+func (r *RateLimiter) Stats() Stats {
+	limit := float64(r.Limit())
+	if r.Limit() == rate.Inf {
+		limit = -1
+	}
+	return Stats{
+		EventsPerSecond:     limit,
+		Burst:               r.Burst(),
+		Tokens:              r.Tokens(),
+		DroppedLastInterval: r.lastDropped.Load(),
+		DroppedTotal:        r.droppedTotal.Load(),
+	}
 }
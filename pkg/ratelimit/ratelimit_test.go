@@ -4,6 +4,7 @@
 package ratelimit
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -52,3 +53,111 @@ func Test_rateLimitJSON(t *testing.T) {
 
 	assert.Equal(t, ev, ev2)
 }
+
+func TestNewRateLimiter_Interval(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	assert.Nil(t, NewRateLimiter(ctx, 0, 1, nil))
+	assert.Nil(t, NewRateLimiter(ctx, -time.Second, 1, nil))
+	assert.NotNil(t, NewRateLimiter(ctx, time.Second, 1, nil))
+}
+
+func TestRateLimiter_AllowWithReserve(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := NewRateLimiter(ctx, time.Hour, 10, nil)
+
+	allowed := 0
+	for r.AllowWithReserve(0.5) {
+		allowed++
+	}
+	assert.Equal(t, 5, allowed, "half of the burst is reserved")
+	for r.Allow() {
+		allowed++
+	}
+	assert.Equal(t, 10, allowed, "the reserve is available to Allow")
+}
+
+func TestRateLimiter_Adaptive(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := NewRateLimiter(ctx, time.Hour, 160, nil)
+	maxLimit := r.Limit()
+
+	// Without the adaptive mode, backoffs are ignored.
+	r.Backoff()
+	assert.Equal(t, maxLimit, r.Limit())
+
+	r.EnableAdaptive()
+	r.Backoff()
+	r.Backoff()
+	assert.Equal(t, maxLimit/2, r.Limit(), "at most one backoff per interval")
+	for range 5 {
+		r.adapt()
+		r.Backoff()
+	}
+	assert.Equal(t, maxLimit/16, r.Limit(), "backoff is bounded")
+
+	r.adapt()
+	r.adapt()
+	assert.InEpsilon(t, float64(maxLimit/16+maxLimit/10), float64(r.Limit()), 1e-9)
+	for range 10 {
+		r.adapt()
+	}
+	assert.Equal(t, maxLimit, r.Limit(), "limit recovers up to the configured one")
+}
+
+// discardEncoder discards the rate_limit_info events.
+type discardEncoder struct{}
+
+func (discardEncoder) Encode(interface{}) error {
+	return nil
+}
+
+func TestRateLimiter_Stats(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := NewRateLimiter(ctx, 50*time.Millisecond, 10, discardEncoder{})
+	for range 10 {
+		r.Allow()
+	}
+	for range 3 {
+		r.Drop()
+	}
+	st := r.Stats()
+	assert.InEpsilon(t, 200.0, st.EventsPerSecond, 1e-9)
+	assert.Equal(t, 10, st.Burst)
+	assert.Less(t, st.Tokens, 10.0)
+	assert.Equal(t, uint64(3), st.DroppedTotal)
+
+	assert.Eventually(t, func() bool {
+		return r.Stats().DroppedLastInterval == 3
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Eventually(t, func() bool {
+		return r.Stats().DroppedLastInterval == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, uint64(3), r.Stats().DroppedTotal)
+
+	r.SetLimit(rate.Inf)
+	assert.Negative(t, r.Stats().EventsPerSecond)
+}
+
+func BenchmarkRateLimiter(b *testing.B) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// A limit high enough for all events to be allowed, as on the normal
+	// export path.
+	r := NewRateLimiter(ctx, time.Second, 1<<30, nil)
+	b.Run("Allow", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			r.Allow()
+		}
+	})
+	b.Run("AllowWithReserve", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			r.AllowWithReserve(0.1)
+		}
+	})
+}
@@ -0,0 +1,213 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limits are the export limits in effect at a given time.
+type Limits struct {
+	// RateLimit is the number of events per rate limit interval, or -1 if
+	// events are not limited, like --export-rate-limit.
+	RateLimit int
+	// MaxBytesPerSecond is the bandwidth of network exporters, or 0 if it
+	// is not limited, like --export-max-bytes-per-second.
+	MaxBytesPerSecond int
+}
+
+// Window is a time of day, on some days of the week, with its own limits.
+type Window struct {
+	// days are the days of the week the window starts on.
+	days [7]bool
+	// start and end are times of day. The window ends on the next day if
+	// end is not after start.
+	start, end time.Duration
+	// rateLimit and maxBytesPerSecond, if not nil, override the default
+	// limits.
+	rateLimit         *int
+	maxBytesPerSecond *int
+}
+
+// Schedule is a list of windows with their own limits. The first window
+// containing a time applies, and the default limits apply outside of the
+// windows. Times are in the local time zone.
+type Schedule struct {
+	windows []Window
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ParseSchedule parses the windows of --export-limit-schedule, separated by
+// ";". A window is an optional list of days, a time range and the limits it
+// sets, such as "Mon-Fri 08:00-18:00 rate-limit=100 max-bytes-per-second=125000"
+// or "Sat,Sun 00:00-24:00 rate-limit=-1". Days are comma-separated days or
+// ranges of days, and default to every day. A range ending before it starts,
+// such as "22:00-06:00", ends on the next day. It returns nil if s is empty.
+func ParseSchedule(s string) (*Schedule, error) {
+	var sched Schedule
+	for w := range strings.SplitSeq(s, ";") {
+		if w = strings.TrimSpace(w); w == "" {
+			continue
+		}
+		window, err := parseWindow(w)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule window %q: %w", w, err)
+		}
+		sched.windows = append(sched.windows, window)
+	}
+	if len(sched.windows) == 0 {
+		return nil, nil
+	}
+	return &sched, nil
+}
+
+func parseWindow(s string) (Window, error) {
+	var w Window
+	fields := strings.Fields(s)
+	if len(fields) > 0 && !strings.Contains(fields[0], ":") {
+		days, err := parseDays(fields[0])
+		if err != nil {
+			return w, err
+		}
+		w.days = days
+		fields = fields[1:]
+	} else {
+		for i := range w.days {
+			w.days[i] = true
+		}
+	}
+	if len(fields) == 0 {
+		return w, errors.New("missing time range")
+	}
+	start, end, ok := strings.Cut(fields[0], "-")
+	if !ok {
+		return w, fmt.Errorf("invalid time range %q: must be HH:MM-HH:MM", fields[0])
+	}
+	var err error
+	if w.start, err = parseTimeOfDay(start); err != nil {
+		return w, err
+	}
+	if w.end, err = parseTimeOfDay(end); err != nil {
+		return w, err
+	}
+	if w.start == 24*time.Hour {
+		return w, fmt.Errorf("invalid start %q", start)
+	}
+	for _, f := range fields[1:] {
+		key, value, _ := strings.Cut(f, "=")
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return w, fmt.Errorf("invalid value of %q: %w", key, err)
+		}
+		switch key {
+		case "rate-limit":
+			if n < -1 {
+				return w, fmt.Errorf("invalid rate-limit %d: must be -1 or more", n)
+			}
+			w.rateLimit = &n
+		case "max-bytes-per-second":
+			if n < 0 {
+				return w, fmt.Errorf("invalid max-bytes-per-second %d: must not be negative", n)
+			}
+			w.maxBytesPerSecond = &n
+		default:
+			return w, fmt.Errorf("unknown limit %q: must be rate-limit or max-bytes-per-second", key)
+		}
+	}
+	if w.rateLimit == nil && w.maxBytesPerSecond == nil {
+		return w, errors.New("no limits")
+	}
+	return w, nil
+}
+
+// parseDays parses days such as "Mon-Fri" or "Sat,Sun".
+func parseDays(s string) ([7]bool, error) {
+	var days [7]bool
+	for part := range strings.SplitSeq(s, ",") {
+		first, last, isRange := strings.Cut(part, "-")
+		from, ok := weekdays[strings.ToLower(first)]
+		if !ok {
+			return days, fmt.Errorf("invalid day %q", first)
+		}
+		to := from
+		if isRange {
+			if to, ok = weekdays[strings.ToLower(last)]; !ok {
+				return days, fmt.Errorf("invalid day %q", last)
+			}
+		}
+		// Ranges such as Fri-Mon wrap around the week.
+		for d := from; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == to {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// parseTimeOfDay parses a time of day such as "08:30", up to "24:00".
+func parseTimeOfDay(s string) (time.Duration, error) {
+	h, m, ok := strings.Cut(s, ":")
+	hours, errH := strconv.Atoi(h)
+	minutes, errM := strconv.Atoi(m)
+	if !ok || errH != nil || errM != nil || hours < 0 || minutes < 0 || minutes > 59 || hours*60+minutes > 24*60 {
+		return 0, fmt.Errorf("invalid time of day %q: must be HH:MM", s)
+	}
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute, nil
+}
+
+// contains returns whether the window contains t.
+func (w *Window) contains(t time.Time) bool {
+	day := t.Weekday()
+	tod := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	if w.start < w.end {
+		return w.days[day] && tod >= w.start && tod < w.end
+	}
+	// The window ends on the next day.
+	return (w.days[day] && tod >= w.start) || (w.days[(day+6)%7] && tod < w.end)
+}
+
+// LimitsAt returns the limits at time t: the ones of the first window
+// containing t, with defaults for the limits the window does not set.
+func (s *Schedule) LimitsAt(t time.Time, defaults Limits) Limits {
+	if s == nil {
+		return defaults
+	}
+	for i := range s.windows {
+		w := &s.windows[i]
+		if !w.contains(t) {
+			continue
+		}
+		if w.rateLimit != nil {
+			defaults.RateLimit = *w.rateLimit
+		}
+		if w.maxBytesPerSecond != nil {
+			defaults.MaxBytesPerSecond = *w.maxBytesPerSecond
+		}
+		return defaults
+	}
+	return defaults
+}
+
+// HasRateLimits returns whether a window sets a rate limit.
+func (s *Schedule) HasRateLimits() bool {
+	if s == nil {
+		return false
+	}
+	for _, w := range s.windows {
+		if w.rateLimit != nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+// at returns a time on the week of Monday 2024-01-01.
+func at(day time.Weekday, hour, minute int) time.Time {
+	return time.Date(2024, 1, 1+(int(day)+6)%7, hour, minute, 0, 0, time.Local)
+}
+
+func TestParseSchedule(t *testing.T) {
+	s, err := ParseSchedule("")
+	require.NoError(t, err)
+	assert.Nil(t, s)
+	defaults := Limits{RateLimit: 1000, MaxBytesPerSecond: 0}
+	assert.Equal(t, defaults, s.LimitsAt(time.Now(), defaults))
+	assert.False(t, s.HasRateLimits())
+
+	s, err = ParseSchedule("Mon-Fri 08:00-18:00 rate-limit=100 max-bytes-per-second=125000; Fri-Sun 22:00-06:00 rate-limit=-1; sat,sun 00:00-24:00 max-bytes-per-second=1000000")
+	require.NoError(t, err)
+	assert.True(t, s.HasRateLimits())
+
+	for _, tc := range []struct {
+		time time.Time
+		want Limits
+	}{
+		// Business hours.
+		{at(time.Monday, 8, 0), Limits{RateLimit: 100, MaxBytesPerSecond: 125000}},
+		{at(time.Friday, 17, 59), Limits{RateLimit: 100, MaxBytesPerSecond: 125000}},
+		{at(time.Friday, 18, 0), defaults},
+		{at(time.Wednesday, 7, 59), defaults},
+		// Nights from Friday to Sunday, ending on the next day.
+		{at(time.Friday, 23, 0), Limits{RateLimit: -1}},
+		{at(time.Monday, 5, 59), Limits{RateLimit: -1}},
+		{at(time.Monday, 6, 0), defaults},
+		{at(time.Friday, 5, 0), defaults},
+		// The first window containing the time applies.
+		{at(time.Saturday, 1, 0), Limits{RateLimit: -1}},
+		{at(time.Saturday, 12, 0), Limits{RateLimit: 1000, MaxBytesPerSecond: 1000000}},
+	} {
+		assert.Equal(t, tc.want, s.LimitsAt(tc.time, defaults), tc.time.Format(time.RFC1123))
+	}
+
+	s, err = ParseSchedule("09:00-17:00 max-bytes-per-second=10")
+	require.NoError(t, err)
+	assert.False(t, s.HasRateLimits())
+	assert.Equal(t, Limits{RateLimit: 5, MaxBytesPerSecond: 10}, s.LimitsAt(at(time.Sunday, 9, 0), Limits{RateLimit: 5}))
+}
+
+func TestParseSchedule_Invalid(t *testing.T) {
+	for _, s := range []string{
+		"Mon-Fri",
+		"Mon-Fri 08:00 rate-limit=1",
+		"Mon-Fri 08:00-25:00 rate-limit=1",
+		"Mon-Fri 08:60-18:00 rate-limit=1",
+		"24:00-06:00 rate-limit=1",
+		"Someday 08:00-18:00 rate-limit=1",
+		"08:00-18:00",
+		"08:00-18:00 rate-limit=many",
+		"08:00-18:00 rate-limit=-2",
+		"08:00-18:00 max-bytes-per-second=-1",
+		"08:00-18:00 burst=10",
+	} {
+		_, err := ParseSchedule(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestRateLimiter_Schedule(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := NewRateLimiter(ctx, time.Hour, 0, nil)
+	schedule, err := ParseSchedule("Mon-Fri 08:00-18:00 rate-limit=60")
+	require.NoError(t, err)
+	r.EnableAdaptive()
+	r.SetSchedule(schedule, -1, 0)
+
+	r.applySchedule(at(time.Tuesday, 9, 0))
+	assert.InEpsilon(t, float64(getLimit(60, time.Hour)), float64(r.Limit()), 1e-9)
+	assert.Equal(t, 60, r.Burst())
+	r.Backoff()
+	assert.InEpsilon(t, float64(getLimit(30, time.Hour)), float64(r.Limit()), 1e-9, "the adaptive mode backs off from the scheduled limit")
+
+	r.applySchedule(at(time.Tuesday, 19, 0))
+	assert.Equal(t, rate.Inf, r.Limit())
+	assert.Negative(t, r.Stats().EventsPerSecond)
+}
@@ -60,6 +60,13 @@ func SetNodeName() {
 	}
 }
 
+// OverrideNodeName sets the node name, both for export and for Kubernetes,
+// replacing the one from the environment.
+func OverrideNodeName(name string) {
+	nodeName = name
+	exportNodeName = name
+}
+
 func SetNodeLabels(labels map[string]string) {
 	nodeLabels = labels
 }
@@ -51,3 +51,18 @@ func TestGetKubernetesNodeName(t *testing.T) {
 	require.NoError(t, os.Unsetenv("NODE_NAME"))
 	require.NoError(t, os.Unsetenv("HUBBLE_NODE_NAME"))
 }
+
+func TestOverrideNodeName(t *testing.T) {
+	t.Cleanup(func() {
+		SetExportNodeName()
+		SetNodeName()
+		SetNodeLabels(map[string]string{})
+	})
+	OverrideNodeName("from-flag")
+	SetNodeLabels(map[string]string{"zone": "a"})
+	assert.Equal(t, "from-flag", GetNodeName())
+	ev := tetragon.GetEventsResponse{}
+	SetCommonFields(&ev)
+	assert.Equal(t, "from-flag", ev.GetNodeName())
+	assert.Equal(t, map[string]string{"zone": "a"}, ev.GetNodeLabels())
+}
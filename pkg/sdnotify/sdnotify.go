@@ -0,0 +1,91 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+// Package sdnotify implements the systemd notification protocol (see
+// sd_notify(3)), to report readiness and pet the service watchdog.
+package sdnotify
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/cilium/tetragon/pkg/logger"
+	"github.com/cilium/tetragon/pkg/logger/logfields"
+)
+
+const (
+	// Ready tells systemd that the service has started.
+	Ready = "READY=1"
+	// Stopping tells systemd that the service is stopping.
+	Stopping = "STOPPING=1"
+	// Watchdog pets the service watchdog.
+	Watchdog = "WATCHDOG=1"
+)
+
+// Notify sends state to the socket in $NOTIFY_SOCKET. It returns false if the
+// variable is not set, when the process is not run by systemd or the service
+// does not expect notifications.
+func Notify(state string) (bool, error) {
+	path := os.Getenv("NOTIFY_SOCKET")
+	if path == "" {
+		return false, nil
+	}
+	// Abstract sockets start with '@' in the variable.
+	if path[0] == '@' {
+		path = "\x00" + path[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// WatchdogInterval returns the timeout of the service watchdog set in
+// $WATCHDOG_USEC, or 0 if the watchdog is disabled or meant for another
+// process.
+func WatchdogInterval() time.Duration {
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// RunWatchdog pets the watchdog every half of its timeout until ctx is done,
+// as long as check returns no error. If the watchdog is disabled, it returns
+// immediately.
+func RunWatchdog(ctx context.Context, check func() error) {
+	timeout := WatchdogInterval()
+	if timeout == 0 {
+		return
+	}
+	log := logger.GetLogger()
+	log.Info("Petting the systemd watchdog", "timeout", timeout)
+	ticker := time.NewTicker(timeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := check(); err != nil {
+				log.Warn("Liveness check failed, not petting the systemd watchdog", logfields.Error, err)
+				continue
+			}
+			if _, err := Notify(Watchdog); err != nil {
+				log.Warn("Failed to pet the systemd watchdog", logfields.Error, err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
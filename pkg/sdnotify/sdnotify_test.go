@@ -0,0 +1,84 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package sdnotify
+
+import (
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// listen sets $NOTIFY_SOCKET to a new socket and returns it.
+func listen(t *testing.T) *net.UnixConn {
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	t.Setenv("NOTIFY_SOCKET", path)
+	return conn
+}
+
+func TestNotify(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	sent, err := Notify(Ready)
+	require.NoError(t, err)
+	assert.False(t, sent)
+
+	conn := listen(t)
+	sent, err = Notify(Ready)
+	require.NoError(t, err)
+	assert.True(t, sent)
+	buf := make([]byte, 64)
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, Ready, string(buf[:n]))
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	t.Setenv("WATCHDOG_USEC", "")
+	assert.Zero(t, WatchdogInterval())
+	t.Setenv("WATCHDOG_USEC", "30000000")
+	assert.Equal(t, 30*time.Second, WatchdogInterval())
+	t.Setenv("WATCHDOG_PID", "1")
+	assert.Zero(t, WatchdogInterval())
+}
+
+func TestRunWatchdog(t *testing.T) {
+	conn := listen(t)
+	t.Setenv("WATCHDOG_PID", strconv.Itoa(1<<30))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// The watchdog is meant for another process.
+	RunWatchdog(ctx, func() error { return nil })
+
+	t.Setenv("WATCHDOG_PID", "")
+	t.Setenv("WATCHDOG_USEC", "20000")
+	var healthy atomic.Bool
+	go RunWatchdog(ctx, func() error {
+		if !healthy.Load() {
+			return errors.New("stalled")
+		}
+		return nil
+	})
+
+	// The watchdog is not petted until the check passes.
+	buf := make([]byte, 64)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(50*time.Millisecond)))
+	_, err := conn.Read(buf)
+	require.Error(t, err)
+
+	healthy.Store(true)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, Watchdog, string(buf[:n]))
+}
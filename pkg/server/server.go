@@ -10,6 +10,7 @@ import (
 	"io"
 	"log/slog"
 	"sync"
+	"time"
 
 	"github.com/cilium/tetragon/api/v1/tetragon"
 	"github.com/cilium/tetragon/pkg/aggregator"
@@ -26,12 +27,33 @@ import (
 	"github.com/cilium/tetragon/pkg/version"
 
 	"github.com/google/uuid"
+	"google.golang.org/protobuf/types/known/durationpb"
 )
 
 type Listener interface {
 	Notify(res *tetragon.GetEventsResponse)
 }
 
+// PressureReporter is implemented by listeners, and by the event streams
+// passed to GetEventsWG, that can tell when they cannot keep up with events.
+// Event producers use it to drop the least useful events first.
+type PressureReporter interface {
+	// UnderPressure returns whether events arrive faster than they are
+	// consumed.
+	UnderPressure() bool
+}
+
+// PressureAggregator is implemented by the event streams passed to
+// GetEventsWG that have their process_exec events aggregated while they are
+// under pressure.
+type PressureAggregator interface {
+	PressureReporter
+	// PressureAggregationWindow returns the window process_exec events are
+	// aggregated for while the stream is under pressure, or zero if they
+	// are not aggregated.
+	PressureAggregationWindow() time.Duration
+}
+
 type Notifier interface {
 	AddListener(listener Listener)
 	RemoveListener(listener Listener)
@@ -68,6 +90,8 @@ type Server struct {
 
 type getEventsListener struct {
 	events chan *tetragon.GetEventsResponse
+	// stream, if not nil, reports the pressure of the consumer of events.
+	stream PressureReporter
 }
 
 func NewServer(ctx context.Context, cleanupWg *sync.WaitGroup, notifier Notifier, observer observer, hookRunner hookRunner) *Server {
@@ -80,6 +104,13 @@ func NewServer(ctx context.Context, cleanupWg *sync.WaitGroup, notifier Notifier
 	}
 }
 
+// UnderPressure implements PressureReporter. A listener is under pressure if
+// its stream is. Streams of gRPC clients never are, so that they get all
+// events, only exporters can opt in.
+func (l *getEventsListener) UnderPressure() bool {
+	return l.stream != nil && l.stream.UnderPressure()
+}
+
 func newListener() *getEventsListener {
 	var chanSize uint = 10000
 	if option.Config.EventQueueSize > 0 {
@@ -141,6 +172,34 @@ func (s *Server) GetEventsWG(request *tetragon.GetEventsRequest, server tetragon
 		}
 		return err
 	}
+	// Streams that opt in get their process_exec events aggregated while
+	// under pressure, so that repeated commands do not make them drop other
+	// events, unless the request aggregates them already. process_exit
+	// events are not sent to them at all meanwhile, see PressureReporter.
+	pressure, _ := server.(PressureReporter)
+	var degraded *aggregator.Aggregator
+	var degradedFlush <-chan time.Time
+	if pa, ok := server.(PressureAggregator); ok && pa.PressureAggregationWindow() > 0 && request.AggregationOptions == nil {
+		degraded, err = aggregator.NewAggregator(server, &tetragon.AggregationOptions{
+			WindowSize: durationpb.New(pa.PressureAggregationWindow()),
+		})
+		if err != nil {
+			if readyWG != nil {
+				readyWG.Done()
+			}
+			return err
+		}
+		ticker := time.NewTicker(degraded.Window())
+		defer ticker.Stop()
+		degradedFlush = ticker.C
+	}
+	// Events aggregated under pressure are sent before closer is called,
+	// so that they are not lost when the stream ends.
+	flushDegraded := func() {
+		if degraded != nil {
+			degraded.Flush()
+		}
+	}
 	aggregator, err := aggregator.NewAggregator(server, request.AggregationOptions)
 	if err != nil {
 		if readyWG != nil {
@@ -148,11 +207,25 @@ func (s *Server) GetEventsWG(request *tetragon.GetEventsRequest, server tetragon
 		}
 		return err
 	}
+	// The aggregator sends events to server, so it is stopped before closer
+	// is called, and whenever the stream ends.
+	stopAggregator := func() {}
 	if aggregator != nil {
-		go aggregator.Start()
+		ctx, cancel := context.WithCancel(server.Context())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			aggregator.Start(ctx)
+		}()
+		stopAggregator = func() {
+			cancel()
+			<-done
+		}
 	}
+	defer stopAggregator()
 
 	l := newListener()
+	l.stream = pressure
 	s.notifier.AddListener(l)
 	defer s.removeNotifierAndDrain(l)
 	if readyWG != nil {
@@ -192,18 +265,26 @@ func (s *Server) GetEventsWG(request *tetragon.GetEventsRequest, server tetragon
 					logger.GetLogger().Warn("Aggregator buffer is full. Consider increasing AggregatorOptions.channel_buffer_size.",
 						"request", request)
 				}
+			} else if degraded != nil && event.GetProcessExec() != nil && pressure.UnderPressure() {
+				degraded.Add(event)
 			} else {
 				// No need to aggregate. Directly send out the response.
 				if err = server.Send(event); err != nil {
 					return err
 				}
 			}
+		case <-degradedFlush:
+			degraded.Flush()
 		case <-server.Context().Done():
+			stopAggregator()
+			flushDegraded()
 			if closer != nil {
 				closer.Close()
 			}
 			return server.Context().Err()
 		case <-s.ctx.Done():
+			stopAggregator()
+			flushDegraded()
 			if closer != nil {
 				closer.Close()
 			}
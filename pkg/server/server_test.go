@@ -4,10 +4,15 @@
 package server
 
 import (
+	"context"
 	"log/slog"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/durationpb"
 
 	"github.com/cilium/tetragon/api/v1/tetragon"
 	"github.com/cilium/tetragon/pkg/logger"
@@ -64,3 +69,200 @@ func TestSetDebug(t *testing.T) {
 	require.NoError(t, err, "Expected SetDebug to succeed with valid log level")
 	require.NotEqual(t, logger.GetLogLevel(logger.GetLogger()), prevLogLevel, "Expected log level to change, but it didn't")
 }
+
+type fakePressure bool
+
+func (p fakePressure) UnderPressure() bool {
+	return bool(p)
+}
+
+func TestListenerUnderPressure(t *testing.T) {
+	l := &getEventsListener{events: make(chan *tetragon.GetEventsResponse, 4)}
+	for range 4 {
+		l.Notify(&tetragon.GetEventsResponse{})
+	}
+	require.False(t, l.UnderPressure())
+
+	l = &getEventsListener{events: make(chan *tetragon.GetEventsResponse, 4), stream: fakePressure(true)}
+	require.True(t, l.UnderPressure())
+}
+
+type fakeNotifier struct {
+	listeners chan Listener
+}
+
+func (n *fakeNotifier) AddListener(l Listener) {
+	n.listeners <- l
+}
+
+func (n *fakeNotifier) RemoveListener(Listener) {}
+
+func (n *fakeNotifier) NotifyListener(any, *tetragon.GetEventsResponse) {}
+
+// pressureStream is a GetEvents stream reporting pressure when set, and
+// aggregating process_exec events meanwhile if window is set.
+type pressureStream struct {
+	tetragon.FineGuidanceSensors_GetEventsServer
+	ctx      context.Context
+	window   time.Duration
+	pressure atomic.Bool
+	events   chan *tetragon.GetEventsResponse
+}
+
+func (s *pressureStream) Send(event *tetragon.GetEventsResponse) error {
+	s.events <- event
+	return nil
+}
+
+func (s *pressureStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *pressureStream) UnderPressure() bool {
+	return s.pressure.Load()
+}
+
+func (s *pressureStream) PressureAggregationWindow() time.Duration {
+	return s.window
+}
+
+func TestGetEventsUnderPressure(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	var wg sync.WaitGroup
+	notifier := &fakeNotifier{listeners: make(chan Listener, 1)}
+	srv := NewServer(ctx, &wg, notifier, nil, nil)
+	stream := &pressureStream{ctx: ctx, window: 50 * time.Millisecond, events: make(chan *tetragon.GetEventsResponse, 10)}
+	stream.pressure.Store(true)
+	done := make(chan error)
+	go func() {
+		done <- srv.GetEventsWG(&tetragon.GetEventsRequest{}, stream, nil, nil)
+	}()
+	l := <-notifier.listeners
+
+	exec := func() *tetragon.GetEventsResponse {
+		return &tetragon.GetEventsResponse{Event: &tetragon.GetEventsResponse_ProcessExec{
+			ProcessExec: &tetragon.ProcessExec{Process: &tetragon.Process{Binary: "/bin/true"}},
+		}}
+	}
+	for range 3 {
+		l.Notify(exec())
+	}
+	l.Notify(&tetragon.GetEventsResponse{Event: &tetragon.GetEventsResponse_ProcessKprobe{ProcessKprobe: &tetragon.ProcessKprobe{}}})
+	// The window may end between events, so that process_exec events are
+	// sent in one or two aggregated events.
+	kprobes, execs, sent := 0, uint64(0), 0
+	for kprobes < 1 || execs < 3 {
+		ev := <-stream.events
+		if ev.GetProcessKprobe() != nil {
+			require.Nil(t, ev.GetAggregationInfo(), "other events are not aggregated")
+			kprobes++
+			continue
+		}
+		require.NotNil(t, ev.GetAggregationInfo(), "process_exec events are aggregated under pressure")
+		execs += ev.GetAggregationInfo().GetCount()
+		sent++
+	}
+	require.LessOrEqual(t, sent, 2)
+
+	stream.pressure.Store(false)
+	l.Notify(exec())
+	require.Nil(t, (<-stream.events).GetAggregationInfo(), "process_exec events are not aggregated without pressure")
+
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+}
+
+func TestGetEventsUnderPressureStop(t *testing.T) {
+	exec := &tetragon.GetEventsResponse{Event: &tetragon.GetEventsResponse_ProcessExec{
+		ProcessExec: &tetragon.ProcessExec{Process: &tetragon.Process{Binary: "/bin/true"}},
+	}}
+	kprobe := &tetragon.GetEventsResponse{Event: &tetragon.GetEventsResponse_ProcessKprobe{ProcessKprobe: &tetragon.ProcessKprobe{}}}
+
+	t.Run("flush", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(t.Context())
+		defer cancel()
+		var wg sync.WaitGroup
+		notifier := &fakeNotifier{listeners: make(chan Listener, 1)}
+		srv := NewServer(ctx, &wg, notifier, nil, nil)
+		stream := &pressureStream{ctx: ctx, window: time.Hour, events: make(chan *tetragon.GetEventsResponse, 10)}
+		stream.pressure.Store(true)
+		done := make(chan error)
+		go func() {
+			done <- srv.GetEventsWG(&tetragon.GetEventsRequest{}, stream, nil, nil)
+		}()
+		l := <-notifier.listeners
+
+		l.Notify(exec)
+		l.Notify(exec)
+		l.Notify(kprobe)
+		// Events are handled in order, so process_exec events are
+		// aggregated once the process_kprobe event is sent.
+		require.NotNil(t, (<-stream.events).GetProcessKprobe())
+		require.Nil(t, exec.GetAggregationInfo(), "shared events are not modified")
+
+		cancel()
+		require.ErrorIs(t, <-done, context.Canceled)
+		require.Equal(t, uint64(2), (<-stream.events).GetAggregationInfo().GetCount(), "aggregated events are sent when the stream ends")
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(t.Context())
+		defer cancel()
+		var wg sync.WaitGroup
+		notifier := &fakeNotifier{listeners: make(chan Listener, 1)}
+		srv := NewServer(ctx, &wg, notifier, nil, nil)
+		stream := &pressureStream{ctx: ctx, events: make(chan *tetragon.GetEventsResponse, 10)}
+		stream.pressure.Store(true)
+		done := make(chan error)
+		go func() {
+			done <- srv.GetEventsWG(&tetragon.GetEventsRequest{}, stream, nil, nil)
+		}()
+		l := <-notifier.listeners
+
+		l.Notify(exec)
+		require.Nil(t, (<-stream.events).GetAggregationInfo(), "process_exec events are not aggregated without a window")
+
+		cancel()
+		require.ErrorIs(t, <-done, context.Canceled)
+	})
+}
+
+func TestGetEventsAggregationShared(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	var wg sync.WaitGroup
+	notifier := &fakeNotifier{listeners: make(chan Listener, 2)}
+	srv := NewServer(ctx, &wg, notifier, nil, nil)
+	aggregating := &pressureStream{ctx: ctx, events: make(chan *tetragon.GetEventsResponse, 10)}
+	plain := &pressureStream{ctx: ctx, events: make(chan *tetragon.GetEventsResponse, 10)}
+	done := make(chan error, 2)
+	go func() {
+		done <- srv.GetEventsWG(&tetragon.GetEventsRequest{AggregationOptions: &tetragon.AggregationOptions{
+			WindowSize:        durationpb.New(50 * time.Millisecond),
+			ChannelBufferSize: 10,
+		}}, aggregating, nil, nil)
+	}()
+	l1 := <-notifier.listeners
+	go func() {
+		done <- srv.GetEventsWG(&tetragon.GetEventsRequest{}, plain, nil, nil)
+	}()
+	l2 := <-notifier.listeners
+
+	// Listeners get the same event, as from ProcessManager.NotifyListener.
+	for range 2 {
+		event := &tetragon.GetEventsResponse{Event: &tetragon.GetEventsResponse_ProcessExec{
+			ProcessExec: &tetragon.ProcessExec{Process: &tetragon.Process{Binary: "/bin/true"}},
+		}}
+		l1.Notify(event)
+		l2.Notify(event)
+	}
+	require.Equal(t, uint64(2), (<-aggregating.events).GetAggregationInfo().GetCount())
+	for range 2 {
+		require.Nil(t, (<-plain.events).GetAggregationInfo(), "events of other streams are not aggregated")
+	}
+
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+	require.ErrorIs(t, <-done, context.Canceled)
+}
@@ -0,0 +1,189 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+// Package signing signs exported JSON events and verifies their signatures,
+// so that events can be proven not to be forged or modified after export.
+//
+// The signature is added as the last field of the event:
+//
+//	{...,"signature":{"alg":"ed25519","key_id":"node-key","value":"<base64>"}}
+//
+// and covers the event as it was before the field was added.
+package signing
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+)
+
+const (
+	AlgEd25519    = "ed25519"
+	AlgHMACSHA256 = "hmac-sha256"
+)
+
+// fieldPrefix starts the signature field appended to events.
+var fieldPrefix = []byte(`,"signature":`)
+
+type signature struct {
+	Alg   string `json:"alg"`
+	KeyID string `json:"key_id,omitempty"`
+	Value []byte `json:"value"`
+}
+
+// Signer signs JSON events.
+type Signer struct {
+	alg   string
+	keyID string
+	sign  func(data []byte) []byte
+}
+
+// NewSigner returns a signer using alg. For AlgEd25519, key is a PEM encoded
+// PKCS #8 private key, as generated by "openssl genpkey -algorithm ed25519".
+// For AlgHMACSHA256, key is the secret itself.
+func NewSigner(alg, keyID string, key []byte) (*Signer, error) {
+	s := &Signer{alg: alg, keyID: keyID}
+	switch alg {
+	case AlgEd25519:
+		block, _ := pem.Decode(key)
+		if block == nil {
+			return nil, errors.New("invalid ed25519 key: no PEM data found")
+		}
+		k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ed25519 key: %w", err)
+		}
+		priv, ok := k.(ed25519.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("invalid ed25519 key: found a %T", k)
+		}
+		s.sign = func(data []byte) []byte {
+			sig, _ := priv.Sign(nil, data, crypto.Hash(0))
+			return sig
+		}
+	case AlgHMACSHA256:
+		if len(key) == 0 {
+			return nil, errors.New("invalid hmac-sha256 key: key is empty")
+		}
+		s.sign = func(data []byte) []byte {
+			mac := hmac.New(sha256.New, key)
+			mac.Write(data)
+			return mac.Sum(nil)
+		}
+	default:
+		return nil, fmt.Errorf("invalid signing algorithm %q: must be %q or %q", alg, AlgEd25519, AlgHMACSHA256)
+	}
+	return s, nil
+}
+
+// LoadSigner returns a signer using the key in the file at path, see
+// NewSigner.
+func LoadSigner(alg, keyID, path string) (*Signer, error) {
+	key, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+	return NewSigner(alg, keyID, bytes.TrimRight(key, "\n"))
+}
+
+// AppendSigned appends event, a JSON object, to dst with a signature field.
+func (s *Signer) AppendSigned(dst, event []byte) ([]byte, error) {
+	if len(event) < 2 || event[0] != '{' || event[len(event)-1] != '}' {
+		return nil, errors.New("event is not a JSON object")
+	}
+	sig, err := json.Marshal(signature{Alg: s.alg, KeyID: s.keyID, Value: s.sign(event)})
+	if err != nil {
+		return nil, err
+	}
+	dst = append(dst, event[:len(event)-1]...)
+	if len(event) > 2 {
+		dst = append(dst, fieldPrefix...)
+	} else {
+		dst = append(dst, fieldPrefix[1:]...)
+	}
+	dst = append(dst, sig...)
+	return append(dst, '}'), nil
+}
+
+// Verifier verifies the signature of JSON events.
+type Verifier struct {
+	alg    string
+	verify func(data, sig []byte) bool
+}
+
+// NewVerifier returns a verifier for alg. For AlgEd25519, key is a PEM
+// encoded PKIX public key, as generated by "openssl pkey -pubout". For
+// AlgHMACSHA256, key is the secret used to sign events.
+func NewVerifier(alg string, key []byte) (*Verifier, error) {
+	v := &Verifier{alg: alg}
+	switch alg {
+	case AlgEd25519:
+		block, _ := pem.Decode(key)
+		if block == nil {
+			return nil, errors.New("invalid ed25519 public key: no PEM data found")
+		}
+		k, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ed25519 public key: %w", err)
+		}
+		pub, ok := k.(ed25519.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("invalid ed25519 public key: found a %T", k)
+		}
+		v.verify = func(data, sig []byte) bool {
+			return ed25519.Verify(pub, data, sig)
+		}
+	case AlgHMACSHA256:
+		if len(key) == 0 {
+			return nil, errors.New("invalid hmac-sha256 key: key is empty")
+		}
+		v.verify = func(data, sig []byte) bool {
+			mac := hmac.New(sha256.New, key)
+			mac.Write(data)
+			return hmac.Equal(mac.Sum(nil), sig)
+		}
+	default:
+		return nil, fmt.Errorf("invalid signing algorithm %q: must be %q or %q", alg, AlgEd25519, AlgHMACSHA256)
+	}
+	return v, nil
+}
+
+// Verify checks the signature of a JSON event, and returns the ID of the key
+// it was signed with.
+func (v *Verifier) Verify(event []byte) (string, error) {
+	event = bytes.TrimSpace(event)
+	if len(event) < 2 || event[len(event)-1] != '}' {
+		return "", errors.New("event is not a JSON object")
+	}
+	idx := bytes.LastIndex(event, fieldPrefix)
+	prefixLen := len(fieldPrefix)
+	if idx < 0 {
+		// the signature is the only field of the event
+		idx, prefixLen = 1, len(fieldPrefix)-1
+		if !bytes.HasPrefix(event[idx:], fieldPrefix[1:]) {
+			return "", errors.New("event is not signed")
+		}
+	}
+	var sig signature
+	if err := json.Unmarshal(event[idx+prefixLen:len(event)-1], &sig); err != nil {
+		return "", fmt.Errorf("invalid signature field: %w", err)
+	}
+	if sig.Alg != v.alg {
+		return sig.KeyID, fmt.Errorf("event is signed with %q, not %q", sig.Alg, v.alg)
+	}
+	data := make([]byte, 0, idx+1)
+	data = append(data, event[:idx]...)
+	data = append(data, '}')
+	if !v.verify(data, sig.Value) {
+		return sig.KeyID, errors.New("invalid signature")
+	}
+	return sig.KeyID, nil
+}
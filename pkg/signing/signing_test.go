@@ -0,0 +1,93 @@
+// SPDX-License-Identifier: Apache-2.0
+// Copyright Authors of Tetragon
+
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ed25519Keys(t *testing.T) ([]byte, []byte) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	require.NoError(t, err)
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})
+}
+
+func TestSignVerify(t *testing.T) {
+	privPEM, pubPEM := ed25519Keys(t)
+	tests := []struct {
+		alg       string
+		signKey   []byte
+		verifyKey []byte
+		wrongKey  []byte
+	}{
+		{AlgEd25519, privPEM, pubPEM, nil},
+		{AlgHMACSHA256, []byte("secret"), []byte("secret"), []byte("other")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.alg, func(t *testing.T) {
+			signer, err := NewSigner(tt.alg, "key-1", tt.signKey)
+			require.NoError(t, err)
+			verifier, err := NewVerifier(tt.alg, tt.verifyKey)
+			require.NoError(t, err)
+
+			for _, event := range []string{`{"process_exec":{"process":{"binary":"/bin/sh"}},"node_name":"n1"}`, `{}`} {
+				signed, err := signer.AppendSigned(nil, []byte(event))
+				require.NoError(t, err)
+				assert.Contains(t, string(signed), `"signature":{"alg":"`+tt.alg+`","key_id":"key-1","value":"`)
+
+				keyID, err := verifier.Verify(signed)
+				require.NoError(t, err)
+				assert.Equal(t, "key-1", keyID)
+
+				if event != `{}` {
+					tampered := strings.Replace(string(signed), "/bin/sh", "/bin/ls", 1)
+					_, err = verifier.Verify([]byte(tampered))
+					require.Error(t, err)
+				}
+			}
+
+			_, err = verifier.Verify([]byte(`{"node_name":"n1"}`))
+			require.Error(t, err, "unsigned events are invalid")
+
+			if tt.wrongKey != nil {
+				other, err := NewVerifier(tt.alg, tt.wrongKey)
+				require.NoError(t, err)
+				signed, err := signer.AppendSigned(nil, []byte(`{"node_name":"n1"}`))
+				require.NoError(t, err)
+				_, err = other.Verify(signed)
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestNewSigner_Invalid(t *testing.T) {
+	_, pubPEM := ed25519Keys(t)
+	_, err := NewSigner(AlgEd25519, "", pubPEM)
+	require.Error(t, err, "public key cannot sign")
+	_, err = NewSigner(AlgEd25519, "", []byte("not a key"))
+	require.Error(t, err)
+	_, err = NewSigner(AlgHMACSHA256, "", nil)
+	require.Error(t, err)
+	_, err = NewSigner("rsa", "", []byte("key"))
+	require.Error(t, err)
+
+	signer, err := NewSigner(AlgHMACSHA256, "", []byte("key"))
+	require.NoError(t, err)
+	_, err = signer.AppendSigned(nil, []byte(`[1,2]`))
+	require.Error(t, err)
+}